@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
@@ -11,19 +12,38 @@ import (
 	"time"
 
 	"github.com/kvit-s/kvit-coder/internal/agent"
+	"github.com/kvit-s/kvit-coder/internal/approval"
 	"github.com/kvit-s/kvit-coder/internal/benchmark"
 	"github.com/kvit-s/kvit-coder/internal/checkpoint"
 	"github.com/kvit-s/kvit-coder/internal/config"
 	ctxtools "github.com/kvit-s/kvit-coder/internal/context"
+	"github.com/kvit-s/kvit-coder/internal/control"
+	"github.com/kvit-s/kvit-coder/internal/events"
 	"github.com/kvit-s/kvit-coder/internal/llm"
+	"github.com/kvit-s/kvit-coder/internal/lsp"
 	"github.com/kvit-s/kvit-coder/internal/prompt"
 	"github.com/kvit-s/kvit-coder/internal/repl"
 	"github.com/kvit-s/kvit-coder/internal/session"
+	"github.com/kvit-s/kvit-coder/internal/tokenizer"
 	"github.com/kvit-s/kvit-coder/internal/tools"
+	"github.com/kvit-s/kvit-coder/internal/trajectory"
 	"github.com/kvit-s/kvit-coder/internal/ui"
 	"github.com/kvit-s/kvit-coder/internal/workspace"
 )
 
+// Exit codes of an exec mode run, by why it stopped. Ctrl+C exits with 130
+// (see workspace.AcquireLock).
+const (
+	exitOK            = 0 // final answer given
+	exitError         = 1 // the run failed or was cancelled
+	exitUsage         = 2 // invalid flags (what the flag package exits with)
+	exitBudget        = 3 // a cost, token or time budget ran out
+	exitMaxIterations = 4 // agent.max_tool_iterations reached
+	exitLoop          = 5 // stopped by the loop detector
+	exitDuplicate     = 6 // stopped after repeated identical tool calls
+	exitVerify        = 7 // answered, but the verification command still fails
+)
+
 // Version info set by ldflags at build time
 var (
 	version    = "dev"
@@ -33,6 +53,21 @@ var (
 )
 
 func main() {
+	code, err := run()
+	if err != nil {
+		log.Print(err)
+	}
+	os.Exit(code)
+}
+
+// run is the body of main. It returns the exit code and any error instead of
+// exiting, so deferred cleanup runs before the process exits.
+func run() (int, error) {
+	// Subcommands come before the flags of a run
+	if len(os.Args) > 1 && os.Args[1] == "replay" {
+		return runReplay(os.Args[2:])
+	}
+
 	// Parse flags
 	configPath := flag.String("config", "config.yaml", "path to config file")
 	model := flag.String("model", "", "override model name")
@@ -40,9 +75,33 @@ func main() {
 	logFile := flag.String("log", "kvit-coder.log", "log file path (empty to disable)")
 	execPrompt := flag.String("p", "", "exec mode: run with this prompt and exit after completion")
 	quietPrompt := flag.String("pq", "", "quiet exec mode: run with this prompt and only print final LLM response")
-	jsonOutput := flag.Bool("json", false, "output structured JSON messages to stderr")
+	jsonOutput := flag.Bool("json", false, "alias for --output-format json")
+	outputFormat := flag.String("output-format", "text", "exec mode output on stdout: text, json or stream-json (JSON lines as the run progresses)")
 	showVersion := flag.Bool("version", false, "show version information and exit")
 
+	// Record/replay flags
+	recordDir := flag.String("record", "", "record all LLM traffic to a cassette in this directory")
+	replayDir := flag.String("replay", "", "serve LLM responses from the cassette in this directory instead of a server")
+	replayMode := flag.String("replay-match", "hash", "how replayed requests are matched: strict, hash or sequential")
+
+	// Budget flags (override agent.max_cost, max_tokens and max_duration)
+	maxCost := flag.Float64("max-cost", 0, "stop after spending this many USD, after a final wrap-up turn")
+	maxTokens := flag.Int("max-tokens", 0, "stop after this many prompt + completion tokens, after a final wrap-up turn")
+	maxDuration := flag.Duration("max-duration", 0, "stop after this much wall time (e.g. 30m), after a final wrap-up turn")
+
+	// Verification flag (overrides agent.verify_command)
+	verifyCommand := flag.String("verify", "", "run this shell command on each final answer and send failures back to the model, e.g. \"go test ./...\"")
+
+	// Approval flags (override approval.policy_file and approval.interactive)
+	approvalPolicy := flag.String("approval-policy", "", "approve tool calls with the rules in this YAML file (enables approval)")
+	approvalInteractive := flag.String("approval-interactive", "", "override approval.interactive: auto (ask on the terminal) or never (deny what needs asking)")
+
+	// Steering flag (the socket is next to the session lock by default)
+	controlPath := flag.String("control", "", "listen for steering messages and commands on this Unix socket (default with -s: next to the session lock)")
+
+	// Event stream flags
+	eventsPath := flag.String("events", "", "write the agent's events as JSON lines to this file (- for stdout)")
+
 	// Benchmark flags
 	benchmarkMode := flag.String("benchmark", "", "run benchmark mode (optional suffix, e.g., 'x5' uses config-x5.yaml)")
 	benchmarkRuns := flag.Int("n", 10, "number of runs per benchmark")
@@ -54,6 +113,7 @@ func main() {
 
 	// Session flags
 	sessionName := flag.String("s", "", "session name: continue existing session or create new one with this name")
+	resume := flag.Bool("resume", false, "continue the unfinished run of session -s where it stopped (no -p needed)")
 	sessionList := flag.Bool("sessions", false, "list all sessions and exit")
 	sessionDelete := flag.String("session-delete", "", "delete a session and exit")
 	sessionShow := flag.String("session-show", "", "show session history and exit")
@@ -63,20 +123,20 @@ func main() {
 	// Handle --version
 	if *showVersion {
 		fmt.Printf("%s-%s-%s\n", version, commitDate, commitHash)
-		return
+		return exitOK, nil
 	}
 
 	// Handle session management commands early (before config load)
 	if *sessionList || *sessionDelete != "" || *sessionShow != "" {
 		sessionMgr, err := session.NewManager()
 		if err != nil {
-			log.Fatalf("Failed to create session manager: %v", err)
+			return exitError, fmt.Errorf("failed to create session manager: %w", err)
 		}
 
 		if *sessionList {
 			sessions, err := sessionMgr.ListSessions()
 			if err != nil {
-				log.Fatalf("Failed to list sessions: %v", err)
+				return exitError, fmt.Errorf("failed to list sessions: %w", err)
 			}
 			if len(sessions) == 0 {
 				fmt.Println("No sessions found.")
@@ -87,30 +147,30 @@ func main() {
 					fmt.Printf("%-30s  %-20s  %d\n", s.Name, s.ModTime.Format("2006-01-02 15:04"), s.MessageCount)
 				}
 			}
-			return
+			return exitOK, nil
 		}
 
 		if *sessionDelete != "" {
 			if !sessionMgr.SessionExists(*sessionDelete) {
-				log.Fatalf("Session %q not found", *sessionDelete)
+				return exitError, fmt.Errorf("session %q not found", *sessionDelete)
 			}
 			if err := sessionMgr.DeleteSession(*sessionDelete); err != nil {
-				log.Fatalf("Failed to delete session: %v", err)
+				return exitError, fmt.Errorf("failed to delete session: %w", err)
 			}
 			fmt.Printf("Deleted session: %s\n", *sessionDelete)
-			return
+			return exitOK, nil
 		}
 
 		if *sessionShow != "" {
 			if !sessionMgr.SessionExists(*sessionShow) {
-				log.Fatalf("Session %q not found", *sessionShow)
+				return exitError, fmt.Errorf("session %q not found", *sessionShow)
 			}
 			content, err := sessionMgr.ShowSession(*sessionShow)
 			if err != nil {
-				log.Fatalf("Failed to show session: %v", err)
+				return exitError, fmt.Errorf("failed to show session: %w", err)
 			}
 			fmt.Print(content)
-			return
+			return exitOK, nil
 		}
 	}
 
@@ -131,6 +191,15 @@ func main() {
 		promptText = *execPrompt
 		quietMode = false
 	}
+	if *resume {
+		if *sessionName == "" {
+			return exitUsage, errors.New("--resume needs the session to continue: -s <name>")
+		}
+		if promptText != "" {
+			return exitUsage, errors.New("--resume continues the saved run; it can't take a new prompt")
+		}
+		execMode = true
+	}
 
 	// Initialize UI writer (verbose level set after config load)
 	writer := ui.NewWriter(0)
@@ -138,7 +207,18 @@ func main() {
 		writer.SetQuiet(true)
 	}
 	if *jsonOutput {
+		*outputFormat = "json"
+	}
+	switch *outputFormat {
+	case "text":
+	case "json", "stream-json":
+		// stdout carries only the JSON output
 		writer.SetJSONMode(true)
+	default:
+		return exitUsage, fmt.Errorf("unknown --output-format %q (want text, json or stream-json)", *outputFormat)
+	}
+	if *outputFormat == "stream-json" && *eventsPath == "-" {
+		return exitUsage, errors.New("--events - and --output-format stream-json both write to stdout")
 	}
 	// Enable headless mode for exec mode (progress to stderr, final answer to stdout)
 	if execMode {
@@ -148,7 +228,7 @@ func main() {
 	// Initialize logger
 	logger, err := agent.NewLogger(*logFile, false)
 	if err != nil {
-		log.Fatalf("Failed to initialize logger: %v", err)
+		return exitError, fmt.Errorf("failed to initialize logger: %w", err)
 	}
 	defer logger.Close()
 
@@ -167,7 +247,7 @@ func main() {
 	// Load config
 	cfg, err := config.Load(actualConfigPath)
 	if err != nil {
-		log.Fatalf("Failed to load config: %v", err)
+		return exitError, fmt.Errorf("failed to load config: %w", err)
 	}
 
 	// Set verbose level from config
@@ -176,9 +256,9 @@ func main() {
 	// Handle --benchmark-list early
 	if *benchmarkList {
 		if err := benchmark.ListBenchmarks(cfg); err != nil {
-			log.Fatalf("Failed to list benchmarks: %v", err)
+			return exitError, fmt.Errorf("failed to list benchmarks: %w", err)
 		}
-		return
+		return exitOK, nil
 	}
 
 	// Apply flag overrides
@@ -187,6 +267,26 @@ func main() {
 	}
 	if *baseURL != "" {
 		cfg.LLM.BaseURL = *baseURL
+		cfg.LLM.Endpoints = nil // an explicit URL replaces the endpoint list
+	}
+	if *maxCost > 0 {
+		cfg.Agent.MaxCost = *maxCost
+	}
+	if *maxTokens > 0 {
+		cfg.Agent.MaxTokens = *maxTokens
+	}
+	if *maxDuration > 0 {
+		cfg.Agent.MaxDuration = *maxDuration
+	}
+	if *verifyCommand != "" {
+		cfg.Agent.VerifyCommand = *verifyCommand
+	}
+	if *approvalPolicy != "" {
+		cfg.Approval.Enabled = true
+		cfg.Approval.PolicyFile = *approvalPolicy
+	}
+	if *approvalInteractive != "" {
+		cfg.Approval.Interactive = *approvalInteractive
 	}
 
 	// Override workspace for benchmark mode - set BEFORE tools are initialized
@@ -206,19 +306,55 @@ func main() {
 
 		// Create workspace directory (needed before checkpoint manager initializes)
 		if err := os.MkdirAll(cfg.Workspace.Root, 0755); err != nil {
-			log.Fatalf("Failed to create benchmark workspace: %v", err)
+			return exitError, fmt.Errorf("failed to create benchmark workspace: %w", err)
 		}
 	}
 
 	// Acquire workspace lock to prevent multiple instances on same workspace
 	workspaceLock, err := workspace.AcquireLock(cfg.Workspace.Root)
 	if err != nil {
-		log.Fatalf("Failed to acquire workspace lock: %v", err)
+		return exitError, fmt.Errorf("failed to acquire workspace lock: %w", err)
 	}
 	defer workspaceLock.Release()
 
 	// Initialize LLM client
-	llmClient := llm.NewClient(cfg.LLM.BaseURL, cfg.LLM.APIKey)
+	var llmClient llm.Provider
+	if *replayDir != "" {
+		llmClient, err = llm.NewReplayer(*replayDir, *replayMode)
+	} else {
+		llmClient, err = newLLMProvider(cfg)
+	}
+	if err != nil {
+		return exitError, fmt.Errorf("failed to create LLM provider: %w", err)
+	}
+	if *recordDir != "" {
+		recorder, err := llm.NewRecorder(llmClient, *recordDir)
+		if err != nil {
+			return exitError, fmt.Errorf("failed to start recording: %w", err)
+		}
+		defer recorder.Close()
+		llmClient = recorder
+	}
+
+	// Initialize token estimation for the pre-flight context check.
+	// A replayed session has no server to ask, so it uses the heuristic.
+	tokenizerOpts := tokenizer.Options{
+		Kind:     cfg.LLM.Tokenizer,
+		Provider: cfg.LLM.Provider,
+		BaseURL:  cfg.LLM.BaseURL,
+		Model:    cfg.LLM.Model,
+	}
+	if *replayDir != "" && tokenizerOpts.Kind != tokenizer.KindOff {
+		tokenizerOpts.Kind = tokenizer.KindHeuristic
+	}
+	estimator, err := tokenizer.New(tokenizerOpts)
+	if err != nil {
+		return exitError, fmt.Errorf("failed to create tokenizer: %w", err)
+	}
+	var tokenCounter *tokenizer.Counter
+	if estimator != nil {
+		tokenCounter = tokenizer.NewCounter(estimator)
+	}
 
 	// Initialize temp file manager for shell command outputs
 	tempFileMgr := tools.NewTempFileManager(cfg.Workspace.Root)
@@ -227,8 +363,29 @@ func main() {
 	// Initialize plan manager
 	planManager := tools.NewPlanManager()
 
+	// Initialize session manager
+	sessionMgr, err := session.NewManager()
+	if err != nil {
+		return exitError, fmt.Errorf("failed to create session manager: %w", err)
+	}
+
+	// Load the run to resume before the checkpoints, which continue from it
+	var resumeState *session.RunState
+	if *resume {
+		resumeState, err = sessionMgr.LoadState(*sessionName)
+		if err != nil {
+			return exitError, fmt.Errorf("failed to load session %q: %w", *sessionName, err)
+		}
+		if resumeState == nil {
+			return exitError, fmt.Errorf("session %q has no unfinished run to resume", *sessionName)
+		}
+	}
+
 	// Initialize checkpoint manager
 	sessionID := fmt.Sprintf("%d", time.Now().UnixNano())
+	if resumeState != nil && resumeState.CheckpointSession != "" {
+		sessionID = resumeState.CheckpointSession
+	}
 	checkpointMgr, err := checkpoint.NewManager(
 		sessionID,
 		cfg.Workspace.Root,
@@ -236,11 +393,21 @@ func main() {
 		cfg.Tools.Checkpoint.MaxFileSizeKB,
 	)
 	if err != nil {
-		log.Fatalf("Failed to create checkpoint manager: %v", err)
+		return exitError, fmt.Errorf("failed to create checkpoint manager: %w", err)
 	}
 
-	// Initialize checkpoint infrastructure
-	if err := checkpointMgr.Initialize(); err != nil {
+	// Initialize checkpoint infrastructure. A resumed run keeps the shadow
+	// repository of the process that died, if it is still there.
+	if resumeState != nil && resumeState.CheckpointSession != "" {
+		if err := checkpointMgr.Resume(resumeState.CheckpointTurn); err != nil {
+			writer.Warn(fmt.Sprintf("Checkpoints of the interrupted run are gone (%v) - starting new ones", err))
+			resumeState.CheckpointSession = ""
+		}
+	}
+	if resumeState != nil && resumeState.CheckpointSession != "" {
+		writer.Debug("Checkpoint infrastructure resumed")
+		defer func() { _ = checkpointMgr.Cleanup() }()
+	} else if err := checkpointMgr.Initialize(); err != nil {
 		writer.Warn(fmt.Sprintf("Failed to initialize checkpoints: %v (continuing without checkpoints)", err))
 		checkpointMgr.SetEnabled(false)
 	} else {
@@ -276,6 +443,35 @@ func main() {
 		}
 	}
 
+	// Language servers for the LSP.* tools start on first use and run until
+	// the session ends
+	var lspMgr *lsp.Manager
+	if cfg.Tools.LSP.Enabled {
+		lspMgr = lsp.NewManager(cfg.Workspace.Root, cfg.Tools.LSP.Servers)
+		defer func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			lspMgr.Shutdown(ctx)
+		}()
+	}
+
+	// Background processes of the Process.* tools are killed when the session ends
+	var processMgr *tools.ProcessManager
+	if cfg.Tools.Process.Enabled {
+		processMgr = tools.NewProcessManager(tempFileMgr, cfg.Tools.Process.MaxProcesses)
+		defer processMgr.KillAll()
+		// They run in process groups of their own, so Ctrl+C doesn't reach them
+		workspaceLock.AtExit(processMgr.KillAll)
+	}
+
+	// The persistent shell and what it started are killed the same way
+	var shellSession *tools.ShellSession
+	if cfg.Tools.Shell.Enabled && cfg.Tools.Shell.Persistent {
+		shellSession = tools.NewShellSession(cfg.Workspace.Root)
+		defer shellSession.Close()
+		workspaceLock.AtExit(shellSession.Close)
+	}
+
 	// Setup tool registry using the new setup function
 	registry := tools.SetupRegistry(tools.SetupConfig{
 		Cfg:           cfg,
@@ -284,12 +480,86 @@ func main() {
 		Logger:        writer, // Writer implements DebugLogger
 		TempFileMgr:   tempFileMgr,
 		PlanManager:   planManager,
+		LSPManager:    lspMgr,
+		ProcessMgr:    processMgr,
+		ShellSession:  shellSession,
 	})
 
+	// Tool calls go through the approval policy when one is configured. Calls
+	// that need asking are denied when there is no terminal to ask on.
+	var approvalGate *approval.Gate
+	if cfg.Approval.Enabled {
+		policy, err := approval.NewPolicy(cfg.Approval)
+		if err != nil {
+			return exitError, fmt.Errorf("invalid approval policy: %w", err)
+		}
+		var prompter approval.Prompter
+		if cfg.Approval.Interactive != "never" {
+			prompter = approval.NewTerminalPrompter()
+		}
+		approvalGate = approval.NewGate(policy, prompter, cfg.Workspace.Root)
+	}
+
+	// The sub-agent tool picks its tools from the registry, so it's added last
+	if cfg.Tools.Delegate.Enabled {
+		registry.Enable(agent.NewDelegateTool(agent.DelegateOptions{
+			Cfg:       cfg,
+			LLMClient: llmClient,
+			Registry:  registry,
+			Writer:    writer,
+			Logger:    logger,
+			Tokens:    tokenCounter,
+			Approval:  approvalGate,
+		}))
+	}
+
 	// Generate system prompt using the prompt generator
 	promptGen := prompt.NewGenerator(registry, cfg)
 	systemPrompt := promptGen.GenerateSystemPrompt()
 
+	// Stream events to a JSONL file for other tools to follow
+	bus := events.NewBus()
+	if *eventsPath != "" {
+		out := os.Stdout
+		if *eventsPath != "-" {
+			f, err := os.Create(*eventsPath)
+			if err != nil {
+				return exitError, fmt.Errorf("failed to create events file: %w", err)
+			}
+			defer f.Close()
+			out = f
+		}
+		bus.Subscribe(events.NewJSONLSink(out))
+	}
+	var stream *ui.StreamJSONSink
+	if *outputFormat == "stream-json" {
+		stream = ui.NewStreamJSONSink(os.Stdout)
+		bus.Subscribe(stream)
+	}
+
+	// Acquire lock on session if specified
+	if *sessionName != "" {
+		sessionUnlock, err := sessionMgr.AcquireLock(*sessionName)
+		if err != nil {
+			return exitError, err
+		}
+		defer sessionUnlock()
+	}
+
+	// Listen for steering while holding the session lock, which guards the socket
+	var controlSrv *control.Server
+	if *controlPath == "" && *sessionName != "" {
+		*controlPath = sessionMgr.ControlPath(*sessionName)
+	}
+	if *controlPath != "" && !benchmarkEnabled {
+		controlSrv, err = control.Listen(*controlPath)
+		if err != nil {
+			writer.Warn(fmt.Sprintf("Steering disabled: %v", err))
+		} else {
+			defer controlSrv.Close()
+		}
+	}
+
 	// Create agent runner
 	runner := agent.NewRunner(agent.RunnerOptions{
 		Cfg:               cfg,
@@ -301,6 +571,10 @@ func main() {
 		ContextMgr:        contextMgr,
 		ContextMiddleware: contextMiddleware,
 		PlanManager:       planManager,
+		Tokens:            tokenCounter,
+		Events:            bus,
+		Approval:          approvalGate,
+		Control:           controlSrv,
 	})
 
 	// Run benchmark mode if requested
@@ -320,21 +594,22 @@ func main() {
 		}
 
 		if err := benchmark.Run(context.Background(), flags, runner, cfg, systemPrompt, version, originalWorkspaceRoot); err != nil {
-			log.Fatalf("Benchmark failed: %v", err)
+			return exitError, fmt.Errorf("benchmark failed: %w", err)
 		}
-		return
+		return exitOK, nil
 	}
 
 	// Require -p or --benchmark mode (kvit-coder is headless, use kvit-coder-ui for interactive mode)
 	if !execMode {
 		fmt.Fprintln(os.Stderr, "Usage: kvit-coder -p \"prompt\" [options]")
 		fmt.Fprintln(os.Stderr, "       kvit-coder --benchmark [options]")
+		fmt.Fprintln(os.Stderr, "       kvit-coder replay [options] <session>")
 		fmt.Fprintln(os.Stderr, "")
 		fmt.Fprintln(os.Stderr, "kvit-coder is a headless agent. Use kvit-coder-ui for interactive mode.")
 		fmt.Fprintln(os.Stderr, "")
 		fmt.Fprintln(os.Stderr, "Options:")
 		flag.PrintDefaults()
-		os.Exit(1)
+		return exitError, nil
 	}
 
 	// Show startup info
@@ -344,23 +619,116 @@ func main() {
 	if *logFile != "" {
 		writer.StartupInfo(fmt.Sprintf("Logs: %s", *logFile))
 	}
-	fmt.Println()
+	if !writer.IsJSONMode() {
+		fmt.Println()
+	}
+
+	// Run in exec mode (always, since we require -p or --benchmark)
+	reason := repl.RunExec(runner, writer, cfg, systemPrompt, promptText, quietMode, *sessionName, sessionMgr, stream, resumeState)
+	return exitCode(reason), nil
+}
+
+// runReplay shows a saved session step by step: kvit-coder replay <session>
+func runReplay(args []string) (int, error) {
+	fs := flag.NewFlagSet("replay", flag.ExitOnError)
+	all := fs.Bool("all", false, "print every step and exit instead of browsing")
+	turn := fs.Int("turn", 0, "start at the first step of this turn")
+	step := fs.Int("step", 0, "start at this step")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: kvit-coder replay [options] <session>")
+		fmt.Fprintln(os.Stderr, "")
+		fmt.Fprintln(os.Stderr, "Options:")
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return exitUsage, nil
+	}
+	name := fs.Arg(0)
 
-	// Initialize session manager
 	sessionMgr, err := session.NewManager()
 	if err != nil {
-		log.Fatalf("Failed to create session manager: %v", err)
+		return exitError, fmt.Errorf("failed to create session manager: %w", err)
 	}
+	if !sessionMgr.SessionExists(name) {
+		return exitError, fmt.Errorf("session %q not found", name)
+	}
+	messages, err := sessionMgr.LoadSession(name)
+	if err != nil {
+		return exitError, fmt.Errorf("failed to load session: %w", err)
+	}
+	t := trajectory.Build(messages, tokenizer.NewCounter(tokenizer.NewHeuristic("")))
 
-	// Acquire lock on session if specified
-	if *sessionName != "" {
-		sessionUnlock, err := sessionMgr.AcquireLock(*sessionName)
-		if err != nil {
-			log.Fatalf("%v", err)
+	// Browsing needs someone at the keyboard
+	stdin, _ := os.Stdin.Stat()
+	if *all || stdin == nil || stdin.Mode()&os.ModeCharDevice == 0 {
+		trajectory.RenderAll(os.Stdout, t)
+		return exitOK, nil
+	}
+	start := *step - 1
+	if *turn > 0 {
+		if start = t.TurnStart(*turn); start < 0 {
+			return exitError, fmt.Errorf("session %q has no turn %d", name, *turn)
 		}
-		defer sessionUnlock()
 	}
+	if err := trajectory.Browse(os.Stdin, os.Stdout, t, start); err != nil {
+		return exitError, fmt.Errorf("failed to read input: %w", err)
+	}
+	return exitOK, nil
+}
 
-	// Run in exec mode (always, since we require -p or --benchmark)
-	repl.RunExec(runner, writer, cfg, systemPrompt, promptText, quietMode, *sessionName, sessionMgr)
+// exitCode maps why a run stopped to the process exit code
+func exitCode(reason agent.StopReason) int {
+	switch reason {
+	case agent.StopCompleted:
+		return exitOK
+	case agent.StopBudget:
+		return exitBudget
+	case agent.StopMaxIterations:
+		return exitMaxIterations
+	case agent.StopLoop:
+		return exitLoop
+	case agent.StopDuplicateCalls:
+		return exitDuplicate
+	case agent.StopVerifyFailed:
+		return exitVerify
+	default:
+		return exitError
+	}
+}
+
+// newLLMProvider creates the LLM provider from config. With llm.endpoints,
+// requests are spread over the endpoints and fail over between them.
+func newLLMProvider(cfg *config.Config) (llm.Provider, error) {
+	opts := llm.ProviderOptions{
+		Kind:           cfg.LLM.Provider,
+		BaseURL:        cfg.LLM.BaseURL,
+		APIKey:         cfg.LLM.APIKey,
+		ThinkingBudget: cfg.LLM.ThinkingBudget,
+		NumCtx:         cfg.LLM.NumCtx,
+		KeepAlive:      cfg.LLM.KeepAlive,
+	}
+	if len(cfg.LLM.Endpoints) == 0 {
+		return llm.NewProvider(opts)
+	}
+
+	// The pool handles retries across endpoints, so a dead host fails fast
+	opts.MaxRetries = -1
+	opts.ConnectTimeout = 5 * time.Second
+	var endpoints []llm.PoolEndpoint
+	for _, ep := range cfg.LLM.Endpoints {
+		opts.BaseURL = ep.BaseURL
+		provider, err := llm.NewProvider(opts)
+		if err != nil {
+			return nil, err
+		}
+		endpoints = append(endpoints, llm.PoolEndpoint{
+			Name:     ep.BaseURL,
+			Provider: provider,
+			Weight:   ep.Weight,
+			Model:    ep.Model,
+		})
+	}
+	return llm.NewPool(endpoints, llm.PoolOptions{Strategy: cfg.LLM.EndpointStrategy})
 }
@@ -0,0 +1,45 @@
+package agent
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/kvit-s/kvit-coder/internal/approval"
+	"github.com/kvit-s/kvit-coder/internal/config"
+	"github.com/kvit-s/kvit-coder/internal/llm"
+	"github.com/kvit-s/kvit-coder/internal/llm/fake"
+)
+
+func TestRunApprovalDenialReachesModel(t *testing.T) {
+	f := newRunnerFixture(t, nil,
+		fake.ToolCall("Echo", `{"text":"secret"}`),
+		fake.Text("I can't do that"),
+	)
+	policy, err := approval.NewPolicy(config.ApprovalConfig{
+		Rules: []config.ApprovalRule{{Tool: "Echo", Action: "ask", Reason: "echo needs a human"}},
+	})
+	if err != nil {
+		t.Fatalf("NewPolicy() error = %v", err)
+	}
+	f.runner.approval = approval.NewGate(policy, nil, t.TempDir())
+
+	result, err := f.run(t)
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if f.echo.calls != 0 {
+		t.Errorf("echo calls = %d, want 0", f.echo.calls)
+	}
+
+	requests := f.server.Requests()
+	if len(requests) != 2 {
+		t.Fatalf("requests = %d, want 2", len(requests))
+	}
+	denial := lastMessage(requests[1].Messages)
+	if denial.Role != llm.RoleTool || !strings.Contains(denial.Content, "echo needs a human") {
+		t.Errorf("tool result = %+v, want the denial with its reason", denial)
+	}
+	if got := lastMessage(result.FinalMessages); got.Content != "I can't do that" {
+		t.Errorf("last message = %+v", got)
+	}
+}
@@ -0,0 +1,55 @@
+package agent
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/kvit-s/kvit-coder/internal/llm"
+	"github.com/kvit-s/kvit-coder/internal/stats"
+)
+
+// StopReason tells why a run ended
+type StopReason string
+
+const (
+	StopCompleted      StopReason = "completed"       // the model gave a final answer
+	StopBudget         StopReason = "budget"          // a cost, token or time budget ran out
+	StopMaxIterations  StopReason = "max_iterations"  // agent.max_tool_iterations reached without an answer
+	StopLoop           StopReason = "loop_detected"   // the model kept looping after repeated warnings
+	StopDuplicateCalls StopReason = "duplicate_calls" // the same call was repeated with identical arguments
+	StopVerifyFailed   StopReason = "verify_failed"   // answered, but agent.verify_command still fails
+	StopCancelled      StopReason = "cancelled"
+	StopError          StopReason = "error" // the LLM request failed
+)
+
+// budgetExceeded reports which of the configured budgets the run has used up,
+// or "" while all of them have room left
+func (r *Runner) budgetExceeded(s *stats.AgentStats, elapsed time.Duration) string {
+	agent := r.cfg.Agent
+	if agent.MaxCost > 0 && s.TotalCost >= agent.MaxCost {
+		return fmt.Sprintf("cost $%.4f of $%.4f", s.TotalCost, agent.MaxCost)
+	}
+	if tokens := s.TotalPromptTokens + s.TotalCompletionTokens; agent.MaxTokens > 0 && tokens >= agent.MaxTokens {
+		return fmt.Sprintf("%d of %d tokens", tokens, agent.MaxTokens)
+	}
+	if agent.MaxDuration > 0 && elapsed >= agent.MaxDuration {
+		return fmt.Sprintf("%s of %s", elapsed.Round(time.Second), agent.MaxDuration)
+	}
+	return ""
+}
+
+// wrapUpMessage asks the model to finish after a budget ran out
+func wrapUpMessage(reason string) llm.Message {
+	return llm.Message{
+		Role: llm.RoleUser,
+		Content: fmt.Sprintf("[System: The budget for this task is exhausted (%s). Stop working now: no more tool calls. "+
+			"Reply with a final answer summarizing what you did, what is left to do, and anything the user should check.]", reason),
+	}
+}
+
+// withoutTools removes the tools from a request, for the wrap-up turn
+func withoutTools(req llm.ChatRequest) llm.ChatRequest {
+	req.Tools = nil
+	req.ToolChoice = ""
+	return req
+}
@@ -0,0 +1,153 @@
+package agent
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kvit-s/kvit-coder/internal/config"
+	"github.com/kvit-s/kvit-coder/internal/llm"
+	"github.com/kvit-s/kvit-coder/internal/llm/fake"
+	"github.com/kvit-s/kvit-coder/internal/stats"
+)
+
+func TestRunTokenBudgetWrapsUp(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Agent.MaxTokens = 100
+	f := newRunnerFixture(t, cfg,
+		fake.ToolCall("Echo", `{"text":"a"}`).WithUsage(100, 10),
+		fake.Text("here is where I got to"),
+		fake.Text("never requested"),
+	)
+
+	result, err := f.run(t)
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if result.StopReason != StopBudget {
+		t.Errorf("StopReason = %q, want %q", result.StopReason, StopBudget)
+	}
+	if got := lastMessage(result.FinalMessages); got.Content != "here is where I got to" {
+		t.Errorf("last message = %+v, want the wrap-up answer", got)
+	}
+
+	requests := f.server.Requests()
+	if len(requests) != 2 {
+		t.Fatalf("requests = %d, want 2", len(requests))
+	}
+	wrapUp := requests[1]
+	if len(wrapUp.Tools) != 0 {
+		t.Errorf("wrap-up request offers %d tools, want none", len(wrapUp.Tools))
+	}
+	if prompt := lastMessage(wrapUp.Messages); prompt.Role != llm.RoleUser || !strings.Contains(prompt.Content, "110 of 100 tokens") {
+		t.Errorf("wrap-up prompt = %+v", prompt)
+	}
+}
+
+func TestRunWrapUpIgnoresToolCalls(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Agent.MaxTokens = 50
+	f := newRunnerFixture(t, cfg,
+		fake.ToolCall("Echo", `{"text":"a"}`).WithUsage(100, 10),
+		fake.Text("one more thing").WithToolCall("Echo", `{"text":"b"}`),
+	)
+
+	result, err := f.run(t)
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if result.StopReason != StopBudget || f.echo.calls != 1 {
+		t.Errorf("StopReason = %q, echo calls = %d; want budget after 1 call", result.StopReason, f.echo.calls)
+	}
+	if got := lastMessage(result.FinalMessages); got.Content != "one more thing" || len(got.ToolCalls) != 0 {
+		t.Errorf("last message = %+v, want the text without tool calls", got)
+	}
+}
+
+func TestRunMaxIterations(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Agent.MaxIterations = 2
+	f := newRunnerFixture(t, cfg,
+		fake.ToolCall("Echo", `{"text":"a"}`),
+		fake.ToolCall("Echo", `{"text":"b"}`),
+	)
+
+	result, err := f.run(t)
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if result.StopReason != StopMaxIterations {
+		t.Errorf("StopReason = %q, want %q", result.StopReason, StopMaxIterations)
+	}
+}
+
+func TestRunLoopInterventionLimit(t *testing.T) {
+	// Four failing calls in a row get one loop warning
+	failing := func() []fake.Step {
+		return []fake.Step{
+			fake.ToolCall("Echo", `{"text":"a","times":"x"}`),
+			fake.ToolCall("Echo", `{"text":"b","times":"x"}`),
+			fake.ToolCall("Echo", `{"text":"c","times":"x"}`),
+			fake.ToolCall("Echo", `{"text":"d","times":"x"}`),
+			fake.Text("done"),
+		}
+	}
+
+	// Off by default: the model is warned and carries on
+	f := newRunnerFixture(t, nil, failing()...)
+	result, err := f.run(t)
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if result.StopReason != StopCompleted {
+		t.Errorf("StopReason = %q, want %q without a limit", result.StopReason, StopCompleted)
+	}
+
+	cfg := &config.Config{}
+	cfg.Agent.MaxLoopInterventions = 1
+	f = newRunnerFixture(t, cfg, failing()...)
+	result, err = f.run(t)
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if result.StopReason != StopLoop || f.server.Remaining() != 1 {
+		t.Errorf("StopReason = %q with %d steps left, want %q before the answer", result.StopReason, f.server.Remaining(), StopLoop)
+	}
+}
+
+func TestRunCompletedStopReason(t *testing.T) {
+	f := newRunnerFixture(t, nil, fake.Text("done"))
+	result, err := f.run(t)
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if result.StopReason != StopCompleted {
+		t.Errorf("StopReason = %q, want %q", result.StopReason, StopCompleted)
+	}
+}
+
+func TestBudgetExceeded(t *testing.T) {
+	tests := []struct {
+		name    string
+		budget  func(cfg *config.Config)
+		stats   stats.AgentStats
+		elapsed time.Duration
+		want    string
+	}{
+		{"no budgets", func(cfg *config.Config) {}, stats.AgentStats{TotalCost: 100, TotalPromptTokens: 1e6}, time.Hour, ""},
+		{"cost left", func(cfg *config.Config) { cfg.Agent.MaxCost = 1 }, stats.AgentStats{TotalCost: 0.5}, 0, ""},
+		{"cost spent", func(cfg *config.Config) { cfg.Agent.MaxCost = 1 }, stats.AgentStats{TotalCost: 1.25}, 0, "cost $1.2500 of $1.0000"},
+		{"tokens spent", func(cfg *config.Config) { cfg.Agent.MaxTokens = 1000 }, stats.AgentStats{TotalPromptTokens: 900, TotalCompletionTokens: 100}, 0, "1000 of 1000 tokens"},
+		{"time spent", func(cfg *config.Config) { cfg.Agent.MaxDuration = time.Minute }, stats.AgentStats{}, 90 * time.Second, "1m30s of 1m0s"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{}
+			tt.budget(cfg)
+			r := &Runner{cfg: cfg}
+			if got := r.budgetExceeded(&tt.stats, tt.elapsed); got != tt.want {
+				t.Errorf("budgetExceeded() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
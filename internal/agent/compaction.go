@@ -0,0 +1,140 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/kvit-s/kvit-coder/internal/llm"
+	"github.com/kvit-s/kvit-coder/internal/session"
+	"github.com/kvit-s/kvit-coder/internal/stats"
+)
+
+// compactionPrompt instructs the model to summarize older turns
+const compactionPrompt = `You summarize the earlier part of a coding agent's conversation so the agent can continue with less context.
+
+Write a concise summary with these sections:
+- Task: what the user asked for, including constraints
+- Files touched: each file read, created or edited, and what changed
+- Decisions: approaches chosen or ruled out, and why
+- Open TODOs: what remains to be done, including errors or failing tests not yet fixed
+
+Keep exact file paths, function names, commands and error messages. Only include what is in the transcript.`
+
+// Limits on how much of each message goes into the summarization transcript
+const (
+	compactionMaxMessageChars = 4000
+	compactionMaxToolChars    = 1500
+)
+
+// errNothingToCompact means the history is too short to leave anything to summarize
+var errNothingToCompact = errors.New("nothing to compact")
+
+// compactionDue reports whether the conversation has grown past the
+// compaction threshold, and its estimated size. Without a token estimator the
+// usage reported for the previous response is used.
+func (r *Runner) compactionDue(ctx context.Context, messages []llm.Message, lastUsage int) (int, bool) {
+	if !r.cfg.Compaction.Enabled || r.cfg.LLM.Context <= 0 {
+		return 0, false
+	}
+	usage := lastUsage
+	if r.tokens != nil {
+		if estimate, err := r.tokens.RequestTokens(ctx, r.chatRequest(messages)); err == nil {
+			usage = estimate
+		}
+	}
+	threshold := int(float64(r.cfg.LLM.Context) * r.cfg.Compaction.Threshold)
+	return usage, usage > threshold
+}
+
+// compact replaces older turns with a model-written summary. The system
+// prompt and the most recent messages are kept, and the kept part starts at
+// an assistant message so every tool result still follows its tool call.
+func (r *Runner) compact(ctx context.Context, messages []llm.Message, usage int, agentStats *stats.AgentStats) ([]llm.Message, *session.Compaction, error) {
+	start := 0
+	if len(messages) > 0 && messages[0].Role == llm.RoleSystem {
+		start = 1
+	}
+	cut := len(messages) - r.cfg.Compaction.KeepRecent
+	for cut > start && messages[cut].Role != llm.RoleAssistant {
+		cut--
+	}
+	if cut-start < 2 {
+		return nil, nil, errNothingToCompact
+	}
+	replaced := messages[start:cut]
+
+	resp, err := r.llmClient.Chat(ctx, llm.ChatRequest{
+		Model: r.cfg.LLM.Model,
+		Messages: []llm.Message{
+			{Role: llm.RoleSystem, Content: compactionPrompt},
+			{Role: llm.RoleUser, Content: compactionTranscript(replaced)},
+		},
+		Temperature: r.cfg.LLM.Temperature,
+		MaxTokens:   r.cfg.Compaction.SummaryTokens,
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("summarize: %w", err)
+	}
+	if len(resp.Choices) == 0 || resp.Choices[0].Error != nil {
+		return nil, nil, fmt.Errorf("summarize: no response from model")
+	}
+	summary := strings.TrimSpace(resp.Choices[0].Message.Content)
+	if summary == "" {
+		return nil, nil, fmt.Errorf("summarize: model returned an empty summary")
+	}
+	r.addUsage(resp, agentStats)
+	agentStats.CompactionCount++
+
+	compacted := make([]llm.Message, 0, start+1+len(messages)-cut)
+	compacted = append(compacted, messages[:start]...)
+	compacted = append(compacted, llm.Message{
+		Role:    llm.RoleUser,
+		Content: session.SummaryPrefix + "\n\n" + summary,
+	})
+	compacted = append(compacted, messages[cut:]...)
+
+	record := &session.Compaction{
+		Time:         time.Now(),
+		Summary:      summary,
+		Replaced:     append([]llm.Message(nil), replaced...),
+		TokensBefore: usage,
+	}
+	if r.tokens != nil {
+		record.TokensAfter, _ = r.tokens.RequestTokens(ctx, r.chatRequest(compacted))
+	}
+	return compacted, record, nil
+}
+
+// compactionTranscript renders messages as plain text for the summarizer,
+// shortening long contents and tool outputs
+func compactionTranscript(messages []llm.Message) string {
+	var sb strings.Builder
+	sb.WriteString("Summarize this conversation:\n\n")
+	for _, msg := range messages {
+		switch msg.Role {
+		case llm.RoleTool:
+			sb.WriteString(fmt.Sprintf("[tool result: %s]\n%s\n\n", msg.Name, shorten(msg.Content, compactionMaxToolChars)))
+		default:
+			sb.WriteString(fmt.Sprintf("[%s]\n", msg.Role))
+			if msg.Content != "" {
+				sb.WriteString(shorten(msg.Content, compactionMaxMessageChars) + "\n")
+			}
+			for _, tc := range msg.ToolCalls {
+				sb.WriteString(fmt.Sprintf("-> %s(%s)\n", tc.Function.Name, shorten(tc.Function.Arguments, compactionMaxToolChars)))
+			}
+			sb.WriteString("\n")
+		}
+	}
+	return sb.String()
+}
+
+// shorten cuts s to about limit bytes on a rune boundary
+func shorten(s string, limit int) string {
+	if len(s) <= limit {
+		return s
+	}
+	return strings.ToValidUTF8(s[:limit], "") + fmt.Sprintf("... (%d more characters)", len(s)-limit)
+}
@@ -0,0 +1,128 @@
+package agent
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/kvit-s/kvit-coder/internal/config"
+	"github.com/kvit-s/kvit-coder/internal/llm"
+	"github.com/kvit-s/kvit-coder/internal/llm/fake"
+	"github.com/kvit-s/kvit-coder/internal/session"
+	"github.com/kvit-s/kvit-coder/internal/tokenizer"
+)
+
+func compactionConfig() *config.Config {
+	cfg := &config.Config{}
+	cfg.LLM.Context = 1000
+	cfg.Compaction.Enabled = true
+	cfg.Compaction.Threshold = 0.5
+	cfg.Compaction.KeepRecent = 2
+	cfg.Compaction.SummaryTokens = 256
+	return cfg
+}
+
+// longHistory is a conversation whose tool output pushes it past the compaction threshold
+func longHistory() []llm.Message {
+	call := llm.ToolCall{ID: "call_1", Type: "function"}
+	call.Function.Name = "Echo"
+	call.Function.Arguments = `{"text":"hi"}`
+	return []llm.Message{
+		{Role: llm.RoleSystem, Content: "system prompt"},
+		{Role: llm.RoleUser, Content: "fix the tests in a.go"},
+		{Role: llm.RoleAssistant, ToolCalls: []llm.ToolCall{call}},
+		{Role: llm.RoleTool, Name: "Echo", ToolCallID: "call_1", Content: strings.Repeat("test output line\n", 300)},
+		{Role: llm.RoleAssistant, Content: "The tests fail in a.go"},
+		{Role: llm.RoleUser, Content: "continue"},
+	}
+}
+
+func TestCompactionReplacesOlderTurns(t *testing.T) {
+	var summaryStats llm.GenerationStats
+	summaryStats.Data.TotalCost = 0.5
+	summaryStats.Data.NativeTokensCached = 40
+	f := newRunnerFixture(t, compactionConfig(),
+		fake.Text("Task: fix the tests in a.go\nOpen TODOs: make them pass").WithUsage(300, 20).WithStats(summaryStats),
+		fake.Text("done"),
+	)
+	f.runner.tokens = tokenizer.NewCounter(tokenizer.NewHeuristic("qwen"))
+
+	result, err := f.runner.Run(context.Background(), RunConfig{Messages: longHistory()})
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	reqs := f.server.Requests()
+	if len(reqs) != 2 {
+		t.Fatalf("requests = %d, want summary + turn", len(reqs))
+	}
+	summaryReq := reqs[0]
+	if summaryReq.MaxTokens != 256 || len(summaryReq.Tools) != 0 {
+		t.Errorf("summary request MaxTokens = %d, tools = %d", summaryReq.MaxTokens, len(summaryReq.Tools))
+	}
+	if transcript := summaryReq.Messages[1].Content; !strings.Contains(transcript, "fix the tests in a.go") || !strings.Contains(transcript, "-> Echo(") {
+		t.Errorf("transcript is missing turns:\n%s", transcript)
+	}
+
+	// System prompt, summary, then the kept turns starting at an assistant message
+	msgs := reqs[1].Messages
+	if len(msgs) != 4 {
+		t.Fatalf("compacted request has %d messages, want 4", len(msgs))
+	}
+	if msgs[0].Role != llm.RoleSystem || msgs[1].Role != llm.RoleUser || !strings.HasPrefix(msgs[1].Content, session.SummaryPrefix) {
+		t.Errorf("compacted head = %+v", msgs[:2])
+	}
+	if msgs[2].Content != "The tests fail in a.go" || msgs[3].Content != "continue" {
+		t.Errorf("kept turns = %+v", msgs[2:])
+	}
+
+	if len(result.Compactions) != 1 || len(result.Compactions[0].Replaced) != 3 {
+		t.Fatalf("Compactions = %+v, want one replacing 3 messages", result.Compactions)
+	}
+	c := result.Compactions[0]
+	if c.TokensAfter == 0 || c.TokensAfter >= c.TokensBefore {
+		t.Errorf("tokens before/after = %d/%d", c.TokensBefore, c.TokensAfter)
+	}
+	if result.Stats.CompactionCount != 1 {
+		t.Errorf("CompactionCount = %d, want 1", result.Stats.CompactionCount)
+	}
+	// The summary is paid for like any other request
+	if s := result.Stats; s.TotalPromptTokens < 300 || s.TotalCost != 0.5 || s.TotalCacheReadTokens != 40 {
+		t.Errorf("stats = %d prompt tokens, cost %v, %d cached; want the summary's counted", s.TotalPromptTokens, s.TotalCost, s.TotalCacheReadTokens)
+	}
+}
+
+func TestCompactionFailureIsNotRetried(t *testing.T) {
+	f := newRunnerFixture(t, compactionConfig(),
+		fake.Error(400, `{"error":"summary failed"}`),
+		fake.ToolCall("Echo", `{"text":"again"}`),
+		fake.Text("done"),
+	)
+	f.runner.tokens = tokenizer.NewCounter(tokenizer.NewHeuristic("qwen"))
+
+	result, err := f.runner.Run(context.Background(), RunConfig{Messages: longHistory()})
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if len(f.server.Requests()) != 3 {
+		t.Errorf("requests = %d, want one summary attempt and two turns", len(f.server.Requests()))
+	}
+	if len(result.Compactions) != 0 {
+		t.Errorf("Compactions = %d, want 0", len(result.Compactions))
+	}
+}
+
+func TestCompactionNeedsEnoughHistory(t *testing.T) {
+	cfg := compactionConfig()
+	cfg.Compaction.KeepRecent = 10
+	f := newRunnerFixture(t, cfg, fake.Text("done"))
+	f.runner.tokens = tokenizer.NewCounter(tokenizer.NewHeuristic("qwen"))
+
+	result, err := f.runner.Run(context.Background(), RunConfig{Messages: longHistory()})
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if len(result.Compactions) != 0 || len(f.server.Requests()) != 1 {
+		t.Errorf("short history should not be compacted")
+	}
+}
@@ -0,0 +1,227 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/kvit-s/kvit-coder/internal/approval"
+	"github.com/kvit-s/kvit-coder/internal/config"
+	"github.com/kvit-s/kvit-coder/internal/events"
+	"github.com/kvit-s/kvit-coder/internal/llm"
+	"github.com/kvit-s/kvit-coder/internal/prompt"
+	"github.com/kvit-s/kvit-coder/internal/stats"
+	"github.com/kvit-s/kvit-coder/internal/tokenizer"
+	"github.com/kvit-s/kvit-coder/internal/tools"
+	"github.com/kvit-s/kvit-coder/internal/ui"
+)
+
+// DelegateToolName is the name of the sub-agent tool
+const DelegateToolName = "Agent.delegate"
+
+// delegateInstructions is appended to the sub-agent's system prompt
+const delegateInstructions = `## Delegated Task
+
+You are a sub-agent working for another agent, which sees nothing of your work except your final answer.
+Investigate the task with your tools, then answer with a concise summary of what you found:
+file paths with line numbers, names of the relevant functions and types, and anything that is still unclear.
+Don't paste large blocks of code; quote only the lines that matter.`
+
+// usageReporter is implemented by tools that make LLM requests of their own.
+// The runner adds what they spent to the run's stats after each call.
+type usageReporter interface {
+	// takeUsage returns the usage since the last call and resets it
+	takeUsage() *stats.AgentStats
+}
+
+// DelegateOptions are the dependencies of the sub-agent tool
+type DelegateOptions struct {
+	Cfg       *config.Config
+	LLMClient llm.Provider
+	Registry  *tools.Registry // The parent's tools, which the sub-agent's are picked from
+	Writer    *ui.Writer      // Shows the sub-agent's tool calls
+	Logger    *Logger
+	Tokens    *tokenizer.Counter
+	Approval  *approval.Gate // Applies to the sub-agent's tool calls too
+}
+
+// DelegateTool runs a task in a nested Runner with its own message history,
+// tools and limits, and returns only the final summary. Broad exploration
+// then costs the parent one tool result instead of every Search and Read.
+type DelegateTool struct {
+	opts DelegateOptions
+
+	mu    sync.Mutex
+	usage stats.AgentStats // Spent by sub-agents and not yet taken by the parent
+}
+
+// NewDelegateTool creates the sub-agent tool
+func NewDelegateTool(opts DelegateOptions) *DelegateTool {
+	return &DelegateTool{opts: opts}
+}
+
+func (t *DelegateTool) Name() string {
+	return DelegateToolName
+}
+
+func (t *DelegateTool) Description() string {
+	return "Hand a research task to a sub-agent with its own context and read-only tools. Returns only its summary, keeping search and read output out of your context."
+}
+
+func (t *DelegateTool) JSONSchema() map[string]any {
+	return map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"task": map[string]any{
+				"type":        "string",
+				"description": "What to find out, with everything the sub-agent needs to know: it doesn't see your conversation",
+			},
+		},
+		"required": []string{"task"},
+	}
+}
+
+func (t *DelegateTool) Check(ctx context.Context, args json.RawMessage) error {
+	var params struct {
+		Task string `json:"task"`
+	}
+	if err := json.Unmarshal(args, &params); err != nil {
+		return tools.SemanticErrorf("invalid arguments: %v", err)
+	}
+	if strings.TrimSpace(params.Task) == "" {
+		return tools.SemanticErrorf("task is required")
+	}
+	return nil
+}
+
+func (t *DelegateTool) Call(ctx context.Context, args json.RawMessage) (any, error) {
+	var params struct {
+		Task string `json:"task"`
+	}
+	if err := json.Unmarshal(args, &params); err != nil {
+		return nil, err
+	}
+
+	cfg := t.subConfig()
+	registry := t.subRegistry()
+	if len(registry.ListTools()) == 0 {
+		return nil, fmt.Errorf("no tools available to the sub-agent")
+	}
+
+	// The sub-agent's output stays off the terminal except for its tool calls
+	writer := ui.NewWriter(0)
+	writer.SetQuiet(true)
+	bus := events.NewBus(events.SinkFunc(t.showProgress))
+
+	runner := NewRunner(RunnerOptions{
+		Cfg:       cfg,
+		LLMClient: t.opts.LLMClient,
+		Registry:  registry,
+		Writer:    writer,
+		Logger:    t.opts.Logger,
+		Tokens:    t.opts.Tokens,
+		Events:    bus,
+		Approval:  t.opts.Approval,
+	})
+
+	// What the sub-agent read doesn't count as read for the parent's edits
+	tracker := tools.GetReadTracker()
+	defer tracker.Restore(tracker.Save())
+
+	systemPrompt := prompt.NewGenerator(registry, cfg).GenerateSystemPrompt() + "\n\n" + delegateInstructions
+	result, err := runner.Run(ctx, RunConfig{
+		Messages: []llm.Message{
+			{Role: llm.RoleSystem, Content: systemPrompt},
+			{Role: llm.RoleUser, Content: params.Task},
+		},
+		QuietMode: true,
+	})
+	if result != nil {
+		t.mu.Lock()
+		t.usage.AddUsage(result.Stats)
+		t.mu.Unlock()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("sub-agent failed: %w", err)
+	}
+
+	var summary llm.Message
+	if n := len(result.FinalMessages); n > 0 {
+		summary = result.FinalMessages[n-1]
+	}
+	if summary.Role != llm.RoleAssistant || len(summary.ToolCalls) > 0 || summary.Content == "" {
+		return nil, fmt.Errorf("sub-agent stopped without a summary (%s after %d steps)", result.StopReason, result.Stats.Steps)
+	}
+	return map[string]any{
+		"content":     summary.Content,
+		"stop_reason": string(result.StopReason),
+		"steps":       result.Stats.Steps,
+	}, nil
+}
+
+func (t *DelegateTool) PromptCategory() string { return "agent" }
+func (t *DelegateTool) PromptOrder() int       { return 0 }
+func (t *DelegateTool) PromptSection() string {
+	return `### Agent.delegate - Delegate Research
+
+**Usage:** ` + "`" + `Agent.delegate {"task": "<what to find out>"}` + "`" + `
+
+Starts a sub-agent with read-only tools and a fresh context. Only its final summary comes back, so use it for broad exploration ("where is X configured and who calls it?") instead of many Search and Read calls of your own. The sub-agent doesn't see this conversation: put everything it needs in the task.`
+}
+
+// takeUsage implements usageReporter
+func (t *DelegateTool) takeUsage() *stats.AgentStats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	usage := t.usage
+	t.usage = stats.AgentStats{}
+	return &usage
+}
+
+// subConfig is the parent's config with the delegate limits as the agent
+// limits and no verification
+func (t *DelegateTool) subConfig() *config.Config {
+	cfg := *t.opts.Cfg
+	d := t.opts.Cfg.Tools.Delegate
+	cfg.Agent.MaxIterations = d.MaxIterations
+	cfg.Agent.MaxCost = d.MaxCost
+	cfg.Agent.MaxTokens = d.MaxTokens
+	cfg.Agent.MaxDuration = d.MaxDuration
+	cfg.Agent.VerifyCommand = "" // The parent checks the work, not its helpers
+	return &cfg
+}
+
+// subRegistry picks the sub-agent's tools from the parent's: the configured
+// ones, or else the read-only ones. Sub-agents can't delegate further.
+func (t *DelegateTool) subRegistry() *tools.Registry {
+	registry := tools.NewRegistry()
+	allowed := t.opts.Cfg.Tools.Delegate.Tools
+	for _, tool := range t.opts.Registry.All() {
+		if tool.Name() == DelegateToolName {
+			continue
+		}
+		if len(allowed) > 0 && !slices.Contains(allowed, tool.Name()) {
+			continue
+		}
+		if len(allowed) == 0 && !tools.IsReadOnly(tool) {
+			continue
+		}
+		registry.Enable(tool)
+	}
+	return registry
+}
+
+// showProgress shows the sub-agent's tool calls under the parent's
+func (t *DelegateTool) showProgress(e events.Event) {
+	if t.opts.Writer == nil {
+		return
+	}
+	if e, ok := e.(events.ToolCallStarted); ok {
+		var args map[string]any
+		_ = json.Unmarshal([]byte(e.Arguments), &args)
+		t.opts.Writer.Info(fmt.Sprintf("  ↳ %s %s", e.Name, ui.FormatToolArgs(args)))
+	}
+}
@@ -0,0 +1,153 @@
+package agent
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kvit-s/kvit-coder/internal/config"
+	"github.com/kvit-s/kvit-coder/internal/llm"
+	"github.com/kvit-s/kvit-coder/internal/llm/fake"
+	"github.com/kvit-s/kvit-coder/internal/tools"
+)
+
+func newDelegateFixture(t *testing.T, cfg *config.Config, steps ...fake.Step) *runnerFixture {
+	t.Helper()
+	if cfg == nil {
+		cfg = &config.Config{}
+	}
+	f := newRunnerFixture(t, cfg, steps...)
+	f.runner.registry.Enable(&peekTool{log: &eventLog{}})
+	f.runner.registry.Enable(NewDelegateTool(DelegateOptions{
+		Cfg:       cfg,
+		LLMClient: f.runner.llmClient,
+		Registry:  f.runner.registry,
+		Logger:    f.runner.logger,
+	}))
+	return f
+}
+
+func TestDelegateRunsIsolatedSubAgent(t *testing.T) {
+	f := newDelegateFixture(t, nil,
+		fake.ToolCall(DelegateToolName, `{"task":"find where x is set"}`).WithUsage(100, 10),
+		fake.ToolCall("Peek", `{"text":"a.go"}`).WithUsage(50, 5), // sub-agent
+		fake.Text("x is set in a.go:3").WithUsage(60, 6),          // sub-agent summary
+		fake.Text("done").WithUsage(200, 20),
+	)
+
+	result, err := f.run(t)
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	var toolResult llm.Message
+	for _, msg := range result.FinalMessages {
+		if msg.Role == llm.RoleTool {
+			toolResult = msg
+		}
+	}
+	if toolResult.Name != DelegateToolName || !strings.Contains(toolResult.Content, "x is set in a.go:3") {
+		t.Errorf("tool result = %+v, want the sub-agent's summary", toolResult)
+	}
+	if strings.Contains(toolResult.Content, "seen") {
+		t.Errorf("tool result leaks the sub-agent's tool output: %s", toolResult.Content)
+	}
+
+	// The sub-agent's own request starts from scratch, with read-only tools only
+	sub := f.server.Requests()[1]
+	if len(sub.Messages) != 2 || lastMessage(sub.Messages).Content != "find where x is set" {
+		t.Errorf("sub-agent messages = %+v, want system prompt and task", sub.Messages)
+	}
+	var names []string
+	for _, spec := range sub.Tools {
+		names = append(names, spec.Function.Name)
+	}
+	if strings.Join(names, ",") != "Peek" {
+		t.Errorf("sub-agent tools = %v, want [Peek]", names)
+	}
+
+	// Usage rolls up into the parent, steps don't
+	s := result.Stats
+	if s.TotalPromptTokens != 410 || s.TotalCompletionTokens != 41 || s.Steps != 2 {
+		t.Errorf("stats = %d prompt, %d completion, %d steps; want 410, 41, 2",
+			s.TotalPromptTokens, s.TotalCompletionTokens, s.Steps)
+	}
+}
+
+func TestDelegateConfiguredTools(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Tools.Delegate.Tools = []string{"Echo", DelegateToolName}
+	f := newDelegateFixture(t, cfg)
+
+	tool := f.runner.registry.Get(DelegateToolName).(*DelegateTool)
+	if got := tool.subRegistry().ListTools(); strings.Join(got, ",") != "Echo" {
+		t.Errorf("sub-agent tools = %v, want [Echo]", got)
+	}
+}
+
+func TestDelegateWithoutSummary(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Tools.Delegate.MaxIterations = 1
+	f := newDelegateFixture(t, cfg,
+		fake.ToolCall(DelegateToolName, `{"task":"look around"}`),
+		fake.ToolCall("Peek", `{"text":"a.go"}`).WithUsage(50, 5), // sub-agent runs out of iterations
+		fake.Text("done"),
+	)
+
+	result, err := f.run(t)
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	var toolResult llm.Message
+	for _, msg := range result.FinalMessages {
+		if msg.Role == llm.RoleTool {
+			toolResult = msg
+		}
+	}
+	if !strings.Contains(toolResult.Content, "without a summary (max_iterations") {
+		t.Errorf("tool result = %q, want an error naming the stop reason", toolResult.Content)
+	}
+	if result.Stats.TotalPromptTokens != 50 {
+		t.Errorf("prompt tokens = %d, want the sub-agent's 50", result.Stats.TotalPromptTokens)
+	}
+}
+
+func TestDelegateReadsDontCountForParentEdits(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Workspace.Root = t.TempDir()
+	cfg.Tools.Read.Enabled = true
+	cfg.Tools.Edit.Enabled = true
+	cfg.Tools.Edit.ReadBeforeEditMsgs = 5
+	path := filepath.Join(cfg.Workspace.Root, "a.go")
+	if err := os.WriteFile(path, []byte("package a\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	f := newDelegateFixture(t, cfg,
+		fake.ToolCall(DelegateToolName, `{"task":"read a.go"}`),
+		fake.ToolCall("Read", `{"path":"a.go"}`), // sub-agent
+		fake.Text("a.go declares package a"),     // sub-agent summary
+		fake.ToolCall("Edit", `{"path":"a.go","start_line":1,"end_line":1,"new_text":"package b"}`),
+		fake.Text("done"),
+	)
+	f.runner.registry.Enable(tools.NewReadFileTool(cfg))
+	f.runner.registry.Enable(tools.NewUnifiedEditTool(cfg))
+
+	result, err := f.run(t)
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "package a\n" {
+		t.Errorf("file = %q, want the edit rejected", data)
+	}
+	var rejected bool
+	for _, msg := range result.FinalMessages {
+		if msg.Role == llm.RoleTool && strings.Contains(msg.Content, `"file_not_read"`) {
+			rejected = true
+		}
+	}
+	if !rejected {
+		t.Errorf("no read-before-edit error in %+v", result.FinalMessages)
+	}
+}
@@ -0,0 +1,260 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/kvit-s/kvit-coder/internal/config"
+	"github.com/kvit-s/kvit-coder/internal/llm"
+)
+
+// maskedPrefix starts a tool result that was replaced by a stub
+const maskedPrefix = "[masked] "
+
+// readResult is the part of a Read result that masking needs
+type readResult struct {
+	Path  string `json:"path"`
+	First int    `json:"first_read_line"`
+	Last  int    `json:"last_read_line"`
+	Total int    `json:"total_lines"`
+}
+
+// maskObservations finds stale tool results, following the per-tool rules in
+// cfg, and records what they are replaced with in masks, by tool call ID. It
+// returns how many results it masked. The history itself is not changed, so
+// saved sessions keep the full results; applyMasks builds the request.
+// Results already masked are left as they are, so a pass only touches
+// results that became stale since the previous one.
+func maskObservations(messages []llm.Message, masks map[string]string, cfg config.MaskingConfig) int {
+	calls := make(map[string]llm.ToolCall)
+	for _, msg := range messages {
+		for _, tc := range msg.ToolCalls {
+			calls[tc.ID] = tc
+		}
+	}
+
+	// Age of each message in assistant turns
+	turnsAfter := make([]int, len(messages))
+	turns := 0
+	for i := len(messages) - 1; i >= 0; i-- {
+		turnsAfter[i] = turns
+		if messages[i].Role == llm.RoleAssistant {
+			turns++
+		}
+	}
+
+	var superseded map[int]string
+	if cfg.CollapseReads {
+		superseded = supersededReads(messages, calls)
+	}
+
+	masked := 0
+	for i, msg := range messages {
+		// Pending edits are tracked through their results, so those stay intact
+		current, done := masks[msg.ToolCallID]
+		if msg.Role != llm.RoleTool || msg.ToolCallID == "" || strings.HasPrefix(current, maskedPrefix) ||
+			strings.Contains(msg.Content, "pending_confirmation") {
+			continue
+		}
+		if reason, ok := superseded[i]; ok {
+			masks[msg.ToolCallID] = maskedPrefix + reason
+			masked++
+			continue
+		}
+		if done {
+			continue
+		}
+
+		rule, ok := cfg.Rules[msg.Name]
+		if !ok {
+			rule, ok = cfg.Rules["*"]
+		}
+		if !ok || rule.AfterTurns <= 0 || turnsAfter[i] < rule.AfterTurns {
+			continue
+		}
+
+		var content string
+		if rule.MaxLines > 0 {
+			content = limitOutputLines(msg.Content, rule.MaxLines)
+		} else {
+			content = maskedPrefix + maskStub(msg.Name, msg.Content, calls[msg.ToolCallID], turnsAfter[i])
+		}
+		if content != msg.Content {
+			masks[msg.ToolCallID] = content
+			masked++
+		}
+	}
+	return masked
+}
+
+// applyMasks returns messages with the masked tool results from masks in
+// place of the full ones. messages is not changed.
+func applyMasks(messages []llm.Message, masks map[string]string) []llm.Message {
+	if len(masks) == 0 {
+		return messages
+	}
+	out := append([]llm.Message(nil), messages...)
+	for i := range out {
+		if content, ok := masks[out[i].ToolCallID]; ok && out[i].Role == llm.RoleTool {
+			out[i].Content = content
+		}
+	}
+	return out
+}
+
+// maskStub describes a masked result well enough for the model to get it back
+func maskStub(toolName, content string, call llm.ToolCall, age int) string {
+	var args map[string]any
+	_ = json.Unmarshal([]byte(call.Function.Arguments), &args)
+
+	switch toolName {
+	case "Read":
+		var rr readResult
+		if json.Unmarshal([]byte(content), &rr) == nil && rr.Path != "" && rr.Total > 0 {
+			return fmt.Sprintf("Read output: file %s lines %d-%d of %d, re-read if needed", rr.Path, rr.First, rr.Last, rr.Total)
+		}
+		path, _ := args["path"].(string)
+		return fmt.Sprintf("Read output: %s, re-read if needed", path)
+	case "Shell", "Shell.advanced":
+		command, _ := args["command"].(string)
+		var result struct {
+			ExitCode *int `json:"exit_code"`
+		}
+		if json.Unmarshal([]byte(content), &result) == nil && result.ExitCode != nil {
+			return fmt.Sprintf("%s output: `%s` exited with %d, run it again if needed", toolName, shorten(command, 200), *result.ExitCode)
+		}
+		return fmt.Sprintf("%s output: `%s`, run it again if needed", toolName, shorten(command, 200))
+	default:
+		return fmt.Sprintf("%s output from %d turns ago (arguments: %s), call it again if needed",
+			toolName, age, shorten(call.Function.Arguments, 200))
+	}
+}
+
+// limitOutputLines keeps the first and last lines of each long text in a
+// tool result. JSON results are rewritten field by field in the runner's format.
+func limitOutputLines(content string, maxLines int) string {
+	var fields map[string]any
+	if json.Unmarshal([]byte(content), &fields) != nil {
+		return limitLines(content, maxLines)
+	}
+	changed := false
+	for key, value := range fields {
+		if text, ok := value.(string); ok {
+			if limited := limitLines(text, maxLines); limited != text {
+				fields[key] = limited
+				changed = true
+			}
+		}
+	}
+	if !changed {
+		return content
+	}
+	data, err := json.MarshalIndent(fields, "", "  ")
+	if err != nil {
+		return content
+	}
+	return string(data)
+}
+
+// limitLines keeps the head and tail of text, maxLines lines in all, with a
+// marker line in between. Applying it again to its own output is a no-op.
+func limitLines(text string, maxLines int) string {
+	lines := strings.Split(text, "\n")
+	if len(lines) <= maxLines+1 {
+		return text
+	}
+	head := maxLines / 2
+	tail := maxLines - head
+	kept := append([]string(nil), lines[:head]...)
+	kept = append(kept, fmt.Sprintf("... [%d lines masked] ...", len(lines)-maxLines))
+	kept = append(kept, lines[len(lines)-tail:]...)
+	return strings.Join(kept, "\n")
+}
+
+// supersededReads finds Read results made stale by a later read of the same
+// file covering the same lines, or by a later edit of the file. In preview
+// mode an edit counts once it is confirmed.
+func supersededReads(messages []llm.Message, calls map[string]llm.ToolCall) map[int]string {
+	type readAt struct {
+		index       int
+		first, last int
+	}
+	reads := make(map[string][]readAt)
+	superseded := make(map[int]string)
+	pendingPath := "" // File of the edit waiting for Edit.confirm
+
+	edited := func(path string) {
+		for _, prev := range reads[path] {
+			superseded[prev.index] = fmt.Sprintf("Read output: file %s lines %d-%d, stale since the file was edited later, re-read if needed", path, prev.first, prev.last)
+		}
+		delete(reads, path)
+	}
+
+	for i, msg := range messages {
+		if msg.Role != llm.RoleTool {
+			continue
+		}
+		failed := strings.HasPrefix(msg.Content, "Error") || strings.Contains(msg.Content, `"success": false`)
+
+		// Confirm and cancel take no path; they act on the pending edit
+		switch msg.Name {
+		case "Edit.confirm", "Write.confirm":
+			if !failed && pendingPath != "" {
+				edited(pendingPath)
+			}
+			pendingPath = ""
+			continue
+		case "Edit.cancel", "Write.cancel":
+			pendingPath = ""
+			continue
+		}
+
+		var args struct {
+			Path string `json:"path"`
+		}
+		_ = json.Unmarshal([]byte(calls[msg.ToolCallID].Function.Arguments), &args)
+		if args.Path == "" {
+			continue
+		}
+		path := filepath.Clean(args.Path)
+
+		switch msg.Name {
+		case "Read":
+			var rr readResult
+			if failed || json.Unmarshal([]byte(msg.Content), &rr) != nil || rr.Total == 0 {
+				continue
+			}
+			var kept []readAt
+			for _, prev := range reads[path] {
+				if prev.first >= rr.First && prev.last <= rr.Last {
+					superseded[prev.index] = fmt.Sprintf("Read output: file %s lines %d-%d, superseded by a later read of the file", path, prev.first, prev.last)
+				} else {
+					kept = append(kept, prev)
+				}
+			}
+			reads[path] = append(kept, readAt{index: i, first: rr.First, last: rr.Last})
+		case "Edit", "Write":
+			switch {
+			case failed:
+			case strings.Contains(msg.Content, "pending_confirmation"):
+				pendingPath = path
+			default:
+				edited(path)
+			}
+		}
+	}
+	return superseded
+}
+
+// countAssistantTurns counts the assistant messages in the history
+func countAssistantTurns(messages []llm.Message) int {
+	turns := 0
+	for _, msg := range messages {
+		if msg.Role == llm.RoleAssistant {
+			turns++
+		}
+	}
+	return turns
+}
@@ -0,0 +1,254 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/kvit-s/kvit-coder/internal/config"
+	"github.com/kvit-s/kvit-coder/internal/llm"
+	"github.com/kvit-s/kvit-coder/internal/llm/fake"
+)
+
+// history builds a conversation from tool turns, one assistant message per turn
+type history struct {
+	messages []llm.Message
+	calls    int
+}
+
+func newHistory() *history {
+	return &history{messages: []llm.Message{
+		{Role: llm.RoleSystem, Content: "system prompt"},
+		{Role: llm.RoleUser, Content: "do the task"},
+	}}
+}
+
+// turn appends an assistant tool call and its result, returning the result's index
+func (h *history) turn(tool, args string, result any) int {
+	h.calls++
+	call := llm.ToolCall{ID: fmt.Sprintf("call_%d", h.calls), Type: "function"}
+	call.Function.Name = tool
+	call.Function.Arguments = args
+	content, ok := result.(string)
+	if !ok {
+		data, _ := json.MarshalIndent(result, "", "  ")
+		content = string(data)
+	}
+	h.messages = append(h.messages,
+		llm.Message{Role: llm.RoleAssistant, ToolCalls: []llm.ToolCall{call}},
+		llm.Message{Role: llm.RoleTool, Name: tool, ToolCallID: call.ID, Content: content},
+	)
+	return len(h.messages) - 1
+}
+
+// sent returns the message at index i as requests show it
+func (h *history) sent(masks map[string]string, i int) string {
+	return applyMasks(h.messages, masks)[i].Content
+}
+
+func readResultFor(path string, first, last, total int) map[string]any {
+	return map[string]any{
+		"success":         true,
+		"path":            path,
+		"content":         strings.Repeat("code\n", last-first+1),
+		"first_read_line": first,
+		"last_read_line":  last,
+		"total_lines":     total,
+	}
+}
+
+func maskingConfig() config.MaskingConfig {
+	return config.MaskingConfig{
+		Enabled: true,
+		Stride:  1,
+		Rules: map[string]config.MaskingRule{
+			"Read":  {AfterTurns: 2},
+			"Shell": {AfterTurns: 2, MaxLines: 4},
+		},
+	}
+}
+
+func TestMaskObservationsStubsOldReads(t *testing.T) {
+	h := newHistory()
+	masks := make(map[string]string)
+	old := h.turn("Read", `{"path":"a.go"}`, readResultFor("a.go", 1, 50, 120))
+	recent := h.turn("Read", `{"path":"b.go"}`, readResultFor("b.go", 1, 10, 10))
+	h.turn("Echo", `{"text":"x"}`, "ok")
+
+	if n := maskObservations(h.messages, masks, maskingConfig()); n != 1 {
+		t.Fatalf("masked = %d, want 1", n)
+	}
+	want := maskedPrefix + "Read output: file a.go lines 1-50 of 120, re-read if needed"
+	if got := h.sent(masks, old); got != want {
+		t.Errorf("old read = %q, want %q", got, want)
+	}
+	if strings.HasPrefix(h.sent(masks, recent), maskedPrefix) {
+		t.Errorf("recent read was masked: %q", h.sent(masks, recent))
+	}
+	if strings.HasPrefix(h.messages[old].Content, maskedPrefix) {
+		t.Errorf("masking changed the history: %q", h.messages[old].Content)
+	}
+
+	// A second pass leaves the history unchanged
+	before := h.sent(masks, old)
+	if n := maskObservations(h.messages, masks, maskingConfig()); n != 0 {
+		t.Errorf("second pass masked = %d, want 0", n)
+	}
+	if h.sent(masks, old) != before {
+		t.Errorf("second pass changed the stub")
+	}
+}
+
+func TestMaskObservationsLimitsShellLines(t *testing.T) {
+	var lines []string
+	for i := 1; i <= 30; i++ {
+		lines = append(lines, fmt.Sprintf("line %d", i))
+	}
+	h := newHistory()
+	masks := make(map[string]string)
+	shell := h.turn("Shell", `{"command":"go test ./..."}`, map[string]any{"stdout": strings.Join(lines, "\n"), "exit_code": 1})
+	h.turn("Echo", `{"text":"x"}`, "ok")
+	h.turn("Echo", `{"text":"y"}`, "ok")
+
+	if n := maskObservations(h.messages, masks, maskingConfig()); n != 1 {
+		t.Fatalf("masked = %d, want 1", n)
+	}
+	var result struct {
+		Stdout   string `json:"stdout"`
+		ExitCode int    `json:"exit_code"`
+	}
+	if err := json.Unmarshal([]byte(h.sent(masks, shell)), &result); err != nil {
+		t.Fatalf("masked shell result is not JSON: %v", err)
+	}
+	want := "line 1\nline 2\n... [26 lines masked] ...\nline 29\nline 30"
+	if result.Stdout != want || result.ExitCode != 1 {
+		t.Errorf("stdout = %q, exit code = %d", result.Stdout, result.ExitCode)
+	}
+
+	if n := maskObservations(h.messages, masks, maskingConfig()); n != 0 {
+		t.Errorf("second pass masked = %d, want 0", n)
+	}
+}
+
+func TestMaskObservationsFallbackRule(t *testing.T) {
+	h := newHistory()
+	masks := make(map[string]string)
+	echo := h.turn("Echo", `{"text":"hello"}`, "a long answer")
+	h.turn("Read", `{"path":"a.go"}`, readResultFor("a.go", 1, 1, 1))
+	h.turn("Read", `{"path":"b.go"}`, readResultFor("b.go", 1, 1, 1))
+
+	if n := maskObservations(h.messages, masks, maskingConfig()); n != 0 {
+		t.Fatalf("masked = %d without a fallback rule, want 0", n)
+	}
+
+	cfg := maskingConfig()
+	cfg.Rules["*"] = config.MaskingRule{AfterTurns: 2}
+	maskObservations(h.messages, masks, cfg)
+	if got := h.sent(masks, echo); !strings.HasPrefix(got, maskedPrefix+"Echo output") || !strings.Contains(got, `{"text":"hello"}`) {
+		t.Errorf("echo result = %q", got)
+	}
+}
+
+func TestMaskObservationsCollapsesReads(t *testing.T) {
+	h := newHistory()
+	masks := make(map[string]string)
+	partial := h.turn("Read", `{"path":"a.go","start":10}`, readResultFor("a.go", 10, 20, 100))
+	other := h.turn("Read", `{"path":"b.go"}`, readResultFor("b.go", 1, 100, 100))
+	full := h.turn("Read", `{"path":"./a.go"}`, readResultFor("a.go", 1, 100, 100))
+	h.turn("Edit", `{"path":"b.go"}`, map[string]any{"success": true})
+
+	cfg := maskingConfig()
+	cfg.Rules = nil
+	cfg.CollapseReads = true
+	if n := maskObservations(h.messages, masks, cfg); n != 2 {
+		t.Fatalf("masked = %d, want 2", n)
+	}
+	if got := h.sent(masks, partial); !strings.Contains(got, "superseded by a later read") {
+		t.Errorf("partial read = %q", got)
+	}
+	if got := h.sent(masks, other); !strings.Contains(got, "edited later") {
+		t.Errorf("read before edit = %q", got)
+	}
+	if strings.HasPrefix(h.sent(masks, full), maskedPrefix) {
+		t.Errorf("latest read was masked")
+	}
+}
+
+func TestMaskObservationsCollapsesReadsOnConfirm(t *testing.T) {
+	h := newHistory()
+	masks := make(map[string]string)
+	cancelled := h.turn("Read", `{"path":"a.go"}`, readResultFor("a.go", 1, 10, 10))
+	h.turn("Edit", `{"path":"a.go"}`, map[string]any{"status": "pending_confirmation", "diff": "-a\n+b"})
+	h.turn("Edit.cancel", `{}`, map[string]any{"success": true})
+	confirmed := h.turn("Read", `{"path":"b.go"}`, readResultFor("b.go", 1, 10, 10))
+	h.turn("Write", `{"path":"b.go"}`, map[string]any{"status": "pending_confirmation", "diff": "-a\n+b"})
+	h.turn("Write.confirm", `{}`, map[string]any{"success": true})
+
+	cfg := maskingConfig()
+	cfg.Rules = nil
+	cfg.CollapseReads = true
+	if n := maskObservations(h.messages, masks, cfg); n != 1 {
+		t.Fatalf("masked = %d, want 1", n)
+	}
+	if got := h.sent(masks, confirmed); !strings.Contains(got, "edited later") {
+		t.Errorf("read before a confirmed edit = %q", got)
+	}
+	if strings.HasPrefix(h.sent(masks, cancelled), maskedPrefix) {
+		t.Errorf("read before a cancelled edit was masked")
+	}
+}
+
+func TestMaskObservationsKeepsPendingEdits(t *testing.T) {
+	h := newHistory()
+	masks := make(map[string]string)
+	pending := h.turn("Edit", `{"path":"a.go"}`, map[string]any{"status": "pending_confirmation", "diff": "-a\n+b"})
+	h.turn("Echo", `{"text":"x"}`, "ok")
+	h.turn("Echo", `{"text":"y"}`, "ok")
+
+	cfg := maskingConfig()
+	cfg.Rules["*"] = config.MaskingRule{AfterTurns: 1}
+	maskObservations(h.messages, masks, cfg)
+	if strings.HasPrefix(h.sent(masks, pending), maskedPrefix) {
+		t.Errorf("pending edit was masked")
+	}
+}
+
+func TestRunnerMasksOnStride(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Masking = maskingConfig()
+	cfg.Masking.Stride = 2
+	cfg.Masking.Rules = map[string]config.MaskingRule{"Echo": {AfterTurns: 1}}
+
+	f := newRunnerFixture(t, cfg,
+		fake.ToolCall("Echo", `{"text":"first"}`),
+		fake.ToolCall("Echo", `{"text":"second"}`),
+		fake.ToolCall("Echo", `{"text":"third"}`),
+		fake.Text("done"),
+	)
+	result, _ := f.run(t)
+
+	masked := func(messages []llm.Message) int {
+		n := 0
+		for _, msg := range messages {
+			if msg.Role == llm.RoleTool && strings.HasPrefix(msg.Content, maskedPrefix) {
+				n++
+			}
+		}
+		return n
+	}
+	reqs := f.server.Requests()
+	if len(reqs) != 4 {
+		t.Fatalf("requests = %d, want 4", len(reqs))
+	}
+	// Masking runs before the third request; the fourth reuses that history unchanged
+	for i, want := range []int{0, 0, 1, 1} {
+		if got := masked(reqs[i].Messages); got != want {
+			t.Errorf("request %d: masked results = %d, want %d", i, got, want)
+		}
+	}
+	// The history the session is saved from keeps the full results
+	if got := masked(result.FinalMessages); got != 0 {
+		t.Errorf("final messages: masked results = %d, want 0", got)
+	}
+}
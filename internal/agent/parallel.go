@@ -0,0 +1,135 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kvit-s/kvit-coder/internal/llm"
+	"github.com/kvit-s/kvit-coder/internal/tools"
+)
+
+// defaultParallelReadTools caps concurrent read-only calls when agent.parallel_read_tools is unset
+const defaultParallelReadTools = 8
+
+// toolCallTimeout bounds a tool call, except for the tools hasToolTimeout exempts
+const toolCallTimeout = 15 * time.Second
+
+var errToolTimeout = fmt.Errorf("tool execution timed out after %d seconds", int(toolCallTimeout.Seconds()))
+
+// hasToolTimeout reports whether calls to the named tool are cut off after
+// toolCallTimeout. Shell commands and sub-agents run as long as they need;
+// Process.* tools bound their own waits, and a wait cut short here would lose
+// the output it read.
+func hasToolTimeout(name string) bool {
+	switch name {
+	case "Shell", "Shell.advanced", DelegateToolName:
+		return false
+	}
+	return !strings.HasPrefix(name, "Process.")
+}
+
+// prefetchedCall is the outcome of a read-only tool call run ahead of the tool loop
+type prefetchedCall struct {
+	result   any
+	err      error
+	duration time.Duration
+}
+
+// parallelReadTools returns how many read-only calls may run at the same time
+func (r *Runner) parallelReadTools() int {
+	if r.cfg.Agent.ParallelReadTools == 0 {
+		return defaultParallelReadTools
+	}
+	return r.cfg.Agent.ParallelReadTools
+}
+
+// readOnlyRun returns the end (exclusive) of the run of consecutive
+// read-only calls starting at start. Runs stop at the first mutating call, so
+// reads after it see its changes, at calls the user has to approve, and at
+// calls the tool loop rejects as duplicates of the call before them, which
+// must not run at all. lastName and lastArgs are the call before start.
+func (r *Runner) readOnlyRun(calls []llm.ToolCall, start int, lastName, lastArgs string) int {
+	end := start
+	for end < len(calls) {
+		fn := calls[end].Function
+		tool := r.registry.Get(fn.Name)
+		if tool == nil || !tools.IsReadOnly(tool) || !r.approval.AutoApproved(fn.Name, json.RawMessage(fn.Arguments)) {
+			break
+		}
+		if fn.Name == lastName && fn.Arguments == lastArgs {
+			break
+		}
+		lastName, lastArgs = fn.Name, fn.Arguments
+		end++
+	}
+	return end
+}
+
+// pendingEditState returns the pending edit state of the conversation
+func pendingEditState(messages []llm.Message) tools.PendingEditState {
+	var roles, contents, toolNames []string
+	for _, msg := range messages {
+		roles = append(roles, string(msg.Role))
+		contents = append(contents, msg.Content)
+		toolNames = append(toolNames, msg.Name) // Tool name for tool messages
+	}
+	return tools.AnalyzePendingEditState(roles, contents, toolNames)
+}
+
+// prefetchReadOnly runs the read-only calls in calls[start:end] concurrently
+// and stores their outcomes by index, returning the wall time it took. The
+// tool loop still runs its own checks for each call before using an outcome,
+// and calls whose Check fails here are left to the loop.
+func (r *Runner) prefetchReadOnly(ctx context.Context, calls []llm.ToolCall, start, end int, into map[int]prefetchedCall) time.Duration {
+	begin := time.Now()
+	// A cancel_tool request cancels the whole batch
+	batchCtx, batchDone := r.control.ToolContext(ctx)
+	defer batchDone()
+	sem := make(chan struct{}, r.parallelReadTools())
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	for idx := start; idx < end; idx++ {
+		tc := calls[idx]
+		tool := r.registry.Get(tc.Function.Name)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			args, err := tools.NormalizeToolCallArguments(tool, json.RawMessage(tc.Function.Arguments))
+			if err != nil {
+				args = json.RawMessage(tc.Function.Arguments)
+			}
+			if tool.Check(ctx, args) != nil {
+				return
+			}
+
+			toolCtx := batchCtx
+			if hasToolTimeout(tc.Function.Name) {
+				var cancel context.CancelFunc
+				toolCtx, cancel = context.WithTimeout(batchCtx, toolCallTimeout)
+				defer cancel()
+			}
+			callStart := time.Now()
+			result, err := tool.Call(toolCtx, args)
+			switch {
+			case batchCtx.Err() != nil && ctx.Err() == nil:
+				err = tools.RuntimeErrorf("cancelled by the user")
+			case toolCtx.Err() == context.DeadlineExceeded:
+				err = errToolTimeout
+			}
+
+			mu.Lock()
+			into[idx] = prefetchedCall{result: result, err: err, duration: time.Since(callStart)}
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	return time.Since(begin)
+}
@@ -0,0 +1,220 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kvit-s/kvit-coder/internal/config"
+	"github.com/kvit-s/kvit-coder/internal/llm"
+	"github.com/kvit-s/kvit-coder/internal/llm/fake"
+)
+
+// eventLog records tool activity in the order it happens
+type eventLog struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (l *eventLog) add(event string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.events = append(l.events, event)
+}
+
+func (l *eventLog) String() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return strings.Join(l.events, " ")
+}
+
+// peekTool is a slow read-only tool that tracks how many calls overlap
+type peekTool struct {
+	log     *eventLog
+	delay   time.Duration
+	mu      sync.Mutex
+	running int
+	peak    int
+}
+
+func (t *peekTool) Name() string        { return "Peek" }
+func (t *peekTool) Description() string { return "Look at something" }
+func (t *peekTool) JSONSchema() map[string]any {
+	return map[string]any{
+		"type":       "object",
+		"properties": map[string]any{"text": map[string]any{"type": "string"}},
+	}
+}
+func (t *peekTool) Check(ctx context.Context, args json.RawMessage) error { return nil }
+func (t *peekTool) Call(ctx context.Context, args json.RawMessage) (any, error) {
+	var in struct {
+		Text string `json:"text"`
+	}
+	_ = json.Unmarshal(args, &in)
+
+	t.mu.Lock()
+	t.running++
+	t.peak = max(t.peak, t.running)
+	t.mu.Unlock()
+	t.log.add("peek:" + in.Text)
+	time.Sleep(t.delay)
+	t.mu.Lock()
+	t.running--
+	t.mu.Unlock()
+	return map[string]any{"seen": in.Text}, nil
+}
+func (t *peekTool) PromptSection() string  { return "" }
+func (t *peekTool) PromptCategory() string { return "filesystem" }
+func (t *peekTool) PromptOrder() int       { return 0 }
+func (t *peekTool) ReadOnly() bool         { return true }
+
+// markTool is a mutating tool that logs when it runs
+type markTool struct {
+	log *eventLog
+}
+
+func (t *markTool) Name() string        { return "Mark" }
+func (t *markTool) Description() string { return "Change something" }
+func (t *markTool) JSONSchema() map[string]any {
+	return map[string]any{"type": "object", "properties": map[string]any{}}
+}
+func (t *markTool) Check(ctx context.Context, args json.RawMessage) error { return nil }
+func (t *markTool) Call(ctx context.Context, args json.RawMessage) (any, error) {
+	t.log.add("mark")
+	return map[string]any{"success": true}, nil
+}
+func (t *markTool) PromptSection() string  { return "" }
+func (t *markTool) PromptCategory() string { return "filesystem" }
+func (t *markTool) PromptOrder() int       { return 1 }
+
+func newParallelFixture(t *testing.T, cfg *config.Config, delay time.Duration, steps ...fake.Step) (*runnerFixture, *peekTool, *eventLog) {
+	t.Helper()
+	log := &eventLog{}
+	peek := &peekTool{log: log, delay: delay}
+	f := newRunnerFixture(t, cfg, steps...)
+	f.runner.registry.Enable(peek)
+	f.runner.registry.Enable(&markTool{log: log})
+	return f, peek, log
+}
+
+func TestRunExecutesReadOnlyCallsConcurrently(t *testing.T) {
+	f, peek, _ := newParallelFixture(t, nil, 100*time.Millisecond,
+		fake.ToolCall("Peek", `{"text":"a"}`).
+			WithToolCall("Peek", `{"text":"b"}`).
+			WithToolCall("Peek", `{"text":"c"}`).
+			WithToolCall("Peek", `{"text":"d"}`),
+		fake.Text("done"),
+	)
+
+	start := time.Now()
+	result, err := f.run(t)
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 350*time.Millisecond {
+		t.Errorf("run took %v, want the four 100ms calls to overlap", elapsed)
+	}
+	if peek.peak != 4 {
+		t.Errorf("peak concurrency = %d, want 4", peek.peak)
+	}
+
+	// Results keep the order of the tool calls
+	var seen []string
+	for _, msg := range result.FinalMessages {
+		if msg.Role == llm.RoleTool {
+			var out struct {
+				Seen string `json:"seen"`
+			}
+			_ = json.Unmarshal([]byte(msg.Content), &out)
+			seen = append(seen, out.Seen)
+		}
+	}
+	if got := strings.Join(seen, ","); got != "a,b,c,d" {
+		t.Errorf("results = %s, want a,b,c,d", got)
+	}
+}
+
+func TestRunSerializesAroundMutatingCalls(t *testing.T) {
+	f, peek, log := newParallelFixture(t, nil, 20*time.Millisecond,
+		fake.ToolCall("Peek", `{"text":"a"}`).
+			WithToolCall("Peek", `{"text":"b"}`).
+			WithToolCall("Mark", `{}`).
+			WithToolCall("Peek", `{"text":"c"}`).
+			WithToolCall("Peek", `{"text":"d"}`),
+		fake.Text("done"),
+	)
+
+	if _, err := f.run(t); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	events := strings.Fields(log.String())
+	if len(events) != 5 || events[2] != "mark" {
+		t.Fatalf("events = %v, want two peeks, mark, two peeks", events)
+	}
+	if before := strings.Join(events[:2], " "); !strings.Contains(before, "peek:a") || !strings.Contains(before, "peek:b") {
+		t.Errorf("events before mark = %v", events[:2])
+	}
+	if peek.peak != 2 {
+		t.Errorf("peak concurrency = %d, want 2", peek.peak)
+	}
+}
+
+func TestRunParallelReadToolsOff(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Agent.ParallelReadTools = 1
+	f, peek, log := newParallelFixture(t, cfg, 10*time.Millisecond,
+		fake.ToolCall("Peek", `{"text":"a"}`).
+			WithToolCall("Peek", `{"text":"b"}`).
+			WithToolCall("Peek", `{"text":"c"}`),
+		fake.Text("done"),
+	)
+
+	if _, err := f.run(t); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if peek.peak != 1 || log.String() != "peek:a peek:b peek:c" {
+		t.Errorf("peak = %d, events = %s", peek.peak, log.String())
+	}
+}
+
+func TestRunDoesNotPrefetchRejectedCalls(t *testing.T) {
+	// The second call duplicates the first, so it must not run
+	f, _, log := newParallelFixture(t, nil, 10*time.Millisecond,
+		fake.ToolCall("Peek", `{"text":"a"}`).
+			WithToolCall("Peek", `{"text":"a"}`).
+			WithToolCall("Peek", `{"text":"b"}`),
+		fake.Text("done"),
+	)
+	if _, err := f.run(t); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if events := strings.Fields(log.String()); len(events) != 2 {
+		t.Errorf("events = %v, want the duplicate left out", events)
+	}
+
+	// While an edit is pending, every call but confirm and cancel is blocked
+	f, _, log = newParallelFixture(t, nil, 10*time.Millisecond,
+		fake.ToolCall("Peek", `{"text":"a"}`).
+			WithToolCall("Peek", `{"text":"b"}`),
+		fake.Text("done"),
+	)
+	edit := llm.ToolCall{ID: "e1", Type: "function"}
+	edit.Function.Name, edit.Function.Arguments = "Edit", `{}`
+	_, err := f.runner.Run(context.Background(), RunConfig{
+		Messages: []llm.Message{
+			{Role: llm.RoleUser, Content: "do the task"},
+			{Role: llm.RoleAssistant, ToolCalls: []llm.ToolCall{edit}},
+			{Role: llm.RoleTool, Name: "Edit", ToolCallID: "e1", Content: `{"pending_confirmation": true, "path": "a.go"}`},
+		},
+		QuietMode: true,
+	})
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if log.String() != "" {
+		t.Errorf("events = %s, want the blocked calls not run", log.String())
+	}
+}
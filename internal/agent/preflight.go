@@ -0,0 +1,110 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/kvit-s/kvit-coder/internal/events"
+	"github.com/kvit-s/kvit-coder/internal/llm"
+)
+
+// Context actions for requests estimated to overflow the context window
+const (
+	ContextActionTruncate = "truncate"
+	ContextActionWarn     = "warn"
+	ContextActionOff      = "off"
+)
+
+// minToolOutputTokens is how much of a tool output truncation always keeps
+const minToolOutputTokens = 200
+
+// truncationSlack covers the truncation note and words cut in half
+const truncationSlack = 50
+
+// contextBudget returns the prompt tokens that fit next to the response.
+// Estimates that don't come from the model's tokenizer get a 10% margin.
+func (r *Runner) contextBudget() int {
+	budget := r.cfg.LLM.Context
+	if r.cfg.LLM.MaxTokens > 0 && r.cfg.LLM.MaxTokens < budget {
+		budget -= r.cfg.LLM.MaxTokens
+	}
+	if !r.tokens.Exact() {
+		budget = budget * 9 / 10
+	}
+	return budget
+}
+
+// preflightContext estimates the size of the next request and, when it would
+// overflow the context window, shortens the newest tool outputs or warns,
+// before the server rejects the request with a 400. The request is estimated
+// with the masked results from masks.
+func (r *Runner) preflightContext(ctx context.Context, messages []llm.Message, masks map[string]string) []llm.Message {
+	if r.tokens == nil || r.cfg.LLM.Context <= 0 || r.cfg.LLM.ContextAction == ContextActionOff {
+		return messages
+	}
+
+	estimate, err := r.tokens.RequestTokens(ctx, r.chatRequest(applyMasks(messages, masks)))
+	if err != nil {
+		r.notify(events.LevelDebug, events.TopicContext, fmt.Sprintf("Token estimate failed: %v", err))
+		return messages
+	}
+	budget := r.contextBudget()
+	if estimate <= budget {
+		return messages
+	}
+
+	if r.cfg.LLM.ContextAction == ContextActionWarn {
+		r.notify(events.LevelWarn, events.TopicContext, fmt.Sprintf("Request is ~%d tokens, ~%d over the context budget of %d (%s estimate)",
+			estimate, estimate-budget, budget, r.tokens.Name()))
+		return messages
+	}
+
+	// Truncate the newest tool outputs first: they caused the growth and the
+	// model has not seen them yet. Proportional cuts are approximate, so
+	// re-estimate and cut again a couple of times if needed.
+	initial := estimate
+	truncated := make(map[int]bool)
+	for pass := 0; pass < 3 && estimate > budget; pass++ {
+		over := estimate - budget
+		for j := len(messages) - 1; j >= 0 && messages[j].Role == llm.RoleTool && over > 0; j-- {
+			size, err := r.tokens.Count(ctx, messages[j].Content)
+			if err != nil || size <= minToolOutputTokens {
+				continue
+			}
+			keep := max(size-over-truncationSlack, minToolOutputTokens)
+			messages[j].Content = truncateMiddle(messages[j].Content, float64(keep)/float64(size))
+			over -= size - keep
+			truncated[j] = true
+		}
+		if len(truncated) == 0 {
+			break
+		}
+		if estimate, err = r.tokens.RequestTokens(ctx, r.chatRequest(applyMasks(messages, masks))); err != nil {
+			break
+		}
+	}
+
+	if len(truncated) > 0 {
+		r.notify(events.LevelWarn, events.TopicContext, fmt.Sprintf("Request would exceed the context window (~%d tokens, budget %d) - truncated %d tool output(s)",
+			initial, budget, len(truncated)))
+	}
+	if err == nil && estimate > budget {
+		r.notify(events.LevelWarn, events.TopicContext, fmt.Sprintf("Request is still ~%d tokens over the context budget of %d", estimate-budget, budget))
+	}
+	return messages
+}
+
+// truncateMiddle keeps about ratio of content, split between its head and
+// tail, with a note in place of the removed middle
+func truncateMiddle(content string, ratio float64) string {
+	runes := []rune(content)
+	keep := int(float64(len(runes)) * ratio)
+	if keep >= len(runes) {
+		return content
+	}
+	head := keep * 2 / 3
+	tail := keep - head
+	return string(runes[:head]) +
+		fmt.Sprintf("\n\n[... %d characters of output removed to fit the context window ...]\n\n", len(runes)-keep) +
+		string(runes[len(runes)-tail:])
+}
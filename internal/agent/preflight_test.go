@@ -0,0 +1,69 @@
+package agent
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/kvit-s/kvit-coder/internal/config"
+	"github.com/kvit-s/kvit-coder/internal/llm/fake"
+	"github.com/kvit-s/kvit-coder/internal/tokenizer"
+)
+
+func hugeEchoCall() fake.Step {
+	return fake.ToolCall("Echo", `{"text":"lorem ipsum dolor ","times":2000}`)
+}
+
+func TestPreflightTruncatesNewestToolOutput(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.LLM.Context = 2000
+	f := newRunnerFixture(t, cfg, hugeEchoCall(), fake.Text("done"))
+	f.runner.tokens = tokenizer.NewCounter(tokenizer.NewHeuristic("qwen"))
+
+	if _, err := f.run(t); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	req := f.server.Requests()[1]
+	toolMsg := lastMessage(req.Messages)
+	if n := strings.Count(toolMsg.Content, "removed to fit the context window"); n != 1 {
+		t.Fatalf("tool output has %d truncation notes, want 1 (%d chars)", n, len(toolMsg.Content))
+	}
+	if !strings.HasPrefix(toolMsg.Content, "{") {
+		t.Errorf("truncation should keep the head of the output, got %.20q", toolMsg.Content)
+	}
+
+	estimate, _ := f.runner.tokens.RequestTokens(context.Background(), req)
+	if budget := f.runner.contextBudget(); estimate > budget {
+		t.Errorf("request estimate %d exceeds budget %d after truncation", estimate, budget)
+	}
+}
+
+func TestPreflightWarnOnly(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.LLM.Context = 2000
+	cfg.LLM.ContextAction = ContextActionWarn
+	f := newRunnerFixture(t, cfg, hugeEchoCall(), fake.Text("done"))
+	f.runner.tokens = tokenizer.NewCounter(tokenizer.NewHeuristic("qwen"))
+
+	if _, err := f.run(t); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	toolMsg := lastMessage(f.server.Requests()[1].Messages)
+	if strings.Contains(toolMsg.Content, "removed to fit") {
+		t.Error("warn mode should not modify tool output")
+	}
+}
+
+func TestTruncateMiddle(t *testing.T) {
+	content := strings.Repeat("é", 1000)
+	got := truncateMiddle(content, 0.3)
+	if !strings.Contains(got, "700 characters of output removed") {
+		t.Errorf("truncateMiddle() note = %q", got[600:700])
+	}
+	if strings.Count(got, "é") != 300 {
+		t.Errorf("kept %d runes, want 300", strings.Count(got, "é"))
+	}
+	if truncateMiddle("short", 1) != "short" {
+		t.Error("ratio 1 should keep content unchanged")
+	}
+}
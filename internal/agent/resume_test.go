@@ -0,0 +1,82 @@
+package agent
+
+import (
+	"context"
+	"testing"
+
+	"github.com/kvit-s/kvit-coder/internal/llm"
+	"github.com/kvit-s/kvit-coder/internal/llm/fake"
+	"github.com/kvit-s/kvit-coder/internal/session"
+)
+
+func TestRunSavesStateAfterToolRounds(t *testing.T) {
+	f := newRunnerFixture(t, nil,
+		fake.ToolCall("Echo", `{"text":"a"}`).WithUsage(100, 10),
+		fake.Text("done"),
+	)
+
+	var states []session.RunState
+	_, err := f.runner.Run(context.Background(), RunConfig{
+		Messages:  []llm.Message{{Role: llm.RoleUser, Content: "do the task"}},
+		QuietMode: true,
+		SaveState: func(s *session.RunState) error {
+			states = append(states, *s)
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	// One save before the first request and one after the tool round
+	if len(states) != 2 {
+		t.Fatalf("states = %d, want 2", len(states))
+	}
+	if states[0].Iteration != 0 || len(states[0].Messages) != 1 {
+		t.Errorf("initial state = iteration %d, %d messages; want 0, 1", states[0].Iteration, len(states[0].Messages))
+	}
+	round := states[1]
+	if round.Iteration != 1 || round.Stats.Steps != 1 || round.Stats.TotalPromptTokens != 100 {
+		t.Errorf("state after the round = iteration %d, %d steps, %d prompt tokens; want 1, 1, 100",
+			round.Iteration, round.Stats.Steps, round.Stats.TotalPromptTokens)
+	}
+	if got := lastMessage(round.Messages); got.Role != llm.RoleTool || got.Name != "Echo" {
+		t.Errorf("last saved message = %+v, want the Echo result", got)
+	}
+}
+
+func TestRunResumesFromState(t *testing.T) {
+	call := llm.ToolCall{ID: "call_1", Type: "function"}
+	call.Function.Name = "Echo"
+	call.Function.Arguments = `{"text":"a"}`
+	state := &session.RunState{
+		Messages: []llm.Message{
+			{Role: llm.RoleUser, Content: "do the task"},
+			{Role: llm.RoleAssistant, ToolCalls: []llm.ToolCall{call}},
+			{Role: llm.RoleTool, Name: "Echo", ToolCallID: "call_1", Content: `{"echo":"a"}`},
+		},
+		Iteration: 1,
+	}
+	state.Stats.Steps = 1
+	state.Stats.TotalPromptTokens = 100
+
+	f := newRunnerFixture(t, nil, fake.Text("picked up where I left off").WithUsage(50, 5))
+	result, err := f.runner.Run(context.Background(), RunConfig{QuietMode: true, Resume: state})
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	requests := f.server.Requests()
+	if len(requests) != 1 {
+		t.Fatalf("requests = %d, want 1", len(requests))
+	}
+	if n := len(requests[0].Messages); n != 3 {
+		t.Errorf("resumed request has %d messages, want the 3 saved ones", n)
+	}
+	if result.Stats.Steps != 2 || result.Stats.TotalPromptTokens != 150 {
+		t.Errorf("stats = %d steps, %d prompt tokens; want 2, 150", result.Stats.Steps, result.Stats.TotalPromptTokens)
+	}
+	if got := lastMessage(result.FinalMessages); got.Content != "picked up where I left off" {
+		t.Errorf("last message = %+v", got)
+	}
+}
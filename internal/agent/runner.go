@@ -4,15 +4,22 @@ package agent
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/kvit-s/kvit-coder/internal/approval"
 	"github.com/kvit-s/kvit-coder/internal/checkpoint"
 	"github.com/kvit-s/kvit-coder/internal/config"
 	ctxtools "github.com/kvit-s/kvit-coder/internal/context"
+	"github.com/kvit-s/kvit-coder/internal/control"
+	"github.com/kvit-s/kvit-coder/internal/events"
 	"github.com/kvit-s/kvit-coder/internal/llm"
+	"github.com/kvit-s/kvit-coder/internal/session"
 	"github.com/kvit-s/kvit-coder/internal/stats"
+	"github.com/kvit-s/kvit-coder/internal/tokenizer"
 	"github.com/kvit-s/kvit-coder/internal/tools"
 	"github.com/kvit-s/kvit-coder/internal/ui"
 )
@@ -20,7 +27,7 @@ import (
 // Runner executes the agent loop for LLM interactions
 type Runner struct {
 	cfg               *config.Config
-	llmClient         *llm.Client
+	llmClient         llm.Provider
 	registry          *tools.Registry
 	writer            *ui.Writer
 	logger            *Logger
@@ -28,12 +35,16 @@ type Runner struct {
 	contextMgr        *ctxtools.Manager
 	contextMiddleware *ctxtools.Middleware
 	planManager       *tools.PlanManager
+	tokens            *tokenizer.Counter
+	events            *events.Bus
+	approval          *approval.Gate
+	control           *control.Server
 }
 
 // RunnerOptions contains all dependencies for creating a Runner
 type RunnerOptions struct {
 	Cfg               *config.Config
-	LLMClient         *llm.Client
+	LLMClient         llm.Provider
 	Registry          *tools.Registry
 	Writer            *ui.Writer
 	Logger            *Logger
@@ -41,6 +52,10 @@ type RunnerOptions struct {
 	ContextMgr        *ctxtools.Manager
 	ContextMiddleware *ctxtools.Middleware
 	PlanManager       *tools.PlanManager
+	Tokens            *tokenizer.Counter // Estimates request size for the pre-flight context check (nil = off)
+	Events            *events.Bus        // Receives the runner's events; Writer is subscribed as the terminal renderer (nil = new bus)
+	Approval          *approval.Gate     // Decides which tool calls may run (nil = all)
+	Control           *control.Server    // Steers the run from another process (nil = off)
 }
 
 // RunConfig contains per-run configuration options
@@ -48,6 +63,12 @@ type RunConfig struct {
 	Messages     []llm.Message
 	UseFileFirst bool
 	QuietMode    bool
+
+	// SaveState persists the run's progress before the first request and
+	// after every tool round (nil = not saved)
+	SaveState func(*session.RunState) error
+	// Resume continues a run from its saved state; Messages is then ignored
+	Resume *session.RunState
 }
 
 // RunResult contains the results of running the agent loop
@@ -55,10 +76,20 @@ type RunResult struct {
 	Stats         *stats.AgentStats
 	FinalMessages []llm.Message
 	Cancelled     bool
+	StopReason    StopReason
+	Compactions   []session.Compaction // Older turns replaced by summaries, to save with the session
 }
 
 // NewRunner creates a new agent runner
 func NewRunner(opts RunnerOptions) *Runner {
+	bus := opts.Events
+	if bus == nil {
+		bus = events.NewBus()
+	}
+	if opts.Writer != nil {
+		bus.Subscribe(ui.NewTerminalSink(opts.Writer, opts.Cfg.Workspace.Root))
+	}
+
 	return &Runner{
 		cfg:               opts.Cfg,
 		llmClient:         opts.LLMClient,
@@ -69,9 +100,23 @@ func NewRunner(opts RunnerOptions) *Runner {
 		contextMgr:        opts.ContextMgr,
 		contextMiddleware: opts.ContextMiddleware,
 		planManager:       opts.PlanManager,
+		tokens:            opts.Tokens,
+		events:            bus,
+		approval:          opts.Approval,
+		control:           opts.Control,
 	}
 }
 
+// Events returns the bus the runner publishes its events on
+func (r *Runner) Events() *events.Bus {
+	return r.events
+}
+
+// notify publishes something the run reports along the way
+func (r *Runner) notify(level, topic, message string) {
+	r.events.Publish(events.Notice{Level: level, Topic: topic, Message: message})
+}
+
 // backtrackResult contains the result of handleToolError
 type backtrackResult struct {
 	shouldBacktrack   bool
@@ -86,6 +131,10 @@ type backtrackResult struct {
 func (r *Runner) Run(ctx context.Context, rcfg RunConfig) (*RunResult, error) {
 	messages := rcfg.Messages
 
+	// An abort from the control socket cancels the run
+	ctx, cancelRun := r.control.Attach(ctx)
+	defer cancelRun()
+
 	// Reset loop detection state on new user input
 	loopDetector := NewLoopDetector()
 
@@ -123,6 +172,25 @@ func (r *Runner) Run(ctx context.Context, rcfg RunConfig) (*RunResult, error) {
 	var emptyReasoningRetries int
 	const maxEmptyReasoningRetries = 3
 
+	// Stop trying to compact after a failed summary, so a broken model isn't asked every iteration
+	compactionFailed := false
+
+	// Assistant turn count at the last masking pass, and the masked tool
+	// results by call ID. Masks apply to requests only; messages keeps the
+	// full results for the saved session.
+	lastMaskTurn := 0
+	masks := make(map[string]string)
+
+	// Set once a budget runs out; the next response is the last
+	wrappingUp := false
+
+	// Loop warnings given so far
+	loopInterventions := 0
+
+	// Failed verifications sent back to the model so far
+	verifyFeedback := 0
+	verifyFailed := false
+
 	// Track overall timing stats
 	requestStartTime := time.Now()
 	var totalLLMTime time.Duration
@@ -141,19 +209,118 @@ func (r *Runner) Run(ctx context.Context, rcfg RunConfig) (*RunResult, error) {
 		Cancelled: false,
 	}
 
-	for i := 0; i < maxIters; i++ {
+	// A resumed run continues with the counters it had when it stopped
+	start := 0
+	if st := rcfg.Resume; st != nil {
+		messages = st.Messages
+		start = st.Iteration
+		*agentStats = st.Stats
+		requestStartTime = time.Now().Add(-st.Elapsed)
+		totalLLMTime = st.Stats.TotalLLMTime
+		totalToolTime = st.Stats.TotalToolTime
+		loopInterventions = st.LoopInterventions
+		verifyFeedback = st.VerifyRounds
+		result.Compactions = st.Compactions
+		tools.RestorePending(st.Pending)
+	}
+
+	// Saves the progress so far, to resume from the next iteration
+	saveState := func(next int) {
+		if rcfg.SaveState == nil {
+			return
+		}
+		agentStats.TotalAgentTime = time.Since(requestStartTime)
+		agentStats.TotalLLMTime = totalLLMTime
+		agentStats.TotalToolTime = totalToolTime
+		state := &session.RunState{
+			Messages:          messages,
+			Iteration:         next,
+			Stats:             *agentStats,
+			Elapsed:           agentStats.TotalAgentTime,
+			LoopInterventions: loopInterventions,
+			VerifyRounds:      verifyFeedback,
+			Pending:           tools.SnapshotPending(),
+			Compactions:       result.Compactions,
+			UpdatedAt:         time.Now(),
+		}
+		if r.checkpointMgr != nil && r.checkpointMgr.Enabled() {
+			state.CheckpointSession = r.checkpointMgr.SessionID()
+			state.CheckpointTurn = r.checkpointMgr.CurrentTurn()
+		}
+		if err := rcfg.SaveState(state); err != nil {
+			r.notify(events.LevelWarn, events.TopicState, fmt.Sprintf("Failed to save run state: %v", err))
+		}
+	}
+	if rcfg.Resume == nil {
+		saveState(0)
+	}
+
+	for i := start; i < maxIters; i++ {
 		r.logger.AgentIteration(i, 0)
 
+		// Give the model one last turn, without tools, once a budget is used up
+		if !wrappingUp {
+			if reason := r.budgetExceeded(agentStats, time.Since(requestStartTime)); reason != "" {
+				r.notify(events.LevelWarn, events.TopicBudget, fmt.Sprintf("Budget exhausted (%s) - asking the model to wrap up", reason))
+				messages = append(messages, wrapUpMessage(reason))
+				wrappingUp = true
+			}
+		}
+
+		// Steering from the control socket takes effect between iterations
+		if r.control.Paused() {
+			r.notify(events.LevelInfo, events.TopicControl, "Paused - waiting for resume")
+			r.control.WaitWhilePaused(ctx)
+		}
+		for _, text := range r.control.TakeMessages() {
+			messages = appendUserMessage(messages, text)
+			r.events.Publish(events.UserMessage{Content: text})
+		}
+
 		// File-first mode: read messages from file at start of each iteration
 		if rcfg.UseFileFirst && r.contextMgr != nil {
 			fileMessages, err := r.contextMgr.ReadMessagesForLLM()
 			if err != nil {
-				r.writer.Error(fmt.Sprintf("Failed to read messages from file: %v", err))
+				r.notify(events.LevelError, events.TopicState, fmt.Sprintf("Failed to read messages from file: %v", err))
 			} else {
 				messages = fileMessages
 			}
 		}
 
+		// Mask stale tool results. Passes run only every few turns and leave
+		// the history alone in between, so the server's prompt cache stays valid.
+		if r.cfg.Masking.Enabled && !rcfg.UseFileFirst {
+			turns := countAssistantTurns(messages)
+			if turns-lastMaskTurn >= r.cfg.Masking.Stride {
+				if n := maskObservations(messages, masks, r.cfg.Masking); n > 0 {
+					r.notify(events.LevelDebug, events.TopicMasking, fmt.Sprintf("Masked %d stale tool results", n))
+				}
+				lastMaskTurn = turns
+			}
+		}
+
+		// Summarize older turns when nearing the context window
+		if !rcfg.UseFileFirst && !compactionFailed {
+			if usage, due := r.compactionDue(ctx, applyMasks(messages, masks), totalTokens); due {
+				r.notify(events.LevelInfo, events.TopicCompaction, fmt.Sprintf("Context at ~%d of %d tokens - compacting older turns...", usage, r.cfg.LLM.Context))
+				compacted, record, err := r.compact(ctx, messages, usage, agentStats)
+				switch {
+				case errors.Is(err, errNothingToCompact):
+					// Too few messages to summarize yet
+				case err != nil:
+					r.notify(events.LevelWarn, events.TopicCompaction, fmt.Sprintf("Compaction failed: %v", err))
+					compactionFailed = true
+				default:
+					messages = compacted
+					result.Compactions = append(result.Compactions, *record)
+					// The last reported usage predates the compaction
+					totalTokens = record.TokensAfter
+					lastMaskTurn = countAssistantTurns(messages)
+					r.notify(events.LevelInfo, events.TopicCompaction, fmt.Sprintf("Compacted %d messages into a summary", len(record.Replaced)))
+				}
+			}
+		}
+
 		// Save current history length for potential rollback (backtrack mode)
 		rollbackPoint := len(messages)
 
@@ -175,11 +342,18 @@ func (r *Runner) Run(ctx context.Context, rcfg RunConfig) (*RunResult, error) {
 		cleanup := func() {}
 		_ = cleanup // Mark cleanup as used (kept for future use)
 
+		// Keep the request inside the context window before the server rejects it
+		messages = r.preflightContext(iterCtx, messages, masks)
+		reqMessages := applyMasks(messages, masks)
+
 		// Call LLM with tools
+		r.events.Publish(events.LLMRequestStarted{Iteration: i, Messages: len(messages)})
 		r.writer.ToolProgress("✨ ")
 
 		startTime := time.Now()
 		llmDone := make(chan bool)
+		firstToken := make(chan struct{})
+		var firstTokenOnce sync.Once
 		llmDotCount := 0
 		go func() {
 			ticker := time.NewTicker(1 * time.Second)
@@ -189,35 +363,42 @@ func (r *Runner) Run(ctx context.Context, rcfg RunConfig) (*RunResult, error) {
 				case <-ticker.C:
 					r.writer.ToolProgress(".")
 					llmDotCount++
+				case <-firstToken:
+					// Streamed tokens replace the progress dots
+					return
 				case <-llmDone:
 					return
 				}
 			}
 		}()
 
-		resp, err := r.llmClient.Chat(iterCtx, llm.ChatRequest{
-			Model:       r.cfg.LLM.Model,
-			Messages:    messages,
-			Tools:       r.registry.Specs(),
-			ToolChoice:  "auto",
-			Temperature: r.cfg.LLM.Temperature,
-			MaxTokens:   r.cfg.LLM.MaxTokens,
-			Stream:      false,
+		streamed := false
+		req := r.chatRequest(reqMessages)
+		if wrappingUp {
+			req = withoutTools(req)
+		}
+		resp, err := r.chat(iterCtx, req, func(delta llm.StreamDelta) {
+			firstTokenOnce.Do(func() { close(firstToken) })
+			streamed = true
+			r.writer.StreamReasoning(delta.ReasoningContent)
+			r.writer.StreamContent(delta.Content)
 		})
 		close(llmDone)
+		r.writer.StreamEnd()
 		time.Sleep(10 * time.Millisecond)
 		duration := time.Since(startTime)
 		totalLLMTime += duration
 
-		// Print newline after sparkles/dots before showing response
-		if llmDotCount == 0 {
+		// Print newline after sparkles/dots before showing response; stdout
+		// carries only machine-readable output in JSON modes
+		if llmDotCount == 0 && !r.writer.IsJSONMode() {
 			fmt.Print("\n")
 		}
 
 		if err != nil {
 			// Check if it was a cancellation
 			if iterCtx.Err() == context.Canceled {
-				r.writer.Info("LLM call cancelled - returning to prompt")
+				r.notify(events.LevelInfo, events.TopicControl, "LLM call cancelled - returning to prompt")
 
 				// If the last message is a tool result, add a dummy assistant message
 				if len(messages) > 0 && messages[len(messages)-1].Role == llm.RoleTool {
@@ -231,6 +412,7 @@ func (r *Runner) Run(ctx context.Context, rcfg RunConfig) (*RunResult, error) {
 				agentStats.TotalLLMTime = totalLLMTime
 				agentStats.TotalToolTime = totalToolTime
 				result.Cancelled = true
+				result.StopReason = StopCancelled
 				result.FinalMessages = messages
 
 				cleanup()
@@ -242,7 +424,7 @@ func (r *Runner) Run(ctx context.Context, rcfg RunConfig) (*RunResult, error) {
 			errStr := err.Error()
 			if strings.Contains(errStr, "API error 400") && contextOverflowRetries < maxContextOverflowRetries {
 				contextOverflowRetries++
-				r.writer.Warn(fmt.Sprintf("Server error on request (attempt %d/%d) - replacing tool output and retrying...",
+				r.notify(events.LevelWarn, events.TopicRetry, fmt.Sprintf("Server error on request (attempt %d/%d) - replacing tool output and retrying...",
 					contextOverflowRetries, maxContextOverflowRetries))
 
 				// Replace all recent tool result messages with server error
@@ -261,18 +443,19 @@ func (r *Runner) Run(ctx context.Context, rcfg RunConfig) (*RunResult, error) {
 
 				// Check if we've exhausted "different approach" attempts
 				if differentApproachAttempts >= maxDifferentApproachAttempts {
-					r.writer.Error(fmt.Sprintf("Server error persists after %d attempts - giving up. Last error: %s",
-						maxDifferentApproachAttempts, errStr))
+					r.events.Publish(events.Error{Message: fmt.Sprintf("Server error persists after %d attempts - giving up. Last error: %s",
+						maxDifferentApproachAttempts, errStr)})
 					agentStats.TotalAgentTime = time.Since(requestStartTime)
 					agentStats.TotalLLMTime = totalLLMTime
 					agentStats.TotalToolTime = totalToolTime
+					result.StopReason = StopError
 					result.FinalMessages = messages
 					cleanup()
 					cancelOnce()
 					return result, fmt.Errorf("persistent server error: %s", errStr)
 				}
 
-				r.writer.Warn(fmt.Sprintf("Server error persists after %d retries - asking LLM to try a different approach (%d/%d)",
+				r.notify(events.LevelWarn, events.TopicRetry, fmt.Sprintf("Server error persists after %d retries - asking LLM to try a different approach (%d/%d)",
 					maxContextOverflowRetries, differentApproachAttempts, maxDifferentApproachAttempts))
 
 				for j := len(messages) - 1; j >= 0 && messages[j].Role == llm.RoleTool; j-- {
@@ -292,12 +475,13 @@ func (r *Runner) Run(ctx context.Context, rcfg RunConfig) (*RunResult, error) {
 				continue
 			}
 
-			r.writer.Error(fmt.Sprintf("%v", err))
+			r.events.Publish(events.Error{Message: err.Error()})
 			r.logger.Error("LLM call failed", err)
 
 			agentStats.TotalAgentTime = time.Since(requestStartTime)
 			agentStats.TotalLLMTime = totalLLMTime
 			agentStats.TotalToolTime = totalToolTime
+			result.StopReason = StopError
 			result.FinalMessages = messages
 
 			cleanup()
@@ -307,11 +491,12 @@ func (r *Runner) Run(ctx context.Context, rcfg RunConfig) (*RunResult, error) {
 
 		// Extract assistant message
 		if len(resp.Choices) == 0 {
-			r.writer.Error("No response from model")
+			r.events.Publish(events.Error{Message: "No response from model"})
 
 			agentStats.TotalAgentTime = time.Since(requestStartTime)
 			agentStats.TotalLLMTime = totalLLMTime
 			agentStats.TotalToolTime = totalToolTime
+			result.StopReason = StopError
 			result.FinalMessages = messages
 
 			cleanup()
@@ -322,29 +507,28 @@ func (r *Runner) Run(ctx context.Context, rcfg RunConfig) (*RunResult, error) {
 		// Check for upstream provider error
 		if resp.Choices[0].Error != nil {
 			choiceErr := resp.Choices[0].Error
-			r.writer.Warn(fmt.Sprintf("Provider error (code %d): %s - retrying...", choiceErr.Code, choiceErr.Message))
+			r.notify(events.LevelWarn, events.TopicRetry, fmt.Sprintf("Provider error (code %d): %s - retrying...", choiceErr.Code, choiceErr.Message))
 
 			retryStart := time.Now()
-			retryResp, retryErr := r.llmClient.Chat(iterCtx, llm.ChatRequest{
-				Model:       r.cfg.LLM.Model,
-				Messages:    messages,
-				Tools:       r.registry.Specs(),
-				ToolChoice:  "auto",
-				Temperature: r.cfg.LLM.Temperature,
-				MaxTokens:   r.cfg.LLM.MaxTokens,
-				Stream:      false,
+			streamed = false
+			retryResp, retryErr := r.chat(iterCtx, req, func(delta llm.StreamDelta) {
+				streamed = true
+				r.writer.StreamReasoning(delta.ReasoningContent)
+				r.writer.StreamContent(delta.Content)
 			})
+			r.writer.StreamEnd()
 			totalLLMTime += time.Since(retryStart)
 
 			if retryErr != nil || len(retryResp.Choices) == 0 || retryResp.Choices[0].Error != nil {
 				consecutiveProviderFailures++
 
 				if consecutiveProviderFailures >= maxProviderFailures {
-					r.writer.Error(fmt.Sprintf("Provider failed %d times consecutively - stopping", consecutiveProviderFailures))
+					r.events.Publish(events.Error{Message: fmt.Sprintf("Provider failed %d times consecutively - stopping", consecutiveProviderFailures)})
 
 					agentStats.TotalAgentTime = time.Since(requestStartTime)
 					agentStats.TotalLLMTime = totalLLMTime
 					agentStats.TotalToolTime = totalToolTime
+					result.StopReason = StopError
 					result.FinalMessages = messages
 
 					cleanup()
@@ -372,11 +556,16 @@ func (r *Runner) Run(ctx context.Context, rcfg RunConfig) (*RunResult, error) {
 			}
 
 			resp = retryResp
-			r.writer.Info("Retry succeeded")
+			r.notify(events.LevelInfo, events.TopicRetry, "Retry succeeded")
 		}
 
 		consecutiveProviderFailures = 0
 
+		// Complete responses cut off at the output token limit
+		if resp.Choices[0].FinishReason == "length" {
+			resp = r.completeTruncated(iterCtx, reqMessages, resp, agentStats)
+		}
+
 		assistantMsg := resp.Choices[0].Message
 
 		// Apply response normalization middleware
@@ -385,6 +574,12 @@ func (r *Runner) Run(ctx context.Context, rcfg RunConfig) (*RunResult, error) {
 			resp.Choices[0].FinishReason = "tool_calls"
 		}
 
+		// The wrap-up turn is the last one, whatever the model tried to call
+		if wrappingUp && len(assistantMsg.ToolCalls) > 0 {
+			assistantMsg.ToolCalls = nil
+			resp.Choices[0].FinishReason = "stop"
+		}
+
 		// Prevent consecutive assistant messages
 		messages, _ = llm.PreventConsecutiveAssistant(messages)
 
@@ -396,35 +591,34 @@ func (r *Runner) Run(ctx context.Context, rcfg RunConfig) (*RunResult, error) {
 		messages = append(messages, assistantMsg)
 
 		// Get token counts
-		promptTokens := resp.Usage.PromptTokens
-		completionTokens := resp.Usage.CompletionTokens
-		totalTokens = promptTokens + completionTokens
-
-		agentStats.TotalPromptTokens += promptTokens
-		agentStats.TotalCompletionTokens += completionTokens
+		totalTokens = resp.Usage.PromptTokens + resp.Usage.CompletionTokens
 		if totalTokens > agentStats.MaxContextUsed {
 			agentStats.MaxContextUsed = totalTokens
 		}
-
-		// Query generation stats for extended data
-		var requestCost float64
-		if resp.ID != "" {
-			genStats, err := r.llmClient.GetGenerationStats(context.Background(), resp.ID)
-			if err == nil {
-				if genStats.Data.NativeTokensPrompt > 0 {
-					promptTokens = genStats.Data.NativeTokensPrompt
-					completionTokens = genStats.Data.NativeTokensCompletion
-					totalTokens = promptTokens + completionTokens
-				}
-				agentStats.TotalCacheReadTokens += genStats.Data.NativeTokensCached
-				agentStats.TotalCost += genStats.Data.TotalCost
-				agentStats.CacheDiscount += genStats.Data.CacheDiscount
-				agentStats.TotalPromptMS += genStats.Data.Latency
-				agentStats.TotalGenerationMS += genStats.Data.GenerationTime
-				requestCost = genStats.Data.TotalCost
-			}
-		}
+		usage := r.addUsage(resp, agentStats)
+		promptTokens, completionTokens, requestCost := usage.promptTokens, usage.completionTokens, usage.cost
+		totalTokens = promptTokens + completionTokens
 		agentStats.Steps++
+		// Saved with the session for replay
+		messages[len(messages)-1].Usage = &llm.MessageUsage{
+			PromptTokens:     promptTokens,
+			CompletionTokens: completionTokens,
+			CacheReadTokens:  usage.cacheReadTokens,
+			Cost:             requestCost,
+		}
+
+		r.events.Publish(events.LLMRequestFinished{
+			Iteration:    i,
+			Duration:     duration,
+			FinishReason: resp.Choices[0].FinishReason,
+			ToolCalls:    len(assistantMsg.ToolCalls),
+			Usage: events.Usage{
+				PromptTokens:     promptTokens,
+				CompletionTokens: completionTokens,
+				CacheReadTokens:  usage.cacheReadTokens,
+				Cost:             requestCost,
+			},
+		})
 
 		r.logger.LLMCall(r.cfg.LLM.Model, promptTokens, completionTokens, duration)
 
@@ -435,8 +629,8 @@ func (r *Runner) Run(ctx context.Context, rcfg RunConfig) (*RunResult, error) {
 		// No tool calls = final answer
 		if len(assistantMsg.ToolCalls) == 0 {
 			finishReason := resp.Choices[0].FinishReason
-			if finishReason == "stop" && r.registry.LooksLikeMalformedToolCall(assistantMsg.Content) {
-				r.writer.Warn("Detected malformed tool call in response, auto-continuing...")
+			if finishReason == "stop" && !wrappingUp && r.registry.LooksLikeMalformedToolCall(assistantMsg.Content) {
+				r.notify(events.LevelWarn, events.TopicRetry, "Detected malformed tool call in response, auto-continuing...")
 				messages = append(messages, llm.Message{
 					Role:    llm.RoleUser,
 					Content: "continue",
@@ -445,10 +639,10 @@ func (r *Runner) Run(ctx context.Context, rcfg RunConfig) (*RunResult, error) {
 			}
 
 			if assistantMsg.Content == "" {
-				if assistantMsg.ReasoningContent != "" {
+				if assistantMsg.ReasoningContent != "" && !wrappingUp {
 					if emptyReasoningRetries < maxEmptyReasoningRetries {
 						emptyReasoningRetries++
-						r.writer.Warn(fmt.Sprintf("LLM returned empty response with reasoning, retrying... (%d/%d)",
+						r.notify(events.LevelWarn, events.TopicRetry, fmt.Sprintf("LLM returned empty response with reasoning, retrying... (%d/%d)",
 							emptyReasoningRetries, maxEmptyReasoningRetries))
 
 						messages = messages[:len(messages)-1]
@@ -457,7 +651,7 @@ func (r *Runner) Run(ctx context.Context, rcfg RunConfig) (*RunResult, error) {
 						continue
 					}
 
-					r.writer.Warn("LLM still confused, using directive prompt...")
+					r.notify(events.LevelWarn, events.TopicRetry, "LLM still confused, using directive prompt...")
 					assistantMsg.Content = assistantMsg.ReasoningContent
 					assistantMsg.ReasoningContent = ""
 					messages[len(messages)-1] = assistantMsg
@@ -472,10 +666,62 @@ func (r *Runner) Run(ctx context.Context, rcfg RunConfig) (*RunResult, error) {
 					continue
 				}
 
-				r.writer.Warn(fmt.Sprintf("LLM returned empty response (finish_reason=%s)", finishReason))
+				r.notify(events.LevelWarn, events.TopicRetry, fmt.Sprintf("LLM returned empty response (finish_reason=%s)", finishReason))
 			}
 
-			r.writer.Assistant(assistantMsg.Content)
+			// Messages sent while the model was answering come before the end,
+			// unless no iteration is left to answer them: then the answer stands
+			if r.control.HasMessages() && !wrappingUp {
+				if i+1 < maxIters {
+					r.events.Publish(events.AssistantText{
+						Iteration:     i,
+						Content:       assistantMsg.Content,
+						Reasoning:     assistantMsg.ReasoningContent,
+						Streamed:      streamed,
+						ContextTokens: totalTokens,
+						ContextWindow: r.cfg.LLM.Context,
+					})
+					cleanup()
+					cancelOnce()
+					continue
+				}
+				dropped := r.control.TakeMessages()
+				r.notify(events.LevelWarn, events.TopicControl, fmt.Sprintf("%d steering message(s) arrived on the last iteration and were not sent to the model", len(dropped)))
+			}
+
+			// Check the work before accepting the answer. A failure goes back to
+			// the model, up to agent.max_verify_rounds times.
+			if r.cfg.Agent.VerifyCommand != "" && !wrappingUp && iterCtx.Err() == nil {
+				passed, output := r.verify(iterCtx, agentStats)
+				verifyFailed = !passed
+				if !passed && verifyFeedback < r.verifyRounds() {
+					verifyFeedback++
+					r.events.Publish(events.AssistantText{
+						Iteration:     i,
+						Content:       assistantMsg.Content,
+						Reasoning:     assistantMsg.ReasoningContent,
+						Streamed:      streamed,
+						ContextTokens: totalTokens,
+						ContextWindow: r.cfg.LLM.Context,
+					})
+					messages = append(messages, verifyFailedMessage(r.cfg.Agent.VerifyCommand, output))
+					cleanup()
+					cancelOnce()
+					continue
+				}
+				if !passed {
+					r.notify(events.LevelWarn, events.TopicVerification, fmt.Sprintf("Verification still failing after %d rounds - accepting the answer", verifyFeedback))
+				}
+			}
+
+			r.events.Publish(events.FinalAnswer{Content: assistantMsg.Content})
+			result.StopReason = StopCompleted
+			if verifyFailed {
+				result.StopReason = StopVerifyFailed
+			}
+			if wrappingUp {
+				result.StopReason = StopBudget
+			}
 
 			// Display stats summary
 			totalTime := time.Since(requestStartTime)
@@ -491,7 +737,7 @@ func (r *Runner) Run(ctx context.Context, rcfg RunConfig) (*RunResult, error) {
 					ui.FormatDuration(totalTime),
 					ui.FormatDuration(totalLLMTime))
 			}
-			r.writer.Info(statsMsg)
+			r.notify(events.LevelInfo, events.TopicStats, statsMsg)
 
 			agentStats.TotalAgentTime = totalTime
 			agentStats.TotalLLMTime = totalLLMTime
@@ -501,7 +747,7 @@ func (r *Runner) Run(ctx context.Context, rcfg RunConfig) (*RunResult, error) {
 			if rcfg.UseFileFirst && r.contextMgr != nil && !tasksToolExecuted && len(messages) > rollbackPoint {
 				newMessages := messages[rollbackPoint:]
 				if err := r.contextMgr.AppendMessages(newMessages); err != nil {
-					r.writer.Error(fmt.Sprintf("Failed to persist messages: %v", err))
+					r.notify(events.LevelError, events.TopicState, fmt.Sprintf("Failed to persist messages: %v", err))
 				}
 			}
 
@@ -516,13 +762,16 @@ func (r *Runner) Run(ctx context.Context, rcfg RunConfig) (*RunResult, error) {
 
 		r.logger.AgentIteration(i, len(assistantMsg.ToolCalls))
 
-		// Display reasoning/thinking if present
-		contextStr := ui.FormatContextStr(totalTokens, r.cfg.LLM.Context)
-		if assistantMsg.ReasoningContent != "" {
-			r.writer.Thinking(contextStr, assistantMsg.ReasoningContent)
-		}
-		if assistantMsg.Content != "" {
-			r.writer.Thinking(contextStr, assistantMsg.Content)
+		// Reasoning and text that accompany the tool calls
+		if assistantMsg.ReasoningContent != "" || assistantMsg.Content != "" {
+			r.events.Publish(events.AssistantText{
+				Iteration:     i,
+				Content:       assistantMsg.Content,
+				Reasoning:     assistantMsg.ReasoningContent,
+				Streamed:      streamed,
+				ContextTokens: totalTokens,
+				ContextWindow: r.cfg.LLM.Context,
+			})
 		}
 
 		// Execute tool calls
@@ -539,7 +788,19 @@ func (r *Runner) Run(ctx context.Context, rcfg RunConfig) (*RunResult, error) {
 			r.checkpointMgr.StartTurn()
 		}
 
+		// Read-only calls run ahead in concurrent batches; prefetchedUpTo marks the end of the last batch
+		prefetched := make(map[int]prefetchedCall)
+		prefetchedUpTo := 0
+
 		for idx, tc := range assistantMsg.ToolCalls {
+			// Not while an edit is pending: the loop blocks most calls then
+			if idx >= prefetchedUpTo && r.parallelReadTools() > 1 && !pendingEditState(messages).HasPending {
+				if end := r.readOnlyRun(assistantMsg.ToolCalls, idx, lastToolName, lastToolArgs); end-idx > 1 {
+					totalToolTime += r.prefetchReadOnly(iterCtx, assistantMsg.ToolCalls, idx, end, prefetched)
+					prefetchedUpTo = end
+				}
+			}
+
 			tool := r.registry.Get(tc.Function.Name)
 			if tool == nil {
 				unknownErr := tools.SemanticErrorf("Unknown tool '%s'. Available tools can be found in the system prompt.", tc.Function.Name)
@@ -552,7 +813,9 @@ func (r *Runner) Run(ctx context.Context, rcfg RunConfig) (*RunResult, error) {
 					}
 					break
 				}
-				r.writer.Error(fmt.Sprintf("Unknown tool: %s", tc.Function.Name))
+				r.events.Publish(events.ToolCallFailed{
+					ID: tc.ID, Name: tc.Function.Name, Stage: events.StageUnknownTool, Error: unknownErr.Error(),
+				})
 				messages = append(messages, llm.Message{
 					Role:       llm.RoleTool,
 					Name:       tc.Function.Name,
@@ -563,13 +826,7 @@ func (r *Runner) Run(ctx context.Context, rcfg RunConfig) (*RunResult, error) {
 			}
 
 			// Analyze pending edit state from message history
-			var roles, contents, toolNames []string
-			for _, msg := range messages {
-				roles = append(roles, string(msg.Role))
-				contents = append(contents, msg.Content)
-				toolNames = append(toolNames, msg.Name) // Tool name for tool messages
-			}
-			pendingState := tools.AnalyzePendingEditState(roles, contents, toolNames)
+			pendingState := pendingEditState(messages)
 
 			if blockErr := tools.CheckPendingEditBlockWithState(tc.Function.Name, pendingState, r.cfg); blockErr != nil {
 				btResult := r.handleToolError(blockErr, tc, backtracker, rollbackPoint, promptTokens, completionTokens, requestCost)
@@ -588,14 +845,17 @@ func (r *Runner) Run(ctx context.Context, rcfg RunConfig) (*RunResult, error) {
 					ToolCallID: tc.ID,
 					Content:    tools.FormatError(blockErr),
 				})
-				r.writer.ToolResult(fmt.Sprintf("Error: %s", ui.ShortenBlockMessage(blockErr.Error())), "")
+				r.events.Publish(events.ToolCallFailed{
+					ID: tc.ID, Name: tc.Function.Name, Stage: events.StageBlocked, Error: blockErr.Error(),
+					Summary: fmt.Sprintf("Error: %s", ui.ShortenBlockMessage(blockErr.Error())),
+				})
 				continue
 			}
 
 			// Normalize tool arguments for Check
 			checkArgs := json.RawMessage(tc.Function.Arguments)
 			if checkArgs, err = tools.NormalizeToolCallArguments(tool, checkArgs); err != nil {
-				r.writer.Warn(fmt.Sprintf("Warning: Failed to normalize tool arguments for Check: %v", err))
+				r.notify(events.LevelWarn, events.TopicTool, fmt.Sprintf("Warning: Failed to normalize tool arguments for Check: %v", err))
 				checkArgs = json.RawMessage(tc.Function.Arguments)
 			}
 
@@ -630,7 +890,9 @@ func (r *Runner) Run(ctx context.Context, rcfg RunConfig) (*RunResult, error) {
 				if errSummary == "" {
 					errSummary = fmt.Sprintf("Error: %v", err)
 				}
-				r.writer.ToolResult(errSummary, "")
+				r.events.Publish(events.ToolCallFailed{
+					ID: tc.ID, Name: tc.Function.Name, Stage: events.StageCheck, Error: err.Error(), Summary: errSummary,
+				})
 				loopDetector.Record(tc.Function.Name, tc.Function.Arguments, errContent, true)
 				continue
 			}
@@ -641,14 +903,15 @@ func (r *Runner) Run(ctx context.Context, rcfg RunConfig) (*RunResult, error) {
 
 				// After max consecutive duplicates, stop with error
 				if consecutiveDuplicates >= maxConsecutiveDuplicates {
-					r.writer.Error(fmt.Sprintf("FATAL: %s called %d times with identical arguments - stopping to prevent infinite loop",
-						tc.Function.Name, consecutiveDuplicates))
+					r.events.Publish(events.Error{Message: fmt.Sprintf("FATAL: %s called %d times with identical arguments - stopping to prevent infinite loop",
+						tc.Function.Name, consecutiveDuplicates)})
 
 					agentStats.TotalAgentTime = time.Since(requestStartTime)
 					agentStats.TotalLLMTime = totalLLMTime
 					agentStats.TotalToolTime = totalToolTime
 					result.FinalMessages = messages
 
+					result.StopReason = StopDuplicateCalls
 					cleanup()
 					cancelOnce()
 					return result, fmt.Errorf("duplicate call loop: %s called %d times with same arguments", tc.Function.Name, consecutiveDuplicates)
@@ -671,7 +934,9 @@ func (r *Runner) Run(ctx context.Context, rcfg RunConfig) (*RunResult, error) {
 					ToolCallID: tc.ID,
 					Content:    errContent,
 				})
-				r.writer.ToolResult("Error: duplicate call", "")
+				r.events.Publish(events.ToolCallFailed{
+					ID: tc.ID, Name: tc.Function.Name, Stage: events.StageDuplicate, Error: dupErr.Error(), Summary: "Error: duplicate call",
+				})
 				loopDetector.Record(tc.Function.Name, tc.Function.Arguments, errContent, true)
 				continue
 			}
@@ -679,37 +944,33 @@ func (r *Runner) Run(ctx context.Context, rcfg RunConfig) (*RunResult, error) {
 			// Reset duplicate counter on different call
 			consecutiveDuplicates = 0
 
-			// Display tool call
-			var args map[string]any
-			_ = json.Unmarshal([]byte(tc.Function.Arguments), &args)
-
-			if tc.Function.Name == "Shell" {
-				cmdStr, _ := args["command"].(string)
-				r.writer.ToolCall("Shell", cmdStr, contextStr)
-			} else if tc.Function.Name == "Shell.advanced" {
-				cmdStr, _ := args["command"].(string)
-				wdStr, _ := args["working_dir"].(string)
-				argsDisplay := ui.FormatShellDisplay(cmdStr, wdStr, r.cfg.Workspace.Root)
-				if timeoutVal, ok := args["timeout"].(float64); ok && timeoutVal > 0 && int(timeoutVal) != 30 {
-					argsDisplay += fmt.Sprintf(", timeout=%ds", int(timeoutVal))
-				}
-				r.writer.ToolCall("Shell.advanced", argsDisplay, contextStr)
-			} else if strings.HasPrefix(tc.Function.Name, "Plan.") {
-				if r.writer.IsVerbose() {
-					argsDisplay := ui.FormatToolArgs(args)
-					r.writer.ToolCall(tc.Function.Name, argsDisplay, contextStr)
-				} else {
-					r.writer.ToolContext(contextStr)
-				}
-			} else {
-				argsDisplay := ui.FormatToolArgs(args)
-				r.writer.ToolCall(tc.Function.Name, argsDisplay, contextStr)
+			// Ask the approval policy; a refusal goes back to the model as is
+			if err := r.approval.Approve(tc.Function.Name, checkArgs, approvalDisplay(tc.Function.Name, checkArgs)); err != nil {
+				errContent := tools.FormatError(err)
+				messages = append(messages, llm.Message{
+					Role:       llm.RoleTool,
+					Name:       tc.Function.Name,
+					ToolCallID: tc.ID,
+					Content:    errContent,
+				})
+				r.events.Publish(events.ToolCallFailed{
+					ID: tc.ID, Name: tc.Function.Name, Stage: events.StageDenied, Error: err.Error(), Summary: "Error: not approved",
+				})
+				loopDetector.Record(tc.Function.Name, tc.Function.Arguments, errContent, true)
+				continue
 			}
 
+			r.events.Publish(events.ToolCallStarted{
+				ID:            tc.ID,
+				Name:          tc.Function.Name,
+				Arguments:     tc.Function.Arguments,
+				ContextTokens: totalTokens,
+				ContextWindow: r.cfg.LLM.Context,
+			})
+
 			// Execute tool with timing
 			toolStart := time.Now()
 			progressDone := make(chan bool)
-			dotCount := 0
 			go func() {
 				ticker := time.NewTicker(1 * time.Second)
 				defer ticker.Stop()
@@ -717,37 +978,53 @@ func (r *Runner) Run(ctx context.Context, rcfg RunConfig) (*RunResult, error) {
 					select {
 					case <-ticker.C:
 						r.writer.ToolProgress(".")
-						dotCount++
 					case <-progressDone:
 						return
 					}
 				}
 			}()
 
-			// Apply timeout to non-shell tools
 			toolCtx := iterCtx
 			var toolCancel context.CancelFunc
-			if tc.Function.Name != "Shell" && tc.Function.Name != "Shell.advanced" {
-				toolCtx, toolCancel = context.WithTimeout(iterCtx, 15*time.Second)
+			if hasToolTimeout(tc.Function.Name) {
+				toolCtx, toolCancel = context.WithTimeout(iterCtx, toolCallTimeout)
 				defer toolCancel()
 			}
 
 			// Normalize tool arguments
 			normalizedArgs := json.RawMessage(tc.Function.Arguments)
 			if normalizedArgs, err = tools.NormalizeToolCallArguments(tool, normalizedArgs); err != nil {
-				r.writer.Warn(fmt.Sprintf("Warning: Failed to normalize tool arguments: %v", err))
+				r.notify(events.LevelWarn, events.TopicTool, fmt.Sprintf("Warning: Failed to normalize tool arguments: %v", err))
 				normalizedArgs = json.RawMessage(tc.Function.Arguments)
 			}
 
-			toolResult, toolErr := tool.Call(toolCtx, normalizedArgs)
+			var toolResult any
+			var toolErr error
+			var toolDuration time.Duration
+			if pf, ok := prefetched[idx]; ok {
+				// Already run in a concurrent batch, whose time is counted in totalToolTime
+				toolResult, toolErr, toolDuration = pf.result, pf.err, pf.duration
+				close(progressDone)
+			} else {
+				callCtx, toolDone := r.control.ToolContext(toolCtx)
+				toolResult, toolErr = tool.Call(callCtx, normalizedArgs)
+				if toolDone() {
+					toolErr = tools.RuntimeErrorf("cancelled by the user")
+				}
+
+				if toolCtx.Err() == context.DeadlineExceeded {
+					toolErr = errToolTimeout
+				}
+				toolDuration = time.Since(toolStart)
+				close(progressDone)
+				time.Sleep(10 * time.Millisecond)
+				totalToolTime += toolDuration
+			}
 
-			if toolCtx.Err() == context.DeadlineExceeded {
-				toolErr = fmt.Errorf("tool execution timed out after 15 seconds")
+			// Tokens and cost of tools that call the LLM themselves
+			if reporter, ok := tool.(usageReporter); ok {
+				agentStats.AddUsage(reporter.takeUsage())
 			}
-			toolDuration := time.Since(toolStart)
-			close(progressDone)
-			time.Sleep(10 * time.Millisecond)
-			totalToolTime += toolDuration
 
 			// Check if context was cancelled
 			select {
@@ -783,7 +1060,9 @@ func (r *Runner) Run(ctx context.Context, rcfg RunConfig) (*RunResult, error) {
 						}
 					}
 					content = fmt.Sprintf("Error: %v", toolErr)
-					r.writer.Error(fmt.Sprintf("Tool error: %s", toolErr))
+					r.events.Publish(events.ToolCallFailed{
+						ID: tc.ID, Name: tc.Function.Name, Stage: events.StageCall, Error: toolErr.Error(), Duration: toolDuration,
+					})
 					r.logger.ToolExecuted(tc.Function.Name, toolDuration, false, toolErr)
 				} else {
 					isPlanTool := strings.HasPrefix(tc.Function.Name, "Plan.")
@@ -796,18 +1075,11 @@ func (r *Runner) Run(ctx context.Context, rcfg RunConfig) (*RunResult, error) {
 						if planText != "" {
 							r.writer.ActivePlan(planText)
 						}
-						r.writer.VerboseOutput(content)
-						r.logger.ToolExecuted(tc.Function.Name, toolDuration, true, nil)
-					} else {
-						summary := ui.GetResultSummary(toolResult)
-						var durationStr string
-						if dotCount > 0 {
-							durationStr = fmt.Sprintf("...%.0fs", toolDuration.Seconds())
-						}
-						r.writer.ToolResult(summary, durationStr)
-						r.writer.VerboseOutput(content)
-						r.logger.ToolExecuted(tc.Function.Name, toolDuration, true, nil)
 					}
+					r.events.Publish(events.ToolCallFinished{
+						ID: tc.ID, Name: tc.Function.Name, Result: toolResult, Content: content, Duration: toolDuration,
+					})
+					r.logger.ToolExecuted(tc.Function.Name, toolDuration, true, nil)
 				}
 
 				messages = append(messages, llm.Message{
@@ -845,7 +1117,7 @@ func (r *Runner) Run(ctx context.Context, rcfg RunConfig) (*RunResult, error) {
 						Role:    llm.RoleUser,
 						Content: userMessageToInject,
 					})
-					r.writer.Debug("Injected user message for backtrack recovery")
+					r.notify(events.LevelDebug, events.TopicTool, "Injected user message for backtrack recovery")
 				}
 			}
 
@@ -857,7 +1129,7 @@ func (r *Runner) Run(ctx context.Context, rcfg RunConfig) (*RunResult, error) {
 		// End checkpoint turn
 		if len(assistantMsg.ToolCalls) > 0 && r.checkpointMgr != nil && r.checkpointMgr.Enabled() {
 			if err := r.checkpointMgr.EndTurn(); err != nil {
-				r.writer.Debug(fmt.Sprintf("Checkpoint error: %v", err))
+				r.notify(events.LevelDebug, events.TopicCheckpoint, fmt.Sprintf("Checkpoint error: %v", err))
 			}
 		}
 
@@ -866,14 +1138,16 @@ func (r *Runner) Run(ctx context.Context, rcfg RunConfig) (*RunResult, error) {
 			var interventionMsg string
 
 			if loopInfo.IsError {
-				r.writer.Warn(fmt.Sprintf("Loop detected: %s called %d times with same error", loopInfo.ToolName, loopInfo.Count))
+				r.events.Publish(events.LoopDetected{Tool: loopInfo.ToolName, Loop: events.LoopRepeatedError, Count: loopInfo.Count})
+				loopInterventions++
 
 				interventionMsg = fmt.Sprintf("\n\n<system-reminder>\n"+
 					"LOOP DETECTED: You have called '%s' %d times in a row with the same failing result. "+
 					"STOP and try a DIFFERENT approach.\n"+
 					"</system-reminder>", loopInfo.ToolName, loopInfo.Count)
 			} else if loopInfo.IsSuccess {
-				r.writer.Warn(fmt.Sprintf("Loop detected: %s called %d times with same arguments and result", loopInfo.ToolName, loopInfo.Count))
+				r.events.Publish(events.LoopDetected{Tool: loopInfo.ToolName, Loop: events.LoopRepeatedSuccess, Count: loopInfo.Count})
+				loopInterventions++
 
 				interventionMsg = fmt.Sprintf("\n\n<system-reminder>\n"+
 					"LOOP DETECTED: You have called '%s' %d times in a row with identical arguments and results. "+
@@ -885,7 +1159,8 @@ func (r *Runner) Run(ctx context.Context, rcfg RunConfig) (*RunResult, error) {
 				messages[len(messages)-1].Content += interventionMsg
 			}
 		} else if loopInfo := loopDetector.DetectErrorLoop(4); loopInfo != nil {
-			r.writer.Warn(fmt.Sprintf("Error loop detected: %s has failed %d times consecutively", loopInfo.ToolName, loopInfo.Count))
+			r.events.Publish(events.LoopDetected{Tool: loopInfo.ToolName, Loop: events.LoopErrorStreak, Count: loopInfo.Count})
+			loopInterventions++
 
 			interventionMsg := fmt.Sprintf("\n\n<system-reminder>\n"+
 				"ERROR LOOP DETECTED: '%s' has failed %d times in a row. "+
@@ -896,7 +1171,8 @@ func (r *Runner) Run(ctx context.Context, rcfg RunConfig) (*RunResult, error) {
 				messages[len(messages)-1].Content += interventionMsg
 			}
 		} else if loopInfo := loopDetector.DetectAlternatingLoop(3); loopInfo != nil {
-			r.writer.Warn(fmt.Sprintf("Alternating loop detected: %s is repeating the same cycle", loopInfo.ToolName))
+			r.events.Publish(events.LoopDetected{Tool: loopInfo.ToolName, Loop: events.LoopAlternating, Count: loopInfo.Count})
+			loopInterventions++
 
 			interventionMsg := fmt.Sprintf("\n\n<system-reminder>\n"+
 				"ALTERNATING LOOP DETECTED: You are stuck in a cycle repeating '%s' with the same arguments followed by cancellation/undo. "+
@@ -910,7 +1186,7 @@ func (r *Runner) Run(ctx context.Context, rcfg RunConfig) (*RunResult, error) {
 
 		// Handle cancelled tools
 		if toolsCancelled {
-			r.writer.Info("Tool execution cancelled - returning to prompt")
+			r.notify(events.LevelInfo, events.TopicControl, "Tool execution cancelled - returning to prompt")
 
 			for k := lastExecutedToolIdx + 1; k < len(assistantMsg.ToolCalls); k++ {
 				tc := assistantMsg.ToolCalls[k]
@@ -929,11 +1205,27 @@ func (r *Runner) Run(ctx context.Context, rcfg RunConfig) (*RunResult, error) {
 			if rcfg.UseFileFirst && r.contextMgr != nil && !tasksToolExecuted && len(messages) > rollbackPoint {
 				newMessages := messages[rollbackPoint:]
 				if err := r.contextMgr.AppendMessages(newMessages); err != nil {
-					r.writer.Error(fmt.Sprintf("Failed to persist messages: %v", err))
+					r.notify(events.LevelError, events.TopicState, fmt.Sprintf("Failed to persist messages: %v", err))
 				}
 			}
 
 			result.Cancelled = true
+			result.StopReason = StopCancelled
+			result.FinalMessages = messages
+
+			cleanup()
+			cancelOnce()
+			break
+		}
+
+		// Stop a model that keeps looping despite the warnings
+		if limit := r.cfg.Agent.MaxLoopInterventions; limit > 0 && loopInterventions >= limit {
+			r.events.Publish(events.Error{Message: fmt.Sprintf("Still looping after %d warnings - stopping", loopInterventions)})
+
+			agentStats.TotalAgentTime = time.Since(requestStartTime)
+			agentStats.TotalLLMTime = totalLLMTime
+			agentStats.TotalToolTime = totalToolTime
+			result.StopReason = StopLoop
 			result.FinalMessages = messages
 
 			cleanup()
@@ -975,14 +1267,25 @@ func (r *Runner) Run(ctx context.Context, rcfg RunConfig) (*RunResult, error) {
 		if rcfg.UseFileFirst && r.contextMgr != nil && !tasksToolExecuted && len(messages) > rollbackPoint {
 			newMessages := messages[rollbackPoint:]
 			if err := r.contextMgr.AppendMessages(newMessages); err != nil {
-				r.writer.Error(fmt.Sprintf("Failed to persist messages: %v", err))
+				r.notify(events.LevelError, events.TopicState, fmt.Sprintf("Failed to persist messages: %v", err))
 			}
 		}
 
+		// Save the finished tool round, so a crash from here on loses nothing before it
+		saveState(i + 1)
+
 		cleanup()
 		cancelOnce()
 	}
 
+	if result.StopReason == "" {
+		r.notify(events.LevelWarn, events.TopicLimit, fmt.Sprintf("Reached the limit of %d iterations without a final answer", maxIters))
+		agentStats.TotalAgentTime = time.Since(requestStartTime)
+		agentStats.TotalLLMTime = totalLLMTime
+		agentStats.TotalToolTime = totalToolTime
+		result.StopReason = StopMaxIterations
+	}
+
 	// Collect backtrack stats
 	discardedStats := backtracker.GetDiscardedStats()
 	agentStats.DiscardedPromptTokens = discardedStats.TotalPromptTokens
@@ -994,6 +1297,64 @@ func (r *Runner) Run(ctx context.Context, rcfg RunConfig) (*RunResult, error) {
 	return result, nil
 }
 
+// chatRequest builds the LLM request for the current message history
+func (r *Runner) chatRequest(messages []llm.Message) llm.ChatRequest {
+	return llm.ChatRequest{
+		Model:       r.cfg.LLM.Model,
+		Messages:    messages,
+		Tools:       r.registry.Specs(),
+		ToolChoice:  "auto",
+		Temperature: r.cfg.LLM.Temperature,
+		MaxTokens:   r.cfg.LLM.MaxTokens,
+	}
+}
+
+// chat sends a request to the LLM. When streaming is enabled, content and
+// reasoning deltas are passed to onDelta as they arrive.
+func (r *Runner) chat(ctx context.Context, req llm.ChatRequest, onDelta llm.StreamHandler) (*llm.ChatResponse, error) {
+	if r.cfg.LLM.Stream {
+		return r.llmClient.ChatStream(ctx, req, onDelta)
+	}
+	return r.llmClient.Chat(ctx, req)
+}
+
+// responseUsage is the usage of one LLM response. Tokens come from the
+// provider's generation stats when it reports native counts.
+type responseUsage struct {
+	promptTokens     int
+	completionTokens int
+	cacheReadTokens  int
+	cost             float64
+}
+
+// addUsage adds the tokens and cost of resp to agentStats, looking up the
+// provider's generation stats for cost and cache tokens, and returns them
+func (r *Runner) addUsage(resp *llm.ChatResponse, agentStats *stats.AgentStats) responseUsage {
+	usage := responseUsage{promptTokens: resp.Usage.PromptTokens, completionTokens: resp.Usage.CompletionTokens}
+	agentStats.TotalPromptTokens += usage.promptTokens
+	agentStats.TotalCompletionTokens += usage.completionTokens
+	if resp.ID == "" {
+		return usage
+	}
+	genStats, err := r.llmClient.GetGenerationStats(context.Background(), resp.ID)
+	if err != nil {
+		return usage
+	}
+	if genStats.Data.NativeTokensPrompt > 0 {
+		usage.promptTokens = genStats.Data.NativeTokensPrompt
+		usage.completionTokens = genStats.Data.NativeTokensCompletion
+	}
+	agentStats.TotalCacheReadTokens += genStats.Data.NativeTokensCached
+	agentStats.TotalCacheWriteTokens += genStats.Data.NativeTokensCacheWrite
+	agentStats.TotalCost += genStats.Data.TotalCost
+	agentStats.CacheDiscount += genStats.Data.CacheDiscount
+	agentStats.TotalPromptMS += genStats.Data.Latency
+	agentStats.TotalGenerationMS += genStats.Data.GenerationTime
+	usage.cacheReadTokens = genStats.Data.NativeTokensCached
+	usage.cost = genStats.Data.TotalCost
+	return usage
+}
+
 // handleToolError handles errors from tool validation or execution.
 // It decides whether to backtrack (discard and retry) or add error to history.
 func (r *Runner) handleToolError(
@@ -1010,9 +1371,12 @@ func (r *Runner) handleToolError(
 		if idx := strings.Index(errMsg, "\n"); idx > 0 {
 			errMsg = errMsg[:idx]
 		}
-		r.writer.Info(fmt.Sprintf("↩ Retry [%d/%d]: %s - %s",
-			backtracker.GetRetryCount(), backtracker.GetMaxRetries(),
-			tc.Function.Name, errMsg))
+		r.events.Publish(events.Backtrack{
+			Tool:       tc.Function.Name,
+			Error:      errMsg,
+			Retry:      backtracker.GetRetryCount(),
+			MaxRetries: backtracker.GetMaxRetries(),
+		})
 		backtracker.RecordDiscarded(promptTokens, completionTokens, requestCost)
 		return backtrackResult{
 			shouldBacktrack: true,
@@ -1030,7 +1394,7 @@ func (r *Runner) handleToolError(
 				"Read the error carefully and take the correct action.",
 				err.Error(), backtracker.GetMaxRetries())
 
-			r.writer.Warn(fmt.Sprintf("⚠ Backtrack limit reached for %s, injecting user message", tc.Function.Name))
+			r.notify(events.LevelWarn, events.TopicTool, fmt.Sprintf("⚠ Backtrack limit reached for %s, injecting user message", tc.Function.Name))
 			backtracker.RecordDiscarded(promptTokens, completionTokens, requestCost)
 			backtracker.ResetAtPoint()
 			return backtrackResult{
@@ -1041,7 +1405,7 @@ func (r *Runner) handleToolError(
 				reason:            err.Error(),
 			}
 		}
-		r.writer.Warn(fmt.Sprintf("⚠ Backtrack limit reached for %s, adding error to history", tc.Function.Name))
+		r.notify(events.LevelWarn, events.TopicTool, fmt.Sprintf("⚠ Backtrack limit reached for %s, adding error to history", tc.Function.Name))
 		backtracker.ResetAtPoint()
 	}
 
@@ -1051,3 +1415,14 @@ func (r *Runner) handleToolError(
 		reason:          err.Error(),
 	}
 }
+
+// approvalDisplay is how a tool call is shown when asking the user to approve
+// it: the command for shell calls, the formatted arguments otherwise
+func approvalDisplay(name string, args json.RawMessage) string {
+	var params map[string]any
+	_ = json.Unmarshal(args, &params)
+	if cmd, ok := params["command"].(string); ok && strings.HasPrefix(name, "Shell") {
+		return cmd
+	}
+	return fmt.Sprintf("%s %s", name, ui.FormatToolArgs(params))
+}
@@ -0,0 +1,509 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/kvit-s/kvit-coder/internal/config"
+	"github.com/kvit-s/kvit-coder/internal/events"
+	"github.com/kvit-s/kvit-coder/internal/llm"
+	"github.com/kvit-s/kvit-coder/internal/llm/fake"
+	"github.com/kvit-s/kvit-coder/internal/tools"
+	"github.com/kvit-s/kvit-coder/internal/ui"
+)
+
+// echoTool returns its text argument, repeated times times, and counts calls
+type echoTool struct {
+	calls int
+}
+
+func (t *echoTool) Name() string        { return "Echo" }
+func (t *echoTool) Description() string { return "Echo text back" }
+func (t *echoTool) JSONSchema() map[string]any {
+	return map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"text":  map[string]any{"type": "string"},
+			"times": map[string]any{"type": "integer"},
+		},
+		"required": []string{"text"},
+	}
+}
+func (t *echoTool) Check(ctx context.Context, args json.RawMessage) error { return nil }
+func (t *echoTool) Call(ctx context.Context, args json.RawMessage) (any, error) {
+	t.calls++
+	var in struct {
+		Text  string `json:"text"`
+		Times int    `json:"times"`
+	}
+	if err := json.Unmarshal(args, &in); err != nil {
+		return nil, err
+	}
+	return map[string]any{"echo": strings.Repeat(in.Text, max(in.Times, 1))}, nil
+}
+func (t *echoTool) PromptSection() string  { return "" }
+func (t *echoTool) PromptCategory() string { return "shell" }
+func (t *echoTool) PromptOrder() int       { return 0 }
+
+type runnerFixture struct {
+	runner *Runner
+	server *fake.Server
+	echo   *echoTool
+}
+
+// newRunnerFixture builds a Runner talking to a fake server with the given script
+func newRunnerFixture(t *testing.T, cfg *config.Config, steps ...fake.Step) *runnerFixture {
+	t.Helper()
+	if cfg == nil {
+		cfg = &config.Config{}
+	}
+	cfg.LLM.Model = "test-model"
+	if cfg.Agent.MaxIterations == 0 {
+		cfg.Agent.MaxIterations = 20
+	}
+
+	srv := fake.NewServer(steps...)
+	t.Cleanup(srv.Close)
+
+	echo := &echoTool{}
+	registry := tools.NewRegistry()
+	registry.Enable(echo)
+
+	writer := ui.NewWriter(0)
+	writer.SetQuiet(true)
+	logger, err := NewLogger("", false)
+	if err != nil {
+		t.Fatalf("NewLogger() error = %v", err)
+	}
+
+	runner := NewRunner(RunnerOptions{
+		Cfg:       cfg,
+		LLMClient: llm.NewClient(srv.URL, ""),
+		Registry:  registry,
+		Writer:    writer,
+		Logger:    logger,
+	})
+	return &runnerFixture{runner: runner, server: srv, echo: echo}
+}
+
+func (f *runnerFixture) run(t *testing.T) (*RunResult, error) {
+	t.Helper()
+	return f.runner.Run(context.Background(), RunConfig{
+		Messages:  []llm.Message{{Role: llm.RoleUser, Content: "do the task"}},
+		QuietMode: true,
+	})
+}
+
+func lastMessage(messages []llm.Message) llm.Message {
+	if len(messages) == 0 {
+		return llm.Message{}
+	}
+	return messages[len(messages)-1]
+}
+
+func TestRunFinalAnswer(t *testing.T) {
+	f := newRunnerFixture(t, nil, fake.Text("all done").WithUsage(100, 5))
+
+	result, err := f.run(t)
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if got := lastMessage(result.FinalMessages); got.Role != llm.RoleAssistant || got.Content != "all done" {
+		t.Errorf("last message = %+v, want assistant answer", got)
+	}
+	if result.Stats.Steps != 1 || result.Stats.TotalPromptTokens != 100 {
+		t.Errorf("stats = %+v, want 1 step with 100 prompt tokens", result.Stats)
+	}
+}
+
+func TestRunToolCallThenAnswer(t *testing.T) {
+	for _, stream := range []bool{false, true} {
+		cfg := &config.Config{}
+		cfg.LLM.Stream = stream
+		f := newRunnerFixture(t, cfg,
+			fake.ToolCall("Echo", `{"text":"ping"}`),
+			fake.Text("pong received"),
+		)
+
+		result, err := f.run(t)
+		if err != nil {
+			t.Fatalf("stream=%v: Run() error = %v", stream, err)
+		}
+		if f.echo.calls != 1 {
+			t.Errorf("stream=%v: Echo calls = %d, want 1", stream, f.echo.calls)
+		}
+
+		// The second request carries the tool result
+		reqs := f.server.Requests()
+		if len(reqs) != 2 {
+			t.Fatalf("stream=%v: requests = %d, want 2", stream, len(reqs))
+		}
+		toolMsg := lastMessage(reqs[1].Messages)
+		if toolMsg.Role != llm.RoleTool || !strings.Contains(toolMsg.Content, "ping") {
+			t.Errorf("stream=%v: tool message = %+v", stream, toolMsg)
+		}
+		if toolMsg.ToolCallID == "" || toolMsg.ToolCallID != reqs[1].Messages[len(reqs[1].Messages)-2].ToolCalls[0].ID {
+			t.Errorf("stream=%v: tool result is not linked to its call", stream)
+		}
+		if got := lastMessage(result.FinalMessages).Content; got != "pong received" {
+			t.Errorf("stream=%v: final content = %q", stream, got)
+		}
+	}
+}
+
+func TestRunContextOverflowReplacesToolOutput(t *testing.T) {
+	f := newRunnerFixture(t, nil,
+		fake.ToolCall("Echo", `{"text":"huge output"}`),
+		fake.Error(400, `{"error":"context length exceeded"}`),
+		fake.Text("recovered"),
+	)
+
+	result, err := f.run(t)
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	reqs := f.server.Requests()
+	if len(reqs) != 3 {
+		t.Fatalf("requests = %d, want 3", len(reqs))
+	}
+	retried := lastMessage(reqs[2].Messages)
+	if retried.Role != llm.RoleTool || !strings.Contains(retried.Content, "[Server error processing tool output") {
+		t.Errorf("retried tool message = %q, want server error placeholder", retried.Content)
+	}
+	if got := lastMessage(result.FinalMessages).Content; got != "recovered" {
+		t.Errorf("final content = %q, want recovered", got)
+	}
+}
+
+func TestRunPersistentContextOverflowGivesUp(t *testing.T) {
+	var steps []fake.Step
+	for i := 0; i < 12; i++ {
+		steps = append(steps, fake.Error(400, `{"error":"context length exceeded"}`))
+	}
+	f := newRunnerFixture(t, nil, steps...)
+
+	_, err := f.run(t)
+	if err == nil || !strings.Contains(err.Error(), "persistent server error") {
+		t.Fatalf("Run() error = %v, want persistent server error", err)
+	}
+	// 2 retries per attempt, 3 "different approach" attempts
+	if got := len(f.server.Requests()); got != 9 {
+		t.Errorf("requests = %d, want 9", got)
+	}
+	reqs := f.server.Requests()
+	if got := lastMessage(reqs[3].Messages).Content; !strings.Contains(got, "try a different approach") {
+		t.Errorf("request 4 last message = %q, want different approach prompt", got)
+	}
+}
+
+func TestRunProviderErrorRetry(t *testing.T) {
+	f := newRunnerFixture(t, nil,
+		fake.ChoiceError(502, "upstream timeout"),
+		fake.Text("second time lucky"),
+	)
+
+	result, err := f.run(t)
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if got := lastMessage(result.FinalMessages).Content; got != "second time lucky" {
+		t.Errorf("final content = %q", got)
+	}
+	if f.server.Remaining() != 0 {
+		t.Errorf("Remaining() = %d, want 0", f.server.Remaining())
+	}
+}
+
+func TestRunProviderErrorStopsAfterConsecutiveFailures(t *testing.T) {
+	f := newRunnerFixture(t, nil,
+		fake.ChoiceError(502, "a"),
+		fake.ChoiceError(502, "b"),
+		fake.ChoiceError(502, "c"),
+		fake.ChoiceError(502, "d"),
+		fake.Text("never reached"),
+	)
+
+	result, err := f.run(t)
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if f.server.Remaining() != 1 {
+		t.Errorf("Remaining() = %d, want the final step unused", f.server.Remaining())
+	}
+	// The first failed retry asks the model to try again
+	reqs := f.server.Requests()
+	if got := lastMessage(reqs[2].Messages).Content; !strings.Contains(got, "caused a server error") {
+		t.Errorf("request 3 last message = %q, want retry prompt", got)
+	}
+	for _, msg := range result.FinalMessages {
+		if msg.Content == "never reached" {
+			t.Error("run continued past the provider failure limit")
+		}
+	}
+}
+
+func TestRunEmptyReasoningRetries(t *testing.T) {
+	f := newRunnerFixture(t, nil,
+		fake.Reasoning("hmm"),
+		fake.Reasoning("hmm"),
+		fake.Reasoning("hmm"),
+		fake.Reasoning("I should echo"),
+		fake.Text("done"),
+	)
+
+	result, err := f.run(t)
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	reqs := f.server.Requests()
+	if len(reqs) != 5 {
+		t.Fatalf("requests = %d, want 5", len(reqs))
+	}
+	// Retries drop the empty reply, so the history is unchanged
+	for i := 1; i < 4; i++ {
+		if len(reqs[i].Messages) != 1 {
+			t.Errorf("request %d has %d messages, want 1", i+1, len(reqs[i].Messages))
+		}
+	}
+	// After the retries the reasoning becomes content and a directive follows
+	msgs := reqs[4].Messages
+	if len(msgs) != 3 || msgs[1].Content != "I should echo" || !strings.Contains(msgs[2].Content, "Make the tool calls now") {
+		t.Errorf("request 5 messages = %+v, want reasoning as content then directive", msgs)
+	}
+	if got := lastMessage(result.FinalMessages).Content; got != "done" {
+		t.Errorf("final content = %q", got)
+	}
+}
+
+func TestRunPermanentServerErrorStops(t *testing.T) {
+	f := newRunnerFixture(t, nil, fake.Permanent500(), fake.Text("unused"))
+
+	result, err := f.run(t)
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if got := len(f.server.Requests()); got != 1 {
+		t.Errorf("requests = %d, want 1", got)
+	}
+	if len(result.FinalMessages) != 1 {
+		t.Errorf("FinalMessages = %d, want only the user message", len(result.FinalMessages))
+	}
+}
+
+func TestRunTruncatedResponse(t *testing.T) {
+	f := newRunnerFixture(t, nil, fake.Text("despite the bug").Truncated())
+
+	result, err := f.run(t)
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if got := lastMessage(result.FinalMessages).Content; got != "despite the bug" {
+		t.Errorf("final content = %q", got)
+	}
+}
+
+func TestRunNoChoices(t *testing.T) {
+	f := newRunnerFixture(t, nil, fake.Step{NoChoices: true}, fake.Text("unused"))
+
+	if _, err := f.run(t); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if f.server.Remaining() != 1 {
+		t.Errorf("Remaining() = %d, want the run to stop", f.server.Remaining())
+	}
+}
+
+func TestRunUnknownTool(t *testing.T) {
+	f := newRunnerFixture(t, nil, fake.ToolCall("Nope", `{}`), fake.Text("ok"))
+
+	if _, err := f.run(t); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	toolMsg := lastMessage(f.server.Requests()[1].Messages)
+	if toolMsg.Role != llm.RoleTool || !strings.Contains(toolMsg.Content, "Unknown tool") {
+		t.Errorf("tool message = %+v, want unknown tool error", toolMsg)
+	}
+}
+
+func TestRunUnknownToolBacktracks(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Backtrack.Enabled = true
+	cfg.Backtrack.MaxRetries = 5
+	f := newRunnerFixture(t, cfg, fake.ToolCall("Nope", `{}`).WithUsage(50, 5), fake.Text("ok"))
+
+	result, err := f.run(t)
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	// The bad call is discarded, so the retry sees the original history
+	if got := len(f.server.Requests()[1].Messages); got != 1 {
+		t.Errorf("retry request has %d messages, want 1", got)
+	}
+	if result.Stats.BacktrackCount != 1 || result.Stats.DiscardedPromptTokens != 50 {
+		t.Errorf("stats = %+v, want one backtrack discarding 50 prompt tokens", result.Stats)
+	}
+}
+
+func TestRunDuplicateCallLoop(t *testing.T) {
+	call := fake.ToolCall("Echo", `{"text":"same"}`)
+	f := newRunnerFixture(t, nil, call, call, call, call, fake.Text("unused"))
+
+	_, err := f.run(t)
+	if err == nil || !strings.Contains(err.Error(), "duplicate call loop") {
+		t.Fatalf("Run() error = %v, want duplicate call loop", err)
+	}
+	if f.echo.calls != 1 {
+		t.Errorf("Echo calls = %d, want only the first call executed", f.echo.calls)
+	}
+}
+
+func TestRunStopsAtMaxIterations(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Agent.MaxIterations = 2
+	f := newRunnerFixture(t, cfg,
+		fake.ToolCall("Echo", `{"text":"1"}`),
+		fake.ToolCall("Echo", `{"text":"2"}`),
+		fake.ToolCall("Echo", `{"text":"3"}`),
+	)
+
+	if _, err := f.run(t); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if got := len(f.server.Requests()); got != 2 {
+		t.Errorf("requests = %d, want 2", got)
+	}
+}
+
+func TestRunPublishesEvents(t *testing.T) {
+	f := newRunnerFixture(t, nil,
+		fake.ToolCall("Echo", `{"text":"hi"}`).WithToolCall("Nope", `{}`).WithUsage(100, 10),
+		fake.Text("done"),
+	)
+	var kinds []string
+	var failed events.ToolCallFailed
+	f.runner.Events().Subscribe(events.SinkFunc(func(e events.Event) {
+		kinds = append(kinds, string(e.Kind()))
+		if e, ok := e.(events.ToolCallFailed); ok {
+			failed = e
+		}
+	}))
+
+	if _, err := f.run(t); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	want := "llm_request_started llm_request_finished tool_call_started tool_call_finished tool_call_failed " +
+		"llm_request_started llm_request_finished final_answer notice"
+	if got := strings.Join(kinds, " "); got != want {
+		t.Errorf("events = %s\nwant     %s", got, want)
+	}
+	if failed.Name != "Nope" || failed.Stage != events.StageUnknownTool {
+		t.Errorf("failed event = %+v", failed)
+	}
+}
+
+func TestRunKeepsUsageWithMessages(t *testing.T) {
+	f := newRunnerFixture(t, nil,
+		fake.ToolCall("Echo", `{"text":"hi"}`).WithUsage(100, 10),
+		fake.Text("done").WithUsage(150, 5),
+	)
+	result, err := f.run(t)
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	var got []string
+	for _, msg := range result.FinalMessages {
+		if msg.Role == llm.RoleAssistant && msg.Usage != nil {
+			got = append(got, fmt.Sprintf("%d/%d", msg.Usage.PromptTokens, msg.Usage.CompletionTokens))
+		}
+	}
+	if strings.Join(got, " ") != "100/10 150/5" {
+		t.Errorf("assistant usage = %v, want each step's own", got)
+	}
+}
+
+func TestRunPublishesNotices(t *testing.T) {
+	// What the runner reports along the way reaches the bus, not just the terminal
+	cfg := &config.Config{}
+	cfg.Agent.MaxTokens = 100
+	f := newRunnerFixture(t, cfg,
+		fake.ToolCall("Echo", `{"text":"a"}`).WithUsage(100, 10),
+		fake.Text("here is where I got to"),
+	)
+	var notices []events.Notice
+	f.runner.Events().Subscribe(events.SinkFunc(func(e events.Event) {
+		if e, ok := e.(events.Notice); ok {
+			notices = append(notices, e)
+		}
+	}))
+	if _, err := f.run(t); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if len(notices) == 0 || notices[0].Topic != events.TopicBudget || notices[0].Level != events.LevelWarn ||
+		!strings.Contains(notices[0].Message, "Budget exhausted") {
+		t.Errorf("notices = %+v, want the budget exhaustion first", notices)
+	}
+
+	// A run stopped by a loop says why with an error event
+	call := fake.ToolCall("Echo", `{"text":"same"}`)
+	f = newRunnerFixture(t, nil, call, call, call, call)
+	var stopped []string
+	f.runner.Events().Subscribe(events.SinkFunc(func(e events.Event) {
+		if e, ok := e.(events.Error); ok {
+			stopped = append(stopped, e.Message)
+		}
+	}))
+	_, _ = f.run(t)
+	if len(stopped) != 1 || !strings.Contains(stopped[0], "identical arguments") {
+		t.Errorf("error events = %q, want the duplicate call stop", stopped)
+	}
+}
+
+func TestRunStreamJSON(t *testing.T) {
+	f := newRunnerFixture(t, nil,
+		fake.Text("let me check").WithToolCall("Echo", `{"text":"hi"}`).WithUsage(100, 10),
+		fake.Text("done"),
+	)
+	var buf strings.Builder
+	stream := ui.NewStreamJSONSink(&buf)
+	f.runner.Events().Subscribe(stream)
+
+	stream.Start("s1", "test-model")
+	if _, err := f.run(t); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	stream.Result(&ui.JSONStats{Steps: 2}, nil)
+
+	var types []string
+	var records []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var record map[string]any
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("line %q: %v", line, err)
+		}
+		if record["v"] != float64(ui.StreamFormatVersion) {
+			t.Errorf("line %q has no version", line)
+		}
+		types = append(types, record["type"].(string))
+		records = append(records, record)
+	}
+	want := "start usage assistant tool_call tool_result usage assistant result"
+	if got := strings.Join(types, " "); got != want {
+		t.Fatalf("records = %s\nwant      %s", got, want)
+	}
+	if records[2]["text"] != "let me check" || records[2]["final"] != false {
+		t.Errorf("assistant record = %v", records[2])
+	}
+	if args, ok := records[3]["arguments"].(map[string]any); !ok || args["text"] != "hi" {
+		t.Errorf("tool_call arguments = %v", records[3]["arguments"])
+	}
+	if records[1]["prompt_tokens"] != float64(100) {
+		t.Errorf("usage record = %v", records[1])
+	}
+	result := records[len(records)-1]
+	if result["content"] != "done" || result["stats"] == nil {
+		t.Errorf("result record = %v", result)
+	}
+}
@@ -0,0 +1,13 @@
+package agent
+
+import "github.com/kvit-s/kvit-coder/internal/llm"
+
+// appendUserMessage adds a message from the user to the history. Text sent
+// right after another user message joins it, so roles keep alternating.
+func appendUserMessage(messages []llm.Message, text string) []llm.Message {
+	if n := len(messages); n > 0 && messages[n-1].Role == llm.RoleUser {
+		messages[n-1].Content += "\n\n" + text
+		return messages
+	}
+	return append(messages, llm.Message{Role: llm.RoleUser, Content: text})
+}
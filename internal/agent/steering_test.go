@@ -0,0 +1,200 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kvit-s/kvit-coder/internal/control"
+	"github.com/kvit-s/kvit-coder/internal/events"
+	"github.com/kvit-s/kvit-coder/internal/llm"
+	"github.com/kvit-s/kvit-coder/internal/llm/fake"
+)
+
+// steeredFixture is a runner fixture listening on a control socket
+func steeredFixture(t *testing.T, steps ...fake.Step) (*runnerFixture, string) {
+	t.Helper()
+	f := newRunnerFixture(t, nil, steps...)
+	path := filepath.Join(t.TempDir(), "control.sock")
+	srv, err := control.Listen(path)
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	t.Cleanup(func() { srv.Close() })
+	f.runner.control = srv
+	return f, path
+}
+
+func TestSteeringMessageJoinsAfterToolRound(t *testing.T) {
+	f, path := steeredFixture(t,
+		fake.ToolCall("Echo", `{"text":"a"}`),
+		fake.Text("done"),
+	)
+	var seen []string
+	f.runner.Events().Subscribe(events.SinkFunc(func(e events.Event) {
+		switch e := e.(type) {
+		case events.ToolCallFinished:
+			if err := control.Send(path, control.Request{Type: control.TypeMessage, Text: "use tabs"}); err != nil {
+				t.Errorf("Send() error = %v", err)
+			}
+		case events.UserMessage:
+			seen = append(seen, e.Content)
+		}
+	}))
+
+	if _, err := f.run(t); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	reqs := f.server.Requests()
+	if len(reqs) != 2 {
+		t.Fatalf("requests = %d, want 2", len(reqs))
+	}
+	got := lastMessage(reqs[1].Messages)
+	if got.Role != llm.RoleUser || got.Content != "use tabs" {
+		t.Errorf("last message of the second request = %+v, want the steering message", got)
+	}
+	if len(seen) != 1 || seen[0] != "use tabs" {
+		t.Errorf("UserMessage events = %q, want [use tabs]", seen)
+	}
+}
+
+func TestSteeringMessageDefersFinalAnswer(t *testing.T) {
+	f, path := steeredFixture(t,
+		fake.Text("all done"),
+		fake.Text("renamed it too"),
+	)
+	f.runner.Events().Subscribe(events.SinkFunc(func(e events.Event) {
+		if e, ok := e.(events.LLMRequestFinished); ok && e.Iteration == 0 {
+			if err := control.Send(path, control.Request{Type: control.TypeMessage, Text: "rename it"}); err != nil {
+				t.Errorf("Send() error = %v", err)
+			}
+		}
+	}))
+
+	result, err := f.run(t)
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	reqs := f.server.Requests()
+	if len(reqs) != 2 {
+		t.Fatalf("requests = %d, want 2", len(reqs))
+	}
+	msgs := reqs[1].Messages
+	if n := len(msgs); n < 2 || msgs[n-2].Content != "all done" || msgs[n-1].Content != "rename it" {
+		t.Errorf("second request ends with %+v, want the first answer and the steering message", msgs)
+	}
+	if got := lastMessage(result.FinalMessages).Content; got != "renamed it too" {
+		t.Errorf("final answer = %q, want %q", got, "renamed it too")
+	}
+}
+
+func TestSteeringAbortCancelsRun(t *testing.T) {
+	f, path := steeredFixture(t,
+		fake.ToolCall("Echo", `{"text":"a"}`),
+		fake.Text("done"),
+	)
+	if err := control.Send(path, control.Request{Type: control.TypeAbort}); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+
+	result, _ := f.run(t)
+	if result == nil || result.StopReason != StopCancelled {
+		t.Fatalf("result = %+v, want StopCancelled", result)
+	}
+	if f.echo.calls != 0 {
+		t.Errorf("Echo calls = %d, want 0", f.echo.calls)
+	}
+}
+
+// waitTool is a read-only tool that runs until its context ends
+type waitTool struct {
+	started chan struct{}
+}
+
+func (t *waitTool) Name() string        { return "Wait" }
+func (t *waitTool) Description() string { return "Wait for something" }
+func (t *waitTool) JSONSchema() map[string]any {
+	return map[string]any{"type": "object", "properties": map[string]any{"id": map[string]any{"type": "string"}}}
+}
+func (t *waitTool) Check(ctx context.Context, args json.RawMessage) error { return nil }
+func (t *waitTool) Call(ctx context.Context, args json.RawMessage) (any, error) {
+	t.started <- struct{}{}
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-time.After(10 * time.Second):
+		return map[string]any{"waited": true}, nil
+	}
+}
+func (t *waitTool) PromptSection() string  { return "" }
+func (t *waitTool) PromptCategory() string { return "filesystem" }
+func (t *waitTool) PromptOrder() int       { return 0 }
+func (t *waitTool) ReadOnly() bool         { return true }
+
+func TestSteeringCancelToolStopsConcurrentReads(t *testing.T) {
+	f, path := steeredFixture(t,
+		fake.ToolCall("Wait", `{"id":"a"}`).WithToolCall("Wait", `{"id":"b"}`),
+		fake.Text("done"),
+	)
+	wait := &waitTool{started: make(chan struct{}, 2)}
+	f.runner.registry.Enable(wait)
+	go func() {
+		<-wait.started
+		<-wait.started
+		if err := control.Send(path, control.Request{Type: control.TypeCancelTool}); err != nil {
+			t.Errorf("Send() error = %v", err)
+		}
+	}()
+
+	start := time.Now()
+	result, err := f.run(t)
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("run took %v, want the reads cancelled", elapsed)
+	}
+	var cancelled int
+	for _, msg := range result.FinalMessages {
+		if msg.Role == llm.RoleTool && strings.Contains(msg.Content, "cancelled by the user") {
+			cancelled++
+		}
+	}
+	if cancelled != 2 {
+		t.Errorf("cancelled tool results = %d, want 2 in %+v", cancelled, result.FinalMessages)
+	}
+}
+
+func TestSteeringMessageOnLastIterationKeepsAnswer(t *testing.T) {
+	f, path := steeredFixture(t, fake.Text("all done"))
+	f.runner.cfg.Agent.MaxIterations = 1
+	var notices []string
+	f.runner.Events().Subscribe(events.SinkFunc(func(e events.Event) {
+		switch e := e.(type) {
+		case events.LLMRequestFinished:
+			if err := control.Send(path, control.Request{Type: control.TypeMessage, Text: "rename it"}); err != nil {
+				t.Errorf("Send() error = %v", err)
+			}
+		case events.Notice:
+			if e.Topic == events.TopicControl {
+				notices = append(notices, e.Message)
+			}
+		}
+	}))
+
+	result, err := f.run(t)
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if result.StopReason != StopCompleted || lastMessage(result.FinalMessages).Content != "all done" {
+		t.Errorf("result = %s with %q, want the answer to stand", result.StopReason, lastMessage(result.FinalMessages).Content)
+	}
+	if len(notices) != 1 || !strings.Contains(notices[0], "not sent to the model") {
+		t.Errorf("control notices = %q, want the dropped message reported", notices)
+	}
+}
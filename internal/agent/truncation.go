@@ -0,0 +1,204 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/kvit-s/kvit-coder/internal/events"
+	"github.com/kvit-s/kvit-coder/internal/llm"
+	"github.com/kvit-s/kvit-coder/internal/stats"
+)
+
+// continuationPrompt asks the model to carry on a response cut off at the output token limit
+const continuationPrompt = "[System: Your previous response was cut off by the output token limit. Continue exactly where it stopped, without repeating anything already written.]"
+
+// toolArgsContinuationPrompt asks the model for the rest of cut-off tool call arguments
+const toolArgsContinuationPrompt = "[System: Your previous response was cut off by the output token limit in the middle of the arguments of a %s call. The arguments so far are:\n%s\n\nReply with only the rest of the arguments, starting exactly where they stop.]"
+
+// defaultRetryMaxTokens is the first retry limit when llm.max_output_tokens is unset
+const defaultRetryMaxTokens = 8192
+
+// completeTruncated handles a response cut off at the output token limit
+// (finish_reason "length") and returns the response to use in its place.
+// Cut-off text is continued with follow-up requests and stitched together.
+// Cut-off tool call arguments are completed by a continuation when the
+// stitched arguments parse, and otherwise the request is retried with a
+// larger max_tokens. Usage and cost of responses that get replaced are added
+// to agentStats; the returned response's are left to the caller.
+func (r *Runner) completeTruncated(ctx context.Context, messages []llm.Message, resp *llm.ChatResponse, agentStats *stats.AgentStats) *llm.ChatResponse {
+	maxTokens := r.cfg.LLM.MaxTokens
+	for attempt := 0; attempt < r.cfg.LLM.MaxContinuations && resp.Choices[0].FinishReason == "length"; attempt++ {
+		agentStats.TruncationCount++
+		msg := resp.Choices[0].Message
+
+		var next *llm.ChatResponse
+		var err error
+		switch idx := truncatedToolCall(msg); {
+		case idx >= 0:
+			r.notify(events.LevelWarn, events.TopicTruncation, fmt.Sprintf("Response cut off at the output token limit inside a %s call - completing its arguments...", msg.ToolCalls[idx].Function.Name))
+			next, err = r.continueToolCall(ctx, messages, resp, idx, agentStats)
+			if err == nil && next == nil {
+				maxTokens = r.retryMaxTokens(maxTokens)
+				r.notify(events.LevelWarn, events.TopicTruncation, fmt.Sprintf("Could not stitch the arguments - retrying with max_tokens=%d...", maxTokens))
+				next, err = r.retryWithMaxTokens(ctx, messages, maxTokens)
+			}
+		case len(msg.ToolCalls) > 0:
+			// The tool calls are complete, so there's nothing to recover
+			return resp
+		case msg.Content != "":
+			r.notify(events.LevelWarn, events.TopicTruncation, "Response cut off at the output token limit - continuing...")
+			next, err = r.continueText(ctx, messages, resp)
+		default:
+			// Nothing visible to continue from, e.g. the limit was spent on reasoning
+			maxTokens = r.retryMaxTokens(maxTokens)
+			r.notify(events.LevelWarn, events.TopicTruncation, fmt.Sprintf("Response cut off at the output token limit - retrying with max_tokens=%d...", maxTokens))
+			next, err = r.retryWithMaxTokens(ctx, messages, maxTokens)
+		}
+		if err != nil {
+			r.notify(events.LevelWarn, events.TopicTruncation, fmt.Sprintf("Could not complete the truncated response: %v", err))
+			return resp
+		}
+
+		agentStats.ContinuationCount++
+		r.addUsage(resp, agentStats)
+		resp = next
+	}
+	return resp
+}
+
+// continueText asks the model to continue cut-off text and stitches the
+// continuation onto it. Tool calls made in the continuation are kept.
+func (r *Runner) continueText(ctx context.Context, messages []llm.Message, resp *llm.ChatResponse) (*llm.ChatResponse, error) {
+	partial := resp.Choices[0].Message
+	req := r.chatRequest(continuationMessages(messages, partial.Content, continuationPrompt))
+	next, err := r.chat(ctx, req, func(delta llm.StreamDelta) {
+		r.writer.StreamContent(delta.Content)
+	})
+	r.writer.StreamEnd()
+	if err != nil {
+		return nil, err
+	}
+	if len(next.Choices) == 0 || next.Choices[0].Error != nil {
+		return nil, fmt.Errorf("no response from model")
+	}
+
+	stitched := *next
+	stitched.Choices = append(stitched.Choices[:0:0], next.Choices...)
+	msg := &stitched.Choices[0].Message
+	msg.Content = partial.Content + msg.Content
+	if partial.ReasoningContent != "" {
+		msg.ReasoningContent = partial.ReasoningContent
+	}
+	return &stitched, nil
+}
+
+// continueToolCall asks the model for the rest of the arguments of the
+// tool call at idx. It returns nil without an error when the reply doesn't
+// complete them into valid JSON, and adds the reply's usage to agentStats.
+func (r *Runner) continueToolCall(ctx context.Context, messages []llm.Message, resp *llm.ChatResponse, idx int, agentStats *stats.AgentStats) (*llm.ChatResponse, error) {
+	partial := resp.Choices[0].Message
+	call := partial.ToolCalls[idx]
+	prompt := fmt.Sprintf(toolArgsContinuationPrompt, call.Function.Name, call.Function.Arguments)
+
+	// Without tools the model answers with plain text, which is what gets stitched
+	req := r.chatRequest(continuationMessages(messages, partial.Content, prompt))
+	req.Tools = nil
+	req.ToolChoice = ""
+	next, err := r.chat(ctx, req, nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(next.Choices) == 0 || next.Choices[0].Error != nil {
+		return nil, fmt.Errorf("no response from model")
+	}
+
+	args, ok := stitchArguments(call.Function.Arguments, next.Choices[0].Message.Content)
+	if !ok {
+		r.addUsage(next, agentStats)
+		return nil, nil
+	}
+
+	stitched := *resp
+	stitched.ID = next.ID // Its generation stats are the ones left to look up
+	stitched.Usage = next.Usage
+	stitched.Choices = append(stitched.Choices[:0:0], resp.Choices...)
+	msg := &stitched.Choices[0].Message
+	msg.ToolCalls = append([]llm.ToolCall(nil), partial.ToolCalls[:idx+1]...)
+	msg.ToolCalls[idx].Function.Arguments = args
+	stitched.Choices[0].FinishReason = "tool_calls"
+	return &stitched, nil
+}
+
+// retryWithMaxTokens repeats the request with a larger output token limit
+func (r *Runner) retryWithMaxTokens(ctx context.Context, messages []llm.Message, maxTokens int) (*llm.ChatResponse, error) {
+	req := r.chatRequest(messages)
+	req.MaxTokens = maxTokens
+	next, err := r.chat(ctx, req, func(delta llm.StreamDelta) {
+		r.writer.StreamReasoning(delta.ReasoningContent)
+		r.writer.StreamContent(delta.Content)
+	})
+	r.writer.StreamEnd()
+	if err != nil {
+		return nil, err
+	}
+	if len(next.Choices) == 0 || next.Choices[0].Error != nil {
+		return nil, fmt.Errorf("no response from model")
+	}
+	return next, nil
+}
+
+// retryMaxTokens doubles the output token limit, staying within half the context window
+func (r *Runner) retryMaxTokens(current int) int {
+	next := current * 2
+	if current <= 0 {
+		next = defaultRetryMaxTokens
+	}
+	if r.cfg.LLM.Context > 0 && next > r.cfg.LLM.Context/2 {
+		next = r.cfg.LLM.Context / 2
+	}
+	return next
+}
+
+// continuationMessages appends the cut-off response and a continuation prompt to the history
+func continuationMessages(messages []llm.Message, partialContent, prompt string) []llm.Message {
+	out := append([]llm.Message(nil), messages...)
+	if partialContent != "" {
+		out = append(out, llm.Message{Role: llm.RoleAssistant, Content: partialContent})
+	}
+	return append(out, llm.Message{Role: llm.RoleUser, Content: prompt})
+}
+
+// truncatedToolCall returns the index of the first tool call whose
+// arguments are not valid JSON, or -1 if all of them parse
+func truncatedToolCall(msg llm.Message) int {
+	for i, tc := range msg.ToolCalls {
+		if !json.Valid([]byte(tc.Function.Arguments)) {
+			return i
+		}
+	}
+	return -1
+}
+
+// stitchArguments joins cut-off tool call arguments with the model's
+// continuation. A reply that restates the whole arguments object is
+// accepted as well.
+func stitchArguments(partial, continuation string) (string, bool) {
+	rest := continuation
+	if fenced := strings.TrimSpace(rest); strings.HasPrefix(fenced, "```") {
+		fenced = strings.TrimPrefix(strings.TrimPrefix(fenced, "```json"), "```")
+		rest = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(fenced), "```"))
+	}
+
+	// Whitespace may be part of a cut-off string value, so try it as sent first
+	for _, args := range []string{partial + rest, partial + strings.TrimSpace(rest)} {
+		if json.Valid([]byte(args)) {
+			return args, true
+		}
+	}
+	if rest = strings.TrimSpace(rest); strings.HasPrefix(rest, "{") && json.Valid([]byte(rest)) {
+		return rest, true
+	}
+	return "", false
+}
@@ -0,0 +1,165 @@
+package agent
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/kvit-s/kvit-coder/internal/config"
+	"github.com/kvit-s/kvit-coder/internal/llm"
+	"github.com/kvit-s/kvit-coder/internal/llm/fake"
+)
+
+// costing makes /generation report cost for a reply
+func costing(step fake.Step, cost float64) fake.Step {
+	var stats llm.GenerationStats
+	stats.Data.TotalCost = cost
+	return step.WithStats(stats)
+}
+
+func truncationConfig() *config.Config {
+	cfg := &config.Config{}
+	cfg.LLM.MaxTokens = 100
+	cfg.LLM.MaxContinuations = 3
+	return cfg
+}
+
+// toolResult returns the content of the first tool result in messages
+func toolResult(messages []llm.Message) string {
+	for _, msg := range messages {
+		if msg.Role == llm.RoleTool {
+			return msg.Content
+		}
+	}
+	return ""
+}
+
+func TestRunContinuesTruncatedText(t *testing.T) {
+	f := newRunnerFixture(t, truncationConfig(),
+		costing(fake.Text("The answer is").WithFinishReason("length").WithUsage(50, 100), 0.25),
+		costing(fake.Text(" forty-two.").WithUsage(60, 5), 0.5),
+	)
+
+	result, err := f.run(t)
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if got := lastMessage(result.FinalMessages).Content; got != "The answer is forty-two." {
+		t.Errorf("final answer = %q", got)
+	}
+
+	reqs := f.server.Requests()
+	if len(reqs) != 2 {
+		t.Fatalf("requests = %d, want 2", len(reqs))
+	}
+	cont := reqs[1].Messages
+	if n := len(cont); n < 2 || cont[n-2].Content != "The answer is" || cont[n-1].Content != continuationPrompt {
+		t.Errorf("continuation request ends with %+v", cont[max(len(cont)-2, 0):])
+	}
+
+	s := result.Stats
+	if s.TruncationCount != 1 || s.ContinuationCount != 1 {
+		t.Errorf("truncations = %d, continuations = %d, want 1, 1", s.TruncationCount, s.ContinuationCount)
+	}
+	if s.TotalPromptTokens != 110 || s.TotalCompletionTokens != 105 || s.TotalCost != 0.75 {
+		t.Errorf("tokens = %d/%d, cost = %v, want 110/105 for 0.75", s.TotalPromptTokens, s.TotalCompletionTokens, s.TotalCost)
+	}
+}
+
+func TestRunStitchesTruncatedToolArguments(t *testing.T) {
+	f := newRunnerFixture(t, truncationConfig(),
+		costing(fake.ToolCall("Echo", `{"text":"ab`).WithFinishReason("length"), 1),
+		costing(fake.Text(`c"}`), 2),
+		costing(fake.Text("done"), 4),
+	)
+
+	result, err := f.run(t)
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if f.echo.calls != 1 || !strings.Contains(toolResult(result.FinalMessages), `"abc"`) {
+		t.Errorf("Echo calls = %d, result = %q", f.echo.calls, toolResult(result.FinalMessages))
+	}
+
+	reqs := f.server.Requests()
+	if len(reqs) != 3 {
+		t.Fatalf("requests = %d, want 3", len(reqs))
+	}
+	if len(reqs[1].Tools) != 0 || !strings.Contains(lastMessage(reqs[1].Messages).Content, `{"text":"ab`) {
+		t.Errorf("continuation request: tools = %d, prompt = %q", len(reqs[1].Tools), lastMessage(reqs[1].Messages).Content)
+	}
+	if result.Stats.TotalCost != 7 {
+		t.Errorf("cost = %v, want each response counted once", result.Stats.TotalCost)
+	}
+}
+
+func TestRunRetriesTruncatedToolCallWithMoreTokens(t *testing.T) {
+	f := newRunnerFixture(t, truncationConfig(),
+		costing(fake.ToolCall("Echo", `{"text":"ab`).WithFinishReason("length"), 1),
+		costing(fake.Text("I cannot continue that"), 2),
+		costing(fake.ToolCall("Echo", `{"text":"abc"}`), 4),
+		costing(fake.Text("done"), 8),
+	)
+
+	result, err := f.run(t)
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if f.echo.calls != 1 || !strings.Contains(toolResult(result.FinalMessages), `"abc"`) {
+		t.Errorf("Echo calls = %d, result = %q", f.echo.calls, toolResult(result.FinalMessages))
+	}
+
+	reqs := f.server.Requests()
+	if len(reqs) != 4 {
+		t.Fatalf("requests = %d, want 4", len(reqs))
+	}
+	if reqs[2].MaxTokens != 200 || len(reqs[2].Messages) != len(reqs[0].Messages) {
+		t.Errorf("retry request: max_tokens = %d, messages = %d", reqs[2].MaxTokens, len(reqs[2].Messages))
+	}
+	if result.Stats.TruncationCount != 1 || result.Stats.ContinuationCount != 1 {
+		t.Errorf("truncations = %d, continuations = %d", result.Stats.TruncationCount, result.Stats.ContinuationCount)
+	}
+	if result.Stats.TotalCost != 15 {
+		t.Errorf("cost = %v, want all four responses counted", result.Stats.TotalCost)
+	}
+}
+
+func TestRunStopsContinuingAtLimit(t *testing.T) {
+	cfg := truncationConfig()
+	cfg.LLM.MaxContinuations = 2
+	f := newRunnerFixture(t, cfg,
+		fake.Text("one").WithFinishReason("length"),
+		fake.Text(" two").WithFinishReason("length"),
+		fake.Text(" three").WithFinishReason("length"),
+	)
+
+	result, err := f.run(t)
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if got := lastMessage(result.FinalMessages).Content; got != "one two three" {
+		t.Errorf("final answer = %q", got)
+	}
+	if result.Stats.TruncationCount != 2 || f.server.Remaining() != 0 {
+		t.Errorf("truncations = %d, remaining steps = %d", result.Stats.TruncationCount, f.server.Remaining())
+	}
+}
+
+func TestStitchArguments(t *testing.T) {
+	tests := []struct {
+		partial, continuation string
+		want                  string
+		ok                    bool
+	}{
+		{`{"text":"ab`, `c"}`, `{"text":"abc"}`, true},
+		{`{"text":"hello`, ` world"}`, `{"text":"hello world"}`, true},
+		{`{"text":"ab`, "\n```json\nc\"}\n```\n", `{"text":"abc"}`, true},
+		{`{"text":"ab`, `{"text":"abc"}`, `{"text":"abc"}`, true},
+		{`{"text":"ab`, `sorry, I can't`, "", false},
+	}
+	for _, tt := range tests {
+		got, ok := stitchArguments(tt.partial, tt.continuation)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("stitchArguments(%q, %q) = %q, %v, want %q, %v", tt.partial, tt.continuation, got, ok, tt.want, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"syscall"
+	"time"
+
+	"github.com/kvit-s/kvit-coder/internal/events"
+	"github.com/kvit-s/kvit-coder/internal/llm"
+	"github.com/kvit-s/kvit-coder/internal/stats"
+)
+
+const (
+	// defaultVerifyRounds caps the failed checks sent back when agent.max_verify_rounds is unset
+	defaultVerifyRounds = 3
+
+	// defaultVerifyTimeout limits one run of the check when agent.verify_timeout is unset
+	defaultVerifyTimeout = 10 * time.Minute
+
+	// maxVerifyOutput is how many characters of a failed check's output the model sees
+	maxVerifyOutput = 8000
+)
+
+// verifyRounds returns how many failed checks go back to the model
+func (r *Runner) verifyRounds() int {
+	if r.cfg.Agent.VerifyRounds == 0 {
+		return defaultVerifyRounds
+	}
+	return r.cfg.Agent.VerifyRounds
+}
+
+// verify runs agent.verify_command in the workspace, records the outcome in
+// s and publishes it. It returns the output for the model when the check
+// failed, or "" when it passed.
+func (r *Runner) verify(ctx context.Context, s *stats.AgentStats) (passed bool, output string) {
+	command := r.cfg.Agent.VerifyCommand
+	timeout := r.cfg.Agent.VerifyTimeout
+	if timeout == 0 {
+		timeout = defaultVerifyTimeout
+	}
+	r.notify(events.LevelInfo, events.TopicVerification, fmt.Sprintf("Verifying: %s", command))
+
+	verifyCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var buf bytes.Buffer
+	cmd := exec.CommandContext(verifyCtx, "sh", "-c", command)
+	cmd.Dir = r.cfg.Workspace.Root
+	cmd.Stdout = &buf
+	cmd.Stderr = &buf
+	// Kill the whole process group, so test binaries started by the command go too
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+
+	start := time.Now()
+	err := cmd.Run()
+	duration := time.Since(start)
+
+	exitCode := 0
+	var exitErr *exec.ExitError
+	switch {
+	case verifyCtx.Err() == context.DeadlineExceeded:
+		exitCode = -1
+		fmt.Fprintf(&buf, "\n[verification timed out after %s]", timeout)
+	case errors.As(err, &exitErr):
+		exitCode = exitErr.ExitCode()
+	case err != nil:
+		exitCode = -1
+		fmt.Fprintf(&buf, "\n[failed to run: %v]", err)
+	}
+
+	passed = exitCode == 0
+	s.VerifyRuns++
+	s.VerifyPassed = passed
+	if !passed {
+		s.VerifyFailures++
+		output = truncateMiddle(buf.String(), float64(maxVerifyOutput)/float64(max(buf.Len(), 1)))
+	}
+
+	r.events.Publish(events.Verification{
+		Command:  command,
+		Round:    s.VerifyRuns,
+		Passed:   passed,
+		ExitCode: exitCode,
+		Output:   output,
+		Duration: duration,
+	})
+	return passed, output
+}
+
+// verifyFailedMessage sends a failed check back to the model
+func verifyFailedMessage(command string, output string) llm.Message {
+	return llm.Message{
+		Role: llm.RoleUser,
+		Content: fmt.Sprintf("[System: Your work isn't done yet: the verification command `%s` failed. "+
+			"Fix the problems below, then give your final answer again.]\n\n%s", command, output),
+	}
+}
@@ -0,0 +1,70 @@
+package agent
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/kvit-s/kvit-coder/internal/config"
+	"github.com/kvit-s/kvit-coder/internal/llm"
+	"github.com/kvit-s/kvit-coder/internal/llm/fake"
+)
+
+func TestRunVerifyFailureGoesBackToModel(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Workspace.Root = t.TempDir()
+	// Fails on the first run and passes on the second
+	cfg.Agent.VerifyCommand = `n=$(cat runs 2>/dev/null || echo 0); echo $((n+1)) > runs; echo "FAIL: TestThing"; [ "$n" -ge 1 ]`
+	f := newRunnerFixture(t, cfg,
+		fake.Text("all fixed"),
+		fake.Text("really fixed now"),
+	)
+
+	result, err := f.run(t)
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if result.StopReason != StopCompleted {
+		t.Errorf("StopReason = %q, want %q", result.StopReason, StopCompleted)
+	}
+	if s := result.Stats; s.VerifyRuns != 2 || s.VerifyFailures != 1 || !s.VerifyPassed {
+		t.Errorf("verify stats = %d runs, %d failures, passed %v; want 2, 1, true", s.VerifyRuns, s.VerifyFailures, s.VerifyPassed)
+	}
+
+	requests := f.server.Requests()
+	if len(requests) != 2 {
+		t.Fatalf("requests = %d, want 2", len(requests))
+	}
+	feedback := lastMessage(requests[1].Messages)
+	if feedback.Role != llm.RoleUser || !strings.Contains(feedback.Content, "FAIL: TestThing") {
+		t.Errorf("feedback = %+v, want the failed command's output", feedback)
+	}
+	if got := lastMessage(result.FinalMessages); got.Content != "really fixed now" {
+		t.Errorf("last message = %+v", got)
+	}
+}
+
+func TestRunVerifyGivesUpAfterMaxRounds(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Workspace.Root = t.TempDir()
+	cfg.Agent.VerifyCommand = "exit 1"
+	cfg.Agent.VerifyRounds = 1
+	f := newRunnerFixture(t, cfg,
+		fake.Text("done"),
+		fake.Text("done, I promise"),
+		fake.Text("never requested"),
+	)
+
+	result, err := f.run(t)
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if result.StopReason != StopVerifyFailed {
+		t.Errorf("StopReason = %q, want %q", result.StopReason, StopVerifyFailed)
+	}
+	if s := result.Stats; s.VerifyRuns != 2 || s.VerifyFailures != 2 || s.VerifyPassed {
+		t.Errorf("verify stats = %d runs, %d failures, passed %v; want 2, 2, false", s.VerifyRuns, s.VerifyFailures, s.VerifyPassed)
+	}
+	if n := len(f.server.Requests()); n != 2 {
+		t.Errorf("requests = %d, want 2", n)
+	}
+}
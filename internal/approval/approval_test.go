@@ -0,0 +1,159 @@
+package approval
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kvit-s/kvit-coder/internal/config"
+	"github.com/kvit-s/kvit-coder/internal/tools"
+)
+
+func TestPolicyDecide(t *testing.T) {
+	policy, err := NewPolicy(config.ApprovalConfig{
+		Default: "ask",
+		Rules: []config.ApprovalRule{
+			{Tool: "Shell*", Command: `^git\s+push`, Action: "deny"},
+			{Tool: "Shell*", Command: `^(ls|git status)\b`, Action: "allow"},
+			{Paths: []string{"**/*.env", "secrets/**", "deploy/[!d]*.yaml"}, Action: "deny", Reason: "secrets"},
+			{Tool: "Read", Action: "allow"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewPolicy() error = %v", err)
+	}
+
+	tests := []struct {
+		name string
+		call Call
+		want Action
+	}{
+		{"denied command", Call{Tool: "Shell", Command: "git push origin main"}, Deny},
+		{"allowed command", Call{Tool: "Shell.advanced", Command: "ls -la"}, Allow},
+		{"other command", Call{Tool: "Shell", Command: "make"}, Ask},
+		{"env file at root", Call{Tool: "Read", Paths: []string{".env"}}, Deny},
+		{"env file nested", Call{Tool: "Read", Paths: []string{"app/prod.env"}}, Deny},
+		{"secrets dir", Call{Tool: "Edit", Paths: []string{"secrets/a/b.txt"}}, Deny},
+		{"character class", Call{Tool: "Edit", Paths: []string{"deploy/prod.yaml"}}, Deny},
+		{"outside the class", Call{Tool: "Read", Paths: []string{"deploy/dev.yaml"}}, Allow},
+		{"read elsewhere", Call{Tool: "Read", Paths: []string{"main.go"}}, Allow},
+		{"command rule needs a command", Call{Tool: "Shell"}, Ask},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := policy.Decide(tt.call).Action; got != tt.want {
+				t.Errorf("Decide(%+v) = %q, want %q", tt.call, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewPolicyFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "policy.yaml")
+	content := "default: deny\nrules:\n  - {tool: Read, action: allow}\n"
+	if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	policy, err := NewPolicy(config.ApprovalConfig{
+		Default:    "allow",
+		PolicyFile: file,
+		Rules:      []config.ApprovalRule{{Tool: "Read", Action: "deny"}},
+	})
+	if err != nil {
+		t.Fatalf("NewPolicy() error = %v", err)
+	}
+	if got := policy.Decide(Call{Tool: "Read"}).Action; got != Allow {
+		t.Errorf("Read = %q, want the policy file's rule to win", got)
+	}
+	if got := policy.Decide(Call{Tool: "Edit"}).Action; got != Deny {
+		t.Errorf("Edit = %q, want the policy file's default", got)
+	}
+}
+
+func TestNewPolicyInvalid(t *testing.T) {
+	for _, cfg := range []config.ApprovalConfig{
+		{Default: "maybe"},
+		{Rules: []config.ApprovalRule{{Tool: "Read", Action: "yes"}}},
+		{Rules: []config.ApprovalRule{{Command: "(", Action: "deny"}}},
+		{PolicyFile: "/nonexistent/policy.yaml"},
+	} {
+		if _, err := NewPolicy(cfg); err == nil {
+			t.Errorf("NewPolicy(%+v) succeeded, want an error", cfg)
+		}
+	}
+}
+
+func TestCallFromArgs(t *testing.T) {
+	root := t.TempDir()
+	args := `{"command":"ls","path":"src/a.go","paths":["/etc/hosts","` + filepath.Join(root, "b.go") + `"]}`
+	call := CallFromArgs("Shell", json.RawMessage(args), root)
+	if call.Command != "ls" {
+		t.Errorf("Command = %q", call.Command)
+	}
+	want := []string{"src/a.go", "/etc/hosts", "b.go"}
+	if strings.Join(call.Paths, ",") != strings.Join(want, ",") {
+		t.Errorf("Paths = %v, want %v", call.Paths, want)
+	}
+}
+
+type scriptedPrompter struct {
+	answers []Answer
+	asked   int
+}
+
+func (p *scriptedPrompter) Confirm(tool, display, reason string) (Answer, error) {
+	if p.asked >= len(p.answers) {
+		return AnswerNo, errors.New("no more answers")
+	}
+	p.asked++
+	return p.answers[p.asked-1], nil
+}
+
+func TestGateApprove(t *testing.T) {
+	policy, err := NewPolicy(config.ApprovalConfig{Default: "ask"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	args := json.RawMessage(`{"command":"make"}`)
+
+	prompter := &scriptedPrompter{answers: []Answer{AnswerNo, AnswerYes, AnswerAlways}}
+	gate := NewGate(policy, prompter, t.TempDir())
+	if err := gate.Approve("Shell", args, "make"); !tools.IsBacktrackable(err) {
+		t.Errorf("declined call: err = %v, want a semantic error", err)
+	}
+	if err := gate.Approve("Shell", args, "make"); err != nil {
+		t.Errorf("approved call: err = %v", err)
+	}
+	if gate.AutoApproved("Shell", args) {
+		t.Error("AutoApproved before always = true")
+	}
+	if err := gate.Approve("Shell", args, "make"); err != nil {
+		t.Errorf("always: err = %v", err)
+	}
+	if err := gate.Approve("Shell", args, "make"); err != nil || prompter.asked != 3 {
+		t.Errorf("after always: err = %v, asked %d times, want 3", err, prompter.asked)
+	}
+	if !gate.AutoApproved("Shell", args) {
+		t.Error("AutoApproved after always = false")
+	}
+}
+
+func TestGateFailsClosed(t *testing.T) {
+	policy, err := NewPolicy(config.ApprovalConfig{Default: "ask"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	gate := NewGate(policy, nil, t.TempDir())
+	if err := gate.Approve("Read", json.RawMessage(`{}`), "Read"); !tools.IsBacktrackable(err) {
+		t.Errorf("err = %v, want a semantic error without a prompter", err)
+	}
+
+	var none *Gate
+	if err := none.Approve("Read", nil, ""); err != nil || !none.AutoApproved("Read", nil) {
+		t.Errorf("nil gate: err = %v, want everything approved", err)
+	}
+}
@@ -0,0 +1,162 @@
+package approval
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/kvit-s/kvit-coder/internal/tools"
+)
+
+// Answer is the user's reply to an approval prompt
+type Answer int
+
+const (
+	AnswerNo     Answer = iota
+	AnswerYes           // run this call
+	AnswerAlways        // run this call and every later call of the same tool
+)
+
+// Prompter asks the user to approve a call
+type Prompter interface {
+	Confirm(tool, display, reason string) (Answer, error)
+}
+
+// Gate applies a policy to tool calls, asking the user when a rule says so.
+// Without a prompter, calls that need asking are denied.
+type Gate struct {
+	policy        *Policy
+	prompter      Prompter
+	workspaceRoot string
+
+	mu      sync.Mutex
+	allowed map[string]bool // Tools the user approved for the rest of the run
+}
+
+// NewGate creates a gate. prompter may be nil for non-interactive runs.
+func NewGate(policy *Policy, prompter Prompter, workspaceRoot string) *Gate {
+	return &Gate{
+		policy:        policy,
+		prompter:      prompter,
+		workspaceRoot: workspaceRoot,
+		allowed:       make(map[string]bool),
+	}
+}
+
+// AutoApproved reports whether the call runs without asking anyone. A nil
+// gate approves everything.
+func (g *Gate) AutoApproved(tool string, args json.RawMessage) bool {
+	if g == nil {
+		return true
+	}
+	d := g.policy.Decide(CallFromArgs(tool, args, g.workspaceRoot))
+	switch d.Action {
+	case Allow:
+		return true
+	case Ask:
+		g.mu.Lock()
+		defer g.mu.Unlock()
+		return g.allowed[tool]
+	}
+	return false
+}
+
+// Approve decides whether the call may run, asking the user if the policy
+// says so. A refusal is returned as a semantic tool error for the model,
+// with the reason. display is the call as shown to the user. A nil gate
+// approves everything.
+func (g *Gate) Approve(tool string, args json.RawMessage, display string) error {
+	if g == nil {
+		return nil
+	}
+	d := g.policy.Decide(CallFromArgs(tool, args, g.workspaceRoot))
+	switch d.Action {
+	case Allow:
+		return nil
+	case Deny:
+		return denied(tool, "denied by the approval policy", d.Reason)
+	}
+
+	g.mu.Lock()
+	always := g.allowed[tool]
+	g.mu.Unlock()
+	if always {
+		return nil
+	}
+	if g.prompter == nil {
+		return denied(tool, "needs approval, and no one is there to approve it in this non-interactive run", d.Reason)
+	}
+
+	answer, err := g.prompter.Confirm(tool, display, d.Reason)
+	if err != nil {
+		return denied(tool, fmt.Sprintf("could not ask for approval (%v)", err), d.Reason)
+	}
+	switch answer {
+	case AnswerAlways:
+		g.mu.Lock()
+		g.allowed[tool] = true
+		g.mu.Unlock()
+		return nil
+	case AnswerYes:
+		return nil
+	}
+	return denied(tool, "the user declined this call", d.Reason)
+}
+
+func denied(tool, why, reason string) error {
+	details := map[string]any{"denied": true}
+	if reason != "" {
+		details["reason"] = reason
+	}
+	return tools.SemanticErrorWithDetails(
+		fmt.Sprintf("%s call not run: %s. Don't retry it; find another way or explain to the user what you need.", tool, why),
+		details)
+}
+
+// TerminalPrompter asks on the controlling terminal, so it works while stdout
+// and stderr are redirected
+type TerminalPrompter struct{}
+
+// NewTerminalPrompter returns a prompter for the controlling terminal, or nil
+// when there is none
+func NewTerminalPrompter() Prompter {
+	tty, err := os.Open("/dev/tty")
+	if err != nil {
+		return nil
+	}
+	tty.Close()
+	return TerminalPrompter{}
+}
+
+// Confirm implements Prompter
+func (TerminalPrompter) Confirm(tool, display, reason string) (Answer, error) {
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return AnswerNo, err
+	}
+	defer tty.Close()
+
+	fmt.Fprintf(tty, "\n⚠️  Approve %s?\n", tool)
+	for _, line := range strings.Split(display, "\n") {
+		fmt.Fprintf(tty, "   %s\n", line)
+	}
+	if reason != "" {
+		fmt.Fprintf(tty, "   (%s)\n", reason)
+	}
+	fmt.Fprintf(tty, "[y]es, [a]lways for %s, [N]o: ", tool)
+
+	line, err := bufio.NewReader(tty).ReadString('\n')
+	if err != nil && line == "" {
+		return AnswerNo, err
+	}
+	switch strings.ToLower(strings.TrimSpace(line)) {
+	case "y", "yes":
+		return AnswerYes, nil
+	case "a", "always":
+		return AnswerAlways, nil
+	}
+	return AnswerNo, nil
+}
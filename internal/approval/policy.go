@@ -0,0 +1,217 @@
+// Package approval decides whether a tool call may run: allowed outright,
+// after the user confirms it, or not at all. Decisions come from ordered rules
+// that match on the tool name, the paths a call touches and shell commands.
+package approval
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/kvit-s/kvit-coder/internal/config"
+	"github.com/kvit-s/kvit-coder/internal/tools"
+)
+
+// Action is what a policy decides for a call
+type Action string
+
+const (
+	Allow Action = "allow"
+	Ask   Action = "ask"
+	Deny  Action = "deny"
+)
+
+// Call is the part of a tool call that rules match on
+type Call struct {
+	Tool    string
+	Paths   []string // Relative to the workspace when inside it
+	Command string   // Shell command, if any
+}
+
+// Decision is the outcome of a policy for one call
+type Decision struct {
+	Action Action
+	Reason string // From the matching rule, or empty
+	Rule   int    // Index of the matching rule, -1 for the default
+}
+
+// rule is a compiled config.ApprovalRule
+type rule struct {
+	config.ApprovalRule
+	paths   []*regexp.Regexp
+	command *regexp.Regexp
+}
+
+// Policy is an ordered list of rules with a default action
+type Policy struct {
+	def   Action
+	rules []rule
+}
+
+// policyFile is the format of approval.policy_file
+type policyFile struct {
+	Default string                `yaml:"default"`
+	Rules   []config.ApprovalRule `yaml:"rules"`
+}
+
+// NewPolicy compiles the approval config. Rules from the policy file come
+// first, and its default replaces the config's.
+func NewPolicy(cfg config.ApprovalConfig) (*Policy, error) {
+	def := cfg.Default
+	rules := cfg.Rules
+	if cfg.PolicyFile != "" {
+		data, err := os.ReadFile(cfg.PolicyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read approval policy: %w", err)
+		}
+		var file policyFile
+		if err := yaml.Unmarshal(data, &file); err != nil {
+			return nil, fmt.Errorf("failed to parse approval policy %s: %w", cfg.PolicyFile, err)
+		}
+		if file.Default != "" {
+			def = file.Default
+		}
+		rules = append(file.Rules, rules...)
+	}
+	if def == "" {
+		def = string(Allow)
+	}
+	if !validAction(def) {
+		return nil, fmt.Errorf("approval default %q: want allow, ask or deny", def)
+	}
+
+	p := &Policy{def: Action(def)}
+	for i, r := range rules {
+		compiled, err := compileRule(r)
+		if err != nil {
+			return nil, fmt.Errorf("approval rule %d: %w", i+1, err)
+		}
+		p.rules = append(p.rules, compiled)
+	}
+	return p, nil
+}
+
+func compileRule(r config.ApprovalRule) (rule, error) {
+	compiled := rule{ApprovalRule: r}
+	if !validAction(r.Action) {
+		return compiled, fmt.Errorf("action %q: want allow, ask or deny", r.Action)
+	}
+	if _, err := path.Match(r.Tool, ""); err != nil {
+		return compiled, fmt.Errorf("tool pattern %q: %w", r.Tool, err)
+	}
+	for _, glob := range r.Paths {
+		re, err := regexp.Compile("^" + tools.GlobToRegexp(glob, false) + "$")
+		if err != nil {
+			return compiled, fmt.Errorf("path pattern %q: %w", glob, err)
+		}
+		compiled.paths = append(compiled.paths, re)
+	}
+	if r.Command != "" {
+		re, err := regexp.Compile(r.Command)
+		if err != nil {
+			return compiled, fmt.Errorf("command pattern: %w", err)
+		}
+		compiled.command = re
+	}
+	return compiled, nil
+}
+
+func validAction(action string) bool {
+	switch Action(action) {
+	case Allow, Ask, Deny:
+		return true
+	}
+	return false
+}
+
+// Decide returns the action of the first rule that matches c, or the default
+func (p *Policy) Decide(c Call) Decision {
+	for i, r := range p.rules {
+		if r.matches(c) {
+			return Decision{Action: Action(r.Action), Reason: r.Reason, Rule: i}
+		}
+	}
+	return Decision{Action: p.def, Rule: -1}
+}
+
+// matches reports whether every condition of the rule holds for c. A rule
+// with path globs needs a call with a matching path, and one with a command
+// pattern a matching shell command.
+func (r rule) matches(c Call) bool {
+	if r.Tool != "" {
+		if ok, _ := path.Match(r.Tool, c.Tool); !ok {
+			return false
+		}
+	}
+	if len(r.paths) > 0 && !anyPathMatches(r.paths, c.Paths) {
+		return false
+	}
+	if r.command != nil && (c.Command == "" || !r.command.MatchString(c.Command)) {
+		return false
+	}
+	return true
+}
+
+func anyPathMatches(globs []*regexp.Regexp, paths []string) bool {
+	for _, p := range paths {
+		for _, glob := range globs {
+			if glob.MatchString(p) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// CallFromArgs extracts the paths and shell command of a tool call from its
+// arguments. Paths inside workspaceRoot are made relative to it.
+func CallFromArgs(tool string, args json.RawMessage, workspaceRoot string) Call {
+	c := Call{Tool: tool}
+	var params map[string]any
+	if json.Unmarshal(args, &params) != nil {
+		return c
+	}
+	if cmd, ok := params["command"].(string); ok {
+		c.Command = cmd
+	}
+	for _, key := range []string{"path", "file_path", "working_dir"} {
+		if p, ok := params[key].(string); ok && p != "" {
+			c.Paths = append(c.Paths, workspacePath(p, workspaceRoot))
+		}
+	}
+	if list, ok := params["paths"].([]any); ok {
+		for _, item := range list {
+			if p, ok := item.(string); ok && p != "" {
+				c.Paths = append(c.Paths, workspacePath(p, workspaceRoot))
+			}
+		}
+	}
+	return c
+}
+
+// workspacePath returns p relative to the workspace, or as a clean absolute
+// path when it is outside
+func workspacePath(p, workspaceRoot string) string {
+	abs := p
+	if !filepath.IsAbs(p) {
+		abs = filepath.Join(workspaceRoot, p)
+	}
+	abs = filepath.Clean(abs)
+	root, err := filepath.Abs(workspaceRoot)
+	if err != nil {
+		return filepath.ToSlash(abs)
+	}
+	if absP, err := filepath.Abs(abs); err == nil {
+		abs = absP
+	}
+	if rel, err := filepath.Rel(root, abs); err == nil && rel != ".." && !strings.HasPrefix(rel, "../") {
+		return filepath.ToSlash(rel)
+	}
+	return filepath.ToSlash(abs)
+}
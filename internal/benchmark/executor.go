@@ -14,6 +14,7 @@ import (
 
 	"github.com/kvit-s/kvit-coder/internal/agent"
 	"github.com/kvit-s/kvit-coder/internal/config"
+	"github.com/kvit-s/kvit-coder/internal/events"
 	"github.com/kvit-s/kvit-coder/internal/llm"
 )
 
@@ -72,12 +73,17 @@ func (e *Executor) Execute(ctx context.Context, benchmark BenchmarkDef, runID in
 	// Track start time
 	startTime := time.Now()
 
+	// Collect tool failures and backtracks from the runner's events
+	metrics := events.NewMetrics()
+	unsubscribe := e.runner.Events().Subscribe(metrics)
+
 	// Run agent
 	agentResult, err := e.runner.Run(timeoutCtx, agent.RunConfig{
 		Messages:     messages,
 		UseFileFirst: false,
 		QuietMode:    true,
 	})
+	unsubscribe()
 
 	completedAt := time.Now()
 	durationMS := completedAt.Sub(startTime).Milliseconds()
@@ -126,6 +132,11 @@ func (e *Executor) Execute(ctx context.Context, benchmark BenchmarkDef, runID in
 		result.GenerationMS = stats.TotalGenerationMS
 		result.ToolCalls = toolCalls
 	}
+	snapshot := metrics.Snapshot()
+	for _, t := range snapshot.Tools {
+		result.ToolFailures += t.Failures
+	}
+	result.Backtracks = snapshot.Backtracks
 
 	return &ExecuteResult{
 		RunResult:    result,
@@ -54,6 +54,8 @@ type RunResult struct {
 	PromptMS        float64       `json:"prompt_ms" csv:"prompt_ms"`
 	GenerationMS    float64       `json:"generation_ms" csv:"generation_ms"`
 	ToolCalls       []ToolCallLog `json:"tool_calls" csv:"-"`
+	ToolFailures    int           `json:"tool_failures" csv:"-"`
+	Backtracks      int           `json:"backtracks" csv:"-"`
 	Errors          []string      `json:"errors" csv:"-"`
 	StartedAt       time.Time     `json:"started_at" csv:"started_at"`
 	CompletedAt     time.Time     `json:"completed_at" csv:"completed_at"`
@@ -189,6 +189,27 @@ func (m *Manager) createInitialCommit() error {
 	return nil
 }
 
+// SessionID returns the ID that names the shadow repository
+func (m *Manager) SessionID() string {
+	return m.sessionID
+}
+
+// Resume continues the checkpoints of an earlier process with the same
+// session ID, whose shadow repository is still there, after its last turn
+func (m *Manager) Resume(turn int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.enabled {
+		return nil
+	}
+	if _, err := os.Stat(filepath.Join(m.checkpointDir, ".git")); err != nil {
+		return fmt.Errorf("no checkpoints to resume: %w", err)
+	}
+	m.currentTurn = turn
+	return nil
+}
+
 // CurrentTurn returns the current turn number
 func (m *Manager) CurrentTurn() int {
 	m.mu.RLock()
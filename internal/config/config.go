@@ -8,11 +8,13 @@ import (
 	"strings"
 	"time"
 
+	"github.com/kvit-s/kvit-coder/internal/llm"
 	"gopkg.in/yaml.v3"
 )
 
 type Config struct {
 	LLM struct {
+		Provider      string  `yaml:"provider"`       // "openai" (default, any OpenAI-compatible API), "anthropic" or "ollama"
 		BaseURL       string  `yaml:"base_url"`
 		APIKey        string  `yaml:"api_key"`
 		APIKeyEnv     string  `yaml:"api_key_env"`
@@ -23,6 +25,19 @@ type Config struct {
 		MergeThinking bool    `yaml:"merge_thinking"` // Merge reasoning_content into content (default: false, discard thinking)
 		Verbose       int     `yaml:"verbose"`        // 0 = off, >0 = show tool output up to N lines
 		BenchmarkCmd  string  `yaml:"benchmark_cmd"`  // External command for benchmarks (use {prompt} placeholder)
+		Stream        bool    `yaml:"stream"`         // Stream responses (SSE) and render tokens as they arrive
+
+		ThinkingBudget int    `yaml:"thinking_budget"` // Extended thinking budget tokens (anthropic provider only, 0 = off)
+		NumCtx         int    `yaml:"num_ctx"`         // Context window to load the model with (ollama provider only, 0 = use context)
+		KeepAlive      string `yaml:"keep_alive"`      // How long the model stays loaded, e.g. "10m" or "-1" (ollama provider only)
+
+		Endpoints        []LLMEndpoint `yaml:"endpoints"`         // Multiple endpoints with failover (overrides base_url)
+		EndpointStrategy string        `yaml:"endpoint_strategy"` // "round_robin" (default) or "least_latency"
+
+		Tokenizer     string `yaml:"tokenizer"`      // Token estimator for the pre-flight context check: "auto" (default), "heuristic", "llama-server" or "off"
+		ContextAction string `yaml:"context_action"` // When a request would overflow context: "truncate" (default, shorten newest tool output), "warn" or "off"
+
+		MaxContinuations int `yaml:"max_continuations"` // Follow-up requests to complete a response cut off at max_output_tokens (default: 3, -1 = off)
 	} `yaml:"llm"`
 
 	Workspace struct {
@@ -36,10 +51,30 @@ type Config struct {
 
 	Agent struct {
 		MaxIterations int `yaml:"max_tool_iterations"`
+
+		ParallelReadTools int `yaml:"parallel_read_tools"` // Read-only tool calls of one turn run at the same time (default: 8, 1 = one at a time)
+
+		// Run budgets; when one runs out the model gets a last turn to wrap up (0 = no limit)
+		MaxCost     float64       `yaml:"max_cost"`     // USD, as reported by the provider
+		MaxTokens   int           `yaml:"max_tokens"`   // Prompt plus completion tokens over all requests
+		MaxDuration time.Duration `yaml:"max_duration"` // Wall time, e.g. "30m"
+
+		MaxLoopInterventions int `yaml:"max_loop_interventions"` // Loop warnings before the run stops (0 = keep warning)
+
+		// Done check run on each final answer; when it fails, its output goes back to the model (empty = off)
+		VerifyCommand string        `yaml:"verify_command"`    // Shell command run in the workspace, e.g. "go test ./..."
+		VerifyRounds  int           `yaml:"max_verify_rounds"` // Failed checks sent back before the answer is accepted anyway (default: 3)
+		VerifyTimeout time.Duration `yaml:"verify_timeout"`    // Per run of the command (default: 10m)
 	} `yaml:"agent"`
 
 	Backtrack BacktrackConfig `yaml:"backtrack"`
 
+	Compaction CompactionConfig `yaml:"compaction"`
+
+	Masking MaskingConfig `yaml:"masking"`
+
+	Approval ApprovalConfig `yaml:"approval"`
+
 	Tools ToolsConfig `yaml:"tools"`
 }
 
@@ -54,6 +89,16 @@ type ToolsConfig struct {
 	Checkpoint  CheckpointToolsConfig `yaml:"checkpoint"`
 	Tasks       TasksToolsConfig      `yaml:"tasks"`
 
+	Delegate DelegateToolConfig `yaml:"delegate"`
+
+	Glob GlobToolConfig `yaml:"glob"`
+
+	Code CodeToolsConfig `yaml:"code"`
+
+	LSP LSPToolsConfig `yaml:"lsp"`
+
+	Process ProcessToolsConfig `yaml:"process"`
+
 	// Safety confirmations (runtime only, not persisted)
 	SafetyConfirmations map[string]SafetyConfirmation `yaml:"-"`
 }
@@ -91,11 +136,52 @@ type SearchToolConfig struct {
 	// Above max_compact_results: save to temp file, show truncated
 }
 
+// GlobToolConfig configures the Glob tool
+type GlobToolConfig struct {
+	Enabled    bool `yaml:"enabled"`
+	MaxResults int  `yaml:"max_results"` // List up to this many files, save the rest to a temp file (default: 200)
+}
+
+// CodeToolsConfig configures the Code.* tools, which navigate Go source
+type CodeToolsConfig struct {
+	Enabled       bool `yaml:"enabled"`
+	MaxReferences int  `yaml:"max_references"` // List up to this many uses, save the rest to a temp file (default: 100)
+}
+
+// LSPToolsConfig configures the LSP.* tools, which ask language servers
+// about the files they are configured for
+type LSPToolsConfig struct {
+	Enabled        bool              `yaml:"enabled"`
+	Servers        []LSPServerConfig `yaml:"servers"`
+	TimeoutSeconds int               `yaml:"timeout_seconds"` // Per request, including starting the server (default: 30)
+	MaxResults     int               `yaml:"max_results"`     // List up to this many locations, save the rest to a temp file (default: 100)
+}
+
+// LSPServerConfig is a language server started over stdio for files with
+// one of its extensions
+type LSPServerConfig struct {
+	Name                  string         `yaml:"name"`       // Shown in results (default: base name of command)
+	Extensions            []string       `yaml:"extensions"` // e.g. [".py", ".pyi"]
+	Command               string         `yaml:"command"`
+	Args                  []string       `yaml:"args"`
+	LanguageID            string         `yaml:"language_id"`            // textDocument languageId (default: extension without the dot)
+	InitializationOptions map[string]any `yaml:"initialization_options"` // Passed to the server as is
+}
+
 // ShellToolConfig configures the shell tool
 type ShellToolConfig struct {
 	Enabled            bool     `yaml:"enabled"`
 	AllowedCommands    []string `yaml:"allowed_commands"`    // allowlist (empty = allow all)
 	DisallowedCommands []string `yaml:"disallowed_commands"` // blocklist (checked after allowlist)
+
+	Persistent bool `yaml:"persistent"` // One long-lived bash per session: cd, export and activated virtualenvs carry over between calls
+}
+
+// ProcessToolsConfig configures the Process.* tools, which run commands in
+// the background. Commands are checked like shell commands.
+type ProcessToolsConfig struct {
+	Enabled      bool `yaml:"enabled"`
+	MaxProcesses int  `yaml:"max_processes"` // Running at the same time (default: 8)
 }
 
 // PlanToolsConfig configures all plan.* tools as a group
@@ -127,6 +213,19 @@ type TasksToolsConfig struct {
 	NotifyFileChanges   bool `yaml:"notify_file_changes"`   // Notify about file changes in task (default: true)
 }
 
+// DelegateToolConfig configures Agent.delegate, which hands a task to a
+// sub-agent with its own history and returns only its final summary
+type DelegateToolConfig struct {
+	Enabled       bool     `yaml:"enabled"`
+	Tools         []string `yaml:"tools"`               // Tools the sub-agent can use (default: the read-only tools)
+	MaxIterations int      `yaml:"max_tool_iterations"` // Per delegated task (default: 20)
+
+	// Budgets per delegated task (0 = no limit)
+	MaxCost     float64       `yaml:"max_cost"`
+	MaxTokens   int           `yaml:"max_tokens"`
+	MaxDuration time.Duration `yaml:"max_duration"`
+}
+
 // BacktrackConfig configures the backtrack error handling mode
 type BacktrackConfig struct {
 	Enabled           bool `yaml:"enabled"`             // Enable backtrack mode (default: true)
@@ -134,6 +233,48 @@ type BacktrackConfig struct {
 	InjectUserMessage bool `yaml:"inject_user_message"` // On limit reached: backtrack + inject user message instead of error-in-history
 }
 
+// CompactionConfig configures automatic summarization of older turns when
+// the conversation nears the context window
+type CompactionConfig struct {
+	Enabled       bool    `yaml:"enabled"`        // Compact the conversation when nearing llm.context (default: false)
+	Threshold     float64 `yaml:"threshold"`      // Share of llm.context that triggers compaction (default: 0.8)
+	KeepRecent    int     `yaml:"keep_recent"`    // Most recent messages kept verbatim (default: 10)
+	SummaryTokens int     `yaml:"summary_tokens"` // Max output tokens for the summary (default: 1024)
+}
+
+// MaskingConfig configures rewriting of stale tool results before each request
+type MaskingConfig struct {
+	Enabled       bool                   `yaml:"enabled"`        // Mask old tool results (default: false)
+	Stride        int                    `yaml:"stride"`         // Re-mask every N turns so the prompt prefix stays cacheable in between (default: 4)
+	CollapseReads bool                   `yaml:"collapse_reads"` // Stub reads of a file that was read again or edited later
+	Rules         map[string]MaskingRule `yaml:"rules"`          // Per tool name, "*" for all other tools (default: Read, Shell, Shell.advanced, Search)
+}
+
+// ApprovalConfig configures the policy that decides, for each tool call,
+// whether it runs, needs the user's confirmation or is denied
+type ApprovalConfig struct {
+	Enabled     bool           `yaml:"enabled"`
+	Default     string         `yaml:"default"`     // Action when no rule matches: "allow" (default), "ask" or "deny"
+	Interactive string         `yaml:"interactive"` // "auto" (default) asks on the terminal when there is one; "never" denies what needs asking
+	PolicyFile  string         `yaml:"policy_file"` // YAML file with a default and rules, checked before the rules below
+	Rules       []ApprovalRule `yaml:"rules"`
+}
+
+// ApprovalRule matches tool calls; the first rule that matches decides
+type ApprovalRule struct {
+	Tool    string   `yaml:"tool"`    // Glob on the tool name, e.g. "Shell*" (empty = any tool)
+	Paths   []string `yaml:"paths"`   // Globs on the call's paths, relative to the workspace; ** spans directories
+	Command string   `yaml:"command"` // Regular expression on the shell command
+	Action  string   `yaml:"action"`  // "allow", "ask" or "deny"
+	Reason  string   `yaml:"reason"`  // Shown to the user and the model
+}
+
+// MaskingRule configures how old results of one tool are masked
+type MaskingRule struct {
+	AfterTurns int `yaml:"after_turns"` // Mask results older than this many assistant turns (0 = never)
+	MaxLines   int `yaml:"max_lines"`   // Keep this many lines of old output (0 = replace it with a stub)
+}
+
 // GetShowLineNumbers returns whether line numbers should be shown in Read output.
 // Defaults to true for backward compatibility.
 func (r *ReadToolConfig) GetShowLineNumbers() bool {
@@ -151,6 +292,13 @@ func (e *EditToolConfig) GetEditMode() string {
 	return e.Mode
 }
 
+// LLMEndpoint is one entry of llm.endpoints. All endpoints use llm.provider and the API key.
+type LLMEndpoint struct {
+	BaseURL string `yaml:"base_url"`
+	Weight  int    `yaml:"weight"` // Relative share of requests for round_robin (default 1)
+	Model   string `yaml:"model"`  // Overrides llm.model for this endpoint
+}
+
 // SafetyConfirmation tracks user confirmations for path access
 // This is memory-only and does not persist across sessions
 type SafetyConfirmation struct {
@@ -177,6 +325,32 @@ func Load(path string) (*Config, error) {
 		}
 	}
 
+	// With an endpoint list, base_url names the first endpoint for display
+	if cfg.LLM.BaseURL == "" && len(cfg.LLM.Endpoints) > 0 {
+		cfg.LLM.BaseURL = cfg.LLM.Endpoints[0].BaseURL
+	}
+
+	// Native providers have well-known endpoints
+	if cfg.LLM.BaseURL == "" {
+		switch cfg.LLM.Provider {
+		case "anthropic":
+			cfg.LLM.BaseURL = llm.DefaultAnthropicBaseURL
+		case "ollama":
+			cfg.LLM.BaseURL = llm.DefaultOllamaBaseURL
+		}
+	}
+	// Ollama loads models with a small default context; use the configured context size
+	if cfg.LLM.Provider == "ollama" && cfg.LLM.NumCtx == 0 {
+		cfg.LLM.NumCtx = cfg.LLM.Context
+	}
+
+	if cfg.LLM.ContextAction == "" {
+		cfg.LLM.ContextAction = "truncate"
+	}
+	if cfg.LLM.MaxContinuations == 0 {
+		cfg.LLM.MaxContinuations = 3
+	}
+
 	// Convert workspace root to absolute path
 	if cfg.Workspace.Root != "" {
 		absRoot, err := filepath.Abs(cfg.Workspace.Root)
@@ -213,6 +387,19 @@ func Load(path string) (*Config, error) {
 		cfg.Tools.Checkpoint.MaxTurns = 100
 	}
 
+	// Set default approval settings
+	if cfg.Approval.Default == "" {
+		cfg.Approval.Default = "allow"
+	}
+	if cfg.Approval.Interactive == "" {
+		cfg.Approval.Interactive = "auto"
+	}
+
+	// Set default delegate settings
+	if cfg.Tools.Delegate.MaxIterations == 0 {
+		cfg.Tools.Delegate.MaxIterations = 20
+	}
+
 	// Set default path safety mode
 	if cfg.Workspace.PathSafetyMode == "" {
 		cfg.Workspace.PathSafetyMode = "ask_once"
@@ -224,6 +411,33 @@ func Load(path string) (*Config, error) {
 		cfg.Backtrack.MaxRetries = 5 // Default max retries if enabled
 	}
 
+	// Set default compaction settings
+	if cfg.Compaction.Threshold == 0 {
+		cfg.Compaction.Threshold = 0.8
+	}
+	if cfg.Compaction.KeepRecent == 0 {
+		cfg.Compaction.KeepRecent = 10
+	}
+	if cfg.Compaction.KeepRecent < 0 {
+		return nil, fmt.Errorf("compaction.keep_recent must not be negative, got %d", cfg.Compaction.KeepRecent)
+	}
+	if cfg.Compaction.SummaryTokens == 0 {
+		cfg.Compaction.SummaryTokens = 1024
+	}
+
+	// Set default masking settings
+	if cfg.Masking.Stride == 0 {
+		cfg.Masking.Stride = 4
+	}
+	if cfg.Masking.Rules == nil {
+		cfg.Masking.Rules = map[string]MaskingRule{
+			"Read":           {AfterTurns: 6},
+			"Shell":          {AfterTurns: 4, MaxLines: 20},
+			"Shell.advanced": {AfterTurns: 4, MaxLines: 20},
+			"Search":         {AfterTurns: 6, MaxLines: 20},
+		}
+	}
+
 	// Set default Tasks tools settings
 	if cfg.Tools.Tasks.TaskWarnTurns == 0 {
 		cfg.Tools.Tasks.TaskWarnTurns = 5
@@ -257,8 +471,16 @@ func (c *Config) IsToolEnabled(toolName string) bool {
 		return c.Tools.RestoreFile.Enabled
 	case "search":
 		return c.Tools.Search.Enabled
+	case "glob":
+		return c.Tools.Glob.Enabled
+	case "Code.outline", "Code.definition", "Code.references":
+		return c.Tools.Code.Enabled
+	case "LSP.hover", "LSP.definition", "LSP.references", "LSP.symbols", "LSP.diagnostics":
+		return c.Tools.LSP.Enabled
 	case "shell":
 		return c.Tools.Shell.Enabled
+	case "Process.start", "Process.output", "Process.write", "Process.list", "Process.kill":
+		return c.Tools.Process.Enabled
 	case "plan.create", "plan.add_step", "plan.complete_step", "plan.remove_step", "plan.move_step":
 		// Plan tools are disabled when Tasks tools are enabled
 		return c.Tools.Plan.Enabled && !c.Tools.Tasks.Enabled
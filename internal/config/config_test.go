@@ -3,7 +3,9 @@ package config
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestLoad(t *testing.T) {
@@ -24,6 +26,8 @@ workspace:
 
 agent:
   max_tool_iterations: 5
+  max_cost: 2.5
+  max_duration: "30m"
 
 tools:
   shell:
@@ -75,6 +79,10 @@ tools:
 	if cfg.Agent.MaxIterations != 5 {
 		t.Errorf("Agent.MaxIterations = %d, want %d", cfg.Agent.MaxIterations, 5)
 	}
+	if cfg.Agent.MaxCost != 2.5 || cfg.Agent.MaxDuration != 30*time.Minute || cfg.Agent.MaxTokens != 0 {
+		t.Errorf("Agent budgets = $%v, %v, %d tokens; want $2.5, 30m, no token limit",
+			cfg.Agent.MaxCost, cfg.Agent.MaxDuration, cfg.Agent.MaxTokens)
+	}
 
 	// Verify tools config
 	if !cfg.Tools.Shell.Enabled {
@@ -185,3 +193,15 @@ func TestLoadInvalidYAML(t *testing.T) {
 		t.Error("Load() with invalid YAML should return error")
 	}
 }
+
+func TestLoadNegativeKeepRecent(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(configPath, []byte("compaction:\n  keep_recent: -1\n"), 0644); err != nil {
+		t.Fatalf("Failed to create config: %v", err)
+	}
+
+	_, err := Load(configPath)
+	if err == nil || !strings.Contains(err.Error(), "keep_recent") {
+		t.Errorf("Load() error = %v, want keep_recent rejected", err)
+	}
+}
@@ -0,0 +1,311 @@
+// Package control lets other processes steer a running agent through a Unix
+// socket: add user messages to the conversation, pause and resume the loop,
+// cancel the tool call in progress or abort the run.
+//
+// Clients write one JSON request per line and get one JSON response per line:
+//
+//	{"type": "message", "text": "stop, that's the wrong file"}
+//	{"ok": true}
+package control
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Request types
+const (
+	TypeMessage    = "message"     // add Text as a user message at the next iteration
+	TypePause      = "pause"       // stop at the next iteration until resumed
+	TypeResume     = "resume"      // end a pause
+	TypeCancelTool = "cancel_tool" // cancel the tool call in progress; the model sees it as failed
+	TypeAbort      = "abort"       // cancel the run
+)
+
+// Request is a line sent to the control socket
+type Request struct {
+	Type string `json:"type"`
+	Text string `json:"text,omitempty"`
+}
+
+// Response answers a request
+type Response struct {
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+// Server listens on a control socket and holds the requests for the runner.
+// Its runner-side methods are safe to call on a nil *Server, which never
+// steers anything.
+type Server struct {
+	listener net.Listener
+	path     string
+
+	mu         sync.Mutex
+	messages   []string
+	paused     bool
+	resumed    chan struct{}      // Closed when the current pause ends
+	toolCancel context.CancelFunc // Cancels the tool call in progress, if any
+	cancelled  bool               // The tool call in progress was cancelled
+	abort      context.CancelFunc // Cancels the attached run
+	aborted    bool
+	conns      map[net.Conn]struct{} // Open client connections, closed by Close
+	closed     bool
+
+	wg sync.WaitGroup // The accept loop and the connection handlers
+}
+
+// Listen creates the control socket at path, replacing a stale one left by a
+// process that died. The caller must hold the session lock, so no live
+// process can own the socket.
+func Listen(path string) (*Server, error) {
+	// Replace a socket left behind by an earlier run, but nothing else
+	if info, err := os.Lstat(path); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("control socket path exists and is not a socket: %s", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, fmt.Errorf("failed to remove stale control socket: %w", err)
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to check control socket path: %w", err)
+	}
+	// The socket is created owner-only, so no one else can connect between
+	// its creation and a chmod. The umask is process-wide, but Listen runs
+	// at startup, before anything else creates files.
+	oldMask := syscall.Umask(0177)
+	listener, err := net.Listen("unix", path)
+	syscall.Umask(oldMask)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create control socket: %w", err)
+	}
+
+	s := &Server{listener: listener, path: path, conns: make(map[net.Conn]struct{})}
+	s.wg.Add(1)
+	go s.serve()
+	return s, nil
+}
+
+// Path returns the socket path
+func (s *Server) Path() string {
+	return s.path
+}
+
+// Close stops listening, closes the client connections, waits for the
+// requests in progress and removes the socket
+func (s *Server) Close() error {
+	err := s.listener.Close()
+	s.mu.Lock()
+	s.closed = true
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+	_ = os.Remove(s.path)
+	return err
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			conn.Close()
+			return
+		}
+		s.conns[conn] = struct{}{}
+		s.wg.Add(1)
+		s.mu.Unlock()
+		go s.handle(conn)
+	}
+}
+
+func (s *Server) handle(conn net.Conn) {
+	defer s.wg.Done()
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		conn.Close()
+	}()
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	encoder := json.NewEncoder(conn)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var req Request
+		resp := Response{OK: true}
+		if err := json.Unmarshal([]byte(line), &req); err != nil {
+			resp = Response{Error: fmt.Sprintf("invalid request: %v", err)}
+		} else if err := s.apply(req); err != nil {
+			resp = Response{Error: err.Error()}
+		}
+		if encoder.Encode(resp) != nil {
+			return
+		}
+	}
+}
+
+// apply carries out a request
+func (s *Server) apply(req Request) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch req.Type {
+	case TypeMessage:
+		if strings.TrimSpace(req.Text) == "" {
+			return errors.New("message text is empty")
+		}
+		s.messages = append(s.messages, req.Text)
+	case TypePause:
+		if !s.paused {
+			s.paused = true
+			s.resumed = make(chan struct{})
+		}
+	case TypeResume:
+		if s.paused {
+			s.paused = false
+			close(s.resumed)
+		}
+	case TypeCancelTool:
+		if s.toolCancel == nil {
+			return errors.New("no tool call in progress")
+		}
+		s.cancelled = true
+		s.toolCancel()
+	case TypeAbort:
+		s.aborted = true
+		if s.abort != nil {
+			s.abort()
+		}
+	default:
+		return fmt.Errorf("unknown request type %q", req.Type)
+	}
+	return nil
+}
+
+// Attach returns a context for a run that is cancelled by an abort request
+func (s *Server) Attach(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+	if s == nil {
+		return ctx, cancel
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.abort = cancel
+	if s.aborted {
+		cancel()
+	}
+	return ctx, cancel
+}
+
+// Paused reports whether a pause is in effect
+func (s *Server) Paused() bool {
+	if s == nil {
+		return false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.paused
+}
+
+// WaitWhilePaused blocks until the current pause, if any, ends or ctx is done
+func (s *Server) WaitWhilePaused(ctx context.Context) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	resumed := s.resumed
+	paused := s.paused
+	s.mu.Unlock()
+	if !paused {
+		return
+	}
+	select {
+	case <-resumed:
+	case <-ctx.Done():
+	}
+}
+
+// HasMessages reports whether user messages are waiting
+func (s *Server) HasMessages() bool {
+	if s == nil {
+		return false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.messages) > 0
+}
+
+// TakeMessages returns the waiting user messages, oldest first, and clears them
+func (s *Server) TakeMessages() []string {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	messages := s.messages
+	s.messages = nil
+	return messages
+}
+
+// ToolContext returns the context for a tool call that a cancel_tool request
+// can cancel. done must be called when the call returns; it reports whether
+// the call was cancelled that way.
+func (s *Server) ToolContext(ctx context.Context) (toolCtx context.Context, done func() (cancelled bool)) {
+	if s == nil {
+		return ctx, func() bool { return false }
+	}
+	toolCtx, cancel := context.WithCancel(ctx)
+	s.mu.Lock()
+	s.toolCancel = cancel
+	s.cancelled = false
+	s.mu.Unlock()
+	return toolCtx, func() bool {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.toolCancel = nil
+		cancel()
+		return s.cancelled
+	}
+}
+
+// Send sends a request to the control socket at path and waits for the answer
+func Send(path string, req Request) error {
+	conn, err := net.DialTimeout("unix", path, 5*time.Second)
+	if err != nil {
+		return fmt.Errorf("no agent is listening on %s: %w", path, err)
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	var resp Response
+	if err := json.NewDecoder(conn).Decode(&resp); err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+	if !resp.OK {
+		return errors.New(resp.Error)
+	}
+	return nil
+}
@@ -0,0 +1,188 @@
+package control
+
+import (
+	"context"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func listen(t *testing.T) (*Server, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "control.sock")
+	s, err := Listen(path)
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s, path
+}
+
+func TestMessages(t *testing.T) {
+	s, path := listen(t)
+	for _, text := range []string{"first", "second"} {
+		if err := Send(path, Request{Type: TypeMessage, Text: text}); err != nil {
+			t.Fatalf("Send(%q) error = %v", text, err)
+		}
+	}
+	if err := Send(path, Request{Type: TypeMessage, Text: "  "}); err == nil {
+		t.Error("Send() of an empty message succeeded, want an error")
+	}
+	if err := Send(path, Request{Type: "reboot"}); err == nil {
+		t.Error("Send() of an unknown type succeeded, want an error")
+	}
+
+	if !s.HasMessages() {
+		t.Fatal("HasMessages() = false, want true")
+	}
+	got := s.TakeMessages()
+	if len(got) != 2 || got[0] != "first" || got[1] != "second" {
+		t.Errorf("TakeMessages() = %q, want [first second]", got)
+	}
+	if s.HasMessages() {
+		t.Error("HasMessages() after TakeMessages() = true, want false")
+	}
+}
+
+func TestPauseResume(t *testing.T) {
+	s, path := listen(t)
+	if err := Send(path, Request{Type: TypePause}); err != nil {
+		t.Fatalf("Send(pause) error = %v", err)
+	}
+	if !s.Paused() {
+		t.Fatal("Paused() = false, want true")
+	}
+
+	waited := make(chan struct{})
+	go func() {
+		s.WaitWhilePaused(context.Background())
+		close(waited)
+	}()
+	select {
+	case <-waited:
+		t.Fatal("WaitWhilePaused() returned before resume")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	if err := Send(path, Request{Type: TypeResume}); err != nil {
+		t.Fatalf("Send(resume) error = %v", err)
+	}
+	select {
+	case <-waited:
+	case <-time.After(5 * time.Second):
+		t.Fatal("WaitWhilePaused() did not return after resume")
+	}
+}
+
+func TestCancelToolAndAbort(t *testing.T) {
+	s, path := listen(t)
+	if err := Send(path, Request{Type: TypeCancelTool}); err == nil {
+		t.Error("Send(cancel_tool) with no tool running succeeded, want an error")
+	}
+
+	runCtx, cancel := s.Attach(context.Background())
+	defer cancel()
+	toolCtx, done := s.ToolContext(runCtx)
+	if err := Send(path, Request{Type: TypeCancelTool}); err != nil {
+		t.Fatalf("Send(cancel_tool) error = %v", err)
+	}
+	if toolCtx.Err() == nil {
+		t.Error("tool context not cancelled")
+	}
+	if !done() {
+		t.Error("done() = false, want true for a cancelled call")
+	}
+	if runCtx.Err() != nil {
+		t.Fatal("run cancelled by cancel_tool")
+	}
+
+	if err := Send(path, Request{Type: TypeAbort}); err != nil {
+		t.Fatalf("Send(abort) error = %v", err)
+	}
+	if runCtx.Err() == nil {
+		t.Error("run context not cancelled by abort")
+	}
+}
+
+func TestNilServer(t *testing.T) {
+	var s *Server
+	ctx, done := s.ToolContext(context.Background())
+	if ctx.Err() != nil || done() {
+		t.Error("nil server cancelled a tool call")
+	}
+	if s.Paused() || s.HasMessages() || s.TakeMessages() != nil {
+		t.Error("nil server has state")
+	}
+}
+
+func TestListenReplacesOnlySockets(t *testing.T) {
+	// A socket left behind by an earlier run is replaced
+	path := filepath.Join(t.TempDir(), "control.sock")
+	stale, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+	again, err := Listen(path)
+	if err != nil {
+		t.Fatalf("Listen() over a stale socket error = %v", err)
+	}
+	again.Close()
+
+	file := filepath.Join(t.TempDir(), "main.go")
+	if err := os.WriteFile(file, []byte("package main\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Listen(file); err == nil {
+		t.Fatal("Listen() on a regular file succeeded")
+	}
+	if data, err := os.ReadFile(file); err != nil || string(data) != "package main\n" {
+		t.Errorf("Listen() changed the regular file: %q, %v", data, err)
+	}
+}
+
+func TestListenCreatesOwnerOnlySocket(t *testing.T) {
+	_, path := listen(t)
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0o600 {
+		t.Errorf("socket permissions = %o, want 600", perm)
+	}
+}
+
+func TestCloseEndsOpenConnections(t *testing.T) {
+	s, path := listen(t)
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	// Wait until the connection is being handled
+	if _, err := conn.Write([]byte(`{"type":"pause"}` + "\n")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.Read(make([]byte, 64)); err != nil {
+		t.Fatal(err)
+	}
+
+	closed := make(chan struct{})
+	go func() {
+		s.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close() didn't return with a client connected")
+	}
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+	if n, err := conn.Read(make([]byte, 64)); err != io.EOF {
+		t.Errorf("Read() after Close = %d bytes, %v; want the connection closed", n, err)
+	}
+}
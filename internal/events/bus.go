@@ -0,0 +1,75 @@
+package events
+
+import "sync"
+
+// Sink receives events. Handle is called synchronously by the publisher, in
+// the order events happen, so it should return quickly.
+type Sink interface {
+	Handle(e Event)
+}
+
+// SinkFunc adapts a function to a Sink
+type SinkFunc func(e Event)
+
+// Handle calls f(e)
+func (f SinkFunc) Handle(e Event) { f(e) }
+
+// Bus delivers published events to every subscribed sink
+type Bus struct {
+	mu     sync.RWMutex
+	nextID int
+	sinks  map[int]Sink
+	order  []int
+}
+
+// NewBus creates a bus with the given sinks subscribed
+func NewBus(sinks ...Sink) *Bus {
+	b := &Bus{sinks: make(map[int]Sink)}
+	for _, s := range sinks {
+		b.Subscribe(s)
+	}
+	return b
+}
+
+// Subscribe adds a sink and returns a function that removes it again
+func (b *Bus) Subscribe(s Sink) (unsubscribe func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	id := b.nextID
+	b.nextID++
+	b.sinks[id] = s
+	b.order = append(b.order, id)
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			b.mu.Lock()
+			defer b.mu.Unlock()
+			delete(b.sinks, id)
+			for i, o := range b.order {
+				if o == id {
+					b.order = append(b.order[:i:i], b.order[i+1:]...)
+					break
+				}
+			}
+		})
+	}
+}
+
+// Publish delivers e to all sinks in the order they subscribed.
+// Publishing on a nil bus does nothing.
+func (b *Bus) Publish(e Event) {
+	if b == nil {
+		return
+	}
+	b.mu.RLock()
+	sinks := make([]Sink, 0, len(b.order))
+	for _, id := range b.order {
+		sinks = append(sinks, b.sinks[id])
+	}
+	b.mu.RUnlock()
+
+	for _, s := range sinks {
+		s.Handle(e)
+	}
+}
@@ -0,0 +1,204 @@
+// Package events provides the typed event stream emitted by the agent runner
+// and the bus that delivers it to subscribers such as the terminal renderer,
+// a JSONL writer or a metrics collector.
+package events
+
+import "time"
+
+// Kind identifies an event type
+type Kind string
+
+const (
+	KindLLMRequestStarted  Kind = "llm_request_started"
+	KindLLMRequestFinished Kind = "llm_request_finished"
+	KindAssistantText      Kind = "assistant_text"
+	KindToolCallStarted    Kind = "tool_call_started"
+	KindToolCallFinished   Kind = "tool_call_finished"
+	KindToolCallFailed     Kind = "tool_call_failed"
+	KindBacktrack          Kind = "backtrack"
+	KindLoopDetected       Kind = "loop_detected"
+	KindVerification       Kind = "verification"
+	KindFinalAnswer        Kind = "final_answer"
+	KindUserMessage        Kind = "user_message"
+	KindNotice             Kind = "notice"
+	KindError              Kind = "error"
+)
+
+// Event is implemented by every event type
+type Event interface {
+	Kind() Kind
+}
+
+// LLMRequestStarted is emitted before a chat request is sent
+type LLMRequestStarted struct {
+	Iteration int `json:"iteration"`
+	Messages  int `json:"messages"`
+}
+
+// Usage is the token usage and cost of one LLM response
+type Usage struct {
+	PromptTokens     int     `json:"prompt_tokens"`
+	CompletionTokens int     `json:"completion_tokens"`
+	CacheReadTokens  int     `json:"cache_read_tokens,omitempty"`
+	Cost             float64 `json:"cost_usd,omitempty"`
+}
+
+// LLMRequestFinished is emitted when a chat response has been received
+type LLMRequestFinished struct {
+	Iteration    int           `json:"iteration"`
+	Duration     time.Duration `json:"duration_ns"`
+	FinishReason string        `json:"finish_reason,omitempty"`
+	ToolCalls    int           `json:"tool_calls"`
+	Usage        Usage         `json:"usage"`
+}
+
+// AssistantText is emitted for the text of an assistant message that also
+// makes tool calls; the text of the last message comes as FinalAnswer
+type AssistantText struct {
+	Iteration int    `json:"iteration"`
+	Content   string `json:"content,omitempty"`
+	Reasoning string `json:"reasoning,omitempty"`
+	Streamed  bool   `json:"streamed"` // already shown token by token while it was generated
+
+	// Context usage after the response, for display
+	ContextTokens int `json:"context_tokens,omitempty"`
+	ContextWindow int `json:"context_window,omitempty"`
+}
+
+// ToolCallStarted is emitted when a tool call passed its checks and starts running
+type ToolCallStarted struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+
+	// Context usage when the call was made, for display
+	ContextTokens int `json:"context_tokens,omitempty"`
+	ContextWindow int `json:"context_window,omitempty"`
+}
+
+// ToolCallFinished is emitted when a tool call returned a result
+type ToolCallFinished struct {
+	ID       string        `json:"id"`
+	Name     string        `json:"name"`
+	Result   any           `json:"-"`       // Value returned by the tool
+	Content  string        `json:"content"` // Result as sent to the model
+	Duration time.Duration `json:"duration_ns"`
+}
+
+// Stages at which a tool call can fail
+const (
+	StageUnknownTool = "unknown_tool" // the model called a tool that doesn't exist
+	StageBlocked     = "blocked"      // blocked by a pending edit
+	StageCheck       = "check"        // the tool's Check rejected the arguments
+	StageDuplicate   = "duplicate"    // identical to the previous call
+	StageDenied      = "denied"       // refused by the approval policy or the user
+	StageCall        = "call"         // the tool ran and returned an error
+)
+
+// ToolCallFailed is emitted when a tool call was rejected or returned an error
+type ToolCallFailed struct {
+	ID       string        `json:"id"`
+	Name     string        `json:"name"`
+	Stage    string        `json:"stage"`
+	Error    string        `json:"error"`
+	Summary  string        `json:"summary,omitempty"` // Short form for display
+	Duration time.Duration `json:"duration_ns,omitempty"`
+}
+
+// Backtrack is emitted when a failed tool call is discarded and the request retried
+type Backtrack struct {
+	Tool       string `json:"tool"`
+	Error      string `json:"error"`
+	Retry      int    `json:"retry"`
+	MaxRetries int    `json:"max_retries"`
+}
+
+// Loop kinds reported by LoopDetected
+const (
+	LoopRepeatedError   = "repeated_error"   // same call failing the same way
+	LoopRepeatedSuccess = "repeated_success" // same call with the same result
+	LoopErrorStreak     = "error_streak"     // a tool failing over and over
+	LoopAlternating     = "alternating"      // a cycle of calls and undos
+)
+
+// LoopDetected is emitted when the loop detector intervenes
+type LoopDetected struct {
+	Tool  string `json:"tool"`
+	Loop  string `json:"loop"`
+	Count int    `json:"count"`
+}
+
+// Verification is emitted after agent.verify_command ran on a final answer.
+// Output is what went back to the model, and is empty when the check passed.
+type Verification struct {
+	Command  string        `json:"command"`
+	Round    int           `json:"round"`
+	Passed   bool          `json:"passed"`
+	ExitCode int           `json:"exit_code"`
+	Output   string        `json:"output,omitempty"`
+	Duration time.Duration `json:"duration_ns"`
+}
+
+// FinalAnswer is emitted with the model's answer at the end of a run
+type FinalAnswer struct {
+	Content string `json:"content"`
+}
+
+// UserMessage is emitted when a message sent to the running agent, such as
+// through its control socket, is added to the conversation
+type UserMessage struct {
+	Content string `json:"content"`
+}
+
+// Notice levels
+const (
+	LevelDebug = "debug" // details shown on the terminal only in verbose mode
+	LevelInfo  = "info"
+	LevelWarn  = "warn"
+	LevelError = "error" // something failed, but the run goes on
+)
+
+// Notice topics
+const (
+	TopicBudget       = "budget"       // a budget ran out and the model is asked to wrap up
+	TopicCheckpoint   = "checkpoint"   // recording a turn's file changes
+	TopicCompaction   = "compaction"   // older turns are summarized
+	TopicContext      = "context"      // the request doesn't fit the context window
+	TopicControl      = "control"      // paused or cancelled by the user
+	TopicLimit        = "limit"        // the iteration limit was reached
+	TopicMasking      = "masking"      // stale tool results are masked
+	TopicRetry        = "retry"        // a failed or unusable LLM response is retried
+	TopicState        = "state"        // saving the run's state or messages
+	TopicStats        = "stats"        // timing of a finished run
+	TopicTool         = "tool"         // tool call handling, such as the backtrack limit
+	TopicTruncation   = "truncation"   // a response was cut off at the output token limit
+	TopicVerification = "verification" // agent.verify_command
+)
+
+// Notice is emitted for what the runner reports along the way that has no
+// event of its own
+type Notice struct {
+	Level   string `json:"level"`
+	Topic   string `json:"topic"`
+	Message string `json:"message"`
+}
+
+// Error is emitted when the run stops because of an error outside the tools,
+// such as a failed LLM request
+type Error struct {
+	Message string `json:"message"`
+}
+
+func (LLMRequestStarted) Kind() Kind  { return KindLLMRequestStarted }
+func (LLMRequestFinished) Kind() Kind { return KindLLMRequestFinished }
+func (AssistantText) Kind() Kind      { return KindAssistantText }
+func (ToolCallStarted) Kind() Kind    { return KindToolCallStarted }
+func (ToolCallFinished) Kind() Kind   { return KindToolCallFinished }
+func (ToolCallFailed) Kind() Kind     { return KindToolCallFailed }
+func (Backtrack) Kind() Kind          { return KindBacktrack }
+func (LoopDetected) Kind() Kind       { return KindLoopDetected }
+func (Verification) Kind() Kind       { return KindVerification }
+func (FinalAnswer) Kind() Kind        { return KindFinalAnswer }
+func (UserMessage) Kind() Kind        { return KindUserMessage }
+func (Notice) Kind() Kind             { return KindNotice }
+func (Error) Kind() Kind              { return KindError }
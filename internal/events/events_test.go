@@ -0,0 +1,106 @@
+package events
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBusDeliversInSubscriptionOrder(t *testing.T) {
+	var got []string
+	record := func(name string) Sink {
+		return SinkFunc(func(e Event) { got = append(got, name+":"+string(e.Kind())) })
+	}
+
+	bus := NewBus(record("a"))
+	unsubscribe := bus.Subscribe(record("b"))
+	bus.Subscribe(record("c"))
+
+	bus.Publish(FinalAnswer{Content: "done"})
+	unsubscribe()
+	unsubscribe() // removing twice is harmless
+	bus.Publish(Backtrack{Tool: "Edit"})
+
+	want := "a:final_answer b:final_answer c:final_answer a:backtrack c:backtrack"
+	if strings.Join(got, " ") != want {
+		t.Errorf("delivered %v, want %s", got, want)
+	}
+}
+
+func TestNilBusPublish(t *testing.T) {
+	var bus *Bus
+	bus.Publish(FinalAnswer{}) // must not panic
+}
+
+func TestJSONLSink(t *testing.T) {
+	var buf bytes.Buffer
+	sink := NewJSONLSink(&buf)
+	sink.Handle(ToolCallStarted{ID: "call_1", Name: "Read", Arguments: `{"path":"a.go"}`})
+	sink.Handle(ToolCallFinished{ID: "call_1", Name: "Read", Result: map[string]any{"x": 1}, Content: "ok", Duration: time.Second})
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("lines = %d, want 2", len(lines))
+	}
+	var first struct {
+		Type Kind            `json:"type"`
+		Time time.Time       `json:"time"`
+		Data ToolCallStarted `json:"data"`
+	}
+	if err := json.Unmarshal([]byte(lines[0]), &first); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if first.Type != KindToolCallStarted || first.Time.IsZero() || first.Data.Arguments != `{"path":"a.go"}` {
+		t.Errorf("first line = %+v", first)
+	}
+	if !strings.Contains(lines[1], `"duration_ns":1000000000`) || strings.Contains(lines[1], `"Result"`) {
+		t.Errorf("second line = %s", lines[1])
+	}
+}
+
+type failingWriter struct{ writes int }
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	w.writes++
+	return 0, errors.New("disk full")
+}
+
+func TestJSONLSinkStopsAfterError(t *testing.T) {
+	w := &failingWriter{}
+	sink := NewJSONLSink(w)
+	sink.Handle(FinalAnswer{})
+	sink.Handle(FinalAnswer{})
+	if w.writes != 1 || sink.Err() == nil {
+		t.Errorf("writes = %d, err = %v", w.writes, sink.Err())
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	m := NewMetrics()
+	m.Handle(LLMRequestFinished{Duration: time.Second, Usage: Usage{PromptTokens: 100, CompletionTokens: 10, Cost: 0.5}})
+	m.Handle(LLMRequestFinished{Duration: time.Second, Usage: Usage{PromptTokens: 200, CompletionTokens: 20}})
+	m.Handle(ToolCallFinished{Name: "Read", Duration: time.Millisecond})
+	m.Handle(ToolCallFailed{Name: "Read", Stage: StageCheck})
+	m.Handle(Backtrack{Tool: "Edit"})
+	m.Handle(LoopDetected{Tool: "Read"})
+
+	s := m.Snapshot()
+	if s.LLMRequests != 2 || s.PromptTokens != 300 || s.CompletionTokens != 30 || s.Cost != 0.5 || s.LLMDuration != 2*time.Second {
+		t.Errorf("llm metrics = %+v", s)
+	}
+	if read := s.Tools["Read"]; read == nil || read.Calls != 2 || read.Failures != 1 {
+		t.Errorf("Read metrics = %+v", read)
+	}
+	if s.Backtracks != 1 || s.Loops != 1 {
+		t.Errorf("backtracks = %d, loops = %d", s.Backtracks, s.Loops)
+	}
+
+	// Snapshots don't change with later events
+	m.Handle(ToolCallFinished{Name: "Read"})
+	if s.Tools["Read"].Calls != 2 {
+		t.Errorf("snapshot changed after a later event")
+	}
+}
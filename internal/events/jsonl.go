@@ -0,0 +1,47 @@
+package events
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+)
+
+// JSONLSink writes each event as one JSON line:
+// {"time": ..., "type": ..., "data": {...}}
+type JSONLSink struct {
+	mu  sync.Mutex
+	w   io.Writer
+	err error
+}
+
+// NewJSONLSink creates a sink writing to w
+func NewJSONLSink(w io.Writer) *JSONLSink {
+	return &JSONLSink{w: w}
+}
+
+// Handle writes e. After a write error further events are dropped; see Err.
+func (s *JSONLSink) Handle(e Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return
+	}
+	line, err := json.Marshal(struct {
+		Time time.Time `json:"time"`
+		Type Kind      `json:"type"`
+		Data Event     `json:"data"`
+	}{time.Now(), e.Kind(), e})
+	if err != nil {
+		s.err = err
+		return
+	}
+	_, s.err = s.w.Write(append(line, '\n'))
+}
+
+// Err returns the first error that stopped the sink, if any
+func (s *JSONLSink) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
@@ -0,0 +1,85 @@
+package events
+
+import (
+	"sync"
+	"time"
+)
+
+// ToolMetrics aggregates the calls of one tool
+type ToolMetrics struct {
+	Calls    int           `json:"calls"`
+	Failures int           `json:"failures"`
+	Duration time.Duration `json:"duration_ns"`
+}
+
+// Snapshot is a point-in-time copy of the collected metrics
+type Snapshot struct {
+	LLMRequests      int                     `json:"llm_requests"`
+	LLMDuration      time.Duration           `json:"llm_duration_ns"`
+	PromptTokens     int                     `json:"prompt_tokens"`
+	CompletionTokens int                     `json:"completion_tokens"`
+	Cost             float64                 `json:"cost_usd"`
+	Tools            map[string]*ToolMetrics `json:"tools"`
+	Backtracks       int                     `json:"backtracks"`
+	Loops            int                     `json:"loops"`
+}
+
+// Metrics is a sink that aggregates counts and durations
+type Metrics struct {
+	mu sync.Mutex
+	s  Snapshot
+}
+
+// NewMetrics creates an empty collector
+func NewMetrics() *Metrics {
+	return &Metrics{s: Snapshot{Tools: make(map[string]*ToolMetrics)}}
+}
+
+// Handle updates the metrics with e
+func (m *Metrics) Handle(e Event) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	switch e := e.(type) {
+	case LLMRequestFinished:
+		m.s.LLMRequests++
+		m.s.LLMDuration += e.Duration
+		m.s.PromptTokens += e.Usage.PromptTokens
+		m.s.CompletionTokens += e.Usage.CompletionTokens
+		m.s.Cost += e.Usage.Cost
+	case ToolCallFinished:
+		t := m.tool(e.Name)
+		t.Calls++
+		t.Duration += e.Duration
+	case ToolCallFailed:
+		t := m.tool(e.Name)
+		t.Calls++
+		t.Failures++
+		t.Duration += e.Duration
+	case Backtrack:
+		m.s.Backtracks++
+	case LoopDetected:
+		m.s.Loops++
+	}
+}
+
+// Snapshot returns a copy of the metrics collected so far
+func (m *Metrics) Snapshot() Snapshot {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s := m.s
+	s.Tools = make(map[string]*ToolMetrics, len(m.s.Tools))
+	for name, t := range m.s.Tools {
+		copied := *t
+		s.Tools[name] = &copied
+	}
+	return s
+}
+
+func (m *Metrics) tool(name string) *ToolMetrics {
+	t, ok := m.s.Tools[name]
+	if !ok {
+		t = &ToolMetrics{}
+		m.s.Tools[name] = t
+	}
+	return t
+}
@@ -0,0 +1,260 @@
+package gocode
+
+import (
+	"bytes"
+	"go/ast"
+	"go/printer"
+	"go/token"
+	"strings"
+)
+
+// maxSignature is the longest signature shown; longer ones are cut
+const maxSignature = 160
+
+// Decl is a declaration with the lines it spans
+type Decl struct {
+	Name      string `json:"name"` // Type.Method and Type.Field for members
+	Kind      string `json:"kind"` // func, method, type, field, const or var
+	Signature string `json:"signature,omitempty"`
+	File      string `json:"file"`
+	StartLine int    `json:"start_line"`
+	EndLine   int    `json:"end_line"`
+	DocLine   int    `json:"doc_line,omitempty"` // First line of the doc comment
+	Members   []Decl `json:"members,omitempty"`  // Fields and methods of a type
+
+	pkg   *Package
+	ident *ast.Ident
+}
+
+// Package returns the package the declaration is in
+func (d *Decl) Package() *Package {
+	return d.pkg
+}
+
+// FileDecls returns the declarations of one file of pkg, in source order
+func FileDecls(fset *token.FileSet, pkg *Package, i int) []Decl {
+	o := outliner{fset: fset, pkg: pkg, file: pkg.Filenames[i]}
+	var decls []Decl
+	for _, d := range pkg.Files[i].Decls {
+		decls = append(decls, o.decl(d)...)
+	}
+	return decls
+}
+
+// outliner turns the declarations of one file into Decls
+type outliner struct {
+	fset *token.FileSet
+	pkg  *Package
+	file string
+}
+
+func (o *outliner) decl(d ast.Decl) []Decl {
+	switch d := d.(type) {
+	case *ast.FuncDecl:
+		fn := *d
+		fn.Body, fn.Doc = nil, nil
+		decl := o.newDecl(d.Name.Name, "func", d, d.Doc, d.Name)
+		decl.Signature = o.source(&fn)
+		if recv := receiverType(d); recv != "" {
+			decl.Name = recv + "." + d.Name.Name
+			decl.Kind = "method"
+		}
+		return []Decl{decl}
+
+	case *ast.GenDecl:
+		var decls []Decl
+		for _, spec := range d.Specs {
+			// A declaration without parentheses spans its keyword too
+			var node ast.Node = spec
+			doc := d.Doc
+			if !d.Lparen.IsValid() {
+				node = d
+			}
+			switch spec := spec.(type) {
+			case *ast.TypeSpec:
+				if spec.Doc != nil {
+					doc = spec.Doc
+				}
+				decl := o.newDecl(spec.Name.Name, "type", node, doc, spec.Name)
+				decl.Signature = o.typeSignature(spec)
+				decl.Members = o.members(spec)
+				decls = append(decls, decl)
+			case *ast.ValueSpec:
+				if spec.Doc != nil {
+					doc = spec.Doc
+				}
+				kind := "var"
+				if d.Tok == token.CONST {
+					kind = "const"
+				}
+				vs := *spec
+				vs.Doc, vs.Comment = nil, nil
+				signature := kind + " " + o.source(&vs)
+				for _, name := range spec.Names {
+					if name.Name == "_" {
+						continue
+					}
+					decl := o.newDecl(name.Name, kind, node, doc, name)
+					decl.Signature = signature
+					decls = append(decls, decl)
+				}
+			}
+		}
+		return decls
+	}
+	return nil
+}
+
+func (o *outliner) newDecl(name, kind string, node ast.Node, doc *ast.CommentGroup, ident *ast.Ident) Decl {
+	decl := Decl{
+		Name:      name,
+		Kind:      kind,
+		File:      o.file,
+		StartLine: o.fset.Position(node.Pos()).Line,
+		EndLine:   o.fset.Position(node.End()).Line,
+		pkg:       o.pkg,
+		ident:     ident,
+	}
+	if doc != nil {
+		decl.DocLine = o.fset.Position(doc.Pos()).Line
+	}
+	return decl
+}
+
+// typeSignature shows a type declaration without the body of a struct or
+// interface, which its members list
+func (o *outliner) typeSignature(spec *ast.TypeSpec) string {
+	var sb strings.Builder
+	sb.WriteString("type " + spec.Name.Name)
+	if spec.TypeParams != nil {
+		sb.WriteString(o.source(spec.TypeParams))
+	}
+	if spec.Assign.IsValid() {
+		sb.WriteString(" =")
+	}
+	switch spec.Type.(type) {
+	case *ast.StructType:
+		sb.WriteString(" struct")
+	case *ast.InterfaceType:
+		sb.WriteString(" interface")
+	default:
+		sb.WriteString(" " + o.source(spec.Type))
+	}
+	return sb.String()
+}
+
+// members returns the fields of a struct or the methods and embedded types
+// of an interface
+func (o *outliner) members(spec *ast.TypeSpec) []Decl {
+	var fields *ast.FieldList
+	kind := "field"
+	switch t := spec.Type.(type) {
+	case *ast.StructType:
+		fields = t.Fields
+	case *ast.InterfaceType:
+		fields = t.Methods
+		kind = "method"
+	}
+	if fields == nil {
+		return nil
+	}
+
+	var members []Decl
+	for _, f := range fields.List {
+		signature := o.fieldSignature(f)
+		if len(f.Names) == 0 {
+			// Embedded: named after its type
+			if ident := embeddedIdent(f.Type); ident != nil {
+				members = append(members, o.member(spec, ident.Name, "field", f, signature, ident))
+			}
+			continue
+		}
+		for _, name := range f.Names {
+			memberKind := kind
+			if _, isFunc := f.Type.(*ast.FuncType); !isFunc && kind == "method" {
+				memberKind = "field"
+			}
+			members = append(members, o.member(spec, name.Name, memberKind, f, signature, name))
+		}
+	}
+	return members
+}
+
+// fieldSignature shows a struct field or interface method as declared
+func (o *outliner) fieldSignature(f *ast.Field) string {
+	var names []string
+	for _, name := range f.Names {
+		names = append(names, name.Name)
+	}
+	typ := o.source(f.Type)
+	if ft, isFunc := f.Type.(*ast.FuncType); isFunc && len(names) == 1 && ft.Func == token.NoPos {
+		return names[0] + strings.TrimPrefix(typ, "func") // Interface method
+	}
+	if len(names) == 0 {
+		return typ
+	}
+	return strings.Join(names, ", ") + " " + typ
+}
+
+func (o *outliner) member(spec *ast.TypeSpec, name, kind string, f *ast.Field, signature string, ident *ast.Ident) Decl {
+	decl := o.newDecl(spec.Name.Name+"."+name, kind, f, f.Doc, ident)
+	decl.Signature = signature
+	return decl
+}
+
+// source prints node as Go source, on one line and cut to maxSignature
+func (o *outliner) source(node any) string {
+	var buf bytes.Buffer
+	if err := printer.Fprint(&buf, o.fset, node); err != nil {
+		return ""
+	}
+	s := strings.Join(strings.Fields(buf.String()), " ")
+	if len(s) > maxSignature {
+		s = s[:maxSignature-3] + "..."
+	}
+	return s
+}
+
+// receiverType returns the type name of a method's receiver, or ""
+func receiverType(fn *ast.FuncDecl) string {
+	if fn.Recv == nil || len(fn.Recv.List) == 0 {
+		return ""
+	}
+	t := fn.Recv.List[0].Type
+	for {
+		switch x := t.(type) {
+		case *ast.StarExpr:
+			t = x.X
+		case *ast.IndexExpr:
+			t = x.X
+		case *ast.IndexListExpr:
+			t = x.X
+		case *ast.ParenExpr:
+			t = x.X
+		case *ast.Ident:
+			return x.Name
+		default:
+			return ""
+		}
+	}
+}
+
+// embeddedIdent returns the name an embedded field is known by
+func embeddedIdent(t ast.Expr) *ast.Ident {
+	for {
+		switch x := t.(type) {
+		case *ast.StarExpr:
+			t = x.X
+		case *ast.IndexExpr:
+			t = x.X
+		case *ast.IndexListExpr:
+			t = x.X
+		case *ast.SelectorExpr:
+			return x.Sel
+		case *ast.Ident:
+			return x
+		default:
+			return nil
+		}
+	}
+}
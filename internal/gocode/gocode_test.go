@@ -0,0 +1,195 @@
+package gocode
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testModule writes a small module with two packages and returns its index
+func testModule(t *testing.T) *Index {
+	t.Helper()
+	root := t.TempDir()
+	files := map[string]string{
+		"go.mod": "module example.com/shop\n\ngo 1.22\n",
+		"cart/cart.go": `package cart
+
+import "fmt"
+
+// Cart holds the items to buy
+type Cart struct {
+	Items []Item
+	owner string
+}
+
+// Item is one product in a cart
+type Item struct {
+	Name  string
+	Price int
+}
+
+// MaxItems caps a cart
+const MaxItems = 50
+
+// Add puts an item in the cart
+func (c *Cart) Add(it Item) error {
+	if len(c.Items) >= MaxItems {
+		return fmt.Errorf("cart is full")
+	}
+	c.Items = append(c.Items, it)
+	return nil
+}
+
+// Total sums the prices
+func (c *Cart) Total() int {
+	total := 0
+	for _, it := range c.Items {
+		total += it.Price
+	}
+	return total
+}
+`,
+		"cart/cart_test.go": `package cart
+
+import "testing"
+
+func TestAdd(t *testing.T) {
+	var c Cart
+	_ = c.Add(Item{Name: "tea"})
+}
+`,
+		"cmd/shop/main.go": `package main
+
+import "example.com/shop/cart"
+
+func main() {
+	c := &cart.Cart{}
+	_ = c.Add(cart.Item{Name: "milk", Price: 2})
+	println(c.Total())
+}
+`,
+		"vendor/x/x.go": "package x\n\nfunc Add() {}\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	mod, err := FindModule(filepath.Join(root, "cart"))
+	if err != nil {
+		t.Fatalf("FindModule() error = %v", err)
+	}
+	if mod.Path != "example.com/shop" || mod.Dir != root {
+		t.Fatalf("FindModule() = %+v, want example.com/shop at %s", mod, root)
+	}
+	idx, err := Load(context.Background(), mod)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	return idx
+}
+
+func TestFileDecls(t *testing.T) {
+	idx := testModule(t)
+	pkgs := idx.PackagesIn(filepath.Join(idx.Module.Dir, "cart"))
+	if len(pkgs) != 1 {
+		t.Fatalf("packages in cart = %d, want 1", len(pkgs))
+	}
+	var decls []Decl
+	for i, name := range pkgs[0].Filenames {
+		if filepath.Base(name) == "cart.go" {
+			decls = FileDecls(idx.Fset, pkgs[0], i)
+		}
+	}
+
+	want := []struct {
+		name, kind      string
+		start, end, doc int
+	}{
+		{"Cart", "type", 6, 9, 5},
+		{"Item", "type", 12, 15, 11},
+		{"MaxItems", "const", 18, 18, 17},
+		{"Cart.Add", "method", 21, 27, 20},
+		{"Cart.Total", "method", 30, 36, 29},
+	}
+	if len(decls) != len(want) {
+		t.Fatalf("decls = %+v, want %d", decls, len(want))
+	}
+	for i, w := range want {
+		d := decls[i]
+		if d.Name != w.name || d.Kind != w.kind || d.StartLine != w.start || d.EndLine != w.end || d.DocLine != w.doc {
+			t.Errorf("decl %d = %s %s lines %d-%d doc %d, want %s %s lines %d-%d doc %d",
+				i, d.Kind, d.Name, d.StartLine, d.EndLine, d.DocLine, w.kind, w.name, w.start, w.end, w.doc)
+		}
+	}
+	if got := decls[3].Signature; got != "func (c *Cart) Add(it Item) error" {
+		t.Errorf("Add signature = %q", got)
+	}
+	if got := decls[0].Members; len(got) != 2 || got[0].Name != "Cart.Items" || got[0].Signature != "Items []Item" || got[0].StartLine != 7 {
+		t.Errorf("Cart members = %+v, want Items and owner", got)
+	}
+}
+
+func TestDefinitions(t *testing.T) {
+	idx := testModule(t)
+	for _, symbol := range []string{"Cart.Add", "cart.Cart.Add", "Add"} {
+		defs := idx.Definitions(symbol)
+		if len(defs) != 1 || defs[0].Name != "Cart.Add" {
+			t.Errorf("Definitions(%q) = %+v, want Cart.Add only (not vendor)", symbol, defs)
+		}
+	}
+	if defs := idx.Definitions("Item.Price"); len(defs) != 1 || defs[0].Kind != "field" || defs[0].StartLine != 14 {
+		t.Errorf("Definitions(Item.Price) = %+v, want the field at line 14", defs)
+	}
+	if defs := idx.Definitions("Nope"); len(defs) != 0 {
+		t.Errorf("Definitions(Nope) = %+v, want none", defs)
+	}
+}
+
+func TestReferences(t *testing.T) {
+	idx := testModule(t)
+	tests := []struct {
+		symbol string
+		want   []string // base name:line
+	}{
+		{"Cart.Add", []string{"cart_test.go:7", "main.go:7"}},
+		{"Item.Price", []string{"cart.go:33", "main.go:7"}},
+		{"MaxItems", []string{"cart.go:22"}},
+	}
+	for _, tt := range tests {
+		defs := idx.Definitions(tt.symbol)
+		if len(defs) != 1 {
+			t.Fatalf("Definitions(%q) = %d, want 1", tt.symbol, len(defs))
+		}
+		refs, err := idx.References(context.Background(), defs[0])
+		if err != nil {
+			t.Fatalf("References(%q) error = %v", tt.symbol, err)
+		}
+		var got []string
+		for _, r := range refs {
+			got = append(got, fmt.Sprintf("%s:%d", filepath.Base(r.File), r.Line))
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("References(%q) = %v, want %v", tt.symbol, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("References(%q) = %v, want %v", tt.symbol, got, tt.want)
+				break
+			}
+		}
+	}
+
+	refs, _ := idx.References(context.Background(), idx.Definitions("Cart.Total")[0])
+	if len(refs) != 1 || refs[0].In != "main" || refs[0].Text != "println(c.Total())" {
+		t.Errorf("References(Cart.Total) = %+v, want the call in main", refs)
+	}
+}
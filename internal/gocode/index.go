@@ -0,0 +1,199 @@
+package gocode
+
+import (
+	"context"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Package is the Go files of one directory with the same package clause.
+// The files of an external test package (package foo_test) make a package of
+// their own.
+type Package struct {
+	Name       string
+	ImportPath string // With "_test" added for an external test package
+	Dir        string
+	Files      []*ast.File
+	Filenames  []string // Absolute, in the order of Files
+
+	types    *types.Package
+	info     *types.Info
+	checking bool
+}
+
+// Index holds the parsed packages of a module. Packages are type-checked on
+// demand, since only references need types.
+type Index struct {
+	Module   *Module
+	Fset     *token.FileSet
+	Packages []*Package
+
+	byPath map[string]*Package
+	fake   map[string]*types.Package // Stand-ins for packages outside the module
+}
+
+// Load parses every package of the module. Vendored code, testdata, hidden
+// directories and nested modules are skipped; files that don't parse are
+// kept as far as they parse.
+func Load(ctx context.Context, mod *Module) (*Index, error) {
+	idx := &Index{
+		Module: mod,
+		Fset:   token.NewFileSet(),
+		byPath: make(map[string]*Package),
+		fake:   make(map[string]*types.Package),
+	}
+
+	err := filepath.WalkDir(mod.Dir, func(p string, d os.DirEntry, err error) error {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		if err != nil || !d.IsDir() {
+			return nil
+		}
+		if p != mod.Dir {
+			name := d.Name()
+			if name == "vendor" || name == "testdata" || strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") {
+				return filepath.SkipDir
+			}
+			if _, err := os.Stat(filepath.Join(p, "go.mod")); err == nil {
+				return filepath.SkipDir
+			}
+		}
+		idx.parseDir(p)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return idx, nil
+}
+
+// LoadDir parses only the packages in dir, which needn't be in a module
+func LoadDir(dir string) *Index {
+	idx := &Index{
+		Module: &Module{Dir: dir},
+		Fset:   token.NewFileSet(),
+		byPath: make(map[string]*Package),
+		fake:   make(map[string]*types.Package),
+	}
+	idx.parseDir(dir)
+	return idx
+}
+
+// parseDir adds the packages in dir
+func (idx *Index) parseDir(dir string) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	rel, _ := filepath.Rel(idx.Module.Dir, dir)
+	importPath := idx.Module.Path
+	if rel != "." {
+		importPath = path.Join(importPath, filepath.ToSlash(rel))
+	}
+
+	byName := make(map[string]*Package)
+	var order []string
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".go") {
+			continue
+		}
+		filename := filepath.Join(dir, e.Name())
+		f, _ := parser.ParseFile(idx.Fset, filename, nil, parser.ParseComments|parser.SkipObjectResolution)
+		if f == nil || f.Name == nil {
+			continue
+		}
+		name := f.Name.Name
+		pkg := byName[name]
+		if pkg == nil {
+			pkg = &Package{Name: name, ImportPath: importPath, Dir: dir}
+			if strings.HasSuffix(name, "_test") && strings.HasSuffix(e.Name(), "_test.go") {
+				pkg.ImportPath += "_test"
+			}
+			byName[name] = pkg
+			order = append(order, name)
+		}
+		pkg.Files = append(pkg.Files, f)
+		pkg.Filenames = append(pkg.Filenames, filename)
+	}
+
+	sort.Strings(order)
+	for _, name := range order {
+		pkg := byName[name]
+		idx.Packages = append(idx.Packages, pkg)
+		if _, taken := idx.byPath[pkg.ImportPath]; !taken {
+			idx.byPath[pkg.ImportPath] = pkg
+		}
+	}
+}
+
+// PackagesIn returns the packages parsed from dir
+func (idx *Index) PackagesIn(dir string) []*Package {
+	var pkgs []*Package
+	for _, p := range idx.Packages {
+		if p.Dir == dir {
+			pkgs = append(pkgs, p)
+		}
+	}
+	return pkgs
+}
+
+// Import implements types.Importer. Packages of the module are checked from
+// the index. Others, the standard library included, are replaced with empty
+// packages: checking them from source takes seconds, and module code rarely
+// reaches its own declarations through them.
+func (idx *Index) Import(importPath string) (*types.Package, error) {
+	if p := idx.byPath[importPath]; p != nil {
+		if pkg := idx.check(p); pkg != nil {
+			return pkg, nil
+		}
+	}
+
+	pkg := idx.fake[importPath]
+	if pkg == nil {
+		pkg = types.NewPackage(importPath, path.Base(importPath))
+		pkg.MarkComplete()
+		idx.fake[importPath] = pkg
+	}
+	return pkg, nil
+}
+
+// check type-checks p, once, ignoring type errors. It returns nil while p is
+// being checked, which breaks import cycles.
+func (idx *Index) check(p *Package) *types.Package {
+	if p.types != nil || p.checking {
+		return p.types
+	}
+	p.checking = true
+	defer func() { p.checking = false }()
+
+	p.info = &types.Info{
+		Defs: make(map[*ast.Ident]types.Object),
+		Uses: make(map[*ast.Ident]types.Object),
+	}
+	conf := types.Config{
+		Importer:    idx,
+		Error:       func(error) {},
+		FakeImportC: true,
+	}
+	p.types, _ = conf.Check(p.ImportPath, idx.Fset, p.Files, p.info)
+	return p.types
+}
+
+// CheckAll type-checks every package, stopping early if ctx is done
+func (idx *Index) CheckAll(ctx context.Context) error {
+	for _, p := range idx.Packages {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		idx.check(p)
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+package gocode
+
+import (
+	"context"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Definitions returns the declarations named by symbol: Name or Type.Member,
+// optionally qualified with the package name as in agent.Runner.Run. With no
+// exact match, members whose own name is symbol are returned, so "Run" finds
+// Runner.Run.
+func (idx *Index) Definitions(symbol string) []Decl {
+	var exact, members []Decl
+	for _, p := range idx.Packages {
+		for i := range p.Files {
+			for _, d := range FileDecls(idx.Fset, p, i) {
+				for _, c := range append([]Decl{d}, d.Members...) {
+					switch {
+					case c.Name == symbol || p.Name+"."+c.Name == symbol:
+						exact = append(exact, c)
+					case strings.HasSuffix(c.Name, "."+symbol):
+						members = append(members, c)
+					}
+				}
+			}
+		}
+	}
+	if len(exact) > 0 {
+		return exact
+	}
+	return members
+}
+
+// Reference is a use of a declaration
+type Reference struct {
+	File   string `json:"file"`
+	Line   int    `json:"line"`
+	Column int    `json:"column"`
+	Text   string `json:"text"`         // The source line, trimmed
+	In     string `json:"in,omitempty"` // Enclosing function or method
+}
+
+// References returns the uses of d across the module in file and line
+// order, found by type-checking every package. d must come from this index.
+func (idx *Index) References(ctx context.Context, d Decl) ([]Reference, error) {
+	if d.pkg == nil || d.ident == nil {
+		return nil, fmt.Errorf("%s has no declaration to look up", d.Name)
+	}
+	idx.check(d.pkg)
+	target := d.pkg.info.Defs[d.ident]
+	if target == nil {
+		return nil, fmt.Errorf("%s could not be resolved", d.Name)
+	}
+	if err := idx.CheckAll(ctx); err != nil {
+		return nil, err
+	}
+
+	var refs []Reference
+	lines := make(map[string][]string)
+	for _, p := range idx.Packages {
+		if p.info == nil {
+			continue
+		}
+		for ident, obj := range p.info.Uses {
+			if !sameObject(obj, target) {
+				continue
+			}
+			pos := idx.Fset.Position(ident.Pos())
+			if _, ok := lines[pos.Filename]; !ok {
+				data, _ := os.ReadFile(pos.Filename)
+				lines[pos.Filename] = strings.Split(string(data), "\n")
+			}
+			ref := Reference{File: pos.Filename, Line: pos.Line, Column: pos.Column, In: enclosingFunc(p, ident.Pos())}
+			if fileLines := lines[pos.Filename]; pos.Line <= len(fileLines) {
+				ref.Text = strings.TrimSpace(fileLines[pos.Line-1])
+			}
+			refs = append(refs, ref)
+		}
+	}
+	sort.Slice(refs, func(i, j int) bool {
+		a, b := refs[i], refs[j]
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+	return refs, nil
+}
+
+// sameObject reports whether obj is target, looking through instantiations
+// of generic functions, methods and fields
+func sameObject(obj, target types.Object) bool {
+	switch o := obj.(type) {
+	case *types.Func:
+		obj = o.Origin()
+	case *types.Var:
+		obj = o.Origin()
+	}
+	return obj == target
+}
+
+// enclosingFunc returns the name of the function or method declared around
+// pos, or ""
+func enclosingFunc(p *Package, pos token.Pos) string {
+	for _, f := range p.Files {
+		if pos < f.FileStart || pos > f.FileEnd {
+			continue
+		}
+		for _, d := range f.Decls {
+			fn, ok := d.(*ast.FuncDecl)
+			if !ok || pos < fn.Pos() || pos > fn.End() {
+				continue
+			}
+			if recv := receiverType(fn); recv != "" {
+				return recv + "." + fn.Name.Name
+			}
+			return fn.Name.Name
+		}
+	}
+	return ""
+}
@@ -0,0 +1,64 @@
+// Package gocode answers questions about Go source for the Code.* tools: the
+// declarations in a file or package, where a symbol is declared and where it
+// is used. It works from source with go/parser and go/types, so it needs no
+// language server and tolerates code that doesn't compile.
+package gocode
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Module is a Go module on disk
+type Module struct {
+	Dir  string // Directory of go.mod
+	Path string // Module path from go.mod
+}
+
+// FindModule returns the module containing dir, looking for go.mod in dir
+// and its parents
+func FindModule(dir string) (*Module, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	for d := dir; ; d = filepath.Dir(d) {
+		path, err := modulePath(filepath.Join(d, "go.mod"))
+		if err == nil {
+			return &Module{Dir: d, Path: path}, nil
+		}
+		if !os.IsNotExist(err) {
+			return nil, err
+		}
+		if filepath.Dir(d) == d {
+			return nil, fmt.Errorf("no go.mod found in %s or its parents", dir)
+		}
+	}
+}
+
+// modulePath reads the module path from a go.mod file
+func modulePath(gomod string) (string, error) {
+	f, err := os.Open(gomod)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if rest, ok := strings.CutPrefix(line, "module"); ok && (rest == "" || rest[0] == ' ' || rest[0] == '\t') {
+			path := strings.Trim(strings.TrimSpace(rest), `"`)
+			if path != "" {
+				return path, nil
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+	return "", fmt.Errorf("%s has no module line", gomod)
+}
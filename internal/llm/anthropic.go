@@ -0,0 +1,630 @@
+package llm
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+const (
+	// DefaultAnthropicBaseURL is used when no base URL is configured for the Anthropic provider
+	DefaultAnthropicBaseURL = "https://api.anthropic.com/v1"
+
+	anthropicVersion          = "2023-06-01"
+	anthropicDefaultMaxTokens = 4096
+	// anthropicMaxRemembered bounds the stats and thinking blocks a client
+	// keeps. Stats nobody reads and thinking of turns long past are dropped;
+	// only the latest turns need their thinking sent back.
+	anthropicMaxRemembered = 256
+)
+
+// AnthropicClient talks to the native Anthropic Messages API.
+// It translates the OpenAI-shaped request/response types of this package
+// to content blocks, and keeps per-response usage so GetGenerationStats can
+// report cache reads and writes without an extra round trip.
+type AnthropicClient struct {
+	baseURL        string
+	apiKey         string
+	thinkingBudget int
+	client         *http.Client
+	maxRetries     int
+
+	mu       sync.Mutex
+	stats    recentMap[*GenerationStats] // response ID -> stats, removed once read
+	thinking recentMap[[]anthropicBlock] // first tool call ID -> thinking blocks of that turn
+}
+
+// NewAnthropicClient creates a client for the Anthropic Messages API.
+// thinkingBudget > 0 enables extended thinking with that many budget tokens.
+func NewAnthropicClient(baseURL, apiKey string, thinkingBudget int) *AnthropicClient {
+	if baseURL == "" {
+		baseURL = DefaultAnthropicBaseURL
+	}
+	return &AnthropicClient{
+		baseURL:        strings.TrimRight(baseURL, "/"),
+		apiKey:         apiKey,
+		thinkingBudget: thinkingBudget,
+		client:         &http.Client{},
+		maxRetries:     defaultMaxRetries,
+		stats:          newRecentMap[*GenerationStats](anthropicMaxRemembered),
+		thinking:       newRecentMap[[]anthropicBlock](anthropicMaxRemembered),
+	}
+}
+
+// recentMap is a map that forgets its oldest entries beyond max
+type recentMap[V any] struct {
+	max   int
+	seq   int
+	items map[string]recentEntry[V]
+}
+
+type recentEntry[V any] struct {
+	value V
+	seq   int // Order of insertion
+}
+
+func newRecentMap[V any](max int) recentMap[V] {
+	return recentMap[V]{max: max, items: make(map[string]recentEntry[V])}
+}
+
+func (m *recentMap[V]) get(key string) (V, bool) {
+	e, ok := m.items[key]
+	return e.value, ok
+}
+
+func (m *recentMap[V]) put(key string, value V) {
+	if _, ok := m.items[key]; !ok && len(m.items) >= m.max {
+		oldest, oldestSeq := "", m.seq+1
+		for k, e := range m.items {
+			if e.seq < oldestSeq {
+				oldest, oldestSeq = k, e.seq
+			}
+		}
+		delete(m.items, oldest)
+	}
+	m.seq++
+	m.items[key] = recentEntry[V]{value, m.seq}
+}
+
+func (m *recentMap[V]) delete(key string) {
+	delete(m.items, key)
+}
+
+// anthropicRequest is the body of a POST /messages call
+type anthropicRequest struct {
+	Model       string               `json:"model"`
+	System      []anthropicBlock     `json:"system,omitempty"`
+	Messages    []anthropicMessage   `json:"messages"`
+	MaxTokens   int                  `json:"max_tokens"`
+	Temperature *float32             `json:"temperature,omitempty"`
+	Tools       []anthropicTool      `json:"tools,omitempty"`
+	ToolChoice  *anthropicToolChoice `json:"tool_choice,omitempty"`
+	Thinking    *anthropicThinking   `json:"thinking,omitempty"`
+	Stream      bool                 `json:"stream,omitempty"`
+}
+
+type anthropicMessage struct {
+	Role    MessageRole      `json:"role"`
+	Content []anthropicBlock `json:"content"`
+}
+
+// anthropicBlock is a content block; only the fields for its Type are set
+type anthropicBlock struct {
+	Type         string                 `json:"type"`
+	Text         string                 `json:"text,omitempty"`
+	Thinking     string                 `json:"thinking,omitempty"`
+	Signature    string                 `json:"signature,omitempty"`
+	Data         string                 `json:"data,omitempty"` // redacted_thinking payload
+	ID           string                 `json:"id,omitempty"`
+	Name         string                 `json:"name,omitempty"`
+	Input        json.RawMessage        `json:"input,omitempty"`
+	ToolUseID    string                 `json:"tool_use_id,omitempty"`
+	Content      string                 `json:"content,omitempty"`
+	CacheControl *anthropicCacheControl `json:"cache_control,omitempty"`
+}
+
+type anthropicCacheControl struct {
+	Type string `json:"type"` // always "ephemeral"
+}
+
+type anthropicTool struct {
+	Name         string                 `json:"name"`
+	Description  string                 `json:"description,omitempty"`
+	InputSchema  map[string]any         `json:"input_schema"`
+	CacheControl *anthropicCacheControl `json:"cache_control,omitempty"`
+}
+
+type anthropicToolChoice struct {
+	Type string `json:"type"` // "auto", "any", "none" or "tool"
+	Name string `json:"name,omitempty"`
+}
+
+type anthropicThinking struct {
+	Type         string `json:"type"` // always "enabled"
+	BudgetTokens int    `json:"budget_tokens"`
+}
+
+// anthropicResponse is the body of a non-streaming /messages response
+type anthropicResponse struct {
+	ID         string           `json:"id"`
+	Model      string           `json:"model"`
+	Content    []anthropicBlock `json:"content"`
+	StopReason string           `json:"stop_reason"`
+	Usage      anthropicUsage   `json:"usage"`
+}
+
+type anthropicUsage struct {
+	InputTokens              int `json:"input_tokens"`
+	OutputTokens             int `json:"output_tokens"`
+	CacheCreationInputTokens int `json:"cache_creation_input_tokens"`
+	CacheReadInputTokens     int `json:"cache_read_input_tokens"`
+}
+
+// anthropicStreamEvent covers every event type of a streaming response
+type anthropicStreamEvent struct {
+	Type         string             `json:"type"`
+	Index        int                `json:"index"`
+	Message      *anthropicResponse `json:"message"`
+	ContentBlock *anthropicBlock    `json:"content_block"`
+	Delta        struct {
+		Type        string `json:"type"`
+		Text        string `json:"text"`
+		Thinking    string `json:"thinking"`
+		Signature   string `json:"signature"`
+		PartialJSON string `json:"partial_json"`
+		StopReason  string `json:"stop_reason"`
+	} `json:"delta"`
+	Usage *anthropicUsage `json:"usage"`
+	Error *struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func (c *AnthropicClient) Chat(ctx context.Context, req ChatRequest) (*ChatResponse, error) {
+	return c.send(ctx, c.buildRequest(req, false), nil)
+}
+
+// ChatStream sends a streaming Messages request. Text and thinking deltas are
+// passed to onDelta as they arrive; tool_use input is assembled from its JSON deltas.
+func (c *AnthropicClient) ChatStream(ctx context.Context, req ChatRequest, onDelta StreamHandler) (*ChatResponse, error) {
+	return c.send(ctx, c.buildRequest(req, true), onDelta)
+}
+
+// GetGenerationStats returns the usage recorded for a response returned by this client.
+// Anthropic has no generation lookup endpoint, so the data comes from the response itself.
+func (c *AnthropicClient) GetGenerationStats(ctx context.Context, generationID string) (*GenerationStats, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats, ok := c.stats.get(generationID)
+	if !ok {
+		return nil, fmt.Errorf("no generation stats for %q", generationID)
+	}
+	c.stats.delete(generationID)
+	return stats, nil
+}
+
+// buildRequest translates an OpenAI-shaped request into a Messages API request
+func (c *AnthropicClient) buildRequest(req ChatRequest, stream bool) anthropicRequest {
+	areq := anthropicRequest{
+		Model:     req.Model,
+		MaxTokens: req.MaxTokens,
+		Stream:    stream,
+	}
+	if areq.MaxTokens <= 0 {
+		areq.MaxTokens = anthropicDefaultMaxTokens
+	}
+
+	if c.thinkingBudget > 0 {
+		areq.Thinking = &anthropicThinking{Type: "enabled", BudgetTokens: c.thinkingBudget}
+		// max_tokens includes the thinking budget and must exceed it
+		if areq.MaxTokens <= c.thinkingBudget {
+			areq.MaxTokens = c.thinkingBudget + anthropicDefaultMaxTokens
+		}
+	} else if req.Temperature > 0 {
+		// Temperature can't be changed while thinking is enabled
+		temp := req.Temperature
+		areq.Temperature = &temp
+	}
+
+	for _, spec := range req.Tools {
+		schema := spec.Function.Parameters
+		if schema == nil {
+			schema = map[string]any{"type": "object", "properties": map[string]any{}}
+		}
+		areq.Tools = append(areq.Tools, anthropicTool{
+			Name:        spec.Function.Name,
+			Description: spec.Function.Description,
+			InputSchema: schema,
+		})
+	}
+	if len(areq.Tools) > 0 {
+		areq.ToolChoice = anthropicToolChoiceFor(req.ToolChoice)
+	}
+
+	areq.System, areq.Messages = c.convertMessages(req.Messages)
+
+	// Mark the stable prefix (tools, system prompt) and the end of the
+	// conversation as cache breakpoints so each turn reads the previous one from cache
+	ephemeral := &anthropicCacheControl{Type: "ephemeral"}
+	if n := len(areq.Tools); n > 0 {
+		areq.Tools[n-1].CacheControl = ephemeral
+	}
+	if n := len(areq.System); n > 0 {
+		areq.System[n-1].CacheControl = ephemeral
+	}
+	if n := len(areq.Messages); n > 0 {
+		blocks := areq.Messages[n-1].Content
+		if b := len(blocks); b > 0 && blocks[b-1].Type != "thinking" && blocks[b-1].Type != "redacted_thinking" {
+			blocks[b-1].CacheControl = ephemeral
+		}
+	}
+
+	return areq
+}
+
+// anthropicToolChoiceFor maps an OpenAI tool_choice string to its Anthropic equivalent
+func anthropicToolChoiceFor(choice string) *anthropicToolChoice {
+	switch choice {
+	case "", "auto":
+		return &anthropicToolChoice{Type: "auto"}
+	case "required":
+		return &anthropicToolChoice{Type: "any"}
+	case "none":
+		return &anthropicToolChoice{Type: "none"}
+	default:
+		return &anthropicToolChoice{Type: "tool", Name: choice}
+	}
+}
+
+// convertMessages splits leading system messages into the system prompt and
+// turns the rest into alternating user/assistant messages made of content blocks.
+// Tool results become tool_result blocks in a user message; consecutive messages
+// that map to the same role are merged because the API requires alternation.
+func (c *AnthropicClient) convertMessages(messages []Message) ([]anthropicBlock, []anthropicMessage) {
+	var system []anthropicBlock
+	var out []anthropicMessage
+
+	appendBlocks := func(role MessageRole, blocks ...anthropicBlock) {
+		if len(blocks) == 0 {
+			return
+		}
+		if n := len(out); n > 0 && out[n-1].Role == role {
+			out[n-1].Content = append(out[n-1].Content, blocks...)
+			return
+		}
+		out = append(out, anthropicMessage{Role: role, Content: blocks})
+	}
+
+	for _, msg := range messages {
+		switch msg.Role {
+		case RoleSystem:
+			if len(out) == 0 {
+				if msg.Content != "" {
+					system = append(system, anthropicBlock{Type: "text", Text: msg.Content})
+				}
+				continue
+			}
+			// System messages inside the conversation are delivered as user text
+			if msg.Content != "" {
+				appendBlocks(RoleUser, anthropicBlock{Type: "text", Text: msg.Content})
+			}
+
+		case RoleUser:
+			if msg.Content != "" {
+				appendBlocks(RoleUser, anthropicBlock{Type: "text", Text: msg.Content})
+			}
+
+		case RoleTool:
+			appendBlocks(RoleUser, anthropicBlock{
+				Type:      "tool_result",
+				ToolUseID: msg.ToolCallID,
+				Content:   msg.Content,
+			})
+
+		case RoleAssistant:
+			var blocks []anthropicBlock
+			// Thinking blocks must be sent back unchanged (with their signatures)
+			// for turns that used tools, even if the agent dropped the reasoning text
+			if len(msg.ToolCalls) > 0 {
+				c.mu.Lock()
+				thinking, _ := c.thinking.get(msg.ToolCalls[0].ID)
+				blocks = append(blocks, thinking...)
+				c.mu.Unlock()
+			}
+			if msg.Content != "" {
+				blocks = append(blocks, anthropicBlock{Type: "text", Text: msg.Content})
+			}
+			for _, tc := range msg.ToolCalls {
+				blocks = append(blocks, anthropicBlock{
+					Type:  "tool_use",
+					ID:    tc.ID,
+					Name:  tc.Function.Name,
+					Input: toolInput(tc.Function.Arguments),
+				})
+			}
+			appendBlocks(RoleAssistant, blocks...)
+		}
+	}
+
+	return system, out
+}
+
+// toolInput returns tool call arguments as a JSON object, falling back to {}
+// when the model produced something that isn't one
+func toolInput(arguments string) json.RawMessage {
+	trimmed := strings.TrimSpace(arguments)
+	if strings.HasPrefix(trimmed, "{") && json.Valid([]byte(trimmed)) {
+		return json.RawMessage(trimmed)
+	}
+	return json.RawMessage("{}")
+}
+
+// send performs a Messages request with retries and converts the result
+func (c *AnthropicClient) send(ctx context.Context, areq anthropicRequest, onDelta StreamHandler) (*ChatResponse, error) {
+	body, err := json.Marshal(areq)
+	if err != nil {
+		return nil, fmt.Errorf("marshal request: %w", err)
+	}
+
+	var lastErr error
+	for attempt := 0; attempt <= c.maxRetries; attempt++ {
+		if err := waitRetry(ctx, attempt); err != nil {
+			return nil, err
+		}
+
+		httpReq, err := http.NewRequestWithContext(ctx, "POST", c.baseURL+"/messages", bytes.NewReader(body))
+		if err != nil {
+			return nil, fmt.Errorf("create request: %w", err)
+		}
+		httpReq.Header.Set("Content-Type", "application/json")
+		httpReq.Header.Set("anthropic-version", anthropicVersion)
+		if c.apiKey != "" {
+			httpReq.Header.Set("x-api-key", c.apiKey)
+		}
+		if areq.Stream {
+			httpReq.Header.Set("Accept", "text/event-stream")
+		}
+
+		resp, err := c.client.Do(httpReq)
+		if err != nil {
+			lastErr = fmt.Errorf("execute request: %w", err)
+			if attempt < c.maxRetries {
+				continue // retry
+			}
+			return nil, lastErr
+		}
+
+		if resp.StatusCode != http.StatusOK {
+			respBody, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			lastErr = &APIError{StatusCode: resp.StatusCode, Body: respBody}
+			// 429 = rate limited, 529 = overloaded, other 5xx = server errors
+			if isRetryableError(resp.StatusCode, nil) && attempt < c.maxRetries {
+				continue // retry
+			}
+			return nil, lastErr
+		}
+
+		var aresp *anthropicResponse
+		if areq.Stream {
+			var received bool
+			aresp, received, err = readAnthropicStream(resp.Body, onDelta)
+			resp.Body.Close()
+			if err != nil {
+				lastErr = err
+				// Nothing was delivered yet, so the whole request can be retried safely
+				if !received && ctx.Err() == nil && attempt < c.maxRetries {
+					continue // retry
+				}
+				return nil, lastErr
+			}
+		} else {
+			respBody, readErr := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			if readErr != nil {
+				lastErr = fmt.Errorf("read response: %w", readErr)
+				if attempt < c.maxRetries {
+					continue // retry
+				}
+				return nil, lastErr
+			}
+			aresp = &anthropicResponse{}
+			if err := json.Unmarshal(respBody, aresp); err != nil {
+				return nil, fmt.Errorf("decode response: %w (body preview: %s)", err, truncatePreview(string(respBody)))
+			}
+		}
+
+		return c.toChatResponse(aresp), nil
+	}
+
+	return nil, fmt.Errorf("after %d retries: %w", c.maxRetries, lastErr)
+}
+
+// toChatResponse converts a Messages response and records its stats and thinking blocks
+func (c *AnthropicClient) toChatResponse(aresp *anthropicResponse) *ChatResponse {
+	msg := Message{Role: RoleAssistant}
+	var content, reasoning strings.Builder
+	var thinking []anthropicBlock
+
+	for _, block := range aresp.Content {
+		switch block.Type {
+		case "text":
+			content.WriteString(block.Text)
+		case "thinking":
+			reasoning.WriteString(block.Thinking)
+			thinking = append(thinking, block)
+		case "redacted_thinking":
+			thinking = append(thinking, block)
+		case "tool_use":
+			input := string(block.Input)
+			if input == "" {
+				input = "{}"
+			}
+			tc := ToolCall{ID: block.ID, Type: "function"}
+			tc.Function.Name = block.Name
+			tc.Function.Arguments = input
+			msg.ToolCalls = append(msg.ToolCalls, tc)
+		}
+	}
+	msg.Content = content.String()
+	msg.ReasoningContent = reasoning.String()
+
+	resp := &ChatResponse{ID: aresp.ID, Model: aresp.Model}
+	resp.Choices = append(resp.Choices, struct {
+		Index        int          `json:"index"`
+		Message      Message      `json:"message"`
+		FinishReason string       `json:"finish_reason"`
+		Error        *ChoiceError `json:"error,omitempty"`
+	}{
+		Index:        0,
+		Message:      msg,
+		FinishReason: anthropicFinishReason(aresp.StopReason),
+	})
+
+	// input_tokens excludes cached tokens; the agent counts the full prompt
+	usage := aresp.Usage
+	promptTokens := usage.InputTokens + usage.CacheReadInputTokens + usage.CacheCreationInputTokens
+	resp.Usage.PromptTokens = promptTokens
+	resp.Usage.CompletionTokens = usage.OutputTokens
+	resp.Usage.TotalTokens = promptTokens + usage.OutputTokens
+
+	stats := &GenerationStats{}
+	stats.Data.ID = aresp.ID
+	stats.Data.Model = aresp.Model
+	stats.Data.FinishReason = resp.Choices[0].FinishReason
+	stats.Data.ProviderName = "Anthropic"
+	stats.Data.TokensPrompt = promptTokens
+	stats.Data.TokensCompletion = usage.OutputTokens
+	stats.Data.NativeTokensPrompt = promptTokens
+	stats.Data.NativeTokensCompletion = usage.OutputTokens
+	stats.Data.NativeTokensCached = usage.CacheReadInputTokens
+	stats.Data.NativeTokensCacheWrite = usage.CacheCreationInputTokens
+
+	c.mu.Lock()
+	if aresp.ID != "" {
+		c.stats.put(aresp.ID, stats)
+	}
+	if len(thinking) > 0 && len(msg.ToolCalls) > 0 {
+		c.thinking.put(msg.ToolCalls[0].ID, thinking)
+	}
+	c.mu.Unlock()
+
+	return resp
+}
+
+// anthropicFinishReason maps a stop_reason to the OpenAI finish_reason the agent expects
+func anthropicFinishReason(stopReason string) string {
+	switch stopReason {
+	case "max_tokens":
+		return "length"
+	case "tool_use":
+		return "tool_calls"
+	case "end_turn", "stop_sequence", "":
+		return "stop"
+	default:
+		return stopReason
+	}
+}
+
+// readAnthropicStream assembles a Messages response from server-sent events.
+// received reports whether any content was delivered, which tells the caller
+// whether it is still safe to retry the request from scratch.
+func readAnthropicStream(body io.Reader, onDelta StreamHandler) (aresp *anthropicResponse, received bool, err error) {
+	aresp = &anthropicResponse{}
+	var inputs []*strings.Builder // partial tool input JSON per block index
+	stopped := false
+
+	blockAt := func(index int) *anthropicBlock {
+		for len(aresp.Content) <= index {
+			aresp.Content = append(aresp.Content, anthropicBlock{})
+			inputs = append(inputs, &strings.Builder{})
+		}
+		return &aresp.Content[index]
+	}
+
+	reader := bufio.NewReader(body)
+	for !stopped {
+		line, readErr := reader.ReadString('\n')
+		line = strings.TrimRight(line, "\r\n")
+
+		if data, ok := strings.CutPrefix(line, "data:"); ok && strings.TrimSpace(data) != "" {
+			var event anthropicStreamEvent
+			if jsonErr := json.Unmarshal([]byte(strings.TrimSpace(data)), &event); jsonErr != nil {
+				return nil, received, fmt.Errorf("decode stream event: %w (event: %s)", jsonErr, truncatePreview(data))
+			}
+
+			switch event.Type {
+			case "message_start":
+				if event.Message != nil {
+					aresp.ID = event.Message.ID
+					aresp.Model = event.Message.Model
+					aresp.Usage = event.Message.Usage
+				}
+			case "content_block_start":
+				if event.ContentBlock != nil {
+					*blockAt(event.Index) = *event.ContentBlock
+				}
+			case "content_block_delta":
+				block := blockAt(event.Index)
+				switch event.Delta.Type {
+				case "text_delta":
+					block.Text += event.Delta.Text
+					received = true
+					if onDelta != nil {
+						onDelta(StreamDelta{Content: event.Delta.Text})
+					}
+				case "thinking_delta":
+					block.Thinking += event.Delta.Thinking
+					received = true
+					if onDelta != nil {
+						onDelta(StreamDelta{ReasoningContent: event.Delta.Thinking})
+					}
+				case "signature_delta":
+					block.Signature += event.Delta.Signature
+				case "input_json_delta":
+					inputs[event.Index].WriteString(event.Delta.PartialJSON)
+					received = true
+				}
+			case "message_delta":
+				if event.Delta.StopReason != "" {
+					aresp.StopReason = event.Delta.StopReason
+				}
+				if event.Usage != nil {
+					aresp.Usage.OutputTokens = event.Usage.OutputTokens
+				}
+			case "message_stop":
+				stopped = true
+			case "error":
+				msg := "unknown error"
+				if event.Error != nil {
+					msg = event.Error.Type + ": " + event.Error.Message
+				}
+				return nil, received, fmt.Errorf("stream error: %s", msg)
+			}
+			// ping and content_block_stop carry nothing we need
+		}
+
+		if readErr != nil && !stopped {
+			if readErr == io.EOF || errors.Is(readErr, io.ErrUnexpectedEOF) {
+				return nil, received, fmt.Errorf("response stream ended before message_stop")
+			}
+			return nil, received, fmt.Errorf("read stream: %w", readErr)
+		}
+	}
+
+	// Tool inputs arrive as JSON fragments; the start event only carries {}
+	for i := range aresp.Content {
+		if aresp.Content[i].Type == "tool_use" && inputs[i].Len() > 0 {
+			aresp.Content[i].Input = json.RawMessage(inputs[i].String())
+		}
+	}
+	return aresp, received, nil
+}
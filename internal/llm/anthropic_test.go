@@ -0,0 +1,300 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func toolCall(id, name, args string) ToolCall {
+	tc := ToolCall{ID: id, Type: "function"}
+	tc.Function.Name = name
+	tc.Function.Arguments = args
+	return tc
+}
+
+func TestAnthropicRequestMapping(t *testing.T) {
+	var got anthropicRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/messages" {
+			t.Errorf("path = %q, want /messages", r.URL.Path)
+		}
+		if r.Header.Get("x-api-key") != "secret" {
+			t.Errorf("x-api-key = %q, want secret", r.Header.Get("x-api-key"))
+		}
+		if r.Header.Get("anthropic-version") == "" {
+			t.Error("anthropic-version header not set")
+		}
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Fatalf("Failed to decode request: %v", err)
+		}
+		_, _ = w.Write([]byte(`{"id":"msg_1","model":"claude","content":[{"type":"text","text":"done"}],"stop_reason":"end_turn","usage":{"input_tokens":5,"output_tokens":1}}`))
+	}))
+	defer server.Close()
+
+	var spec ToolSpec
+	spec.Type = "function"
+	spec.Function.Name = "Read"
+	spec.Function.Description = "Read a file"
+	spec.Function.Parameters = map[string]any{"type": "object"}
+
+	client := NewAnthropicClient(server.URL, "secret", 0)
+	_, err := client.Chat(context.Background(), ChatRequest{
+		Model:       "claude",
+		Temperature: 0.2,
+		ToolChoice:  "auto",
+		Tools:       []ToolSpec{spec},
+		Messages: []Message{
+			{Role: RoleSystem, Content: "You are helpful."},
+			{Role: RoleUser, Content: "Read main.go"},
+			{Role: RoleAssistant, Content: "Reading.", ToolCalls: []ToolCall{
+				toolCall("toolu_1", "Read", `{"path":"main.go"}`),
+				toolCall("toolu_2", "Read", `not json`),
+			}},
+			{Role: RoleTool, ToolCallID: "toolu_1", Content: "package main"},
+			{Role: RoleTool, ToolCallID: "toolu_2", Content: "error"},
+			{Role: RoleUser, Content: "Thanks"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Chat() error = %v", err)
+	}
+
+	if len(got.System) != 1 || got.System[0].Text != "You are helpful." {
+		t.Errorf("System = %+v, want the system prompt", got.System)
+	}
+	if got.System[0].CacheControl == nil {
+		t.Error("System prompt should be a cache breakpoint")
+	}
+	if got.MaxTokens != anthropicDefaultMaxTokens {
+		t.Errorf("MaxTokens = %d, want default %d", got.MaxTokens, anthropicDefaultMaxTokens)
+	}
+	if got.Temperature == nil || *got.Temperature != 0.2 {
+		t.Errorf("Temperature = %v, want 0.2", got.Temperature)
+	}
+	if len(got.Tools) != 1 || got.Tools[0].Name != "Read" || got.Tools[0].InputSchema["type"] != "object" {
+		t.Errorf("Tools = %+v, want Read with input_schema", got.Tools)
+	}
+	if got.ToolChoice == nil || got.ToolChoice.Type != "auto" {
+		t.Errorf("ToolChoice = %+v, want auto", got.ToolChoice)
+	}
+
+	// user, assistant, user (two tool results merged with the follow-up text)
+	if len(got.Messages) != 3 {
+		t.Fatalf("len(Messages) = %d, want 3: %+v", len(got.Messages), got.Messages)
+	}
+	assistant := got.Messages[1]
+	if assistant.Role != RoleAssistant || len(assistant.Content) != 3 {
+		t.Fatalf("assistant message = %+v, want text + 2 tool_use blocks", assistant)
+	}
+	if assistant.Content[1].Type != "tool_use" || assistant.Content[1].ID != "toolu_1" || string(assistant.Content[1].Input) != `{"path":"main.go"}` {
+		t.Errorf("tool_use block = %+v", assistant.Content[1])
+	}
+	if string(assistant.Content[2].Input) != "{}" {
+		t.Errorf("invalid arguments input = %s, want {}", assistant.Content[2].Input)
+	}
+
+	results := got.Messages[2]
+	if results.Role != RoleUser || len(results.Content) != 3 {
+		t.Fatalf("results message = %+v, want 2 tool_result blocks + text", results)
+	}
+	if results.Content[0].Type != "tool_result" || results.Content[0].ToolUseID != "toolu_1" || results.Content[0].Content != "package main" {
+		t.Errorf("tool_result block = %+v", results.Content[0])
+	}
+	if results.Content[2].Type != "text" || results.Content[2].CacheControl == nil {
+		t.Errorf("last block = %+v, want text with cache breakpoint", results.Content[2])
+	}
+}
+
+func TestAnthropicResponseMapping(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{
+			"id": "msg_2",
+			"model": "claude",
+			"content": [
+				{"type": "thinking", "thinking": "Need the file.", "signature": "sig"},
+				{"type": "text", "text": "Let me look."},
+				{"type": "tool_use", "id": "toolu_9", "name": "Read", "input": {"path": "a.go"}}
+			],
+			"stop_reason": "tool_use",
+			"usage": {"input_tokens": 10, "output_tokens": 20, "cache_read_input_tokens": 100, "cache_creation_input_tokens": 30}
+		}`))
+	}))
+	defer server.Close()
+
+	client := NewAnthropicClient(server.URL, "", 0)
+	resp, err := client.Chat(context.Background(), ChatRequest{Model: "claude", Messages: []Message{{Role: RoleUser, Content: "hi"}}})
+	if err != nil {
+		t.Fatalf("Chat() error = %v", err)
+	}
+
+	choice := resp.Choices[0]
+	if choice.FinishReason != "tool_calls" {
+		t.Errorf("FinishReason = %q, want tool_calls", choice.FinishReason)
+	}
+	if choice.Message.Content != "Let me look." || choice.Message.ReasoningContent != "Need the file." {
+		t.Errorf("Message = %+v, want content and reasoning", choice.Message)
+	}
+	if len(choice.Message.ToolCalls) != 1 || choice.Message.ToolCalls[0].Function.Arguments != `{"path": "a.go"}` {
+		t.Errorf("ToolCalls = %+v", choice.Message.ToolCalls)
+	}
+	if resp.Usage.PromptTokens != 140 || resp.Usage.CompletionTokens != 20 {
+		t.Errorf("Usage = %+v, want prompt 140 (incl. cache), completion 20", resp.Usage)
+	}
+
+	stats, err := client.GetGenerationStats(context.Background(), "msg_2")
+	if err != nil {
+		t.Fatalf("GetGenerationStats() error = %v", err)
+	}
+	if stats.Data.NativeTokensCached != 100 || stats.Data.NativeTokensCacheWrite != 30 || stats.Data.NativeTokensPrompt != 140 {
+		t.Errorf("stats = %+v, want cached 100, cache write 30, prompt 140", stats.Data)
+	}
+	if _, err := client.GetGenerationStats(context.Background(), "msg_2"); err == nil {
+		t.Error("GetGenerationStats() should forget stats once read")
+	}
+
+	// The thinking block must be replayed before the tool_use on the next turn,
+	// even though the agent may have dropped the reasoning text from history
+	assistant := choice.Message
+	assistant.ReasoningContent = ""
+	areq := client.buildRequest(ChatRequest{Messages: []Message{
+		{Role: RoleUser, Content: "hi"},
+		assistant,
+		{Role: RoleTool, ToolCallID: "toolu_9", Content: "ok"},
+	}}, false)
+	first := areq.Messages[1].Content[0]
+	if first.Type != "thinking" || first.Signature != "sig" {
+		t.Errorf("first assistant block = %+v, want signed thinking block", first)
+	}
+}
+
+func TestAnthropicChatStream(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req anthropicRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		if !req.Stream {
+			t.Error("Request.Stream = false, want true")
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		events := []string{
+			`{"type":"message_start","message":{"id":"msg_3","model":"claude","usage":{"input_tokens":7,"cache_read_input_tokens":50}}}`,
+			`{"type":"content_block_start","index":0,"content_block":{"type":"thinking","thinking":""}}`,
+			`{"type":"content_block_delta","index":0,"delta":{"type":"thinking_delta","thinking":"Hmm."}}`,
+			`{"type":"content_block_delta","index":0,"delta":{"type":"signature_delta","signature":"s1"}}`,
+			`{"type":"content_block_start","index":1,"content_block":{"type":"text","text":""}}`,
+			`{"type":"ping"}`,
+			`{"type":"content_block_delta","index":1,"delta":{"type":"text_delta","text":"Hi "}}`,
+			`{"type":"content_block_delta","index":1,"delta":{"type":"text_delta","text":"there"}}`,
+			`{"type":"content_block_start","index":2,"content_block":{"type":"tool_use","id":"toolu_5","name":"Search","input":{}}}`,
+			`{"type":"content_block_delta","index":2,"delta":{"type":"input_json_delta","partial_json":"{\"pattern\":"}}`,
+			`{"type":"content_block_delta","index":2,"delta":{"type":"input_json_delta","partial_json":"\"x\"}"}}`,
+			`{"type":"content_block_stop","index":2}`,
+			`{"type":"message_delta","delta":{"stop_reason":"tool_use"},"usage":{"output_tokens":12}}`,
+			`{"type":"message_stop"}`,
+		}
+		for _, e := range events {
+			var typ struct {
+				Type string `json:"type"`
+			}
+			_ = json.Unmarshal([]byte(e), &typ)
+			_, _ = w.Write([]byte("event: " + typ.Type + "\ndata: " + e + "\n\n"))
+		}
+	}))
+	defer server.Close()
+
+	client := NewAnthropicClient(server.URL, "", 0)
+	var content, reasoning strings.Builder
+	resp, err := client.ChatStream(context.Background(), ChatRequest{Model: "claude"}, func(d StreamDelta) {
+		content.WriteString(d.Content)
+		reasoning.WriteString(d.ReasoningContent)
+	})
+	if err != nil {
+		t.Fatalf("ChatStream() error = %v", err)
+	}
+
+	if content.String() != "Hi there" || reasoning.String() != "Hmm." {
+		t.Errorf("streamed content = %q, reasoning = %q", content.String(), reasoning.String())
+	}
+	msg := resp.Choices[0].Message
+	if len(msg.ToolCalls) != 1 || msg.ToolCalls[0].Function.Arguments != `{"pattern":"x"}` {
+		t.Errorf("ToolCalls = %+v, want Search with assembled input", msg.ToolCalls)
+	}
+	if resp.Usage.PromptTokens != 57 || resp.Usage.CompletionTokens != 12 {
+		t.Errorf("Usage = %+v, want prompt 57, completion 12", resp.Usage)
+	}
+	stats, err := client.GetGenerationStats(context.Background(), "msg_3")
+	if err != nil || stats.Data.NativeTokensCached != 50 {
+		t.Errorf("GetGenerationStats() = %+v, %v, want 50 cached", stats, err)
+	}
+}
+
+func TestAnthropicForgetsOldResponses(t *testing.T) {
+	// Stats nobody reads and old thinking blocks don't pile up
+	m := newRecentMap[int](3)
+	for i, key := range []string{"a", "b", "c", "d"} {
+		m.put(key, i)
+	}
+	if _, ok := m.get("a"); ok || len(m.items) != 3 {
+		t.Errorf("items = %v, want the oldest of 4 dropped at 3", m.items)
+	}
+	m.delete("c")
+	m.put("e", 4)
+	m.put("f", 5)
+	if _, ok := m.get("b"); ok {
+		t.Errorf("items = %v, want b dropped after c was deleted", m.items)
+	}
+	if v, ok := m.get("d"); !ok || v != 3 {
+		t.Errorf("d = %v, %v, want 3 kept", v, ok)
+	}
+}
+
+func TestAnthropicAPIError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"type":"error","error":{"type":"invalid_request_error","message":"prompt is too long"}}`))
+	}))
+	defer server.Close()
+
+	client := NewAnthropicClient(server.URL, "", 0)
+	_, err := client.Chat(context.Background(), ChatRequest{Model: "claude"})
+	// The runner detects context overflow by this prefix
+	if err == nil || !strings.Contains(err.Error(), "API error 400") {
+		t.Errorf("Chat() error = %v, want API error 400", err)
+	}
+}
+
+func TestAnthropicThinkingBudget(t *testing.T) {
+	client := NewAnthropicClient("", "", 8000)
+	areq := client.buildRequest(ChatRequest{Temperature: 0.5, MaxTokens: 2048}, false)
+	if areq.Thinking == nil || areq.Thinking.BudgetTokens != 8000 {
+		t.Errorf("Thinking = %+v, want budget 8000", areq.Thinking)
+	}
+	if areq.MaxTokens <= 8000 {
+		t.Errorf("MaxTokens = %d, must exceed the thinking budget", areq.MaxTokens)
+	}
+	if areq.Temperature != nil {
+		t.Error("Temperature must not be sent with thinking enabled")
+	}
+	if client.baseURL != DefaultAnthropicBaseURL {
+		t.Errorf("baseURL = %q, want default", client.baseURL)
+	}
+}
+
+func TestNewProvider(t *testing.T) {
+	if p, err := NewProvider(ProviderOptions{BaseURL: "http://x"}); err != nil {
+		t.Errorf("NewProvider(default) error = %v", err)
+	} else if _, ok := p.(*Client); !ok {
+		t.Errorf("NewProvider(default) = %T, want *Client", p)
+	}
+	if p, err := NewProvider(ProviderOptions{Kind: ProviderAnthropic}); err != nil {
+		t.Errorf("NewProvider(anthropic) error = %v", err)
+	} else if _, ok := p.(*AnthropicClient); !ok {
+		t.Errorf("NewProvider(anthropic) = %T, want *AnthropicClient", p)
+	}
+	if _, err := NewProvider(ProviderOptions{Kind: "bogus"}); err == nil {
+		t.Error("NewProvider(bogus) should fail")
+	}
+}
@@ -0,0 +1,310 @@
+package llm
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// CassetteFile is the name of the cassette inside a record/replay directory
+const CassetteFile = "cassette.jsonl"
+
+// Replay match modes, from strictest to most lenient
+const (
+	// MatchStrict requires requests to arrive in recorded order with identical content
+	MatchStrict = "strict"
+	// MatchHash serves the first unused recording with identical content, in any order
+	MatchHash = "hash"
+	// MatchSequential serves recordings in order without comparing content
+	MatchSequential = "sequential"
+)
+
+// CassetteEntry is one recorded interaction with the LLM server
+type CassetteEntry struct {
+	Seq  int    `json:"seq"`
+	Kind string `json:"kind"` // "chat" or "generation"
+
+	// Chat interactions
+	Hash     string        `json:"hash,omitempty"`
+	Request  *ChatRequest  `json:"request,omitempty"`
+	Response *ChatResponse `json:"response,omitempty"`
+
+	// Generation stats lookups
+	GenerationID string           `json:"generation_id,omitempty"`
+	Stats        *GenerationStats `json:"stats,omitempty"`
+
+	// Failed calls are recorded too, so error handling can be replayed
+	Error      string `json:"error,omitempty"`
+	StatusCode int    `json:"status_code,omitempty"` // set when Error came from an APIError
+	ErrorBody  string `json:"error_body,omitempty"`
+}
+
+// RequestHash identifies a request by content. Streaming flags are left out
+// so a recording made with streaming can be replayed without it and vice versa.
+func RequestHash(req ChatRequest) string {
+	req.Stream = false
+	req.StreamOptions = nil
+	data, _ := json.Marshal(req)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// Recorder is a Provider that passes calls through and writes each
+// request/response pair and generation stats lookup to a cassette
+type Recorder struct {
+	next Provider
+
+	mu   sync.Mutex
+	file *os.File
+	seq  int
+}
+
+// NewRecorder creates dir if needed and starts a new cassette in it
+func NewRecorder(next Provider, dir string) (*Recorder, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("create cassette directory: %w", err)
+	}
+	file, err := os.Create(filepath.Join(dir, CassetteFile))
+	if err != nil {
+		return nil, fmt.Errorf("create cassette: %w", err)
+	}
+	return &Recorder{next: next, file: file}, nil
+}
+
+// Close closes the cassette file
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.file.Close()
+}
+
+func (r *Recorder) Chat(ctx context.Context, req ChatRequest) (*ChatResponse, error) {
+	resp, err := r.next.Chat(ctx, req)
+	r.recordChat(req, resp, err)
+	return resp, err
+}
+
+func (r *Recorder) ChatStream(ctx context.Context, req ChatRequest, onDelta StreamHandler) (*ChatResponse, error) {
+	resp, err := r.next.ChatStream(ctx, req, onDelta)
+	r.recordChat(req, resp, err)
+	return resp, err
+}
+
+func (r *Recorder) GetGenerationStats(ctx context.Context, generationID string) (*GenerationStats, error) {
+	stats, err := r.next.GetGenerationStats(ctx, generationID)
+	entry := CassetteEntry{Kind: "generation", GenerationID: generationID, Stats: stats}
+	setEntryError(&entry, err)
+	r.write(entry)
+	return stats, err
+}
+
+func (r *Recorder) recordChat(req ChatRequest, resp *ChatResponse, err error) {
+	// Cancellation is the user's doing, not the server's, and isn't replayable
+	if errors.Is(err, context.Canceled) {
+		return
+	}
+	entry := CassetteEntry{Kind: "chat", Hash: RequestHash(req), Request: &req, Response: resp}
+	setEntryError(&entry, err)
+	r.write(entry)
+}
+
+// write appends an entry and syncs it, so a crashed run still leaves a usable cassette
+func (r *Recorder) write(entry CassetteEntry) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.seq++
+	entry.Seq = r.seq
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	_, _ = r.file.Write(append(data, '\n'))
+	_ = r.file.Sync()
+}
+
+func setEntryError(entry *CassetteEntry, err error) {
+	if err == nil {
+		return
+	}
+	entry.Error = err.Error()
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		entry.StatusCode = apiErr.StatusCode
+		entry.ErrorBody = string(apiErr.Body)
+	}
+}
+
+// entryError rebuilds the error of a recorded failed call
+func entryError(entry *CassetteEntry) error {
+	if entry.StatusCode != 0 {
+		return &APIError{StatusCode: entry.StatusCode, Body: []byte(entry.ErrorBody)}
+	}
+	return errors.New(entry.Error)
+}
+
+// Replayer is a Provider that serves responses from a cassette instead of a server
+type Replayer struct {
+	mode string
+
+	mu    sync.Mutex
+	chats []*CassetteEntry
+	used  []bool
+	next  int                       // index of the next chat for strict and sequential modes
+	stats map[string]*CassetteEntry // generation ID -> stats lookup
+}
+
+// NewReplayer loads the cassette in dir. mode is MatchStrict, MatchHash (default) or MatchSequential.
+func NewReplayer(dir, mode string) (*Replayer, error) {
+	switch mode {
+	case "":
+		mode = MatchHash
+	case MatchStrict, MatchHash, MatchSequential:
+	default:
+		return nil, fmt.Errorf("unknown replay mode %q (expected %q, %q or %q)", mode, MatchStrict, MatchHash, MatchSequential)
+	}
+
+	file, err := os.Open(filepath.Join(dir, CassetteFile))
+	if err != nil {
+		return nil, fmt.Errorf("open cassette: %w", err)
+	}
+	defer file.Close()
+
+	r := &Replayer{mode: mode, stats: make(map[string]*CassetteEntry)}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 1024*1024), 64*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var entry CassetteEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("cassette line %d: %w", line, err)
+		}
+		switch entry.Kind {
+		case "chat":
+			r.chats = append(r.chats, &entry)
+		case "generation":
+			r.stats[entry.GenerationID] = &entry
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read cassette: %w", err)
+	}
+	r.used = make([]bool, len(r.chats))
+	return r, nil
+}
+
+// Remaining returns how many recorded chat responses have not been served
+func (r *Replayer) Remaining() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	n := 0
+	for _, used := range r.used {
+		if !used {
+			n++
+		}
+	}
+	return n
+}
+
+func (r *Replayer) Chat(ctx context.Context, req ChatRequest) (*ChatResponse, error) {
+	entry, err := r.match(req)
+	if err != nil {
+		return nil, err
+	}
+	if entry.Error != "" {
+		return nil, entryError(entry)
+	}
+	return entry.Response, nil
+}
+
+// ChatStream replays a recorded response, delivering its reasoning and content as single deltas
+func (r *Replayer) ChatStream(ctx context.Context, req ChatRequest, onDelta StreamHandler) (*ChatResponse, error) {
+	resp, err := r.Chat(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if onDelta != nil && len(resp.Choices) > 0 {
+		msg := resp.Choices[0].Message
+		if msg.ReasoningContent != "" {
+			onDelta(StreamDelta{ReasoningContent: msg.ReasoningContent})
+		}
+		if msg.Content != "" {
+			onDelta(StreamDelta{Content: msg.Content})
+		}
+	}
+	return resp, nil
+}
+
+func (r *Replayer) GetGenerationStats(ctx context.Context, generationID string) (*GenerationStats, error) {
+	r.mu.Lock()
+	entry, ok := r.stats[generationID]
+	r.mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("cassette has no generation stats for %q", generationID)
+	}
+	if entry.Error != "" {
+		return nil, entryError(entry)
+	}
+	return entry.Stats, nil
+}
+
+// match finds the recording to serve for req according to the replay mode
+func (r *Replayer) match(req ChatRequest) (*CassetteEntry, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	hash := RequestHash(req)
+	switch r.mode {
+	case MatchHash:
+		for i, entry := range r.chats {
+			if !r.used[i] && entry.Hash == hash {
+				r.used[i] = true
+				return entry, nil
+			}
+		}
+		return nil, fmt.Errorf("cassette has no unused recording matching request %s", hash[:12])
+
+	default: // MatchStrict, MatchSequential
+		if r.next >= len(r.chats) {
+			return nil, fmt.Errorf("cassette exhausted after %d requests", len(r.chats))
+		}
+		entry := r.chats[r.next]
+		if r.mode == MatchStrict && entry.Hash != hash {
+			return nil, fmt.Errorf("request %d does not match the recording: %s", r.next+1, describeMismatch(entry.Request, &req))
+		}
+		r.used[r.next] = true
+		r.next++
+		return entry, nil
+	}
+}
+
+// describeMismatch points at the first difference between a recorded and an actual request
+func describeMismatch(recorded, actual *ChatRequest) string {
+	if recorded == nil {
+		return "recording has no request"
+	}
+	if recorded.Model != actual.Model {
+		return fmt.Sprintf("model %q, recorded %q", actual.Model, recorded.Model)
+	}
+	for i := 0; i < len(recorded.Messages) && i < len(actual.Messages); i++ {
+		a, _ := json.Marshal(actual.Messages[i])
+		b, _ := json.Marshal(recorded.Messages[i])
+		if string(a) != string(b) {
+			return fmt.Sprintf("message %d differs (%s: %q, recorded %s: %q)", i,
+				actual.Messages[i].Role, truncatePreview(actual.Messages[i].Content),
+				recorded.Messages[i].Role, truncatePreview(recorded.Messages[i].Content))
+		}
+	}
+	if len(recorded.Messages) != len(actual.Messages) {
+		return fmt.Sprintf("%d messages, recorded %d", len(actual.Messages), len(recorded.Messages))
+	}
+	return "tools or sampling parameters differ"
+}
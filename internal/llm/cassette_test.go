@@ -0,0 +1,162 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// scriptedProvider returns canned responses in order, echoing the last user message
+type scriptedProvider struct {
+	calls int
+	errAt int // 1-based call that fails with a 400 (0 = never)
+}
+
+func (s *scriptedProvider) Chat(ctx context.Context, req ChatRequest) (*ChatResponse, error) {
+	s.calls++
+	if s.calls == s.errAt {
+		return nil, &APIError{StatusCode: 400, Body: []byte("context overflow")}
+	}
+	last := req.Messages[len(req.Messages)-1].Content
+	resp := &ChatResponse{ID: "gen-" + last}
+	resp.Choices = append(resp.Choices, struct {
+		Index        int          `json:"index"`
+		Message      Message      `json:"message"`
+		FinishReason string       `json:"finish_reason"`
+		Error        *ChoiceError `json:"error,omitempty"`
+	}{Message: Message{Role: RoleAssistant, Content: "echo " + last, ReasoningContent: "thinking"}, FinishReason: "stop"})
+	return resp, nil
+}
+
+func (s *scriptedProvider) ChatStream(ctx context.Context, req ChatRequest, onDelta StreamHandler) (*ChatResponse, error) {
+	return s.Chat(ctx, req)
+}
+
+func (s *scriptedProvider) GetGenerationStats(ctx context.Context, generationID string) (*GenerationStats, error) {
+	stats := &GenerationStats{}
+	stats.Data.ID = generationID
+	stats.Data.TotalCost = 0.5
+	return stats, nil
+}
+
+func userReq(content string) ChatRequest {
+	return ChatRequest{Model: "m", Messages: []Message{{Role: RoleUser, Content: content}}}
+}
+
+// recordCassette records "one", "two", then a failing "three" into a temp dir
+func recordCassette(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	rec, err := NewRecorder(&scriptedProvider{errAt: 3}, dir)
+	if err != nil {
+		t.Fatalf("NewRecorder() error = %v", err)
+	}
+	ctx := context.Background()
+	if _, err := rec.Chat(ctx, userReq("one")); err != nil {
+		t.Fatalf("Chat(one) error = %v", err)
+	}
+	if _, err := rec.GetGenerationStats(ctx, "gen-one"); err != nil {
+		t.Fatalf("GetGenerationStats() error = %v", err)
+	}
+	if _, err := rec.ChatStream(ctx, userReq("two"), nil); err != nil {
+		t.Fatalf("ChatStream(two) error = %v", err)
+	}
+	if _, err := rec.Chat(ctx, userReq("three")); err == nil {
+		t.Fatal("Chat(three) should fail")
+	}
+	if err := rec.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	return dir
+}
+
+func TestCassetteReplayHash(t *testing.T) {
+	dir := recordCassette(t)
+	rep, err := NewReplayer(dir, MatchHash)
+	if err != nil {
+		t.Fatalf("NewReplayer() error = %v", err)
+	}
+	ctx := context.Background()
+
+	// Out of order is fine when matching by hash
+	resp, err := rep.Chat(ctx, userReq("two"))
+	if err != nil {
+		t.Fatalf("Chat(two) error = %v", err)
+	}
+	if resp.Choices[0].Message.Content != "echo two" {
+		t.Errorf("Content = %q, want echo two", resp.Choices[0].Message.Content)
+	}
+
+	// Replaying a streamed recording without streaming (and vice versa) matches
+	var streamed strings.Builder
+	resp, err = rep.ChatStream(ctx, userReq("one"), func(d StreamDelta) { streamed.WriteString(d.Content) })
+	if err != nil {
+		t.Fatalf("ChatStream(one) error = %v", err)
+	}
+	if streamed.String() != "echo one" || resp.ID != "gen-one" {
+		t.Errorf("streamed = %q, ID = %q", streamed.String(), resp.ID)
+	}
+
+	stats, err := rep.GetGenerationStats(ctx, "gen-one")
+	if err != nil || stats.Data.TotalCost != 0.5 {
+		t.Errorf("GetGenerationStats() = %+v, %v, want recorded cost", stats, err)
+	}
+
+	// Recorded API errors come back as APIError so overflow handling replays too
+	_, err = rep.Chat(ctx, userReq("three"))
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != 400 || !strings.Contains(err.Error(), "API error 400") {
+		t.Errorf("Chat(three) error = %v, want recorded API error 400", err)
+	}
+
+	if _, err := rep.Chat(ctx, userReq("one")); err == nil {
+		t.Error("a recording should be served only once")
+	}
+	if rep.Remaining() != 0 {
+		t.Errorf("Remaining() = %d, want 0", rep.Remaining())
+	}
+}
+
+func TestCassetteReplayStrict(t *testing.T) {
+	dir := recordCassette(t)
+	rep, _ := NewReplayer(dir, MatchStrict)
+	ctx := context.Background()
+
+	if _, err := rep.Chat(ctx, userReq("one")); err != nil {
+		t.Fatalf("Chat(one) error = %v", err)
+	}
+	_, err := rep.Chat(ctx, userReq("changed"))
+	if err == nil || !strings.Contains(err.Error(), "message 0 differs") {
+		t.Errorf("Chat(changed) error = %v, want mismatch at message 0", err)
+	}
+}
+
+func TestCassetteReplaySequential(t *testing.T) {
+	dir := recordCassette(t)
+	rep, _ := NewReplayer(dir, MatchSequential)
+	ctx := context.Background()
+
+	// Content is not compared, only order
+	resp, err := rep.Chat(ctx, userReq("anything"))
+	if err != nil || resp.ID != "gen-one" {
+		t.Fatalf("Chat() = %v, %v, want first recording", resp, err)
+	}
+	resp, err = rep.Chat(ctx, userReq("else"))
+	if err != nil || resp.ID != "gen-two" {
+		t.Fatalf("Chat() = %v, %v, want second recording", resp, err)
+	}
+	_, _ = rep.Chat(ctx, userReq("x"))
+	if _, err := rep.Chat(ctx, userReq("y")); err == nil || !strings.Contains(err.Error(), "exhausted") {
+		t.Errorf("Chat() error = %v, want cassette exhausted", err)
+	}
+}
+
+func TestNewReplayerErrors(t *testing.T) {
+	if _, err := NewReplayer(t.TempDir(), MatchHash); err == nil {
+		t.Error("NewReplayer() should fail without a cassette")
+	}
+	if _, err := NewReplayer(t.TempDir(), "fuzzy"); err == nil {
+		t.Error("NewReplayer() should reject unknown mode")
+	}
+}
@@ -11,9 +11,10 @@ import (
 )
 
 type Client struct {
-	baseURL string
-	apiKey  string
-	client  *http.Client
+	baseURL    string
+	apiKey     string
+	client     *http.Client
+	maxRetries int
 }
 
 func NewClient(baseURL, apiKey string) *Client {
@@ -25,9 +26,20 @@ func NewClient(baseURL, apiKey string) *Client {
 				DisableKeepAlives: true, // Disable connection reuse to avoid EOF issues
 			},
 		},
+		maxRetries: defaultMaxRetries,
 	}
 }
 
+// APIError is returned when the server answers with a non-200 status
+type APIError struct {
+	StatusCode int
+	Body       []byte
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("API error %d: %s", e.StatusCode, e.Body)
+}
+
 // isRetryableError returns true if the error or status code should trigger a retry
 func isRetryableError(statusCode int, err error) bool {
 	// Network/connection errors are retryable
@@ -38,6 +50,34 @@ func isRetryableError(statusCode int, err error) bool {
 	return statusCode == 429 || statusCode >= 500
 }
 
+// Retry schedule shared by the provider clients
+const (
+	defaultMaxRetries = 10
+	retryBaseDelay    = 1 * time.Second
+	retryMaxDelay     = 128 * time.Second
+)
+
+// waitRetry sleeps before the given attempt using exponential backoff
+// (no wait for attempt 0). It returns early if the context is cancelled.
+func waitRetry(ctx context.Context, attempt int) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if attempt == 0 {
+		return nil
+	}
+	delay := retryBaseDelay * time.Duration(1<<(attempt-1))
+	if delay > retryMaxDelay {
+		delay = retryMaxDelay
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(delay):
+		return nil
+	}
+}
+
 // isPermanent500Error checks if a 500 error is permanent and should not be retried
 // These are typically validation errors from chat templates, not transient server issues
 func isPermanent500Error(respBody []byte) bool {
@@ -61,38 +101,38 @@ func isPermanent500Error(respBody []byte) bool {
 }
 
 func (c *Client) Chat(ctx context.Context, req ChatRequest) (*ChatResponse, error) {
+	req.Stream = false
+	req.StreamOptions = nil
+	return c.send(ctx, req, nil)
+}
+
+// ChatStream sends a streaming chat completion request. Content and reasoning
+// deltas are passed to onDelta as they arrive; the assembled response (including
+// tool calls rebuilt from their argument deltas) is returned once the stream ends.
+func (c *Client) ChatStream(ctx context.Context, req ChatRequest, onDelta StreamHandler) (*ChatResponse, error) {
+	req.Stream = true
+	req.StreamOptions = &StreamOptions{IncludeUsage: true}
+	return c.send(ctx, req, onDelta)
+}
+
+// send performs a chat completion request with retries. When req.Stream is set,
+// the response body is parsed as server-sent events and deltas go to onDelta.
+func (c *Client) send(ctx context.Context, req ChatRequest, onDelta StreamHandler) (*ChatResponse, error) {
 	// Prepare request body
 	body, err := json.Marshal(req)
 	if err != nil {
 		return nil, fmt.Errorf("marshal request: %w", err)
 	}
 
-	// Retry configuration
-	const maxRetries = 10
-	baseDelay := 1 * time.Second
-	maxDelay := 128 * time.Second
-
+	maxRetries := c.maxRetries
 	var lastErr error
 	var lastStatusCode int
 	var lastRespBody []byte
 
 	for attempt := 0; attempt <= maxRetries; attempt++ {
-		// Check context before attempting
-		if ctx.Err() != nil {
-			return nil, ctx.Err()
-		}
-
 		// Wait before retry (exponential backoff)
-		if attempt > 0 {
-			delay := baseDelay * time.Duration(1<<(attempt-1)) // 1s, 2s, 4s, 8s, 16s
-			if delay > maxDelay {
-				delay = maxDelay
-			}
-			select {
-			case <-ctx.Done():
-				return nil, ctx.Err()
-			case <-time.After(delay):
-			}
+		if err := waitRetry(ctx, attempt); err != nil {
+			return nil, err
 		}
 
 		// Create HTTP request (must create new one each attempt)
@@ -108,6 +148,9 @@ func (c *Client) Chat(ctx context.Context, req ChatRequest) (*ChatResponse, erro
 
 		// Set headers
 		httpReq.Header.Set("Content-Type", "application/json")
+		if req.Stream {
+			httpReq.Header.Set("Accept", "text/event-stream")
+		}
 		if c.apiKey != "" {
 			httpReq.Header.Set("Authorization", "Bearer "+c.apiKey)
 		}
@@ -123,6 +166,22 @@ func (c *Client) Chat(ctx context.Context, req ChatRequest) (*ChatResponse, erro
 			return nil, lastErr
 		}
 
+		// Streaming responses are parsed incrementally once the status is known to be OK
+		if req.Stream && resp.StatusCode == http.StatusOK {
+			chatResp, received, streamErr := readStream(resp.Body, onDelta)
+			resp.Body.Close()
+			if streamErr == nil {
+				return chatResp, nil
+			}
+			lastErr = streamErr
+			lastStatusCode = resp.StatusCode
+			// Nothing was delivered yet, so the whole request can be retried safely
+			if !received && ctx.Err() == nil && attempt < maxRetries {
+				continue // retry
+			}
+			return nil, lastErr
+		}
+
 		// Read response body (do this once for all paths)
 		respBody, readErr := io.ReadAll(resp.Body)
 		resp.Body.Close()
@@ -150,7 +209,7 @@ func (c *Client) Chat(ctx context.Context, req ChatRequest) (*ChatResponse, erro
 
 		// Check status code - retry on retryable errors
 		if resp.StatusCode != http.StatusOK {
-			lastErr = fmt.Errorf("API error %d: %s", resp.StatusCode, respBody)
+			lastErr = &APIError{StatusCode: resp.StatusCode, Body: respBody}
 			// Don't retry on permanent 500 errors (validation, template errors)
 			if resp.StatusCode == 500 && isPermanent500Error(respBody) {
 				return nil, lastErr
@@ -0,0 +1,334 @@
+// Package fake provides an in-process OpenAI-compatible chat completions server
+// driven by a script of responses, for end-to-end tests without a live model.
+package fake
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+
+	"github.com/kvit-s/kvit-coder/internal/llm"
+)
+
+// Step is one scripted reply. Build steps with the constructors below and
+// adjust them with the With* methods.
+type Step struct {
+	// Status and Body make the server answer with an HTTP error instead of a completion
+	Status int
+	Body   string
+
+	Message      llm.Message
+	FinishReason string
+	ChoiceError  *llm.ChoiceError // upstream provider error inside the choice
+	NoChoices    bool             // answer with an empty choices array
+
+	// Truncate drops the closing brace of the JSON body while still declaring
+	// its full Content-Length, like the llama.cpp Content-Length bug
+	Truncate bool
+
+	PromptTokens     int
+	CompletionTokens int
+
+	// Stats is served from /generation for this step's response ID (404 if nil)
+	Stats *llm.GenerationStats
+}
+
+// Text replies with a final answer
+func Text(content string) Step {
+	return Step{Message: llm.Message{Role: llm.RoleAssistant, Content: content}, FinishReason: "stop"}
+}
+
+// Reasoning replies with reasoning only and empty content
+func Reasoning(reasoning string) Step {
+	return Step{Message: llm.Message{Role: llm.RoleAssistant, ReasoningContent: reasoning}, FinishReason: "stop"}
+}
+
+// ToolCall replies with a single tool call
+func ToolCall(name, arguments string) Step {
+	return Step{}.WithToolCall(name, arguments)
+}
+
+// Error replies with an HTTP error status and body
+func Error(status int, body string) Step {
+	return Step{Status: status, Body: body}
+}
+
+// Permanent500 replies with a 500 whose body is a chat template validation
+// error, which the client treats as permanent and does not retry
+func Permanent500() Step {
+	return Error(http.StatusInternalServerError, `{"error":{"code":500,"message":"Conversation roles must alternate user/assistant/user/assistant/... raise_exception"}}`)
+}
+
+// ChoiceError replies with an upstream provider error inside the choice
+func ChoiceError(code int, message string) Step {
+	return Step{ChoiceError: &llm.ChoiceError{Code: code, Message: message}}
+}
+
+// WithToolCall adds a tool call to the reply
+func (s Step) WithToolCall(name, arguments string) Step {
+	s.Message.Role = llm.RoleAssistant
+	tc := llm.ToolCall{Type: "function"}
+	tc.Function.Name = name
+	tc.Function.Arguments = arguments
+	s.Message.ToolCalls = append(append([]llm.ToolCall(nil), s.Message.ToolCalls...), tc)
+	s.FinishReason = "tool_calls"
+	return s
+}
+
+// WithReasoning sets the reply's reasoning content
+func (s Step) WithReasoning(reasoning string) Step {
+	s.Message.ReasoningContent = reasoning
+	return s
+}
+
+// WithFinishReason overrides the finish reason
+func (s Step) WithFinishReason(reason string) Step {
+	s.FinishReason = reason
+	return s
+}
+
+// WithUsage sets the token usage of the reply
+func (s Step) WithUsage(prompt, completion int) Step {
+	s.PromptTokens = prompt
+	s.CompletionTokens = completion
+	return s
+}
+
+// WithStats makes /generation return stats for this reply
+func (s Step) WithStats(stats llm.GenerationStats) Step {
+	s.Stats = &stats
+	return s
+}
+
+// Truncated makes the body arrive one byte short of its Content-Length
+func (s Step) Truncated() Step {
+	s.Truncate = true
+	return s
+}
+
+// Server is a scripted OpenAI-compatible server. Each chat completion request
+// consumes the next step; requests beyond the script get a 404 and are
+// reported by Exhausted.
+type Server struct {
+	URL string // base URL to pass to llm.NewClient
+
+	srv *httptest.Server
+
+	mu        sync.Mutex
+	steps     []Step
+	requests  []llm.ChatRequest
+	stats     map[string]*llm.GenerationStats
+	exhausted int
+}
+
+// NewServer starts a server that replies with steps in order
+func NewServer(steps ...Step) *Server {
+	s := &Server{steps: steps, stats: make(map[string]*llm.GenerationStats)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/chat/completions", s.handleChat)
+	mux.HandleFunc("/generation", s.handleGeneration)
+	s.srv = httptest.NewServer(mux)
+	s.URL = s.srv.URL
+	return s
+}
+
+// Close shuts the server down
+func (s *Server) Close() {
+	s.srv.Close()
+}
+
+// Push appends steps to the script
+func (s *Server) Push(steps ...Step) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.steps = append(s.steps, steps...)
+}
+
+// Requests returns the chat requests received so far
+func (s *Server) Requests() []llm.ChatRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]llm.ChatRequest(nil), s.requests...)
+}
+
+// Remaining returns the number of steps not yet served
+func (s *Server) Remaining() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.steps)
+}
+
+// Exhausted returns how many requests arrived after the script ran out
+func (s *Server) Exhausted() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.exhausted
+}
+
+func (s *Server) handleChat(w http.ResponseWriter, r *http.Request) {
+	var req llm.ChatRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"bad request: %v"}`, err), http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	s.requests = append(s.requests, req)
+	n := len(s.requests)
+	if len(s.steps) == 0 {
+		s.exhausted++
+		s.mu.Unlock()
+		// 404 is not retried by the client, so an over-long run fails fast
+		http.Error(w, `{"error":"fake: script exhausted"}`, http.StatusNotFound)
+		return
+	}
+	step := s.steps[0]
+	s.steps = s.steps[1:]
+	id := fmt.Sprintf("fake-%d", n)
+	if step.Stats != nil {
+		stats := *step.Stats
+		stats.Data.ID = id
+		s.stats[id] = &stats
+	}
+	s.mu.Unlock()
+
+	if step.Status != 0 && step.Status != http.StatusOK {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(step.Status)
+		_, _ = w.Write([]byte(step.Body))
+		return
+	}
+
+	resp := step.response(id, req.Model)
+	if req.Stream && !step.Truncate {
+		writeStream(w, resp)
+		return
+	}
+
+	body, _ := json.Marshal(resp)
+	if step.Truncate {
+		writeTruncated(w, body)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(body)
+}
+
+func (s *Server) handleGeneration(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	stats, ok := s.stats[r.URL.Query().Get("id")]
+	s.mu.Unlock()
+	if !ok {
+		http.Error(w, `{"error":"generation not found"}`, http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(stats)
+}
+
+// response builds the completion for a step
+func (s Step) response(id, model string) *llm.ChatResponse {
+	resp := &llm.ChatResponse{ID: id, Model: model}
+	if s.NoChoices {
+		resp.Choices = resp.Choices[:0]
+		return resp
+	}
+
+	msg := s.Message
+	msg.Role = llm.RoleAssistant
+	msg.ToolCalls = nil
+	for i, tc := range s.Message.ToolCalls {
+		if tc.ID == "" {
+			tc.ID = fmt.Sprintf("call_%s_%d", strings.ReplaceAll(id, "-", ""), i)
+		}
+		msg.ToolCalls = append(msg.ToolCalls, tc)
+	}
+
+	resp.Choices = append(resp.Choices, struct {
+		Index        int              `json:"index"`
+		Message      llm.Message      `json:"message"`
+		FinishReason string           `json:"finish_reason"`
+		Error        *llm.ChoiceError `json:"error,omitempty"`
+	}{
+		Message:      msg,
+		FinishReason: s.FinishReason,
+		Error:        s.ChoiceError,
+	})
+	resp.Usage.PromptTokens = s.PromptTokens
+	resp.Usage.CompletionTokens = s.CompletionTokens
+	resp.Usage.TotalTokens = s.PromptTokens + s.CompletionTokens
+	return resp
+}
+
+// writeStream sends a completion as server-sent events: reasoning, content,
+// each tool call, then a usage chunk and [DONE]
+func writeStream(w http.ResponseWriter, resp *llm.ChatResponse) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	send := func(v any) {
+		data, _ := json.Marshal(v)
+		fmt.Fprintf(w, "data: %s\n\n", data)
+		if f, ok := w.(http.Flusher); ok {
+			f.Flush()
+		}
+	}
+	chunk := func(delta map[string]any, finish any) map[string]any {
+		return map[string]any{
+			"id":      resp.ID,
+			"model":   resp.Model,
+			"choices": []any{map[string]any{"index": 0, "delta": delta, "finish_reason": finish}},
+		}
+	}
+
+	if len(resp.Choices) > 0 {
+		choice := resp.Choices[0]
+		if choice.Error != nil {
+			c := chunk(map[string]any{}, nil)
+			c["choices"].([]any)[0].(map[string]any)["error"] = choice.Error
+			send(c)
+		}
+		msg := choice.Message
+		if msg.ReasoningContent != "" {
+			send(chunk(map[string]any{"role": "assistant", "reasoning_content": msg.ReasoningContent}, nil))
+		}
+		if msg.Content != "" {
+			send(chunk(map[string]any{"role": "assistant", "content": msg.Content}, nil))
+		}
+		for i, tc := range msg.ToolCalls {
+			send(chunk(map[string]any{"tool_calls": []any{map[string]any{
+				"index":    i,
+				"id":       tc.ID,
+				"type":     "function",
+				"function": map[string]any{"name": tc.Function.Name, "arguments": tc.Function.Arguments},
+			}}}, nil))
+		}
+		send(chunk(map[string]any{}, choice.FinishReason))
+	}
+	send(map[string]any{"id": resp.ID, "choices": []any{}, "usage": resp.Usage})
+	fmt.Fprint(w, "data: [DONE]\n\n")
+}
+
+// writeTruncated writes body without its last byte but with the full
+// Content-Length, then closes the connection so the client sees an unexpected EOF
+func writeTruncated(w http.ResponseWriter, body []byte) {
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		_, _ = w.Write(body[:len(body)-1])
+		return
+	}
+	conn, buf, err := hj.Hijack()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	writeRaw(buf, body)
+}
+
+func writeRaw(buf *bufio.ReadWriter, body []byte) {
+	fmt.Fprintf(buf, "HTTP/1.1 200 OK\r\nContent-Type: application/json\r\nContent-Length: %d\r\nConnection: close\r\n\r\n", len(body))
+	_, _ = buf.Write(body[:len(body)-1])
+	_ = buf.Flush()
+}
@@ -0,0 +1,117 @@
+package fake
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/kvit-s/kvit-coder/internal/llm"
+)
+
+func userReq(content string) llm.ChatRequest {
+	return llm.ChatRequest{Model: "m", Messages: []llm.Message{{Role: llm.RoleUser, Content: content}}}
+}
+
+func TestServerScript(t *testing.T) {
+	stats := llm.GenerationStats{}
+	stats.Data.TotalCost = 0.25
+	srv := NewServer(
+		Text("hello").WithUsage(10, 2).WithStats(stats),
+		ToolCall("Read", `{"path":"a.go"}`),
+		ChoiceError(502, "upstream"),
+		Error(400, `{"error":"context length exceeded"}`),
+	)
+	defer srv.Close()
+	client := llm.NewClient(srv.URL, "")
+	ctx := context.Background()
+
+	resp, err := client.Chat(ctx, userReq("hi"))
+	if err != nil {
+		t.Fatalf("Chat() error = %v", err)
+	}
+	if resp.Choices[0].Message.Content != "hello" || resp.Usage.TotalTokens != 12 {
+		t.Errorf("response = %+v, want hello with 12 tokens", resp)
+	}
+	got, err := client.GetGenerationStats(ctx, resp.ID)
+	if err != nil || got.Data.TotalCost != 0.25 {
+		t.Errorf("GetGenerationStats() = %+v, %v, want cost 0.25", got, err)
+	}
+
+	resp, err = client.Chat(ctx, userReq("read"))
+	if err != nil {
+		t.Fatalf("Chat() error = %v", err)
+	}
+	calls := resp.Choices[0].Message.ToolCalls
+	if len(calls) != 1 || calls[0].Function.Name != "Read" || calls[0].ID == "" {
+		t.Errorf("ToolCalls = %+v, want one Read call with an ID", calls)
+	}
+	if resp.Choices[0].FinishReason != "tool_calls" {
+		t.Errorf("FinishReason = %q, want tool_calls", resp.Choices[0].FinishReason)
+	}
+
+	resp, _ = client.Chat(ctx, userReq("x"))
+	if resp.Choices[0].Error == nil || resp.Choices[0].Error.Code != 502 {
+		t.Errorf("choice error = %+v, want code 502", resp.Choices[0].Error)
+	}
+
+	_, err = client.Chat(ctx, userReq("x"))
+	var apiErr *llm.APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != 400 {
+		t.Errorf("Chat() error = %v, want API error 400", err)
+	}
+
+	if _, err := client.Chat(ctx, userReq("x")); err == nil {
+		t.Error("Chat() past the end of the script should fail")
+	}
+	if srv.Exhausted() != 1 || srv.Remaining() != 0 || len(srv.Requests()) != 5 {
+		t.Errorf("Exhausted() = %d, Remaining() = %d, Requests() = %d", srv.Exhausted(), srv.Remaining(), len(srv.Requests()))
+	}
+}
+
+func TestServerTruncatedBody(t *testing.T) {
+	srv := NewServer(Text("recovered").Truncated())
+	defer srv.Close()
+
+	resp, err := llm.NewClient(srv.URL, "").Chat(context.Background(), userReq("hi"))
+	if err != nil {
+		t.Fatalf("Chat() error = %v, want the client to repair the body", err)
+	}
+	if resp.Choices[0].Message.Content != "recovered" {
+		t.Errorf("Content = %q, want recovered", resp.Choices[0].Message.Content)
+	}
+}
+
+func TestServerPermanent500(t *testing.T) {
+	srv := NewServer(Permanent500())
+	defer srv.Close()
+
+	_, err := llm.NewClient(srv.URL, "").Chat(context.Background(), userReq("hi"))
+	if err == nil || !strings.Contains(err.Error(), "API error 500") {
+		t.Errorf("Chat() error = %v, want API error 500", err)
+	}
+	if len(srv.Requests()) != 1 {
+		t.Errorf("requests = %d, want 1 (no retries)", len(srv.Requests()))
+	}
+}
+
+func TestServerStream(t *testing.T) {
+	srv := NewServer(Text("streamed").WithReasoning("think").WithToolCall("Read", `{}`))
+	defer srv.Close()
+
+	var content, reasoning strings.Builder
+	resp, err := llm.NewClient(srv.URL, "").ChatStream(context.Background(), userReq("hi"), func(d llm.StreamDelta) {
+		content.WriteString(d.Content)
+		reasoning.WriteString(d.ReasoningContent)
+	})
+	if err != nil {
+		t.Fatalf("ChatStream() error = %v", err)
+	}
+	if content.String() != "streamed" || reasoning.String() != "think" {
+		t.Errorf("deltas = %q / %q", content.String(), reasoning.String())
+	}
+	msg := resp.Choices[0].Message
+	if msg.Content != "streamed" || len(msg.ToolCalls) != 1 || msg.ToolCalls[0].Function.Name != "Read" {
+		t.Errorf("assembled message = %+v", msg)
+	}
+}
@@ -0,0 +1,334 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultOllamaBaseURL is used when no base URL is configured for the Ollama provider
+const DefaultOllamaBaseURL = "http://localhost:11434"
+
+// OllamaClient talks to Ollama's native /api/chat endpoint.
+// Unlike Ollama's OpenAI compatibility layer, the native protocol keeps tool
+// calls intact for every model and reports prompt/eval counts and durations,
+// which are kept per response so GetGenerationStats can return them.
+type OllamaClient struct {
+	baseURL    string
+	numCtx     int
+	keepAlive  string
+	client     *http.Client
+	maxRetries int
+
+	mu     sync.Mutex
+	nextID int
+	stats  map[string]*GenerationStats // response ID -> stats, removed once read
+}
+
+// NewOllamaClient creates a client for Ollama's native API.
+// numCtx sets the context window (0 = model default); keepAlive controls how
+// long the model stays loaded after a request (e.g. "10m", "-1"; "" = server default).
+func NewOllamaClient(baseURL string, numCtx int, keepAlive string) *OllamaClient {
+	if baseURL == "" {
+		baseURL = DefaultOllamaBaseURL
+	}
+	return &OllamaClient{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		numCtx:     numCtx,
+		keepAlive:  keepAlive,
+		client:     &http.Client{},
+		maxRetries: defaultMaxRetries,
+		stats:      make(map[string]*GenerationStats),
+	}
+}
+
+// ollamaRequest is the body of a POST /api/chat call
+type ollamaRequest struct {
+	Model     string          `json:"model"`
+	Messages  []ollamaMessage `json:"messages"`
+	Tools     []ToolSpec      `json:"tools,omitempty"`
+	Stream    bool            `json:"stream"`
+	Options   *ollamaOptions  `json:"options,omitempty"`
+	KeepAlive string          `json:"keep_alive,omitempty"`
+}
+
+type ollamaOptions struct {
+	NumCtx      int     `json:"num_ctx,omitempty"`
+	NumPredict  int     `json:"num_predict,omitempty"`
+	Temperature float32 `json:"temperature,omitempty"`
+}
+
+type ollamaMessage struct {
+	Role      MessageRole      `json:"role"`
+	Content   string           `json:"content"`
+	Thinking  string           `json:"thinking,omitempty"`
+	ToolCalls []ollamaToolCall `json:"tool_calls,omitempty"`
+	ToolName  string           `json:"tool_name,omitempty"` // for tool role messages
+}
+
+// ollamaToolCall carries arguments as a JSON object rather than a string
+type ollamaToolCall struct {
+	Function struct {
+		Name      string          `json:"name"`
+		Arguments json.RawMessage `json:"arguments"`
+	} `json:"function"`
+}
+
+// ollamaResponse is a /api/chat response, or one line of a streamed response.
+// Counts and durations (nanoseconds) are only set on the final (done) message.
+type ollamaResponse struct {
+	Model              string        `json:"model"`
+	CreatedAt          string        `json:"created_at"`
+	Message            ollamaMessage `json:"message"`
+	Done               bool          `json:"done"`
+	DoneReason         string        `json:"done_reason"`
+	PromptEvalCount    int           `json:"prompt_eval_count"`
+	PromptEvalDuration int64         `json:"prompt_eval_duration"`
+	EvalCount          int           `json:"eval_count"`
+	EvalDuration       int64         `json:"eval_duration"`
+	Error              string        `json:"error"`
+}
+
+func (c *OllamaClient) Chat(ctx context.Context, req ChatRequest) (*ChatResponse, error) {
+	return c.send(ctx, c.buildRequest(req, false), nil)
+}
+
+// ChatStream sends a streaming /api/chat request. Ollama streams newline-delimited
+// JSON objects; content and thinking are passed to onDelta as they arrive.
+func (c *OllamaClient) ChatStream(ctx context.Context, req ChatRequest, onDelta StreamHandler) (*ChatResponse, error) {
+	return c.send(ctx, c.buildRequest(req, true), onDelta)
+}
+
+// GetGenerationStats returns the counts and timings recorded for a response returned by this client
+func (c *OllamaClient) GetGenerationStats(ctx context.Context, generationID string) (*GenerationStats, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats, ok := c.stats[generationID]
+	if !ok {
+		return nil, fmt.Errorf("no generation stats for %q", generationID)
+	}
+	delete(c.stats, generationID)
+	return stats, nil
+}
+
+// buildRequest translates an OpenAI-shaped request into an /api/chat request
+func (c *OllamaClient) buildRequest(req ChatRequest, stream bool) ollamaRequest {
+	oreq := ollamaRequest{
+		Model:     req.Model,
+		Tools:     req.Tools,
+		Stream:    stream,
+		KeepAlive: c.keepAlive,
+	}
+	if c.numCtx > 0 || req.MaxTokens > 0 || req.Temperature > 0 {
+		oreq.Options = &ollamaOptions{
+			NumCtx:      c.numCtx,
+			NumPredict:  req.MaxTokens,
+			Temperature: req.Temperature,
+		}
+	}
+
+	// Ollama identifies tool results by tool name, not call ID
+	toolNames := make(map[string]string)
+	for _, msg := range req.Messages {
+		om := ollamaMessage{Role: msg.Role, Content: msg.Content}
+		switch msg.Role {
+		case RoleAssistant:
+			for _, tc := range msg.ToolCalls {
+				toolNames[tc.ID] = tc.Function.Name
+				var otc ollamaToolCall
+				otc.Function.Name = tc.Function.Name
+				otc.Function.Arguments = toolInput(tc.Function.Arguments)
+				om.ToolCalls = append(om.ToolCalls, otc)
+			}
+		case RoleTool:
+			om.ToolName = toolNames[msg.ToolCallID]
+			if om.ToolName == "" {
+				om.ToolName = msg.Name
+			}
+		}
+		oreq.Messages = append(oreq.Messages, om)
+	}
+	return oreq
+}
+
+// send performs an /api/chat request with retries and converts the result
+func (c *OllamaClient) send(ctx context.Context, oreq ollamaRequest, onDelta StreamHandler) (*ChatResponse, error) {
+	body, err := json.Marshal(oreq)
+	if err != nil {
+		return nil, fmt.Errorf("marshal request: %w", err)
+	}
+
+	var lastErr error
+	for attempt := 0; attempt <= c.maxRetries; attempt++ {
+		if err := waitRetry(ctx, attempt); err != nil {
+			return nil, err
+		}
+
+		httpReq, err := http.NewRequestWithContext(ctx, "POST", c.baseURL+"/api/chat", bytes.NewReader(body))
+		if err != nil {
+			return nil, fmt.Errorf("create request: %w", err)
+		}
+		httpReq.Header.Set("Content-Type", "application/json")
+
+		resp, err := c.client.Do(httpReq)
+		if err != nil {
+			lastErr = fmt.Errorf("execute request: %w", err)
+			if attempt < c.maxRetries {
+				continue // retry
+			}
+			return nil, lastErr
+		}
+
+		if resp.StatusCode != http.StatusOK {
+			respBody, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			lastErr = &APIError{StatusCode: resp.StatusCode, Body: respBody}
+			if isRetryableError(resp.StatusCode, nil) && attempt < c.maxRetries {
+				continue // retry
+			}
+			return nil, lastErr
+		}
+
+		oresp, received, err := readOllamaResponse(resp.Body, onDelta)
+		resp.Body.Close()
+		if err != nil {
+			lastErr = err
+			// Nothing was delivered yet, so the whole request can be retried safely
+			if !received && ctx.Err() == nil && attempt < c.maxRetries {
+				continue // retry
+			}
+			return nil, lastErr
+		}
+
+		return c.toChatResponse(oresp), nil
+	}
+
+	return nil, fmt.Errorf("after %d retries: %w", c.maxRetries, lastErr)
+}
+
+// readOllamaResponse reads a single JSON response or a newline-delimited stream
+// of them, merging message fragments into one response. received reports whether
+// any content was delivered to onDelta.
+func readOllamaResponse(body io.Reader, onDelta StreamHandler) (oresp *ollamaResponse, received bool, err error) {
+	oresp = &ollamaResponse{}
+	var content, thinking strings.Builder
+
+	// A json.Decoder reads both a single (possibly indented) object and
+	// newline-delimited stream objects
+	dec := json.NewDecoder(body)
+	for {
+		var part ollamaResponse
+		if err := dec.Decode(&part); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, received, fmt.Errorf("decode response: %w", err)
+		}
+		if part.Error != "" {
+			return nil, received, fmt.Errorf("ollama error: %s", part.Error)
+		}
+
+		content.WriteString(part.Message.Content)
+		thinking.WriteString(part.Message.Thinking)
+		oresp.Message.ToolCalls = append(oresp.Message.ToolCalls, part.Message.ToolCalls...)
+		if part.Message.Content != "" || part.Message.Thinking != "" {
+			received = true
+			if onDelta != nil {
+				onDelta(StreamDelta{Content: part.Message.Content, ReasoningContent: part.Message.Thinking})
+			}
+		}
+
+		if part.Done {
+			oresp.Model = part.Model
+			oresp.CreatedAt = part.CreatedAt
+			oresp.Done = true
+			oresp.DoneReason = part.DoneReason
+			oresp.PromptEvalCount = part.PromptEvalCount
+			oresp.PromptEvalDuration = part.PromptEvalDuration
+			oresp.EvalCount = part.EvalCount
+			oresp.EvalDuration = part.EvalDuration
+			break
+		}
+	}
+	if !oresp.Done {
+		return nil, received, fmt.Errorf("response ended before done")
+	}
+
+	oresp.Message.Role = RoleAssistant
+	oresp.Message.Content = content.String()
+	oresp.Message.Thinking = thinking.String()
+	return oresp, received, nil
+}
+
+// toChatResponse converts an /api/chat response and records its stats.
+// Ollama has no response or tool call IDs, so they are generated here.
+func (c *OllamaClient) toChatResponse(oresp *ollamaResponse) *ChatResponse {
+	c.mu.Lock()
+	c.nextID++
+	id := fmt.Sprintf("ollama-%d-%d", time.Now().UnixNano(), c.nextID)
+	c.mu.Unlock()
+
+	msg := Message{
+		Role:             RoleAssistant,
+		Content:          oresp.Message.Content,
+		ReasoningContent: oresp.Message.Thinking,
+	}
+	for i, otc := range oresp.Message.ToolCalls {
+		args := string(otc.Function.Arguments)
+		if args == "" || args == "null" {
+			args = "{}"
+		}
+		tc := ToolCall{ID: fmt.Sprintf("call_%s_%d", id, i), Type: "function"}
+		tc.Function.Name = otc.Function.Name
+		tc.Function.Arguments = args
+		msg.ToolCalls = append(msg.ToolCalls, tc)
+	}
+
+	finishReason := "stop"
+	if len(msg.ToolCalls) > 0 {
+		finishReason = "tool_calls"
+	} else if oresp.DoneReason == "length" {
+		finishReason = "length"
+	}
+
+	resp := &ChatResponse{ID: id, Model: oresp.Model}
+	resp.Choices = append(resp.Choices, struct {
+		Index        int          `json:"index"`
+		Message      Message      `json:"message"`
+		FinishReason string       `json:"finish_reason"`
+		Error        *ChoiceError `json:"error,omitempty"`
+	}{
+		Index:        0,
+		Message:      msg,
+		FinishReason: finishReason,
+	})
+	resp.Usage.PromptTokens = oresp.PromptEvalCount
+	resp.Usage.CompletionTokens = oresp.EvalCount
+	resp.Usage.TotalTokens = oresp.PromptEvalCount + oresp.EvalCount
+
+	stats := &GenerationStats{}
+	stats.Data.ID = id
+	stats.Data.CreatedAt = oresp.CreatedAt
+	stats.Data.Model = oresp.Model
+	stats.Data.FinishReason = finishReason
+	stats.Data.ProviderName = "Ollama"
+	stats.Data.TokensPrompt = oresp.PromptEvalCount
+	stats.Data.TokensCompletion = oresp.EvalCount
+	stats.Data.NativeTokensPrompt = oresp.PromptEvalCount
+	stats.Data.NativeTokensCompletion = oresp.EvalCount
+	// Durations are reported in nanoseconds
+	stats.Data.Latency = float64(oresp.PromptEvalDuration) / float64(time.Millisecond)
+	stats.Data.GenerationTime = float64(oresp.EvalDuration) / float64(time.Millisecond)
+
+	c.mu.Lock()
+	c.stats[id] = stats
+	c.mu.Unlock()
+
+	return resp
+}
@@ -0,0 +1,153 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestOllamaChat(t *testing.T) {
+	var got ollamaRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/chat" {
+			t.Errorf("path = %q, want /api/chat", r.URL.Path)
+		}
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Fatalf("Failed to decode request: %v", err)
+		}
+		_, _ = w.Write([]byte(`{
+			"model": "qwen3",
+			"created_at": "2025-01-01T00:00:00Z",
+			"message": {
+				"role": "assistant",
+				"content": "",
+				"thinking": "Check the file.",
+				"tool_calls": [{"function": {"name": "Read", "arguments": {"path": "go.mod"}}}]
+			},
+			"done": true,
+			"done_reason": "stop",
+			"prompt_eval_count": 120,
+			"prompt_eval_duration": 250000000,
+			"eval_count": 30,
+			"eval_duration": 1500000000
+		}`))
+	}))
+	defer server.Close()
+
+	client := NewOllamaClient(server.URL, 32768, "10m")
+	resp, err := client.Chat(context.Background(), ChatRequest{
+		Model:     "qwen3",
+		MaxTokens: 1024,
+		Messages: []Message{
+			{Role: RoleSystem, Content: "sys"},
+			{Role: RoleUser, Content: "hi"},
+			{Role: RoleAssistant, ToolCalls: []ToolCall{toolCall("call_1", "Search", `{"pattern":"x"}`)}},
+			{Role: RoleTool, ToolCallID: "call_1", Content: "no matches"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Chat() error = %v", err)
+	}
+
+	// Request mapping
+	if got.Stream {
+		t.Error("Request.Stream = true, want false")
+	}
+	if got.Options == nil || got.Options.NumCtx != 32768 || got.Options.NumPredict != 1024 {
+		t.Errorf("Options = %+v, want num_ctx 32768, num_predict 1024", got.Options)
+	}
+	if got.KeepAlive != "10m" {
+		t.Errorf("KeepAlive = %q, want 10m", got.KeepAlive)
+	}
+	if len(got.Messages) != 4 {
+		t.Fatalf("len(Messages) = %d, want 4", len(got.Messages))
+	}
+	if args := string(got.Messages[2].ToolCalls[0].Function.Arguments); args != `{"pattern":"x"}` {
+		t.Errorf("tool call arguments = %s, want JSON object", args)
+	}
+	if got.Messages[3].ToolName != "Search" {
+		t.Errorf("tool message ToolName = %q, want Search", got.Messages[3].ToolName)
+	}
+
+	// Response mapping
+	choice := resp.Choices[0]
+	if choice.FinishReason != "tool_calls" {
+		t.Errorf("FinishReason = %q, want tool_calls", choice.FinishReason)
+	}
+	if choice.Message.ReasoningContent != "Check the file." {
+		t.Errorf("ReasoningContent = %q", choice.Message.ReasoningContent)
+	}
+	calls := choice.Message.ToolCalls
+	if len(calls) != 1 || calls[0].ID == "" || calls[0].Function.Name != "Read" || calls[0].Function.Arguments != `{"path": "go.mod"}` {
+		t.Errorf("ToolCalls = %+v, want Read with generated ID", calls)
+	}
+	if resp.Usage.PromptTokens != 120 || resp.Usage.CompletionTokens != 30 {
+		t.Errorf("Usage = %+v, want 120/30", resp.Usage)
+	}
+
+	stats, err := client.GetGenerationStats(context.Background(), resp.ID)
+	if err != nil {
+		t.Fatalf("GetGenerationStats() error = %v", err)
+	}
+	if stats.Data.Latency != 250 || stats.Data.GenerationTime != 1500 {
+		t.Errorf("Latency = %v, GenerationTime = %v, want 250ms and 1500ms", stats.Data.Latency, stats.Data.GenerationTime)
+	}
+	if stats.Data.NativeTokensPrompt != 120 || stats.Data.NativeTokensCompletion != 30 {
+		t.Errorf("native tokens = %d/%d, want 120/30", stats.Data.NativeTokensPrompt, stats.Data.NativeTokensCompletion)
+	}
+}
+
+func TestOllamaChatStream(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req ollamaRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		if !req.Stream {
+			t.Error("Request.Stream = false, want true")
+		}
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		for _, line := range []string{
+			`{"model":"llama3","message":{"role":"assistant","content":"Hel"},"done":false}`,
+			`{"model":"llama3","message":{"role":"assistant","content":"lo"},"done":false}`,
+			`{"model":"llama3","message":{"role":"assistant","content":""},"done":true,"done_reason":"length","prompt_eval_count":9,"eval_count":2,"eval_duration":4000000}`,
+		} {
+			_, _ = w.Write([]byte(line + "\n"))
+		}
+	}))
+	defer server.Close()
+
+	client := NewOllamaClient(server.URL, 0, "")
+	var streamed strings.Builder
+	resp, err := client.ChatStream(context.Background(), ChatRequest{Model: "llama3"}, func(d StreamDelta) {
+		streamed.WriteString(d.Content)
+	})
+	if err != nil {
+		t.Fatalf("ChatStream() error = %v", err)
+	}
+	if streamed.String() != "Hello" || resp.Choices[0].Message.Content != "Hello" {
+		t.Errorf("streamed = %q, content = %q, want Hello", streamed.String(), resp.Choices[0].Message.Content)
+	}
+	if resp.Choices[0].FinishReason != "length" {
+		t.Errorf("FinishReason = %q, want length", resp.Choices[0].FinishReason)
+	}
+	stats, err := client.GetGenerationStats(context.Background(), resp.ID)
+	if err != nil || stats.Data.GenerationTime != 4 {
+		t.Errorf("GetGenerationStats() = %+v, %v, want 4ms generation", stats, err)
+	}
+}
+
+func TestOllamaError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`{"error":"model \"nope\" not found, try pulling it first"}`))
+	}))
+	defer server.Close()
+
+	client := NewOllamaClient(server.URL, 0, "")
+	_, err := client.Chat(context.Background(), ChatRequest{Model: "nope"})
+	if err == nil || !strings.Contains(err.Error(), "API error 404") {
+		t.Errorf("Chat() error = %v, want API error 404", err)
+	}
+}
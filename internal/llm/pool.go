@@ -0,0 +1,268 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Endpoint selection strategies for a Pool
+const (
+	StrategyRoundRobin   = "round_robin"
+	StrategyLeastLatency = "least_latency"
+)
+
+// PoolEndpoint is one backend of a Pool
+type PoolEndpoint struct {
+	Name     string // shown in errors, usually the base URL
+	Provider Provider
+	Weight   int    // relative share of requests for round-robin (0 = 1)
+	Model    string // overrides the request model when set
+}
+
+// PoolOptions configures endpoint selection and health tracking
+type PoolOptions struct {
+	Strategy         string        // StrategyRoundRobin (default) or StrategyLeastLatency
+	FailureThreshold int           // consecutive failures that open an endpoint's circuit (default 3)
+	Cooldown         time.Duration // how long an open circuit keeps the endpoint out of rotation (default 30s)
+	MaxRounds        int           // passes over all endpoints before giving up (default 3)
+}
+
+// Pool spreads requests over several endpoints and fails over between them.
+// Connection errors, 5xx and 429 responses move the request to the next
+// endpoint immediately; an endpoint that keeps failing has its circuit opened
+// and is skipped until the cooldown expires, after which one request is let
+// through to probe it. Only when every endpoint has failed does the pool back
+// off and try another round.
+type Pool struct {
+	endpoints []*poolEndpoint
+	opts      PoolOptions
+	now       func() time.Time
+
+	mu      sync.Mutex
+	current []int                    // smooth weighted round-robin state, per endpoint
+	owners  recentMap[*poolEndpoint] // response ID -> endpoint that produced it, removed once asked
+}
+
+// poolMaxOwners bounds the response owners a pool remembers for
+// GetGenerationStats; responses whose stats are never asked for age out
+const poolMaxOwners = 256
+
+// poolEndpoint is a PoolEndpoint plus its health state (guarded by Pool.mu)
+type poolEndpoint struct {
+	PoolEndpoint
+	failures  int           // consecutive failures
+	openUntil time.Time     // circuit is open until this time
+	latency   time.Duration // moving average of successful request durations (0 = unmeasured)
+}
+
+// NewPool creates a pool over the given endpoints
+func NewPool(endpoints []PoolEndpoint, opts PoolOptions) (*Pool, error) {
+	if len(endpoints) == 0 {
+		return nil, fmt.Errorf("endpoint pool needs at least one endpoint")
+	}
+	switch opts.Strategy {
+	case "":
+		opts.Strategy = StrategyRoundRobin
+	case StrategyRoundRobin, StrategyLeastLatency:
+	default:
+		return nil, fmt.Errorf("unknown endpoint strategy %q (expected %q or %q)", opts.Strategy, StrategyRoundRobin, StrategyLeastLatency)
+	}
+	if opts.FailureThreshold <= 0 {
+		opts.FailureThreshold = 3
+	}
+	if opts.Cooldown <= 0 {
+		opts.Cooldown = 30 * time.Second
+	}
+	if opts.MaxRounds <= 0 {
+		opts.MaxRounds = 3
+	}
+
+	p := &Pool{
+		opts:    opts,
+		now:     time.Now,
+		current: make([]int, len(endpoints)),
+		owners:  newRecentMap[*poolEndpoint](poolMaxOwners),
+	}
+	for _, ep := range endpoints {
+		if ep.Weight <= 0 {
+			ep.Weight = 1
+		}
+		p.endpoints = append(p.endpoints, &poolEndpoint{PoolEndpoint: ep})
+	}
+	return p, nil
+}
+
+func (p *Pool) Chat(ctx context.Context, req ChatRequest) (*ChatResponse, error) {
+	return p.do(ctx, req, func(ep *poolEndpoint, req ChatRequest) (*ChatResponse, bool, error) {
+		resp, err := ep.Provider.Chat(ctx, req)
+		return resp, false, err
+	})
+}
+
+// ChatStream streams from the selected endpoint. Once any delta has been
+// delivered the request can't be moved to another endpoint without repeating
+// output, so errors after that point are returned as is.
+func (p *Pool) ChatStream(ctx context.Context, req ChatRequest, onDelta StreamHandler) (*ChatResponse, error) {
+	return p.do(ctx, req, func(ep *poolEndpoint, req ChatRequest) (*ChatResponse, bool, error) {
+		delivered := false
+		resp, err := ep.Provider.ChatStream(ctx, req, func(delta StreamDelta) {
+			delivered = true
+			if onDelta != nil {
+				onDelta(delta)
+			}
+		})
+		return resp, delivered, err
+	})
+}
+
+// GetGenerationStats asks the endpoint that produced the response
+func (p *Pool) GetGenerationStats(ctx context.Context, generationID string) (*GenerationStats, error) {
+	p.mu.Lock()
+	ep, ok := p.owners.get(generationID)
+	p.owners.delete(generationID)
+	p.mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("no endpoint recorded for generation %q", generationID)
+	}
+	return ep.Provider.GetGenerationStats(ctx, generationID)
+}
+
+// do runs call against endpoints in selection order until one succeeds.
+// call reports whether output was already delivered, which rules out failover.
+func (p *Pool) do(ctx context.Context, req ChatRequest, call func(*poolEndpoint, ChatRequest) (*ChatResponse, bool, error)) (*ChatResponse, error) {
+	var errs []error
+	for round := 0; round < p.opts.MaxRounds; round++ {
+		if err := waitRetry(ctx, round); err != nil {
+			return nil, err
+		}
+
+		for _, ep := range p.order() {
+			epReq := req
+			if ep.Model != "" {
+				epReq.Model = ep.Model
+			}
+
+			start := p.now()
+			resp, delivered, err := call(ep, epReq)
+			if err == nil {
+				p.recordSuccess(ep, p.now().Sub(start), resp.ID)
+				return resp, nil
+			}
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			if !isFailoverError(ctx, err) {
+				// The endpoint is up; the request itself was rejected
+				p.recordSuccess(ep, 0, "")
+				return nil, err
+			}
+			p.recordFailure(ep)
+			if delivered {
+				return nil, fmt.Errorf("%s: %w", ep.Name, err)
+			}
+			errs = append(errs, fmt.Errorf("%s: %w", ep.Name, err))
+		}
+	}
+	return nil, fmt.Errorf("all endpoints failed after %d rounds: %w", p.opts.MaxRounds, errors.Join(errs...))
+}
+
+// isFailoverError reports whether an error means the endpoint, rather than
+// the request, is at fault: transport errors (connection failures, timeouts,
+// cut-off bodies), 429 and 5xx. Nothing fails over once ctx is done, and
+// responses that can't be decoded are returned as they are.
+func isFailoverError(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		if apiErr.StatusCode == 500 && isPermanent500Error(apiErr.Body) {
+			return false
+		}
+		return isRetryableError(apiErr.StatusCode, nil)
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// order returns the endpoints to try for the next request: healthy endpoints
+// by strategy, then endpoints with an open circuit (soonest to close first)
+// as a last resort
+func (p *Pool) order() []*poolEndpoint {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := p.now()
+	var healthy, open []*poolEndpoint
+	var healthyIdx []int
+	for i, ep := range p.endpoints {
+		if now.Before(ep.openUntil) {
+			open = append(open, ep)
+		} else {
+			healthy = append(healthy, ep)
+			healthyIdx = append(healthyIdx, i)
+		}
+	}
+
+	switch p.opts.Strategy {
+	case StrategyLeastLatency:
+		// Unmeasured endpoints sort first so they get measured
+		sort.SliceStable(healthy, func(i, j int) bool {
+			return healthy[i].latency < healthy[j].latency
+		})
+	default:
+		if len(healthy) > 1 {
+			// Smooth weighted round-robin: the endpoint with the highest
+			// running weight goes first; the others follow as failover
+			total, best := 0, 0
+			for k, i := range healthyIdx {
+				p.current[i] += healthy[k].Weight
+				total += healthy[k].Weight
+				if p.current[i] > p.current[healthyIdx[best]] {
+					best = k
+				}
+			}
+			p.current[healthyIdx[best]] -= total
+			rotated := append([]*poolEndpoint{}, healthy[best:]...)
+			healthy = append(rotated, healthy[:best]...)
+		}
+	}
+
+	sort.SliceStable(open, func(i, j int) bool {
+		return open[i].openUntil.Before(open[j].openUntil)
+	})
+	return append(healthy, open...)
+}
+
+func (p *Pool) recordSuccess(ep *poolEndpoint, latency time.Duration, responseID string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	ep.failures = 0
+	ep.openUntil = time.Time{}
+	if latency > 0 {
+		if ep.latency == 0 {
+			ep.latency = latency
+		} else {
+			ep.latency = (ep.latency*7 + latency) / 8
+		}
+	}
+	if responseID != "" {
+		p.owners.put(responseID, ep)
+	}
+}
+
+func (p *Pool) recordFailure(ep *poolEndpoint) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	ep.failures++
+	// A failed probe after the cooldown reopens the circuit right away
+	if ep.failures >= p.opts.FailureThreshold {
+		ep.openUntil = p.now().Add(p.opts.Cooldown)
+	}
+}
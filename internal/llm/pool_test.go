@@ -0,0 +1,222 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// stubProvider answers with a fixed error or a response naming itself
+type stubProvider struct {
+	name   string
+	err    error
+	calls  int
+	models []string
+}
+
+func (s *stubProvider) Chat(ctx context.Context, req ChatRequest) (*ChatResponse, error) {
+	s.calls++
+	s.models = append(s.models, req.Model)
+	if s.err != nil {
+		return nil, s.err
+	}
+	return &ChatResponse{ID: s.name}, nil
+}
+
+func (s *stubProvider) ChatStream(ctx context.Context, req ChatRequest, onDelta StreamHandler) (*ChatResponse, error) {
+	return s.Chat(ctx, req)
+}
+
+func (s *stubProvider) GetGenerationStats(ctx context.Context, generationID string) (*GenerationStats, error) {
+	stats := &GenerationStats{}
+	stats.Data.ProviderName = s.name
+	return stats, nil
+}
+
+func TestPoolWeightedRoundRobin(t *testing.T) {
+	a := &stubProvider{name: "a"}
+	b := &stubProvider{name: "b"}
+	pool, err := NewPool([]PoolEndpoint{
+		{Name: "a", Provider: a, Weight: 2},
+		{Name: "b", Provider: b, Weight: 1, Model: "override"},
+	}, PoolOptions{})
+	if err != nil {
+		t.Fatalf("NewPool() error = %v", err)
+	}
+
+	var order []string
+	for i := 0; i < 6; i++ {
+		resp, err := pool.Chat(context.Background(), ChatRequest{Model: "m"})
+		if err != nil {
+			t.Fatalf("Chat() error = %v", err)
+		}
+		order = append(order, resp.ID)
+	}
+	if got := strings.Join(order, ""); got != "abaaba" {
+		t.Errorf("selection order = %q, want abaaba", got)
+	}
+	for _, m := range b.models {
+		if m != "override" {
+			t.Errorf("endpoint b got model %q, want override", m)
+		}
+	}
+
+	stats, err := pool.GetGenerationStats(context.Background(), "b")
+	if err != nil || stats.Data.ProviderName != "b" {
+		t.Errorf("GetGenerationStats() = %+v, %v, want stats from b", stats, err)
+	}
+}
+
+func TestPoolFailoverAndCircuitBreaker(t *testing.T) {
+	refused := &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}
+	dead := &stubProvider{name: "dead", err: fmt.Errorf("execute request: %w", refused)}
+	live := &stubProvider{name: "live"}
+	pool, _ := NewPool([]PoolEndpoint{
+		{Name: "dead", Provider: dead},
+		{Name: "live", Provider: live},
+	}, PoolOptions{FailureThreshold: 2, Cooldown: time.Minute})
+
+	now := time.Now()
+	pool.now = func() time.Time { return now }
+
+	for i := 0; i < 6; i++ {
+		resp, err := pool.Chat(context.Background(), ChatRequest{})
+		if err != nil {
+			t.Fatalf("Chat() error = %v", err)
+		}
+		if resp.ID != "live" {
+			t.Errorf("request %d served by %q, want live", i, resp.ID)
+		}
+	}
+	// Round-robin tries dead first every other request until its circuit opens
+	if dead.calls != 2 {
+		t.Errorf("dead endpoint calls = %d, want 2 (circuit should open)", dead.calls)
+	}
+
+	// After the cooldown the dead endpoint is probed again
+	now = now.Add(2 * time.Minute)
+	dead.err = nil
+	seen := map[string]bool{}
+	for i := 0; i < 2; i++ {
+		resp, _ := pool.Chat(context.Background(), ChatRequest{})
+		seen[resp.ID] = true
+	}
+	if !seen["dead"] {
+		t.Error("recovered endpoint was not used after cooldown")
+	}
+}
+
+func TestPoolDoesNotFailOverClientErrors(t *testing.T) {
+	bad := &stubProvider{name: "a", err: &APIError{StatusCode: 400, Body: []byte("context too long")}}
+	other := &stubProvider{name: "b"}
+	pool, _ := NewPool([]PoolEndpoint{
+		{Name: "a", Provider: bad},
+		{Name: "b", Provider: other},
+	}, PoolOptions{Strategy: StrategyLeastLatency})
+
+	_, err := pool.Chat(context.Background(), ChatRequest{})
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != 400 {
+		t.Errorf("Chat() error = %v, want the 400 API error", err)
+	}
+	if other.calls != 0 {
+		t.Errorf("second endpoint calls = %d, want 0", other.calls)
+	}
+}
+
+func TestPoolAllEndpointsFail(t *testing.T) {
+	a := &stubProvider{name: "a", err: &APIError{StatusCode: 503}}
+	pool, _ := NewPool([]PoolEndpoint{{Name: "a", Provider: a}}, PoolOptions{MaxRounds: 1})
+
+	_, err := pool.Chat(context.Background(), ChatRequest{})
+	if err == nil || !strings.Contains(err.Error(), "all endpoints failed") {
+		t.Errorf("Chat() error = %v, want all endpoints failed", err)
+	}
+}
+
+func TestPoolFailsOverFromDeadHost(t *testing.T) {
+	deadServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	deadURL := deadServer.URL
+	deadServer.Close()
+
+	live := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"id":"ok","choices":[{"message":{"role":"assistant","content":"hi"},"finish_reason":"stop"}]}`))
+	}))
+	defer live.Close()
+
+	var endpoints []PoolEndpoint
+	for _, url := range []string{deadURL, live.URL} {
+		p, err := NewProvider(ProviderOptions{BaseURL: url, MaxRetries: -1, ConnectTimeout: time.Second})
+		if err != nil {
+			t.Fatalf("NewProvider() error = %v", err)
+		}
+		endpoints = append(endpoints, PoolEndpoint{Name: url, Provider: p})
+	}
+	pool, _ := NewPool(endpoints, PoolOptions{})
+
+	start := time.Now()
+	resp, err := pool.Chat(context.Background(), ChatRequest{Model: "m"})
+	if err != nil {
+		t.Fatalf("Chat() error = %v", err)
+	}
+	if resp.ID != "ok" {
+		t.Errorf("Response.ID = %q, want ok", resp.ID)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("failover took %v, want no retry backoff on the dead host", elapsed)
+	}
+}
+
+func TestNewPoolRejectsUnknownStrategy(t *testing.T) {
+	_, err := NewPool([]PoolEndpoint{{Provider: &stubProvider{}}}, PoolOptions{Strategy: "random"})
+	if err == nil {
+		t.Error("NewPool() should reject unknown strategy")
+	}
+}
+
+func TestPoolFailsOverOnlyForEndpointErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"connection refused", fmt.Errorf("execute request: %w", &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}), true},
+		{"cut-off body", fmt.Errorf("read stream: %w", io.ErrUnexpectedEOF), true},
+		{"503", &APIError{StatusCode: 503}, true},
+		{"400", &APIError{StatusCode: 400}, false},
+		{"undecodable response", errors.New("decode response: invalid character"), false},
+	}
+	for _, tt := range tests {
+		if got := isFailoverError(context.Background(), tt.err); got != tt.want {
+			t.Errorf("isFailoverError(%s) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if isFailoverError(ctx, &APIError{StatusCode: 503}) {
+		t.Error("isFailoverError() = true after the context was cancelled")
+	}
+}
+
+func TestPoolForgetsOldResponseOwners(t *testing.T) {
+	pool, _ := NewPool([]PoolEndpoint{{Name: "a", Provider: &stubProvider{name: "a"}}}, PoolOptions{})
+	ep := pool.endpoints[0]
+	for i := 0; i < poolMaxOwners+10; i++ {
+		pool.recordSuccess(ep, time.Millisecond, fmt.Sprintf("gen-%d", i))
+	}
+	if n := len(pool.owners.items); n != poolMaxOwners {
+		t.Errorf("owners = %d, want %d", n, poolMaxOwners)
+	}
+	if _, err := pool.GetGenerationStats(context.Background(), "gen-0"); err == nil {
+		t.Error("GetGenerationStats() of the oldest response succeeded, want it forgotten")
+	}
+}
@@ -0,0 +1,88 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+)
+
+// Provider is a chat completion backend used by the agent.
+// Requests and responses use the OpenAI-shaped types of this package;
+// adapters for other APIs translate at the boundary.
+type Provider interface {
+	// Chat sends a request and waits for the complete response
+	Chat(ctx context.Context, req ChatRequest) (*ChatResponse, error)
+	// ChatStream sends a request and passes content deltas to onDelta as they arrive
+	ChatStream(ctx context.Context, req ChatRequest, onDelta StreamHandler) (*ChatResponse, error)
+	// GetGenerationStats returns extended usage, cost and timing data for a response ID
+	GetGenerationStats(ctx context.Context, generationID string) (*GenerationStats, error)
+}
+
+// Provider kinds accepted by NewProvider
+const (
+	ProviderOpenAI    = "openai"
+	ProviderAnthropic = "anthropic"
+	ProviderOllama    = "ollama"
+)
+
+// ProviderOptions configures a provider created by NewProvider
+type ProviderOptions struct {
+	Kind    string // ProviderOpenAI (default), ProviderAnthropic or ProviderOllama
+	BaseURL string
+	APIKey  string
+
+	// ThinkingBudget enables extended thinking with this many budget tokens (Anthropic only, 0 = off)
+	ThinkingBudget int
+
+	// NumCtx and KeepAlive are passed to Ollama's native API (Ollama only)
+	NumCtx    int
+	KeepAlive string
+
+	// MaxRetries limits retries per request (0 = default of 10, negative = no retries).
+	// Endpoints in a Pool use no retries so failures move on to the next endpoint.
+	MaxRetries int
+	// ConnectTimeout bounds how long to wait for a TCP connection (0 = no limit)
+	ConnectTimeout time.Duration
+}
+
+// NewProvider creates the provider selected by opts.Kind
+func NewProvider(opts ProviderOptions) (Provider, error) {
+	switch opts.Kind {
+	case "", ProviderOpenAI:
+		c := NewClient(opts.BaseURL, opts.APIKey)
+		applyTransportOptions(opts, c.client, &c.maxRetries)
+		return c, nil
+	case ProviderAnthropic:
+		c := NewAnthropicClient(opts.BaseURL, opts.APIKey, opts.ThinkingBudget)
+		applyTransportOptions(opts, c.client, &c.maxRetries)
+		return c, nil
+	case ProviderOllama:
+		c := NewOllamaClient(opts.BaseURL, opts.NumCtx, opts.KeepAlive)
+		applyTransportOptions(opts, c.client, &c.maxRetries)
+		return c, nil
+	default:
+		return nil, fmt.Errorf("unknown LLM provider %q (expected %q, %q or %q)", opts.Kind, ProviderOpenAI, ProviderAnthropic, ProviderOllama)
+	}
+}
+
+// applyTransportOptions sets the retry limit and connect timeout of a client
+func applyTransportOptions(opts ProviderOptions, hc *http.Client, maxRetries *int) {
+	if opts.MaxRetries < 0 {
+		*maxRetries = 0
+	} else if opts.MaxRetries > 0 {
+		*maxRetries = opts.MaxRetries
+	}
+
+	if opts.ConnectTimeout > 0 {
+		var transport *http.Transport
+		if t, ok := hc.Transport.(*http.Transport); ok {
+			transport = t.Clone()
+		} else {
+			transport = http.DefaultTransport.(*http.Transport).Clone()
+		}
+		transport.DialContext = (&net.Dialer{Timeout: opts.ConnectTimeout, KeepAlive: 30 * time.Second}).DialContext
+		hc.Transport = transport
+	}
+}
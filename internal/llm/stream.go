@@ -0,0 +1,215 @@
+package llm
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// StreamDelta is an incremental piece of model output received while streaming
+type StreamDelta struct {
+	Content          string
+	ReasoningContent string
+}
+
+// StreamHandler receives deltas as they arrive. It may be nil.
+type StreamHandler func(delta StreamDelta)
+
+// streamChunk is a single server-sent event payload of a streaming chat completion
+type streamChunk struct {
+	ID      string `json:"id"`
+	Model   string `json:"model"`
+	Choices []struct {
+		Index int `json:"index"`
+		Delta struct {
+			Role             MessageRole     `json:"role"`
+			Content          string          `json:"content"`
+			ReasoningContent string          `json:"reasoning_content"`
+			ToolCalls        []toolCallDelta `json:"tool_calls"`
+		} `json:"delta"`
+		FinishReason *string      `json:"finish_reason"`
+		Error        *ChoiceError `json:"error,omitempty"`
+	} `json:"choices"`
+	Usage *struct {
+		PromptTokens     int `json:"prompt_tokens"`
+		CompletionTokens int `json:"completion_tokens"`
+		TotalTokens      int `json:"total_tokens"`
+	} `json:"usage"`
+	Error *struct {
+		Message string `json:"message"`
+		Code    any    `json:"code"`
+	} `json:"error,omitempty"`
+}
+
+// toolCallDelta is a fragment of a tool call; fragments with the same index belong together
+type toolCallDelta struct {
+	Index    int    `json:"index"`
+	ID       string `json:"id"`
+	Type     string `json:"type"`
+	Function struct {
+		Name      string `json:"name"`
+		Arguments string `json:"arguments"`
+	} `json:"function"`
+}
+
+// streamAccumulator assembles a ChatResponse from streaming chunks
+type streamAccumulator struct {
+	id           string
+	model        string
+	content      strings.Builder
+	reasoning    strings.Builder
+	toolCalls    map[int]*ToolCall
+	finishReason string
+	choiceErr    *ChoiceError
+	usage        *struct {
+		PromptTokens     int `json:"prompt_tokens"`
+		CompletionTokens int `json:"completion_tokens"`
+		TotalTokens      int `json:"total_tokens"`
+	}
+}
+
+func newStreamAccumulator() *streamAccumulator {
+	return &streamAccumulator{toolCalls: make(map[int]*ToolCall)}
+}
+
+// add merges one chunk into the accumulated response and forwards text deltas
+func (a *streamAccumulator) add(chunk *streamChunk, onDelta StreamHandler) {
+	if chunk.ID != "" {
+		a.id = chunk.ID
+	}
+	if chunk.Model != "" {
+		a.model = chunk.Model
+	}
+	if chunk.Usage != nil {
+		a.usage = chunk.Usage
+	}
+
+	for _, choice := range chunk.Choices {
+		// Only the first choice is used by the agent
+		if choice.Index != 0 {
+			continue
+		}
+		if choice.Error != nil {
+			a.choiceErr = choice.Error
+		}
+		if choice.FinishReason != nil && *choice.FinishReason != "" {
+			a.finishReason = *choice.FinishReason
+		}
+
+		delta := choice.Delta
+		if delta.Content != "" || delta.ReasoningContent != "" {
+			a.content.WriteString(delta.Content)
+			a.reasoning.WriteString(delta.ReasoningContent)
+			if onDelta != nil {
+				onDelta(StreamDelta{Content: delta.Content, ReasoningContent: delta.ReasoningContent})
+			}
+		}
+
+		for _, tcd := range delta.ToolCalls {
+			tc, ok := a.toolCalls[tcd.Index]
+			if !ok {
+				tc = &ToolCall{}
+				a.toolCalls[tcd.Index] = tc
+			}
+			if tcd.ID != "" {
+				tc.ID = tcd.ID
+			}
+			if tcd.Type != "" {
+				tc.Type = tcd.Type
+			}
+			tc.Function.Name += tcd.Function.Name
+			tc.Function.Arguments += tcd.Function.Arguments
+		}
+	}
+}
+
+// response builds the final ChatResponse from everything received so far
+func (a *streamAccumulator) response() *ChatResponse {
+	msg := Message{
+		Role:             RoleAssistant,
+		Content:          a.content.String(),
+		ReasoningContent: a.reasoning.String(),
+	}
+
+	indices := make([]int, 0, len(a.toolCalls))
+	for idx := range a.toolCalls {
+		indices = append(indices, idx)
+	}
+	sort.Ints(indices)
+	for _, idx := range indices {
+		msg.ToolCalls = append(msg.ToolCalls, *a.toolCalls[idx])
+	}
+
+	resp := &ChatResponse{ID: a.id, Model: a.model}
+	resp.Choices = append(resp.Choices, struct {
+		Index        int          `json:"index"`
+		Message      Message      `json:"message"`
+		FinishReason string       `json:"finish_reason"`
+		Error        *ChoiceError `json:"error,omitempty"`
+	}{
+		Index:        0,
+		Message:      msg,
+		FinishReason: a.finishReason,
+		Error:        a.choiceErr,
+	})
+	if a.usage != nil {
+		resp.Usage = *a.usage
+	}
+	return resp
+}
+
+// readStream parses a server-sent events body into a ChatResponse.
+// received reports whether any chunk was delivered, which tells the caller
+// whether it is still safe to retry the request from scratch.
+func readStream(body io.Reader, onDelta StreamHandler) (resp *ChatResponse, received bool, err error) {
+	acc := newStreamAccumulator()
+	reader := bufio.NewReader(body)
+
+	for {
+		line, readErr := reader.ReadString('\n')
+		line = strings.TrimRight(line, "\r\n")
+
+		if data, ok := strings.CutPrefix(line, "data:"); ok {
+			data = strings.TrimSpace(data)
+			if data == "[DONE]" {
+				return acc.response(), received, nil
+			}
+			if data != "" {
+				var chunk streamChunk
+				if jsonErr := json.Unmarshal([]byte(data), &chunk); jsonErr != nil {
+					return nil, received, fmt.Errorf("decode stream chunk: %w (chunk: %s)", jsonErr, truncatePreview(data))
+				}
+				if chunk.Error != nil {
+					return nil, received, fmt.Errorf("stream error: %s", chunk.Error.Message)
+				}
+				acc.add(&chunk, onDelta)
+				received = true
+			}
+		}
+		// Other lines (comments, event names, blank separators) carry nothing we need
+
+		if readErr != nil {
+			// The stream ended without [DONE]. llama.cpp sometimes closes the
+			// connection early, so accept what was received if anything arrived.
+			if received && (readErr == io.EOF || errors.Is(readErr, io.ErrUnexpectedEOF)) {
+				return acc.response(), received, nil
+			}
+			if readErr == io.EOF {
+				return nil, received, fmt.Errorf("empty response stream")
+			}
+			return nil, received, fmt.Errorf("read stream: %w", readErr)
+		}
+	}
+}
+
+// truncatePreview shortens a payload for inclusion in error messages
+func truncatePreview(s string) string {
+	if len(s) > 500 {
+		return s[:500] + "..."
+	}
+	return s
+}
@@ -0,0 +1,199 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// writeSSE writes each payload as a server-sent event and flushes it
+func writeSSE(t *testing.T, w http.ResponseWriter, payloads ...string) {
+	t.Helper()
+	w.Header().Set("Content-Type", "text/event-stream")
+	flusher, _ := w.(http.Flusher)
+	for _, p := range payloads {
+		fmt.Fprintf(w, "data: %s\n\n", p)
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+}
+
+func TestChatStreamContent(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req ChatRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Fatalf("Failed to decode request: %v", err)
+		}
+		if !req.Stream {
+			t.Error("Request.Stream = false, want true")
+		}
+		if req.StreamOptions == nil || !req.StreamOptions.IncludeUsage {
+			t.Error("Request.StreamOptions.IncludeUsage not set")
+		}
+
+		writeSSE(t, w,
+			`{"id":"gen-1","model":"m","choices":[{"index":0,"delta":{"role":"assistant","reasoning_content":"Let me "}}]}`,
+			`{"id":"gen-1","choices":[{"index":0,"delta":{"reasoning_content":"think."}}]}`,
+			`{"id":"gen-1","choices":[{"index":0,"delta":{"content":"Hello"}}]}`,
+			`{"id":"gen-1","choices":[{"index":0,"delta":{"content":" world"},"finish_reason":"stop"}]}`,
+			`{"id":"gen-1","choices":[],"usage":{"prompt_tokens":12,"completion_tokens":5,"total_tokens":17}}`,
+			`[DONE]`,
+		)
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "")
+
+	var content, reasoning strings.Builder
+	resp, err := client.ChatStream(context.Background(), ChatRequest{Model: "m"}, func(d StreamDelta) {
+		content.WriteString(d.Content)
+		reasoning.WriteString(d.ReasoningContent)
+	})
+	if err != nil {
+		t.Fatalf("ChatStream() error = %v", err)
+	}
+
+	if content.String() != "Hello world" {
+		t.Errorf("streamed content = %q, want %q", content.String(), "Hello world")
+	}
+	if reasoning.String() != "Let me think." {
+		t.Errorf("streamed reasoning = %q, want %q", reasoning.String(), "Let me think.")
+	}
+	if resp.ID != "gen-1" {
+		t.Errorf("Response.ID = %q, want gen-1", resp.ID)
+	}
+	if len(resp.Choices) != 1 {
+		t.Fatalf("len(Choices) = %d, want 1", len(resp.Choices))
+	}
+	msg := resp.Choices[0].Message
+	if msg.Content != "Hello world" || msg.ReasoningContent != "Let me think." {
+		t.Errorf("Message = %+v, want assembled content and reasoning", msg)
+	}
+	if resp.Choices[0].FinishReason != "stop" {
+		t.Errorf("FinishReason = %q, want stop", resp.Choices[0].FinishReason)
+	}
+	if resp.Usage.TotalTokens != 17 {
+		t.Errorf("Usage.TotalTokens = %d, want 17", resp.Usage.TotalTokens)
+	}
+}
+
+func TestChatStreamToolCalls(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeSSE(t, w,
+			`{"id":"gen-2","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"id":"call_a","type":"function","function":{"name":"Read","arguments":""}}]}}]}`,
+			`{"id":"gen-2","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"{\"path\":"}}]}}]}`,
+			`{"id":"gen-2","choices":[{"index":0,"delta":{"tool_calls":[{"index":1,"id":"call_b","type":"function","function":{"name":"Search","arguments":"{\"pattern\":\"x\"}"}}]}}]}`,
+			`{"id":"gen-2","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"\"main.go\"}"}}]},"finish_reason":"tool_calls"}]}`,
+			`[DONE]`,
+		)
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "")
+	resp, err := client.ChatStream(context.Background(), ChatRequest{Model: "m"}, nil)
+	if err != nil {
+		t.Fatalf("ChatStream() error = %v", err)
+	}
+
+	calls := resp.Choices[0].Message.ToolCalls
+	if len(calls) != 2 {
+		t.Fatalf("len(ToolCalls) = %d, want 2", len(calls))
+	}
+	if calls[0].ID != "call_a" || calls[0].Function.Name != "Read" || calls[0].Function.Arguments != `{"path":"main.go"}` {
+		t.Errorf("ToolCalls[0] = %+v, want Read with assembled arguments", calls[0])
+	}
+	if calls[1].ID != "call_b" || calls[1].Function.Name != "Search" || calls[1].Function.Arguments != `{"pattern":"x"}` {
+		t.Errorf("ToolCalls[1] = %+v, want Search", calls[1])
+	}
+	if resp.Choices[0].FinishReason != "tool_calls" {
+		t.Errorf("FinishReason = %q, want tool_calls", resp.Choices[0].FinishReason)
+	}
+}
+
+func TestChatStreamMissingDone(t *testing.T) {
+	// llama.cpp sometimes closes the connection without sending [DONE]
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeSSE(t, w,
+			`{"id":"gen-3","choices":[{"index":0,"delta":{"content":"partial"},"finish_reason":"stop"}]}`,
+		)
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "")
+	resp, err := client.ChatStream(context.Background(), ChatRequest{Model: "m"}, nil)
+	if err != nil {
+		t.Fatalf("ChatStream() error = %v", err)
+	}
+	if resp.Choices[0].Message.Content != "partial" {
+		t.Errorf("Content = %q, want partial", resp.Choices[0].Message.Content)
+	}
+}
+
+func TestChatStreamRetriesBeforeFirstChunk(t *testing.T) {
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			_, _ = w.Write([]byte(`{"error":"loading model"}`))
+			return
+		}
+		writeSSE(t, w,
+			`{"id":"gen-4","choices":[{"index":0,"delta":{"content":"ok"},"finish_reason":"stop"}]}`,
+			`[DONE]`,
+		)
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "")
+	resp, err := client.ChatStream(context.Background(), ChatRequest{Model: "m"}, nil)
+	if err != nil {
+		t.Fatalf("ChatStream() error = %v", err)
+	}
+	if attempts != 2 {
+		t.Errorf("attempts = %d, want 2", attempts)
+	}
+	if resp.Choices[0].Message.Content != "ok" {
+		t.Errorf("Content = %q, want ok", resp.Choices[0].Message.Content)
+	}
+}
+
+func TestChatStreamPermanent500(t *testing.T) {
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = w.Write([]byte(`{"error":"conversation roles must alternate user/assistant"}`))
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "")
+	_, err := client.ChatStream(context.Background(), ChatRequest{Model: "m"}, nil)
+	if err == nil {
+		t.Fatal("ChatStream() should return error for permanent 500")
+	}
+	if attempts != 1 {
+		t.Errorf("attempts = %d, want 1 (permanent errors are not retried)", attempts)
+	}
+}
+
+func TestChatStreamErrorChunk(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeSSE(t, w,
+			`{"id":"gen-5","choices":[{"index":0,"delta":{"content":"a"}}]}`,
+			`{"error":{"message":"upstream failed","code":502}}`,
+		)
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "")
+	_, err := client.ChatStream(context.Background(), ChatRequest{Model: "m"}, nil)
+	if err == nil || !strings.Contains(err.Error(), "upstream failed") {
+		t.Errorf("ChatStream() error = %v, want stream error", err)
+	}
+}
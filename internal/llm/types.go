@@ -16,6 +16,18 @@ type Message struct {
 	Name             string      `json:"name,omitempty"`
 	ToolCalls        []ToolCall  `json:"tool_calls,omitempty"`
 	ToolCallID       string      `json:"tool_call_id,omitempty"` // For tool role messages
+
+	// Usage reported for the response an assistant message came from. It is
+	// saved with sessions but never sent to the server.
+	Usage *MessageUsage `json:"-"`
+}
+
+// MessageUsage is the usage of the response behind an assistant message
+type MessageUsage struct {
+	PromptTokens     int     `json:"prompt_tokens"`
+	CompletionTokens int     `json:"completion_tokens"`
+	CacheReadTokens  int     `json:"cache_read_tokens,omitempty"`
+	Cost             float64 `json:"cost_usd,omitempty"`
 }
 
 type ToolCall struct {
@@ -35,6 +47,13 @@ type ChatRequest struct {
 	Tools       []ToolSpec `json:"tools,omitempty"`
 	ToolChoice  string     `json:"tool_choice,omitempty"`
 	Stream      bool       `json:"stream,omitempty"`
+
+	StreamOptions *StreamOptions `json:"stream_options,omitempty"`
+}
+
+// StreamOptions controls extra data sent in streaming responses
+type StreamOptions struct {
+	IncludeUsage bool `json:"include_usage"` // Request a final chunk with token usage
 }
 
 // ChoiceError represents an error returned in a choice (e.g., upstream provider errors)
@@ -81,6 +100,7 @@ type GenerationStats struct {
 		NativeTokensPrompt     int     `json:"native_tokens_prompt"`
 		NativeTokensCompletion int     `json:"native_tokens_completion"`
 		NativeTokensCached     int     `json:"native_tokens_cached"`
+		NativeTokensCacheWrite int     `json:"native_tokens_cache_write"`
 		TotalCost              float64 `json:"total_cost"`
 		CacheDiscount          float64 `json:"cache_discount"`
 		ProviderName           string  `json:"provider_name"`
@@ -0,0 +1,396 @@
+package lsp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kvit-s/kvit-coder/internal/config"
+)
+
+// stderrTail is how much of a server's stderr is kept for error messages
+const stderrTail = 2048
+
+// Client is a running language server
+type Client struct {
+	name   string
+	server config.LSPServerConfig
+	root   string
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	conn   *Conn
+	stderr *tailWriter
+
+	exited  chan struct{} // closed when the process is gone
+	waitErr error
+
+	syncMu sync.Mutex // keeps a document's notifications in order
+
+	mu        sync.Mutex
+	docs      map[string]*document // open documents by URI
+	diags     map[string][]Diagnostic
+	published chan struct{} // closed and replaced on every publishDiagnostics
+}
+
+// document is the text of a file as the server last saw it
+type document struct {
+	version int
+	text    string
+}
+
+// Start runs a language server in root and initializes it
+func Start(ctx context.Context, server config.LSPServerConfig, root string) (*Client, error) {
+	c := &Client{
+		name:      ServerName(server),
+		server:    server,
+		root:      root,
+		stderr:    &tailWriter{max: stderrTail},
+		exited:    make(chan struct{}),
+		docs:      make(map[string]*document),
+		diags:     make(map[string][]Diagnostic),
+		published: make(chan struct{}),
+	}
+
+	c.cmd = exec.Command(server.Command, server.Args...)
+	c.cmd.Dir = root
+	c.cmd.Stderr = c.stderr
+	stdin, err := c.cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	c.stdin = stdin
+	// The connection reads stdout through a pipe that is closed once the
+	// process is gone, so a crash ends every pending call
+	stdoutR, stdoutW := io.Pipe()
+	c.cmd.Stdout = stdoutW
+	if err := c.cmd.Start(); err != nil {
+		return nil, fmt.Errorf("starting %s: %w", c.name, err)
+	}
+	go func() {
+		c.waitErr = c.cmd.Wait()
+		stdoutW.Close()
+		close(c.exited)
+	}()
+	c.conn = NewConn(stdoutR, stdin, c.handle)
+
+	if err := c.initialize(ctx); err != nil {
+		c.kill()
+		return nil, c.failure("initializing", err)
+	}
+	return c, nil
+}
+
+// ServerName returns the name a server is reported under: its configured
+// name, or the base name of its command
+func ServerName(server config.LSPServerConfig) string {
+	if server.Name != "" {
+		return server.Name
+	}
+	return filepath.Base(server.Command)
+}
+
+// Name returns the server's name
+func (c *Client) Name() string {
+	return c.name
+}
+
+// Alive reports whether the server process is still running
+func (c *Client) Alive() bool {
+	select {
+	case <-c.exited:
+		return false
+	default:
+		return true
+	}
+}
+
+func (c *Client) initialize(ctx context.Context) error {
+	rootURI := PathToURI(c.root)
+	params := map[string]any{
+		"processId": os.Getpid(),
+		"clientInfo": map[string]any{
+			"name": "kvit-coder",
+		},
+		"rootUri":  rootURI,
+		"rootPath": c.root,
+		"workspaceFolders": []map[string]any{
+			{"uri": rootURI, "name": filepath.Base(c.root)},
+		},
+		"capabilities": map[string]any{
+			"textDocument": map[string]any{
+				"synchronization": map[string]any{},
+				"hover": map[string]any{
+					"contentFormat": []string{"markdown", "plaintext"},
+				},
+				"definition": map[string]any{"linkSupport": true},
+				"references": map[string]any{},
+				"documentSymbol": map[string]any{
+					"hierarchicalDocumentSymbolSupport": true,
+				},
+				"publishDiagnostics": map[string]any{},
+			},
+			"workspace": map[string]any{
+				"configuration":    true,
+				"workspaceFolders": true,
+			},
+		},
+	}
+	if c.server.InitializationOptions != nil {
+		params["initializationOptions"] = c.server.InitializationOptions
+	}
+	if err := c.conn.Call(ctx, "initialize", params, nil); err != nil {
+		return err
+	}
+	return c.conn.Notify("initialized", map[string]any{})
+}
+
+// handle answers what the server sends on its own
+func (c *Client) handle(method string, params json.RawMessage) (any, error) {
+	switch method {
+	case "textDocument/publishDiagnostics":
+		var p struct {
+			URI         string       `json:"uri"`
+			Diagnostics []Diagnostic `json:"diagnostics"`
+		}
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, err
+		}
+		c.mu.Lock()
+		c.diags[p.URI] = p.Diagnostics
+		close(c.published)
+		c.published = make(chan struct{})
+		c.mu.Unlock()
+		return nil, nil
+	case "workspace/configuration":
+		// No settings of our own: null for every item lets the server use its defaults
+		var p struct {
+			Items []json.RawMessage `json:"items"`
+		}
+		_ = json.Unmarshal(params, &p)
+		return make([]any, len(p.Items)), nil
+	case "workspace/workspaceFolders":
+		return []map[string]any{{"uri": PathToURI(c.root), "name": filepath.Base(c.root)}}, nil
+	case "window/workDoneProgress/create", "client/registerCapability", "client/unregisterCapability", "window/showMessageRequest":
+		return nil, nil
+	}
+	// Other notifications (logs, progress) are dropped
+	return nil, &ResponseError{Code: CodeMethodNotFound, Message: "method not supported: " + method}
+}
+
+// Sync opens path on the server, or sends its new text if it changed on
+// disk since the server last saw it
+func (c *Client) Sync(path string) error {
+	c.syncMu.Lock()
+	defer c.syncMu.Unlock()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	text := string(data)
+	uri := PathToURI(path)
+
+	c.mu.Lock()
+	doc, open := c.docs[uri]
+	if open && doc.text == text {
+		c.mu.Unlock()
+		return nil
+	}
+	if !open {
+		doc = &document{}
+		c.docs[uri] = doc
+	}
+	doc.version++
+	doc.text = text
+	version := doc.version
+	// What the server reported is stale until it publishes for the new text
+	delete(c.diags, uri)
+	c.mu.Unlock()
+
+	if !open {
+		return c.conn.Notify("textDocument/didOpen", map[string]any{
+			"textDocument": map[string]any{
+				"uri":        uri,
+				"languageId": LanguageID(c.server, path),
+				"version":    version,
+				"text":       text,
+			},
+		})
+	}
+	return c.conn.Notify("textDocument/didChange", map[string]any{
+		"textDocument":   map[string]any{"uri": uri, "version": version},
+		"contentChanges": []map[string]any{{"text": text}},
+	})
+}
+
+// LanguageID returns the languageId sent for a file: the configured one,
+// or the file's extension
+func LanguageID(server config.LSPServerConfig, path string) string {
+	if server.LanguageID != "" {
+		return server.LanguageID
+	}
+	return strings.TrimPrefix(filepath.Ext(path), ".")
+}
+
+// Hover returns the hover text at pos, empty when the server has none
+func (c *Client) Hover(ctx context.Context, path string, pos Position) (string, error) {
+	var result *struct {
+		Contents json.RawMessage `json:"contents"`
+	}
+	if err := c.request(ctx, "textDocument/hover", path, map[string]any{"position": pos}, &result); err != nil {
+		return "", err
+	}
+	if result == nil {
+		return "", nil
+	}
+	return strings.TrimSpace(hoverText(result.Contents)), nil
+}
+
+// Definition returns where the symbol at pos is declared
+func (c *Client) Definition(ctx context.Context, path string, pos Position) ([]Location, error) {
+	var raw json.RawMessage
+	if err := c.request(ctx, "textDocument/definition", path, map[string]any{"position": pos}, &raw); err != nil {
+		return nil, err
+	}
+	return locations(raw)
+}
+
+// References returns where the symbol at pos is used, and declared if
+// includeDeclaration is set
+func (c *Client) References(ctx context.Context, path string, pos Position, includeDeclaration bool) ([]Location, error) {
+	params := map[string]any{
+		"position": pos,
+		"context":  map[string]any{"includeDeclaration": includeDeclaration},
+	}
+	var raw json.RawMessage
+	if err := c.request(ctx, "textDocument/references", path, params, &raw); err != nil {
+		return nil, err
+	}
+	return locations(raw)
+}
+
+// Symbols returns the declarations in path
+func (c *Client) Symbols(ctx context.Context, path string) ([]Symbol, error) {
+	var raw []documentSymbol
+	if err := c.request(ctx, "textDocument/documentSymbol", path, map[string]any{}, &raw); err != nil {
+		return nil, err
+	}
+	symbols := make([]Symbol, len(raw))
+	for i, s := range raw {
+		symbols[i] = s.symbol()
+	}
+	return symbols, nil
+}
+
+// Diagnostics returns what the server reports for path. Servers publish
+// diagnostics when they are done analyzing, so it waits up to wait for them;
+// published is false if none came in time.
+func (c *Client) Diagnostics(ctx context.Context, path string, wait time.Duration) (diags []Diagnostic, published bool, err error) {
+	if err := c.Sync(path); err != nil {
+		return nil, false, c.failure("opening "+path, err)
+	}
+	uri := PathToURI(path)
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	for {
+		c.mu.Lock()
+		diags, published = c.diags[uri]
+		next := c.published
+		c.mu.Unlock()
+		if published {
+			return diags, true, nil
+		}
+		select {
+		case <-next:
+		case <-timer.C:
+			return nil, false, nil
+		case <-c.exited:
+			return nil, false, c.failure("waiting for diagnostics", ErrClosed)
+		case <-ctx.Done():
+			return nil, false, ctx.Err()
+		}
+	}
+}
+
+// request syncs path and sends a textDocument request about it
+func (c *Client) request(ctx context.Context, method, path string, params map[string]any, result any) error {
+	if err := c.Sync(path); err != nil {
+		return c.failure("opening "+path, err)
+	}
+	params["textDocument"] = map[string]any{"uri": PathToURI(path)}
+	if err := c.conn.Call(ctx, method, params, result); err != nil {
+		return c.failure(method, err)
+	}
+	return nil
+}
+
+// Shutdown asks the server to exit, and kills it if it hasn't by the time
+// ctx is done
+func (c *Client) Shutdown(ctx context.Context) error {
+	if !c.Alive() {
+		return nil
+	}
+	err := c.conn.Call(ctx, "shutdown", nil, nil)
+	if err == nil {
+		_ = c.conn.Notify("exit", nil)
+	}
+	c.stdin.Close()
+	select {
+	case <-c.exited:
+	case <-ctx.Done():
+		c.kill()
+	}
+	return err
+}
+
+func (c *Client) kill() {
+	if c.cmd.Process != nil {
+		_ = c.cmd.Process.Kill()
+	}
+	<-c.exited
+}
+
+// failure describes an error talking to the server, with the end of its
+// stderr when it died
+func (c *Client) failure(what string, err error) error {
+	if c.Alive() {
+		return fmt.Errorf("%s: %s: %w", c.name, what, err)
+	}
+	msg := fmt.Sprintf("%s exited during %s", c.name, what)
+	if c.waitErr != nil {
+		msg += fmt.Sprintf(" (%v)", c.waitErr)
+	}
+	if tail := strings.TrimSpace(c.stderr.String()); tail != "" {
+		msg += ": " + tail
+	}
+	return fmt.Errorf("%s: %w", msg, ErrClosed)
+}
+
+// tailWriter keeps the last max bytes written to it
+type tailWriter struct {
+	mu  sync.Mutex
+	max int
+	buf []byte
+}
+
+func (w *tailWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.buf = append(w.buf, p...)
+	if len(w.buf) > w.max {
+		w.buf = w.buf[len(w.buf)-w.max:]
+	}
+	return len(p), nil
+}
+
+func (w *tailWriter) String() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return string(w.buf)
+}
@@ -0,0 +1,161 @@
+package lsp_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kvit-s/kvit-coder/internal/config"
+	"github.com/kvit-s/kvit-coder/internal/lsp"
+	"github.com/kvit-s/kvit-coder/internal/lsp/lsptest"
+)
+
+func TestMain(m *testing.M) {
+	lsptest.MainIfServer()
+	os.Exit(m.Run())
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func newManager(t *testing.T) (*lsp.Manager, string) {
+	t.Helper()
+	root := t.TempDir()
+	m := lsp.NewManager(root, []config.LSPServerConfig{lsptest.Server(".fk")})
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		m.Shutdown(ctx)
+	})
+	return m, root
+}
+
+func TestClientRequests(t *testing.T) {
+	m, root := newManager(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	lib := filepath.Join(root, "lib.fk")
+	main := filepath.Join(root, "main.fk")
+	writeFile(t, lib, "def greet\ndef wave\n")
+	writeFile(t, main, "call greet\n  call greet\ncall missing\n")
+
+	c, err := m.Client(ctx, main)
+	if err != nil {
+		t.Fatalf("Client() error = %v", err)
+	}
+	if c.Name() != "fake" {
+		t.Errorf("Name() = %q, want fake", c.Name())
+	}
+
+	symbols, err := c.Symbols(ctx, lib)
+	if err != nil {
+		t.Fatalf("Symbols() error = %v", err)
+	}
+	if len(symbols) != 2 || symbols[0].Name != "greet" || symbols[0].Kind != "function" || symbols[1].Range.Start.Line != 1 {
+		t.Errorf("Symbols() = %+v, want greet and wave as functions", symbols)
+	}
+
+	pos := lsp.Position{Line: 0, Character: 6} // "greet" in "call greet"
+	hover, err := c.Hover(ctx, main, pos)
+	if err != nil {
+		t.Fatalf("Hover() error = %v", err)
+	}
+	if hover != "```fake\ndef greet\n```" {
+		t.Errorf("Hover() = %q", hover)
+	}
+
+	defs, err := c.Definition(ctx, main, pos)
+	if err != nil {
+		t.Fatalf("Definition() error = %v", err)
+	}
+	if len(defs) != 1 || defs[0].Path() != lib || defs[0].Range.Start != (lsp.Position{Line: 0, Character: 4}) {
+		t.Errorf("Definition() = %+v, want lib.fk 0:4", defs)
+	}
+
+	refs, err := c.References(ctx, main, pos, false)
+	if err != nil {
+		t.Fatalf("References() error = %v", err)
+	}
+	if len(refs) != 2 || refs[0].Path() != main || refs[1].Range.Start != (lsp.Position{Line: 1, Character: 7}) {
+		t.Errorf("References() = %+v, want the two calls in main.fk", refs)
+	}
+	withDecl, err := c.References(ctx, main, pos, true)
+	if err != nil || len(withDecl) != 3 {
+		t.Errorf("References(includeDeclaration) = %+v, %v; want 3 locations", withDecl, err)
+	}
+}
+
+func TestClientDiagnosticsFollowEdits(t *testing.T) {
+	m, root := newManager(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	path := filepath.Join(root, "main.fk")
+	writeFile(t, path, "def a\ncall a\ncall b\n")
+	c, err := m.Client(ctx, path)
+	if err != nil {
+		t.Fatalf("Client() error = %v", err)
+	}
+
+	diags, published, err := c.Diagnostics(ctx, path, 5*time.Second)
+	if err != nil || !published {
+		t.Fatalf("Diagnostics() = %v, %v, %v", diags, published, err)
+	}
+	if len(diags) != 1 || diags[0].Message != "undefined: b" || diags[0].Range.Start.Line != 2 || diags[0].SeverityName() != "error" {
+		t.Errorf("Diagnostics() = %+v, want undefined: b on line 2", diags)
+	}
+
+	// The file changes on disk: the server gets the new text
+	writeFile(t, path, "def a\ndef b\ncall a\ncall b\n")
+	diags, published, err = c.Diagnostics(ctx, path, 5*time.Second)
+	if err != nil || !published || len(diags) != 0 {
+		t.Errorf("Diagnostics() after the fix = %+v, %v, %v; want none", diags, published, err)
+	}
+}
+
+func TestManagerLifecycle(t *testing.T) {
+	m, root := newManager(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if _, err := m.Client(ctx, filepath.Join(root, "notes.txt")); err == nil || !strings.Contains(err.Error(), "no language server configured for .txt") {
+		t.Errorf("Client(.txt) error = %v", err)
+	}
+
+	path := filepath.Join(root, "main.fk")
+	writeFile(t, path, "crash\n")
+	first, err := m.Client(ctx, path)
+	if err != nil {
+		t.Fatalf("Client() error = %v", err)
+	}
+	again, _ := m.Client(ctx, path)
+	if again != first {
+		t.Error("Client() started a second server for the same extension")
+	}
+
+	// A crashed server reports its stderr and is replaced on the next request
+	_, err = first.Hover(ctx, path, lsp.Position{Line: 0, Character: 0})
+	if err == nil || !strings.Contains(err.Error(), "crashing on request") {
+		t.Errorf("Hover() on a crashing server error = %v", err)
+	}
+	restarted, err := m.Client(ctx, path)
+	if err != nil {
+		t.Fatalf("Client() after crash error = %v", err)
+	}
+	if restarted == first || !restarted.Alive() {
+		t.Error("Client() did not restart the crashed server")
+	}
+
+	m.Shutdown(ctx)
+	if restarted.Alive() {
+		t.Error("server still running after Shutdown()")
+	}
+}
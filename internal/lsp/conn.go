@@ -0,0 +1,276 @@
+// Package lsp is a small Language Server Protocol client. It starts the
+// language servers configured in tools.lsp.servers, talks JSON-RPC to them
+// over stdio and exposes the requests the LSP.* tools need.
+package lsp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// JSON-RPC error codes used by the protocol
+const (
+	CodeMethodNotFound   = -32601
+	CodeInternalError    = -32603
+	CodeRequestCancelled = -32800
+)
+
+// ErrClosed is returned by calls on a connection whose peer went away
+var ErrClosed = errors.New("connection closed")
+
+// Handler answers the requests and notifications the peer sends. The result
+// is ignored for notifications. It runs on the connection's read loop, so it
+// must not wait for responses to its own calls.
+type Handler func(method string, params json.RawMessage) (any, error)
+
+// ResponseError is a JSON-RPC error. Handlers can return one to choose the
+// code sent to the peer.
+type ResponseError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *ResponseError) Error() string {
+	return fmt.Sprintf("%s (code %d)", e.Message, e.Code)
+}
+
+// message is any JSON-RPC message: a request has a method and an id, a
+// notification a method only, a response an id only
+type message struct {
+	JSONRPC string           `json:"jsonrpc"`
+	ID      *json.RawMessage `json:"id,omitempty"`
+	Method  string           `json:"method,omitempty"`
+	Params  json.RawMessage  `json:"params,omitempty"`
+	Result  json.RawMessage  `json:"result,omitempty"`
+	Error   *ResponseError   `json:"error,omitempty"`
+}
+
+// response is written instead of message so that a null result is kept
+type response struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  any             `json:"result"`
+	Error   *ResponseError  `json:"error,omitempty"`
+}
+
+// Conn is a JSON-RPC 2.0 connection framed with Content-Length headers, as
+// LSP uses on stdio. It works in both directions: the client uses it to talk
+// to a server, and the fake server in lsptest to answer.
+type Conn struct {
+	w       io.Writer
+	handler Handler
+
+	writeMu sync.Mutex
+
+	mu      sync.Mutex
+	nextID  int64
+	pending map[int64]chan *message
+	err     error // why the read loop stopped
+	done    chan struct{}
+}
+
+// NewConn starts reading messages from r. Requests and notifications go to
+// handler; a nil handler answers every request with "method not found".
+func NewConn(r io.Reader, w io.Writer, handler Handler) *Conn {
+	c := &Conn{
+		w:       w,
+		handler: handler,
+		pending: make(map[int64]chan *message),
+		done:    make(chan struct{}),
+	}
+	go c.readLoop(bufio.NewReader(r))
+	return c
+}
+
+// Call sends a request and decodes its result into result, which may be nil
+func (c *Conn) Call(ctx context.Context, method string, params, result any) error {
+	c.mu.Lock()
+	if c.err != nil {
+		c.mu.Unlock()
+		return c.err
+	}
+	c.nextID++
+	id := c.nextID
+	ch := make(chan *message, 1)
+	c.pending[id] = ch
+	c.mu.Unlock()
+
+	rawID := json.RawMessage(strconv.FormatInt(id, 10))
+	if err := c.send(message{ID: &rawID, Method: method, Params: marshalParams(params)}); err != nil {
+		c.forget(id)
+		return err
+	}
+
+	select {
+	case resp := <-ch:
+		if resp == nil {
+			return c.Err()
+		}
+		if resp.Error != nil {
+			return resp.Error
+		}
+		if result == nil || len(resp.Result) == 0 {
+			return nil
+		}
+		if err := json.Unmarshal(resp.Result, result); err != nil {
+			return fmt.Errorf("decoding %s result: %w", method, err)
+		}
+		return nil
+	case <-ctx.Done():
+		c.forget(id)
+		_ = c.Notify("$/cancelRequest", map[string]any{"id": id})
+		return ctx.Err()
+	}
+}
+
+// Notify sends a notification
+func (c *Conn) Notify(method string, params any) error {
+	return c.send(message{Method: method, Params: marshalParams(params)})
+}
+
+// Done is closed when the peer goes away
+func (c *Conn) Done() <-chan struct{} {
+	return c.done
+}
+
+// Err returns why the connection stopped, or nil while it is open
+func (c *Conn) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+func (c *Conn) forget(id int64) {
+	c.mu.Lock()
+	delete(c.pending, id)
+	c.mu.Unlock()
+}
+
+func (c *Conn) send(msg any) error {
+	switch m := msg.(type) {
+	case message:
+		m.JSONRPC = "2.0"
+		msg = m
+	case response:
+		m.JSONRPC = "2.0"
+		msg = m
+	}
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if _, err := fmt.Fprintf(c.w, "Content-Length: %d\r\n\r\n", len(body)); err != nil {
+		return err
+	}
+	_, err = c.w.Write(body)
+	return err
+}
+
+func (c *Conn) readLoop(r *bufio.Reader) {
+	var err error
+	for {
+		var msg *message
+		if msg, err = readMessage(r); err != nil {
+			break
+		}
+		switch {
+		case msg.Method != "" && msg.ID != nil:
+			c.answer(msg)
+		case msg.Method != "":
+			if c.handler != nil {
+				_, _ = c.handler(msg.Method, msg.Params)
+			}
+		case msg.ID != nil:
+			c.deliver(msg)
+		}
+	}
+
+	if errors.Is(err, io.EOF) {
+		err = ErrClosed
+	}
+	c.mu.Lock()
+	c.err = err
+	for id, ch := range c.pending {
+		close(ch)
+		delete(c.pending, id)
+	}
+	c.mu.Unlock()
+	close(c.done)
+}
+
+// answer runs the handler for a request from the peer and sends its response
+func (c *Conn) answer(msg *message) {
+	resp := response{ID: *msg.ID}
+	if c.handler == nil {
+		resp.Error = &ResponseError{Code: CodeMethodNotFound, Message: "method not found: " + msg.Method}
+	} else if result, err := c.handler(msg.Method, msg.Params); err != nil {
+		var respErr *ResponseError
+		if !errors.As(err, &respErr) {
+			respErr = &ResponseError{Code: CodeInternalError, Message: err.Error()}
+		}
+		resp.Error = respErr
+	} else {
+		resp.Result = result
+	}
+	_ = c.send(resp)
+}
+
+// deliver hands a response to the Call waiting for it
+func (c *Conn) deliver(msg *message) {
+	id, err := strconv.ParseInt(string(*msg.ID), 10, 64)
+	if err != nil {
+		return // not one of ours
+	}
+	c.mu.Lock()
+	ch, ok := c.pending[id]
+	delete(c.pending, id)
+	c.mu.Unlock()
+	if ok {
+		ch <- msg
+	}
+}
+
+// readMessage reads one framed message
+func readMessage(r *bufio.Reader) (*message, error) {
+	header, err := textproto.NewReader(r).ReadMIMEHeader()
+	if err != nil {
+		return nil, err
+	}
+	length, err := strconv.Atoi(strings.TrimSpace(header.Get("Content-Length")))
+	if err != nil || length < 0 {
+		return nil, fmt.Errorf("invalid Content-Length %q", header.Get("Content-Length"))
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, err
+	}
+	var msg message
+	if err := json.Unmarshal(body, &msg); err != nil {
+		return nil, fmt.Errorf("invalid message: %w", err)
+	}
+	return &msg, nil
+}
+
+func marshalParams(params any) json.RawMessage {
+	if params == nil {
+		return nil
+	}
+	if raw, ok := params.(json.RawMessage); ok {
+		return raw
+	}
+	data, err := json.Marshal(params)
+	if err != nil {
+		return nil
+	}
+	return data
+}
@@ -0,0 +1,272 @@
+// Package lsptest provides a fake language server, so the LSP client and
+// tools can be tested without a real one installed.
+//
+// The fake understands a tiny language: a line "def NAME" declares NAME,
+// any other whole-word NAME uses it, and "call NAME" with no declaration in
+// the same file is reported as an error. Hovering over "crash" makes the
+// server exit with status 3, for testing restarts.
+//
+// The server runs as the test binary itself: Server returns a config that
+// starts os.Args[0] with Flag, and the package's TestMain calls MainIfServer
+// first thing, which serves stdio and exits when it sees the flag.
+package lsptest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/kvit-s/kvit-coder/internal/config"
+	"github.com/kvit-s/kvit-coder/internal/lsp"
+)
+
+// Flag is the argument that turns a test binary into the fake server
+const Flag = "-lsptest.serve"
+
+// Server returns the config of a fake server for files with the given
+// extensions
+func Server(extensions ...string) config.LSPServerConfig {
+	return config.LSPServerConfig{
+		Name:       "fake",
+		Extensions: extensions,
+		Command:    os.Args[0],
+		Args:       []string{Flag},
+	}
+}
+
+// MainIfServer serves LSP on stdin and stdout and exits if the process was
+// started from a Server config; otherwise it returns
+func MainIfServer() {
+	for _, arg := range os.Args[1:] {
+		if arg == Flag {
+			if err := Serve(os.Stdin, os.Stdout); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			os.Exit(0)
+		}
+	}
+}
+
+var (
+	declRe = regexp.MustCompile(`^\s*def\s+(\w+)`)
+	callRe = regexp.MustCompile(`^\s*call\s+(\w+)`)
+)
+
+type server struct {
+	conn *lsp.Conn
+	exit chan struct{}
+
+	mu   sync.Mutex
+	docs map[string][]string // lines by URI
+}
+
+// Serve answers LSP requests on r and w until the client sends exit or
+// closes r
+func Serve(r io.Reader, w io.Writer) error {
+	s := &server{exit: make(chan struct{}), docs: make(map[string][]string)}
+	s.conn = lsp.NewConn(r, w, s.handle)
+	select {
+	case <-s.exit:
+		return nil
+	case <-s.conn.Done():
+		if err := s.conn.Err(); err != lsp.ErrClosed {
+			return err
+		}
+		return nil
+	}
+}
+
+type textDocumentPosition struct {
+	TextDocument struct {
+		URI string `json:"uri"`
+	} `json:"textDocument"`
+	Position lsp.Position `json:"position"`
+	Context  struct {
+		IncludeDeclaration bool `json:"includeDeclaration"`
+	} `json:"context"`
+}
+
+func (s *server) handle(method string, params json.RawMessage) (any, error) {
+	var p textDocumentPosition
+	_ = json.Unmarshal(params, &p)
+	uri := p.TextDocument.URI
+
+	switch method {
+	case "initialize":
+		return map[string]any{
+			"capabilities": map[string]any{
+				"textDocumentSync":       1,
+				"hoverProvider":          true,
+				"definitionProvider":     true,
+				"referencesProvider":     true,
+				"documentSymbolProvider": true,
+			},
+			"serverInfo": map[string]any{"name": "lsptest"},
+		}, nil
+	case "initialized", "shutdown":
+		return nil, nil
+	case "exit":
+		close(s.exit)
+		return nil, nil
+
+	case "textDocument/didOpen", "textDocument/didChange":
+		var doc struct {
+			TextDocument struct {
+				URI  string `json:"uri"`
+				Text string `json:"text"`
+			} `json:"textDocument"`
+			ContentChanges []struct {
+				Text string `json:"text"`
+			} `json:"contentChanges"`
+		}
+		if err := json.Unmarshal(params, &doc); err != nil {
+			return nil, err
+		}
+		text := doc.TextDocument.Text
+		if len(doc.ContentChanges) > 0 {
+			text = doc.ContentChanges[len(doc.ContentChanges)-1].Text
+		}
+		s.mu.Lock()
+		s.docs[doc.TextDocument.URI] = strings.Split(text, "\n")
+		s.mu.Unlock()
+		return nil, s.publish(doc.TextDocument.URI)
+
+	case "textDocument/hover":
+		word, _ := s.wordAt(uri, p.Position)
+		if word == "" {
+			return nil, nil
+		}
+		if word == "crash" {
+			fmt.Fprintln(os.Stderr, "lsptest: crashing on request")
+			os.Exit(3)
+		}
+		if decl := s.find(word, true); len(decl) > 0 {
+			return map[string]any{"contents": map[string]any{"kind": "markdown", "value": "```fake\ndef " + word + "\n```"}}, nil
+		}
+		return map[string]any{"contents": word}, nil
+
+	case "textDocument/definition":
+		word, _ := s.wordAt(uri, p.Position)
+		return s.find(word, true), nil
+
+	case "textDocument/references":
+		word, _ := s.wordAt(uri, p.Position)
+		refs := s.find(word, false)
+		if p.Context.IncludeDeclaration {
+			refs = append(s.find(word, true), refs...)
+		}
+		return refs, nil
+
+	case "textDocument/documentSymbol":
+		var symbols []map[string]any
+		for i, line := range s.lines(uri) {
+			if m := declRe.FindStringSubmatchIndex(line); m != nil {
+				symbols = append(symbols, map[string]any{
+					"name":           line[m[2]:m[3]],
+					"kind":           lsp.SymbolKind("function"),
+					"range":          lineRange(line, i, 0, len(line)),
+					"selectionRange": lineRange(line, i, m[2], m[3]),
+				})
+			}
+		}
+		return symbols, nil
+	}
+	return nil, &lsp.ResponseError{Code: lsp.CodeMethodNotFound, Message: "lsptest: unsupported method " + method}
+}
+
+// publish sends the diagnostics of a document: every call of a name the
+// document doesn't declare
+func (s *server) publish(uri string) error {
+	lines := s.lines(uri)
+	declared := make(map[string]bool)
+	for _, line := range lines {
+		if m := declRe.FindStringSubmatch(line); m != nil {
+			declared[m[1]] = true
+		}
+	}
+	diags := []lsp.Diagnostic{}
+	for i, line := range lines {
+		if m := callRe.FindStringSubmatchIndex(line); m != nil && !declared[line[m[2]:m[3]]] {
+			diags = append(diags, lsp.Diagnostic{
+				Range:    lineRange(line, i, m[2], m[3]),
+				Severity: lsp.SeverityError,
+				Source:   "lsptest",
+				Message:  "undefined: " + line[m[2]:m[3]],
+			})
+		}
+	}
+	return s.conn.Notify("textDocument/publishDiagnostics", map[string]any{"uri": uri, "diagnostics": diags})
+}
+
+func (s *server) lines(uri string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.docs[uri]
+}
+
+// wordAt returns the identifier at pos
+func (s *server) wordAt(uri string, pos lsp.Position) (string, bool) {
+	lines := s.lines(uri)
+	if pos.Line >= len(lines) {
+		return "", false
+	}
+	runes := []rune(lines[pos.Line])
+	col := lsp.RuneColumn(lines[pos.Line], pos.Character)
+	isWord := func(i int) bool {
+		return i >= 0 && i < len(runes) && (unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i]) || runes[i] == '_')
+	}
+	if !isWord(col) {
+		return "", false
+	}
+	start, end := col, col
+	for isWord(start - 1) {
+		start--
+	}
+	for isWord(end) {
+		end++
+	}
+	return string(runes[start:end]), true
+}
+
+// find returns the declarations of word, or its uses, in every open document
+func (s *server) find(word string, declarations bool) []lsp.Location {
+	locs := []lsp.Location{}
+	if word == "" {
+		return locs
+	}
+	wordRe := regexp.MustCompile(`\b` + regexp.QuoteMeta(word) + `\b`)
+	s.mu.Lock()
+	uris := make([]string, 0, len(s.docs))
+	for uri := range s.docs {
+		uris = append(uris, uri)
+	}
+	sort.Strings(uris)
+	for _, uri := range uris {
+		for i, line := range s.docs[uri] {
+			decl := declRe.FindStringSubmatchIndex(line)
+			for _, m := range wordRe.FindAllStringIndex(line, -1) {
+				isDecl := decl != nil && decl[2] == m[0]
+				if isDecl == declarations {
+					locs = append(locs, lsp.Location{URI: uri, Range: lineRange(line, i, m[0], m[1])})
+				}
+			}
+		}
+	}
+	s.mu.Unlock()
+	return locs
+}
+
+// lineRange converts byte offsets in line to an LSP range
+func lineRange(line string, lineNo, start, end int) lsp.Range {
+	return lsp.Range{
+		Start: lsp.Position{Line: lineNo, Character: lsp.UTF16Offset(line, len([]rune(line[:start])))},
+		End:   lsp.Position{Line: lineNo, Character: lsp.UTF16Offset(line, len([]rune(line[:end])))},
+	}
+}
@@ -0,0 +1,96 @@
+package lsp
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/kvit-s/kvit-coder/internal/config"
+)
+
+// Manager starts the configured language servers on first use and keeps
+// them running for the rest of the session, one per server config. A server
+// that crashed is started again on the next request.
+type Manager struct {
+	root    string
+	servers []config.LSPServerConfig
+
+	mu      sync.Mutex
+	clients map[int]*Client // by index in servers
+}
+
+// NewManager creates a manager for servers working on root
+func NewManager(root string, servers []config.LSPServerConfig) *Manager {
+	return &Manager{root: root, servers: servers, clients: make(map[int]*Client)}
+}
+
+// Server returns the index of the server configured for path's extension
+func (m *Manager) Server(path string) (int, bool) {
+	ext := strings.ToLower(filepath.Ext(path))
+	for i, s := range m.servers {
+		for _, e := range s.Extensions {
+			if strings.ToLower("."+strings.TrimPrefix(e, ".")) == ext {
+				return i, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// Extensions returns every extension a server is configured for
+func (m *Manager) Extensions() []string {
+	var exts []string
+	for _, s := range m.servers {
+		for _, e := range s.Extensions {
+			exts = append(exts, "."+strings.TrimPrefix(e, "."))
+		}
+	}
+	return exts
+}
+
+// Client returns the running server for path, starting it if needed
+func (m *Manager) Client(ctx context.Context, path string) (*Client, error) {
+	i, ok := m.Server(path)
+	if !ok {
+		return nil, fmt.Errorf("no language server configured for %s files", extOrName(path))
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if c, ok := m.clients[i]; ok && c.Alive() {
+		return c, nil
+	}
+	c, err := Start(ctx, m.servers[i], m.root)
+	if err != nil {
+		return nil, err
+	}
+	m.clients[i] = c
+	return c, nil
+}
+
+// Shutdown stops every running server
+func (m *Manager) Shutdown(ctx context.Context) {
+	m.mu.Lock()
+	clients := m.clients
+	m.clients = make(map[int]*Client)
+	m.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, c := range clients {
+		wg.Add(1)
+		go func(c *Client) {
+			defer wg.Done()
+			_ = c.Shutdown(ctx)
+		}(c)
+	}
+	wg.Wait()
+}
+
+func extOrName(path string) string {
+	if ext := filepath.Ext(path); ext != "" {
+		return ext
+	}
+	return filepath.Base(path)
+}
@@ -0,0 +1,230 @@
+package lsp
+
+import (
+	"encoding/json"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// Position is a zero-based line and UTF-16 character offset
+type Position struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+// Range is a span between two positions, end exclusive
+type Range struct {
+	Start Position `json:"start"`
+	End   Position `json:"end"`
+}
+
+// Location is a range in a document
+type Location struct {
+	URI   string `json:"uri"`
+	Range Range  `json:"range"`
+}
+
+// Path returns the file path of the location's document
+func (l Location) Path() string {
+	return URIToPath(l.URI)
+}
+
+// Diagnostic severities
+const (
+	SeverityError       = 1
+	SeverityWarning     = 2
+	SeverityInformation = 3
+	SeverityHint        = 4
+)
+
+// Diagnostic is an error or warning a server reports for a document
+type Diagnostic struct {
+	Range    Range           `json:"range"`
+	Severity int             `json:"severity,omitempty"`
+	Code     json.RawMessage `json:"code,omitempty"`
+	Source   string          `json:"source,omitempty"`
+	Message  string          `json:"message"`
+}
+
+// SeverityName returns the severity as a word, "error" when the server left
+// it out
+func (d Diagnostic) SeverityName() string {
+	switch d.Severity {
+	case SeverityWarning:
+		return "warning"
+	case SeverityInformation:
+		return "information"
+	case SeverityHint:
+		return "hint"
+	default:
+		return "error"
+	}
+}
+
+// Symbol is a declaration in a document. Servers answer documentSymbol
+// either with a tree or with a flat list; both end up as Symbols, the flat
+// list without children and with Container set.
+type Symbol struct {
+	Name      string
+	Detail    string
+	Kind      string
+	Range     Range
+	Container string
+	Children  []Symbol
+}
+
+// documentSymbol decodes both kinds of documentSymbol answer: a
+// DocumentSymbol has selectionRange and children, a SymbolInformation has
+// location and containerName instead
+type documentSymbol struct {
+	Name           string           `json:"name"`
+	Detail         string           `json:"detail,omitempty"`
+	Kind           int              `json:"kind"`
+	Range          Range            `json:"range"`
+	SelectionRange *Range           `json:"selectionRange,omitempty"`
+	Location       *Location        `json:"location,omitempty"`
+	ContainerName  string           `json:"containerName,omitempty"`
+	Children       []documentSymbol `json:"children,omitempty"`
+}
+
+func (s documentSymbol) symbol() Symbol {
+	sym := Symbol{Name: s.Name, Detail: s.Detail, Kind: SymbolKindName(s.Kind), Range: s.Range, Container: s.ContainerName}
+	if s.Location != nil {
+		sym.Range = s.Location.Range
+	}
+	for _, child := range s.Children {
+		sym.Children = append(sym.Children, child.symbol())
+	}
+	return sym
+}
+
+var symbolKinds = []string{
+	"file", "module", "namespace", "package", "class", "method", "property",
+	"field", "constructor", "enum", "interface", "function", "variable",
+	"constant", "string", "number", "boolean", "array", "object", "key",
+	"null", "enum member", "struct", "event", "operator", "type parameter",
+}
+
+// SymbolKindName returns the name of an LSP SymbolKind
+func SymbolKindName(kind int) string {
+	if kind < 1 || kind > len(symbolKinds) {
+		return "symbol"
+	}
+	return symbolKinds[kind-1]
+}
+
+// SymbolKind returns the LSP SymbolKind with the given name, 0 if unknown
+func SymbolKind(name string) int {
+	for i, k := range symbolKinds {
+		if k == name {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// locations decodes a definition or references answer: null, a Location,
+// a list of Locations or a list of LocationLinks
+func locations(raw json.RawMessage) ([]Location, error) {
+	raw = json.RawMessage(strings.TrimSpace(string(raw)))
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil
+	}
+	if raw[0] != '[' {
+		var loc Location
+		if err := json.Unmarshal(raw, &loc); err != nil {
+			return nil, err
+		}
+		return []Location{loc}, nil
+	}
+	var items []struct {
+		Location
+		TargetURI   string `json:"targetUri"`
+		TargetRange *Range `json:"targetRange"`
+	}
+	if err := json.Unmarshal(raw, &items); err != nil {
+		return nil, err
+	}
+	locs := make([]Location, len(items))
+	for i, item := range items {
+		locs[i] = item.Location
+		if item.TargetURI != "" && item.TargetRange != nil {
+			locs[i] = Location{URI: item.TargetURI, Range: *item.TargetRange}
+		}
+	}
+	return locs, nil
+}
+
+// hoverText flattens the contents of a hover answer: a string, a
+// MarkedString, a list of them, or MarkupContent
+func hoverText(raw json.RawMessage) string {
+	var s string
+	if json.Unmarshal(raw, &s) == nil {
+		return s
+	}
+	var list []json.RawMessage
+	if json.Unmarshal(raw, &list) == nil {
+		parts := make([]string, 0, len(list))
+		for _, item := range list {
+			if text := hoverText(item); text != "" {
+				parts = append(parts, text)
+			}
+		}
+		return strings.Join(parts, "\n\n")
+	}
+	var marked struct {
+		Language string `json:"language"`
+		Value    string `json:"value"`
+		Kind     string `json:"kind"`
+	}
+	if json.Unmarshal(raw, &marked) == nil {
+		if marked.Language != "" {
+			return "```" + marked.Language + "\n" + marked.Value + "\n```"
+		}
+		return marked.Value
+	}
+	return ""
+}
+
+// PathToURI returns the file URI of an absolute path
+func PathToURI(path string) string {
+	return (&url.URL{Scheme: "file", Path: filepath.ToSlash(path)}).String()
+}
+
+// URIToPath returns the path of a file URI, or the URI itself when it is
+// not one
+func URIToPath(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "file" {
+		return uri
+	}
+	return filepath.FromSlash(u.Path)
+}
+
+// UTF16Offset converts a zero-based rune column of line to the UTF-16
+// offset LSP positions use
+func UTF16Offset(line string, column int) int {
+	offset := 0
+	for i, r := range []rune(line) {
+		if i >= column {
+			break
+		}
+		offset += utf16.RuneLen(r)
+	}
+	return offset
+}
+
+// RuneColumn converts a UTF-16 offset in line back to a zero-based rune column
+func RuneColumn(line string, offset int) int {
+	column, units := 0, 0
+	for len(line) > 0 && units < offset {
+		r, size := utf8.DecodeRuneInString(line)
+		line = line[size:]
+		units += utf16.RuneLen(r)
+		column++
+	}
+	return column
+}
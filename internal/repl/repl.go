@@ -14,8 +14,11 @@ import (
 	"github.com/kvit-s/kvit-coder/internal/ui"
 )
 
-// RunExec runs in exec mode with a single prompt
-func RunExec(runner *agent.Runner, writer *ui.Writer, cfg *config.Config, systemPrompt string, promptText string, quietMode bool, sessionName string, sessionMgr *session.Manager) {
+// RunExec runs in exec mode with a single prompt and returns why the run ended.
+// With stream set, the run is also written to it as JSON lines, closed by a
+// result record. With resume set, the saved run continues instead, and
+// promptText is ignored.
+func RunExec(runner *agent.Runner, writer *ui.Writer, cfg *config.Config, systemPrompt string, promptText string, quietMode bool, sessionName string, sessionMgr *session.Manager, stream *ui.StreamJSONSink, resume *session.RunState) agent.StopReason {
 	messages := []llm.Message{
 		{Role: llm.RoleSystem, Content: systemPrompt},
 	}
@@ -23,7 +26,12 @@ func RunExec(runner *agent.Runner, writer *ui.Writer, cfg *config.Config, system
 	// Determine session name (auto-generate if exec mode without -s)
 	isNewSession := true
 	if sessionMgr != nil {
-		if sessionName == "" {
+		if resume != nil {
+			isNewSession = false
+			if !quietMode {
+				fmt.Fprintf(os.Stderr, "Resuming session: %s (step %d, %d messages)\n\n", sessionName, resume.Iteration+1, len(resume.Messages))
+			}
+		} else if sessionName == "" {
 			// Auto-generate session name for exec mode
 			sessionName = sessionMgr.GenerateSessionName()
 		} else if sessionMgr.SessionExists(sessionName) {
@@ -42,6 +50,9 @@ func RunExec(runner *agent.Runner, writer *ui.Writer, cfg *config.Config, system
 				if !quietMode {
 					fmt.Fprintf(os.Stderr, "Continuing session: %s (%d messages)\n\n", sessionName, len(sessionMessages))
 				}
+				if state, _ := sessionMgr.LoadState(sessionName); state != nil {
+					writer.Warn(fmt.Sprintf("Session %s has an unfinished run; it is dropped (use --resume to continue it instead)", sessionName))
+				}
 			}
 		} else {
 			if !quietMode {
@@ -50,8 +61,12 @@ func RunExec(runner *agent.Runner, writer *ui.Writer, cfg *config.Config, system
 		}
 	}
 
-	// Display the prompt (unless in quiet mode)
-	if !quietMode {
+	if stream != nil {
+		stream.Start(sessionName, cfg.LLM.Model)
+	}
+
+	// Display the prompt (unless in quiet mode or resuming)
+	if !quietMode && resume == nil {
 		colorStart := "\033[97;100m"
 		colorEnd := "\033[0m"
 		inputLines := strings.Split(promptText, "\n")
@@ -61,22 +76,52 @@ func RunExec(runner *agent.Runner, writer *ui.Writer, cfg *config.Config, system
 		fmt.Fprintln(os.Stderr)
 	}
 
-	// Add user message
-	userMsg := llm.Message{
-		Role:    llm.RoleUser,
-		Content: promptText,
+	if resume != nil {
+		// The saved history continues with the current system prompt
+		if len(resume.Messages) > 0 && resume.Messages[0].Role == llm.RoleSystem {
+			resume.Messages[0].Content = systemPrompt
+		}
+	} else {
+		// Add user message
+		userMsg := llm.Message{
+			Role:    llm.RoleUser,
+			Content: promptText,
+		}
+		messages = append(messages, userMsg)
+	}
+
+	// Save the run as it goes, so it can be resumed if the process dies
+	var saveState func(*session.RunState) error
+	if sessionMgr != nil && sessionName != "" {
+		saveState = func(state *session.RunState) error {
+			if err := sessionMgr.SaveSession(sessionName, state.Messages); err != nil {
+				return err
+			}
+			return sessionMgr.SaveState(sessionName, state)
+		}
 	}
-	messages = append(messages, userMsg)
 
 	// Run agent loop
 	result, err := runner.Run(context.Background(), agent.RunConfig{
 		Messages:     messages,
 		UseFileFirst: false,
 		QuietMode:    quietMode,
+		SaveState:    saveState,
+		Resume:       resume,
 	})
 	if err != nil {
 		writer.Error(fmt.Sprintf("Agent error: %v", err))
-		return
+		if saveState != nil {
+			fmt.Fprintf(os.Stderr, "Resume with: kvit-coder -s %s --resume\n", sessionName)
+		}
+		reason := agent.StopError
+		if result != nil && result.StopReason != "" {
+			reason = result.StopReason
+		}
+		if stream != nil {
+			stream.Result(&ui.JSONStats{Session: sessionName, StopReason: string(reason)}, err)
+		}
+		return reason
 	}
 
 	// Save session
@@ -84,21 +129,39 @@ func RunExec(runner *agent.Runner, writer *ui.Writer, cfg *config.Config, system
 		if err := sessionMgr.SaveSession(sessionName, result.FinalMessages); err != nil {
 			writer.Error(fmt.Sprintf("Failed to save session: %v", err))
 		}
+		// Keep the original messages of compacted turns for --session-show
+		if err := sessionMgr.AppendCompactions(sessionName, result.Compactions); err != nil {
+			writer.Error(fmt.Sprintf("Failed to save session compactions: %v", err))
+		}
+		// The run is over; there is nothing left to resume
+		if err := sessionMgr.ClearState(sessionName); err != nil {
+			writer.Error(fmt.Sprintf("Failed to clear run state: %v", err))
+		}
 	}
 
 	// Output JSON or print stats
 	if writer.IsJSONMode() {
-		writer.WriteJSONOutput(&ui.JSONStats{
+		stats := &ui.JSONStats{
 			Session:          sessionName,
 			PromptTokens:     result.Stats.TotalPromptTokens,
 			CompletionTokens: result.Stats.TotalCompletionTokens,
 			TotalTokens:      result.Stats.TotalPromptTokens + result.Stats.TotalCompletionTokens,
 			CacheReadTokens:  result.Stats.TotalCacheReadTokens,
+			CacheWriteTokens: result.Stats.TotalCacheWriteTokens,
 			TotalCost:        result.Stats.TotalCost,
 			CacheDiscount:    result.Stats.CacheDiscount,
 			DurationMs:       result.Stats.TotalAgentTime.Milliseconds(),
 			Steps:            result.Stats.Steps,
-		})
+			Truncations:      result.Stats.TruncationCount,
+			Continuations:    result.Stats.ContinuationCount,
+			StopReason:       string(result.StopReason),
+			Verify:           result.Stats.VerifyJSON(),
+		}
+		if stream != nil {
+			stream.Result(stats, nil)
+		} else {
+			writer.WriteJSONOutput(stats)
+		}
 	} else {
 		// Print stats to stderr
 		result.Stats.PrintTo(os.Stderr)
@@ -120,4 +183,5 @@ func RunExec(runner *agent.Runner, writer *ui.Writer, cfg *config.Config, system
 			fmt.Fprintf(os.Stderr, "Continue with: kvit-coder -p \"your message\" -s %s\n", sessionName)
 		}
 	}
+	return result.StopReason
 }
@@ -0,0 +1,88 @@
+package session
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/kvit-s/kvit-coder/internal/llm"
+)
+
+// SummaryPrefix starts the message that replaces compacted turns in the history
+const SummaryPrefix = "[Summary of earlier conversation, compacted to fit the context window]"
+
+// compactionsSuffix names the sidecar file that keeps the original messages of compacted turns
+const compactionsSuffix = ".compactions.jsonl"
+
+// Compaction records older turns that were replaced by a summary
+type Compaction struct {
+	Time         time.Time     `json:"time"`
+	Summary      string        `json:"summary"`
+	Replaced     []llm.Message `json:"replaced"`
+	TokensBefore int           `json:"tokens_before"`
+	TokensAfter  int           `json:"tokens_after"`
+}
+
+// AppendCompactions appends compaction records to the session's sidecar file.
+func (m *Manager) AppendCompactions(name string, compactions []Compaction) error {
+	if len(compactions) == 0 {
+		return nil
+	}
+	file, err := os.OpenFile(m.compactionsPath(name), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open compactions file: %w", err)
+	}
+	defer file.Close()
+
+	for _, c := range compactions {
+		data, err := json.Marshal(c)
+		if err != nil {
+			return fmt.Errorf("failed to marshal compaction: %w", err)
+		}
+		if _, err := file.Write(append(data, '\n')); err != nil {
+			return fmt.Errorf("failed to write compaction: %w", err)
+		}
+	}
+	return nil
+}
+
+// LoadCompactions loads the compaction records of a session, oldest first.
+// A session that was never compacted has none.
+func (m *Manager) LoadCompactions(name string) ([]Compaction, error) {
+	file, err := os.Open(m.compactionsPath(name))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to open compactions file: %w", err)
+	}
+	defer file.Close()
+
+	var compactions []Compaction
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		var c Compaction
+		if err := json.Unmarshal([]byte(line), &c); err != nil {
+			return nil, fmt.Errorf("failed to parse compaction: %w", err)
+		}
+		compactions = append(compactions, c)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read compactions file: %w", err)
+	}
+	return compactions, nil
+}
+
+// compactionsPath returns the path to a session's compactions file.
+func (m *Manager) compactionsPath(name string) string {
+	return filepath.Join(m.baseDir, name+compactionsSuffix)
+}
@@ -16,6 +16,19 @@ import (
 	"github.com/kvit-s/kvit-coder/internal/llm"
 )
 
+// storedMessage is a line of a session file: a message and, for assistant
+// messages, the usage of the response it came from
+type storedMessage struct {
+	llm.Message
+	Usage *llm.MessageUsage `json:"usage,omitempty"`
+}
+
+func (s storedMessage) message() llm.Message {
+	msg := s.Message
+	msg.Usage = s.Usage
+	return msg
+}
+
 // Manager handles session storage and retrieval.
 type Manager struct {
 	baseDir string // ~/.kvit-coder/sessions/
@@ -71,11 +84,11 @@ func (m *Manager) LoadSession(name string) ([]llm.Message, error) {
 			continue
 		}
 
-		var msg llm.Message
-		if err := json.Unmarshal([]byte(line), &msg); err != nil {
+		var stored storedMessage
+		if err := json.Unmarshal([]byte(line), &stored); err != nil {
 			return nil, fmt.Errorf("failed to parse message: %w", err)
 		}
-		messages = append(messages, msg)
+		messages = append(messages, stored.message())
 	}
 
 	if err := scanner.Err(); err != nil {
@@ -95,7 +108,7 @@ func (m *Manager) SaveSession(name string, messages []llm.Message) error {
 	defer file.Close()
 
 	for _, msg := range messages {
-		data, err := json.Marshal(msg)
+		data, err := json.Marshal(storedMessage{msg, msg.Usage})
 		if err != nil {
 			return fmt.Errorf("failed to marshal message: %w", err)
 		}
@@ -117,7 +130,7 @@ func (m *Manager) AppendToSession(name string, messages []llm.Message) error {
 	defer file.Close()
 
 	for _, msg := range messages {
-		data, err := json.Marshal(msg)
+		data, err := json.Marshal(storedMessage{msg, msg.Usage})
 		if err != nil {
 			return fmt.Errorf("failed to marshal message: %w", err)
 		}
@@ -154,7 +167,7 @@ func (m *Manager) ListSessions() ([]SessionInfo, error) {
 
 	var sessions []SessionInfo
 	for _, entry := range entries {
-		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".jsonl") {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".jsonl") || strings.HasSuffix(entry.Name(), compactionsSuffix) {
 			continue
 		}
 
@@ -192,7 +205,10 @@ func (m *Manager) DeleteSession(name string) error {
 	if err := os.Remove(path); err != nil {
 		return fmt.Errorf("failed to delete session: %w", err)
 	}
-	return nil
+	if err := os.Remove(m.compactionsPath(name)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to delete session compactions: %w", err)
+	}
+	return m.ClearState(name)
 }
 
 // ShowSession returns the formatted content of a session for display.
@@ -202,38 +218,63 @@ func (m *Manager) ShowSession(name string) (string, error) {
 		return "", err
 	}
 
+	compactions, err := m.LoadCompactions(name)
+	if err != nil {
+		return "", err
+	}
+
 	var sb strings.Builder
 	sb.WriteString(fmt.Sprintf("Session: %s (%d messages)\n", name, len(messages)))
 	sb.WriteString(strings.Repeat("─", 50) + "\n\n")
 
 	for _, msg := range messages {
-		switch msg.Role {
-		case llm.RoleSystem:
-			sb.WriteString("[system] (omitted)\n\n")
-		case llm.RoleUser:
-			content := msg.Content
-			if len(content) > 500 {
-				content = content[:497] + "..."
-			}
-			sb.WriteString(fmt.Sprintf("[user]\n%s\n\n", content))
-		case llm.RoleAssistant:
-			content := msg.Content
-			if len(content) > 500 {
-				content = content[:497] + "..."
-			}
-			sb.WriteString(fmt.Sprintf("[assistant]\n%s", content))
-			if len(msg.ToolCalls) > 0 {
-				sb.WriteString(fmt.Sprintf(" (+ %d tool calls)", len(msg.ToolCalls)))
-			}
-			sb.WriteString("\n\n")
-		case llm.RoleTool:
-			sb.WriteString(fmt.Sprintf("[tool: %s] (result omitted)\n\n", msg.Name))
+		writeMessage(&sb, msg)
+	}
+
+	// Compacted turns: the summaries above replaced these original messages
+	for i, c := range compactions {
+		sb.WriteString(strings.Repeat("─", 50) + "\n")
+		sb.WriteString(fmt.Sprintf("Compaction %d/%d at %s: %d messages summarized (~%d -> ~%d tokens)\n\n",
+			i+1, len(compactions), c.Time.Format("2006-01-02 15:04:05"), len(c.Replaced), c.TokensBefore, c.TokensAfter))
+		for _, msg := range c.Replaced {
+			writeMessage(&sb, msg)
 		}
 	}
 
 	return sb.String(), nil
 }
 
+// writeMessage formats one message for ShowSession.
+func writeMessage(sb *strings.Builder, msg llm.Message) {
+	switch msg.Role {
+	case llm.RoleSystem:
+		sb.WriteString("[system] (omitted)\n\n")
+	case llm.RoleUser:
+		label := "user"
+		content := msg.Content
+		if strings.HasPrefix(content, SummaryPrefix) {
+			// Summaries are shown in full: they are all that is left of the compacted turns
+			label = "summary"
+			content = strings.TrimSpace(strings.TrimPrefix(content, SummaryPrefix))
+		} else if len(content) > 500 {
+			content = content[:497] + "..."
+		}
+		sb.WriteString(fmt.Sprintf("[%s]\n%s\n\n", label, content))
+	case llm.RoleAssistant:
+		content := msg.Content
+		if len(content) > 500 {
+			content = content[:497] + "..."
+		}
+		sb.WriteString(fmt.Sprintf("[assistant]\n%s", content))
+		if len(msg.ToolCalls) > 0 {
+			sb.WriteString(fmt.Sprintf(" (+ %d tool calls)", len(msg.ToolCalls)))
+		}
+		sb.WriteString("\n\n")
+	case llm.RoleTool:
+		sb.WriteString(fmt.Sprintf("[tool: %s] (result omitted)\n\n", msg.Name))
+	}
+}
+
 // AcquireLock attempts to acquire an exclusive lock on a session.
 // Returns a cleanup function that releases the lock, or an error if lock fails.
 func (m *Manager) AcquireLock(name string) (func(), error) {
@@ -274,3 +315,9 @@ func (m *Manager) sessionPath(name string) string {
 func (m *Manager) lockPath(name string) string {
 	return filepath.Join(m.baseDir, "."+name+".lock")
 }
+
+// ControlPath returns the path to the control socket of a session's running
+// agent, next to its lock file.
+func (m *Manager) ControlPath(name string) string {
+	return filepath.Join(m.baseDir, "."+name+".sock")
+}
@@ -1,6 +1,7 @@
 package session
 
 import (
+	"encoding/json"
 	"os"
 	"path/filepath"
 	"strings"
@@ -8,6 +9,7 @@ import (
 	"time"
 
 	"github.com/kvit-s/kvit-coder/internal/llm"
+	"github.com/kvit-s/kvit-coder/internal/tools"
 )
 
 func TestNewManager(t *testing.T) {
@@ -156,6 +158,42 @@ func TestSaveSessionWithToolCalls(t *testing.T) {
 	}
 }
 
+func TestSessionKeepsUsage(t *testing.T) {
+	mgr := setupTestManager(t)
+	usage := &llm.MessageUsage{PromptTokens: 1200, CompletionTokens: 40, CacheReadTokens: 1000, Cost: 0.002}
+	messages := []llm.Message{
+		{Role: llm.RoleUser, Content: "hi"},
+		{Role: llm.RoleAssistant, Content: "hello", Usage: usage},
+	}
+	if err := mgr.SaveSession("usage", messages); err != nil {
+		t.Fatalf("SaveSession failed: %v", err)
+	}
+	loaded, err := mgr.LoadSession("usage")
+	if err != nil {
+		t.Fatalf("LoadSession failed: %v", err)
+	}
+	if loaded[0].Usage != nil || loaded[1].Usage == nil || *loaded[1].Usage != *usage {
+		t.Errorf("usage = %v, %v; want none, then %v", loaded[0].Usage, loaded[1].Usage, *usage)
+	}
+
+	// The run state keeps it too, so a resumed run saves it again
+	if err := mgr.SaveState("usage", &RunState{Messages: messages}); err != nil {
+		t.Fatalf("SaveState failed: %v", err)
+	}
+	state, err := mgr.LoadState("usage")
+	if err != nil {
+		t.Fatalf("LoadState failed: %v", err)
+	}
+	if len(state.Messages) != 2 || state.Messages[1].Usage == nil || *state.Messages[1].Usage != *usage {
+		t.Errorf("state messages = %+v, want the usage kept", state.Messages)
+	}
+
+	// Usage is never sent to the server
+	if data, _ := json.Marshal(messages[1]); strings.Contains(string(data), "usage") {
+		t.Errorf("message JSON = %s, want no usage", data)
+	}
+}
+
 func TestAppendToSession(t *testing.T) {
 	mgr := setupTestManager(t)
 
@@ -394,3 +432,103 @@ func setupTestManager(t *testing.T) *Manager {
 
 	return &Manager{baseDir: tempDir}
 }
+
+func TestCompactionsSidecar(t *testing.T) {
+	mgr := setupTestManager(t)
+
+	messages := []llm.Message{
+		{Role: llm.RoleSystem, Content: "system"},
+		{Role: llm.RoleUser, Content: SummaryPrefix + "\nEdited main.go; tests still failing."},
+		{Role: llm.RoleAssistant, Content: "Running the tests again"},
+	}
+	if err := mgr.SaveSession("compacted", messages); err != nil {
+		t.Fatalf("SaveSession failed: %v", err)
+	}
+
+	if got, err := mgr.LoadCompactions("compacted"); err != nil || got != nil {
+		t.Errorf("LoadCompactions before any compaction = %v, %v; want none", got, err)
+	}
+
+	compaction := Compaction{
+		Time:    time.Now(),
+		Summary: "Edited main.go; tests still failing.",
+		Replaced: []llm.Message{
+			{Role: llm.RoleUser, Content: "fix the tests"},
+			{Role: llm.RoleTool, Name: "Edit", Content: "ok"},
+		},
+		TokensBefore: 9000,
+		TokensAfter:  1200,
+	}
+	if err := mgr.AppendCompactions("compacted", []Compaction{compaction}); err != nil {
+		t.Fatalf("AppendCompactions failed: %v", err)
+	}
+
+	loaded, err := mgr.LoadCompactions("compacted")
+	if err != nil || len(loaded) != 1 || len(loaded[0].Replaced) != 2 {
+		t.Fatalf("LoadCompactions = %+v, %v; want one compaction with 2 messages", loaded, err)
+	}
+
+	output, err := mgr.ShowSession("compacted")
+	if err != nil {
+		t.Fatalf("ShowSession failed: %v", err)
+	}
+	for _, want := range []string{"[summary]\nEdited main.go", "2 messages summarized (~9000 -> ~1200 tokens)", "fix the tests", "[tool: Edit]"} {
+		if !strings.Contains(output, want) {
+			t.Errorf("ShowSession output missing %q:\n%s", want, output)
+		}
+	}
+
+	// The sidecar is not a session of its own and is deleted with the session
+	sessions, _ := mgr.ListSessions()
+	if len(sessions) != 1 {
+		t.Errorf("ListSessions returned %d sessions, want 1", len(sessions))
+	}
+	if err := mgr.DeleteSession("compacted"); err != nil {
+		t.Fatalf("DeleteSession failed: %v", err)
+	}
+	if _, err := os.Stat(mgr.compactionsPath("compacted")); !os.IsNotExist(err) {
+		t.Error("compactions file should be deleted with the session")
+	}
+}
+
+func TestRunState(t *testing.T) {
+	mgr := setupTestManager(t)
+
+	if state, err := mgr.LoadState("run"); err != nil || state != nil {
+		t.Errorf("LoadState before any save = %v, %v; want nil", state, err)
+	}
+
+	state := &RunState{
+		Messages:       []llm.Message{{Role: llm.RoleUser, Content: "fix the tests"}},
+		Iteration:      3,
+		Elapsed:        90 * time.Second,
+		CheckpointTurn: 2,
+	}
+	state.Stats.TotalCost = 0.25
+	state.Pending.Write = &tools.SavedWrite{Path: "main.go", Content: "package main"}
+	if err := mgr.SaveSession("run", state.Messages); err != nil {
+		t.Fatalf("SaveSession failed: %v", err)
+	}
+	if err := mgr.SaveState("run", state); err != nil {
+		t.Fatalf("SaveState failed: %v", err)
+	}
+
+	loaded, err := mgr.LoadState("run")
+	if err != nil {
+		t.Fatalf("LoadState failed: %v", err)
+	}
+	if loaded.Iteration != 3 || loaded.Elapsed != 90*time.Second || loaded.Stats.TotalCost != 0.25 ||
+		loaded.CheckpointTurn != 2 || len(loaded.Messages) != 1 || loaded.Pending.Write == nil {
+		t.Errorf("LoadState = %+v, want the saved state", loaded)
+	}
+
+	if err := mgr.DeleteSession("run"); err != nil {
+		t.Fatalf("DeleteSession failed: %v", err)
+	}
+	if state, err := mgr.LoadState("run"); err != nil || state != nil {
+		t.Errorf("LoadState after DeleteSession = %v, %v; want nil", state, err)
+	}
+	if entries, _ := os.ReadDir(mgr.baseDir); len(entries) != 0 {
+		t.Errorf("files left after DeleteSession: %v", entries)
+	}
+}
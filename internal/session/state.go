@@ -0,0 +1,121 @@
+package session
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/kvit-s/kvit-coder/internal/llm"
+	"github.com/kvit-s/kvit-coder/internal/stats"
+	"github.com/kvit-s/kvit-coder/internal/tools"
+)
+
+// stateSuffix names the file that holds the progress of a run while it goes on
+const stateSuffix = ".state.json"
+
+// RunState is the progress of a run, saved after every tool round so that a
+// run killed midway can resume where it stopped
+type RunState struct {
+	Messages  []llm.Message    `json:"messages"`
+	Iteration int              `json:"iteration"` // Next iteration of the agent loop
+	Stats     stats.AgentStats `json:"stats"`     // Tokens, cost and time used so far
+	Elapsed   time.Duration    `json:"elapsed_ns"`
+
+	LoopInterventions int                `json:"loop_interventions,omitempty"`
+	VerifyRounds      int                `json:"verify_rounds,omitempty"` // Failed verifications sent back so far
+	Pending           tools.PendingState `json:"pending"`                 // Edit or write waiting for confirmation
+	Compactions       []Compaction       `json:"compactions,omitempty"`   // Not yet written to the sidecar file
+
+	CheckpointSession string `json:"checkpoint_session,omitempty"` // Shadow repository of the checkpoints
+	CheckpointTurn    int    `json:"checkpoint_turn,omitempty"`
+
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// MarshalJSON keeps the usage of the messages, as session files do
+func (s RunState) MarshalJSON() ([]byte, error) {
+	type plain RunState
+	stored := make([]storedMessage, len(s.Messages))
+	for i, msg := range s.Messages {
+		stored[i] = storedMessage{msg, msg.Usage}
+	}
+	return json.Marshal(struct {
+		plain
+		Messages []storedMessage `json:"messages"`
+	}{plain(s), stored})
+}
+
+// UnmarshalJSON reads what MarshalJSON writes
+func (s *RunState) UnmarshalJSON(data []byte) error {
+	type plain RunState
+	var v struct {
+		plain
+		Messages []storedMessage `json:"messages"`
+	}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	*s = RunState(v.plain)
+	for _, stored := range v.Messages {
+		s.Messages = append(s.Messages, stored.message())
+	}
+	return nil
+}
+
+// SaveState replaces the run state of a session. The file is written in full
+// before it takes the place of the old one, so a crash leaves either.
+func (m *Manager) SaveState(name string, state *RunState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("failed to marshal run state: %w", err)
+	}
+	path := m.statePath(name)
+	tmp, err := os.CreateTemp(m.baseDir, filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to create run state file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write run state: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write run state: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to replace run state: %w", err)
+	}
+	return nil
+}
+
+// LoadState loads the run state of a session, or nil when no run was left
+// unfinished
+func (m *Manager) LoadState(name string) (*RunState, error) {
+	data, err := os.ReadFile(m.statePath(name))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read run state: %w", err)
+	}
+	var state RunState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("failed to parse run state: %w", err)
+	}
+	return &state, nil
+}
+
+// ClearState removes the run state of a session once its run has finished
+func (m *Manager) ClearState(name string) error {
+	if err := os.Remove(m.statePath(name)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove run state: %w", err)
+	}
+	return nil
+}
+
+// statePath returns the path to a session's run state file.
+func (m *Manager) statePath(name string) string {
+	return filepath.Join(m.baseDir, name+stateSuffix)
+}
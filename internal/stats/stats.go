@@ -14,6 +14,7 @@ type AgentStats struct {
 	TotalPromptTokens     int
 	TotalCompletionTokens int
 	TotalCacheReadTokens  int
+	TotalCacheWriteTokens int
 	TotalAgentTime        time.Duration
 	TotalLLMTime          time.Duration
 	TotalToolTime         time.Duration
@@ -31,6 +32,18 @@ type AgentStats struct {
 	DiscardedCompletionTokens int
 	DiscardedCost             float64
 	BacktrackCount            int
+
+	// Number of times older turns were summarized to free context
+	CompactionCount int
+
+	// Responses cut off at the output token limit, and the extra requests made to complete them
+	TruncationCount   int
+	ContinuationCount int
+
+	// Runs of agent.verify_command on final answers
+	VerifyRuns     int
+	VerifyFailures int
+	VerifyPassed   bool // Outcome of the last run
 }
 
 // AgentStatsJSON is the JSON output format for agent stats
@@ -39,6 +52,7 @@ type AgentStatsJSON struct {
 		Prompt     int `json:"prompt"`
 		Completion int `json:"completion"`
 		CacheRead  int `json:"cache_read"`
+		CacheWrite int `json:"cache_write,omitempty"`
 	} `json:"tokens"`
 	Timing struct {
 		TotalAgentSeconds float64 `json:"total_agent_seconds"`
@@ -59,6 +73,17 @@ type AgentStatsJSON struct {
 		DiscardedCostUSD          float64 `json:"discarded_cost_usd,omitempty"`
 		BacktrackCount            int     `json:"backtrack_count,omitempty"`
 	} `json:"backtrack,omitempty"`
+	Compactions   int         `json:"compactions,omitempty"`
+	Truncations   int         `json:"truncations,omitempty"`
+	Continuations int         `json:"continuations,omitempty"`
+	Verify        *VerifyJSON `json:"verify,omitempty"`
+}
+
+// VerifyJSON reports the runs of the verification command
+type VerifyJSON struct {
+	Runs     int  `json:"runs"`
+	Failures int  `json:"failures"`
+	Passed   bool `json:"passed"` // Outcome of the last run
 }
 
 // ToJSON converts AgentStats to its JSON representation
@@ -67,6 +92,7 @@ func (s *AgentStats) ToJSON() AgentStatsJSON {
 	j.Tokens.Prompt = s.TotalPromptTokens
 	j.Tokens.Completion = s.TotalCompletionTokens
 	j.Tokens.CacheRead = s.TotalCacheReadTokens
+	j.Tokens.CacheWrite = s.TotalCacheWriteTokens
 	j.Timing.TotalAgentSeconds = s.TotalAgentTime.Seconds()
 	j.Timing.LLMSeconds = s.TotalLLMTime.Seconds()
 	j.Timing.ToolSeconds = s.TotalToolTime.Seconds()
@@ -80,9 +106,34 @@ func (s *AgentStats) ToJSON() AgentStatsJSON {
 	j.Backtrack.DiscardedCompletionTokens = s.DiscardedCompletionTokens
 	j.Backtrack.DiscardedCostUSD = s.DiscardedCost
 	j.Backtrack.BacktrackCount = s.BacktrackCount
+	j.Compactions = s.CompactionCount
+	j.Truncations = s.TruncationCount
+	j.Continuations = s.ContinuationCount
+	j.Verify = s.VerifyJSON()
 	return j
 }
 
+// VerifyJSON returns the verification runs, or nil when there were none
+func (s *AgentStats) VerifyJSON() *VerifyJSON {
+	if s.VerifyRuns == 0 {
+		return nil
+	}
+	return &VerifyJSON{Runs: s.VerifyRuns, Failures: s.VerifyFailures, Passed: s.VerifyPassed}
+}
+
+// AddUsage adds the tokens, cost and server timings of other, such as a
+// sub-agent's run, to s
+func (s *AgentStats) AddUsage(other *AgentStats) {
+	s.TotalPromptTokens += other.TotalPromptTokens
+	s.TotalCompletionTokens += other.TotalCompletionTokens
+	s.TotalCacheReadTokens += other.TotalCacheReadTokens
+	s.TotalCacheWriteTokens += other.TotalCacheWriteTokens
+	s.TotalCost += other.TotalCost
+	s.CacheDiscount += other.CacheDiscount
+	s.TotalPromptMS += other.TotalPromptMS
+	s.TotalGenerationMS += other.TotalGenerationMS
+}
+
 // Print outputs the agent stats in a formatted JSON block to stdout
 func (s *AgentStats) Print() {
 	s.PrintTo(os.Stdout)
@@ -0,0 +1,96 @@
+package tokenizer
+
+import (
+	"context"
+	"math"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// defaultCharsPerToken is used for unknown models. It is on the low side
+// of common BPE vocabularies, so unknown models are overestimated.
+const defaultCharsPerToken = 3.2
+
+// modelFamilies maps model name fragments to the average number of word
+// characters per token of the family's BPE vocabulary
+var modelFamilies = []struct {
+	fragment      string
+	charsPerToken float64
+}{
+	{"claude", 3.2},
+	{"gpt", 3.8},
+	{"o1", 3.8},
+	{"o3", 3.8},
+	{"o4", 3.8},
+	{"llama", 3.6},
+	{"qwen", 3.5},
+	{"deepseek", 3.5},
+	{"mistral", 3.3},
+	{"devstral", 3.3},
+	{"codestral", 3.3},
+	{"gemma", 3.6},
+	{"gemini", 3.6},
+	{"glm", 3.4},
+	{"kimi", 3.5},
+}
+
+// Heuristic approximates byte-pair encoding without a vocabulary: words are
+// split into pieces of the model family's average length, punctuation and
+// non-ASCII characters count as a token each, and whitespace mostly merges
+// into the following word.
+type Heuristic struct {
+	charsPerToken float64
+}
+
+// NewHeuristic creates a heuristic estimator tuned to the model's family
+func NewHeuristic(model string) *Heuristic {
+	lower := strings.ToLower(model)
+	for _, family := range modelFamilies {
+		if strings.Contains(lower, family.fragment) {
+			return &Heuristic{charsPerToken: family.charsPerToken}
+		}
+	}
+	return &Heuristic{charsPerToken: defaultCharsPerToken}
+}
+
+func (h *Heuristic) Name() string { return KindHeuristic }
+func (h *Heuristic) Exact() bool  { return false }
+
+func (h *Heuristic) CountTokens(_ context.Context, text string) (int, error) {
+	var tokens float64
+	word, spaces := 0, 0
+	flushWord := func() {
+		if word > 0 {
+			tokens += math.Ceil(float64(word) / h.charsPerToken)
+			word = 0
+		}
+	}
+	flushSpaces := func() {
+		// A single space is part of the next word's token; indentation runs
+		// are usually merged into a few whitespace tokens
+		if spaces > 1 {
+			tokens += math.Ceil(float64(spaces-1) / 4)
+		}
+		spaces = 0
+	}
+
+	for _, r := range text {
+		switch {
+		case r < utf8.RuneSelf && (unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'):
+			flushSpaces()
+			word++
+		case r == ' ':
+			flushWord()
+			spaces++
+		default:
+			// Line breaks, punctuation, symbols and non-ASCII text
+			flushWord()
+			flushSpaces()
+			tokens++
+		}
+	}
+	flushWord()
+	flushSpaces()
+	return int(math.Ceil(tokens)), nil
+}
@@ -0,0 +1,67 @@
+package tokenizer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// LlamaServer counts tokens with llama-server's /tokenize endpoint, which
+// uses the loaded model's own vocabulary
+type LlamaServer struct {
+	url        string
+	httpClient *http.Client
+}
+
+// NewLlamaServer creates an estimator for the llama-server at baseURL. The
+// OpenAI-compatible base URL usually ends in /v1, while /tokenize is served
+// from the root.
+func NewLlamaServer(baseURL string) *LlamaServer {
+	root := strings.TrimSuffix(strings.TrimRight(baseURL, "/"), "/v1")
+	return &LlamaServer{
+		url:        root + "/tokenize",
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (l *LlamaServer) Name() string { return KindLlamaServer }
+func (l *LlamaServer) Exact() bool  { return true }
+
+func (l *LlamaServer) CountTokens(ctx context.Context, text string) (int, error) {
+	body, err := json.Marshal(map[string]any{"content": text, "add_special": false})
+	if err != nil {
+		return 0, fmt.Errorf("marshal tokenize request: %w", err)
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, l.url, bytes.NewReader(body))
+	if err != nil {
+		return 0, fmt.Errorf("create tokenize request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := l.httpClient.Do(httpReq)
+	if err != nil {
+		return 0, fmt.Errorf("tokenize: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return 0, fmt.Errorf("tokenize: status %d: %s", resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+
+	var result struct {
+		Tokens []json.RawMessage `json:"tokens"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return 0, fmt.Errorf("decode tokenize response: %w", err)
+	}
+	if result.Tokens == nil {
+		return 0, fmt.Errorf("tokenize: response has no tokens field")
+	}
+	return len(result.Tokens), nil
+}
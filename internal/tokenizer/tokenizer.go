@@ -0,0 +1,208 @@
+// Package tokenizer estimates how many tokens a chat request will use, so
+// the agent can keep requests inside the model's context window before the
+// server rejects them.
+package tokenizer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"sync"
+
+	"github.com/kvit-s/kvit-coder/internal/llm"
+)
+
+// Estimator counts the tokens in a piece of text
+type Estimator interface {
+	// Name identifies the estimator in logs
+	Name() string
+	// CountTokens returns the number of tokens in text
+	CountTokens(ctx context.Context, text string) (int, error)
+	// Exact reports whether counts come from the model's own tokenizer
+	Exact() bool
+}
+
+// Estimator kinds accepted by New
+const (
+	KindAuto        = "auto"
+	KindHeuristic   = "heuristic"
+	KindLlamaServer = "llama-server"
+	KindOff         = "off"
+)
+
+// Options configures the estimator created by New
+type Options struct {
+	Kind     string // KindAuto (default), KindHeuristic, KindLlamaServer or KindOff
+	Provider string // llm provider kind, used by KindAuto
+	BaseURL  string // LLM server URL, used to reach llama-server's /tokenize
+	Model    string // model name, used to pick the heuristic's model family
+}
+
+// New creates the estimator selected by opts. It returns nil for KindOff.
+// KindAuto asks an OpenAI-compatible server's /tokenize endpoint (served by
+// llama-server) and falls back to the heuristic when that is unavailable.
+func New(opts Options) (Estimator, error) {
+	heuristic := NewHeuristic(opts.Model)
+	switch opts.Kind {
+	case "", KindAuto:
+		if opts.BaseURL == "" || (opts.Provider != "" && opts.Provider != llm.ProviderOpenAI) {
+			return heuristic, nil
+		}
+		return WithFallback(NewLlamaServer(opts.BaseURL), heuristic), nil
+	case KindHeuristic:
+		return heuristic, nil
+	case KindLlamaServer:
+		if opts.BaseURL == "" {
+			return nil, fmt.Errorf("tokenizer %q requires llm.base_url", opts.Kind)
+		}
+		return WithFallback(NewLlamaServer(opts.BaseURL), heuristic), nil
+	case KindOff:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unknown tokenizer %q (expected %q, %q, %q or %q)",
+			opts.Kind, KindAuto, KindHeuristic, KindLlamaServer, KindOff)
+	}
+}
+
+// fallbackEstimator uses primary until it fails once, then secondary for good,
+// so an unavailable /tokenize endpoint costs a single request per session
+type fallbackEstimator struct {
+	primary, secondary Estimator
+
+	mu     sync.Mutex
+	failed bool
+}
+
+// WithFallback returns an estimator that switches to secondary after primary's first error
+func WithFallback(primary, secondary Estimator) Estimator {
+	return &fallbackEstimator{primary: primary, secondary: secondary}
+}
+
+func (f *fallbackEstimator) current() Estimator {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.failed {
+		return f.secondary
+	}
+	return f.primary
+}
+
+func (f *fallbackEstimator) Name() string { return f.current().Name() }
+func (f *fallbackEstimator) Exact() bool  { return f.current().Exact() }
+
+func (f *fallbackEstimator) CountTokens(ctx context.Context, text string) (int, error) {
+	est := f.current()
+	n, err := est.CountTokens(ctx, text)
+	if err == nil || est == f.secondary || ctx.Err() != nil {
+		return n, err
+	}
+	f.mu.Lock()
+	f.failed = true
+	f.mu.Unlock()
+	return f.secondary.CountTokens(ctx, text)
+}
+
+// Per-message and per-request overheads of chat templates (role markers,
+// separators, tool call framing), as in OpenAI's published counting recipe
+const (
+	messageOverhead = 4
+	requestOverhead = 3
+)
+
+// maxCacheEntries bounds the count cache; it is cleared when full
+const maxCacheEntries = 4096
+
+// Counter counts tokens of messages and requests with an Estimator. Counts
+// are cached by text, since each request repeats the whole history.
+type Counter struct {
+	est Estimator
+
+	mu    sync.Mutex
+	cache map[uint64]int
+}
+
+// NewCounter creates a counter using est
+func NewCounter(est Estimator) *Counter {
+	return &Counter{est: est, cache: make(map[uint64]int)}
+}
+
+// Name returns the name of the estimator in use
+func (c *Counter) Name() string {
+	return c.est.Name()
+}
+
+// Exact reports whether counts come from the model's own tokenizer
+func (c *Counter) Exact() bool {
+	return c.est.Exact()
+}
+
+// Count returns the number of tokens in text
+func (c *Counter) Count(ctx context.Context, text string) (int, error) {
+	if text == "" {
+		return 0, nil
+	}
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(text))
+	key := h.Sum64()
+
+	c.mu.Lock()
+	n, ok := c.cache[key]
+	c.mu.Unlock()
+	if ok {
+		return n, nil
+	}
+
+	n, err := c.est.CountTokens(ctx, text)
+	if err != nil {
+		return 0, err
+	}
+	c.mu.Lock()
+	if len(c.cache) >= maxCacheEntries {
+		c.cache = make(map[uint64]int)
+	}
+	c.cache[key] = n
+	c.mu.Unlock()
+	return n, nil
+}
+
+// MessageTokens returns the tokens a message takes in a request
+func (c *Counter) MessageTokens(ctx context.Context, msg llm.Message) (int, error) {
+	total := messageOverhead
+	parts := []string{msg.Content, msg.ReasoningContent, msg.Name}
+	for _, tc := range msg.ToolCalls {
+		parts = append(parts, tc.Function.Name, tc.Function.Arguments)
+	}
+	for _, part := range parts {
+		n, err := c.Count(ctx, part)
+		if err != nil {
+			return 0, err
+		}
+		total += n
+	}
+	return total, nil
+}
+
+// RequestTokens returns the prompt tokens of a request: messages plus tool definitions
+func (c *Counter) RequestTokens(ctx context.Context, req llm.ChatRequest) (int, error) {
+	total := requestOverhead
+	for _, msg := range req.Messages {
+		n, err := c.MessageTokens(ctx, msg)
+		if err != nil {
+			return 0, err
+		}
+		total += n
+	}
+	if len(req.Tools) > 0 {
+		data, err := json.Marshal(req.Tools)
+		if err != nil {
+			return 0, fmt.Errorf("marshal tools: %w", err)
+		}
+		n, err := c.Count(ctx, string(data))
+		if err != nil {
+			return 0, err
+		}
+		total += n
+	}
+	return total, nil
+}
@@ -0,0 +1,168 @@
+package tokenizer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kvit-s/kvit-coder/internal/llm"
+)
+
+func TestHeuristicCounts(t *testing.T) {
+	h := NewHeuristic("qwen/qwen3-coder")
+	ctx := context.Background()
+
+	tests := []struct {
+		text     string
+		min, max int
+	}{
+		{"", 0, 0},
+		{"Hello world", 2, 4},
+		{"func main() {\n\tfmt.Println(\"hi\")\n}", 12, 24},
+		{strings.Repeat("the quick brown fox jumps over the lazy dog. ", 100), 900, 1500},
+		{"日本語のテキスト", 6, 12},
+	}
+	for _, tt := range tests {
+		got, err := h.CountTokens(ctx, tt.text)
+		if err != nil {
+			t.Fatalf("CountTokens(%q) error = %v", tt.text, err)
+		}
+		if got < tt.min || got > tt.max {
+			t.Errorf("CountTokens(%.30q) = %d, want %d..%d", tt.text, got, tt.min, tt.max)
+		}
+	}
+}
+
+func TestHeuristicModelFamilies(t *testing.T) {
+	text := strings.Repeat("internationalization considerations ", 50)
+	claude, _ := NewHeuristic("anthropic/claude-sonnet-4").CountTokens(context.Background(), text)
+	gpt, _ := NewHeuristic("openai/gpt-4o").CountTokens(context.Background(), text)
+	if claude <= gpt {
+		t.Errorf("claude = %d, gpt = %d; claude's smaller vocabulary should count more tokens", claude, gpt)
+	}
+}
+
+func newTokenizeServer(t *testing.T, status int) (*httptest.Server, *int) {
+	t.Helper()
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if r.URL.Path != "/tokenize" {
+			http.NotFound(w, r)
+			return
+		}
+		if status != http.StatusOK {
+			w.WriteHeader(status)
+			return
+		}
+		var req struct {
+			Content string `json:"content"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		// One token per whitespace-separated word
+		tokens := make([]int, len(strings.Fields(req.Content)))
+		_ = json.NewEncoder(w).Encode(map[string]any{"tokens": tokens})
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &calls
+}
+
+func TestLlamaServer(t *testing.T) {
+	srv, _ := newTokenizeServer(t, http.StatusOK)
+
+	est := NewLlamaServer(srv.URL + "/v1/")
+	got, err := est.CountTokens(context.Background(), "one two three")
+	if err != nil {
+		t.Fatalf("CountTokens() error = %v", err)
+	}
+	if got != 3 || !est.Exact() {
+		t.Errorf("CountTokens() = %d, Exact() = %v, want 3 and exact", got, est.Exact())
+	}
+}
+
+func TestFallbackAfterFailure(t *testing.T) {
+	srv, calls := newTokenizeServer(t, http.StatusNotFound)
+
+	est, err := New(Options{BaseURL: srv.URL + "/v1", Model: "m"})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		n, err := est.CountTokens(context.Background(), "some text here")
+		if err != nil || n == 0 {
+			t.Fatalf("CountTokens() = %d, %v, want heuristic count", n, err)
+		}
+	}
+	if *calls != 1 {
+		t.Errorf("tokenize calls = %d, want 1 (no probing after failure)", *calls)
+	}
+	if est.Name() != KindHeuristic || est.Exact() {
+		t.Errorf("Name() = %q, Exact() = %v after fallback", est.Name(), est.Exact())
+	}
+}
+
+func TestNew(t *testing.T) {
+	if est, _ := New(Options{Kind: KindOff}); est != nil {
+		t.Error("New(off) should return nil")
+	}
+	if est, _ := New(Options{Provider: llm.ProviderAnthropic, BaseURL: "https://api.anthropic.com/v1"}); est.Name() != KindHeuristic {
+		t.Errorf("auto for anthropic = %q, want heuristic", est.Name())
+	}
+	if _, err := New(Options{Kind: KindLlamaServer}); err == nil {
+		t.Error("New(llama-server) without base URL should fail")
+	}
+	if _, err := New(Options{Kind: "tiktoken"}); err == nil {
+		t.Error("New() should reject unknown kinds")
+	}
+}
+
+// countingEstimator counts words and records how often it is asked
+type countingEstimator struct {
+	calls int
+	err   error
+}
+
+func (c *countingEstimator) Name() string { return "counting" }
+func (c *countingEstimator) Exact() bool  { return true }
+func (c *countingEstimator) CountTokens(_ context.Context, text string) (int, error) {
+	c.calls++
+	return len(strings.Fields(text)), c.err
+}
+
+func TestCounterRequestTokens(t *testing.T) {
+	est := &countingEstimator{}
+	counter := NewCounter(est)
+	req := llm.ChatRequest{Messages: []llm.Message{
+		{Role: llm.RoleSystem, Content: "you are helpful"},
+		{Role: llm.RoleAssistant, ToolCalls: []llm.ToolCall{{Function: struct {
+			Name      string `json:"name"`
+			Arguments string `json:"arguments"`
+		}{Name: "Read", Arguments: `{"path": "a.go"}`}}}},
+		{Role: llm.RoleTool, Name: "Read", Content: "package main"},
+	}}
+
+	got, err := counter.RequestTokens(context.Background(), req)
+	if err != nil {
+		t.Fatalf("RequestTokens() error = %v", err)
+	}
+	// Words: 3 system, 1 + 2 tool call, 1 + 2 tool result; plus overheads
+	want := 3 + (1 + 2) + (1 + 2) + 3*messageOverhead + requestOverhead
+	if got != want {
+		t.Errorf("RequestTokens() = %d, want %d", got, want)
+	}
+
+	calls := est.calls
+	_, _ = counter.RequestTokens(context.Background(), req)
+	if est.calls != calls {
+		t.Errorf("second count made %d estimator calls, want cached", est.calls-calls)
+	}
+
+	est.err = errors.New("boom")
+	if _, err := NewCounter(est).RequestTokens(context.Background(), req); err == nil {
+		t.Error("RequestTokens() should return estimator errors")
+	}
+}
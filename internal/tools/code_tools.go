@@ -0,0 +1,427 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/kvit-s/kvit-coder/internal/config"
+	"github.com/kvit-s/kvit-coder/internal/gocode"
+)
+
+const (
+	// defaultMaxReferences caps Code.references when tools.code.max_references is unset
+	defaultMaxReferences = 100
+	// maxDefinitionSource is the longest declaration Code.definition shows in full
+	maxDefinitionSource = 60
+)
+
+// codeTool holds what the Code.* tools share
+type codeTool struct {
+	config        *config.Config
+	workspaceRoot string
+	tempFileMgr   *TempFileManager
+}
+
+// resolve checks a path argument the way Read does and returns it absolute
+func (t *codeTool) resolve(toolName, p string) (string, error) {
+	if p == "" {
+		return filepath.Clean(t.workspaceRoot), nil
+	}
+	permResult, err := t.config.CheckPathPermission(p, config.AccessRead)
+	if err != nil && permResult == config.PermissionDenied {
+		return "", fmt.Errorf("access denied: %w", err)
+	}
+	fullPath, outside, err := NormalizeAndValidatePath(t.workspaceRoot, p)
+	if err != nil {
+		return "", fmt.Errorf("invalid path: %w", err)
+	}
+	if outside {
+		if err := t.config.CheckPathSafety(toolName, p); err != nil {
+			return "", err
+		}
+	}
+	return fullPath, nil
+}
+
+// loadModule parses the Go module containing dir. A go.mod found above the
+// workspace is only used if path safety allows reading outside it.
+func (t *codeTool) loadModule(ctx context.Context, dir string) (*gocode.Index, error) {
+	mod, err := gocode.FindModule(dir)
+	if err != nil {
+		return nil, RuntimeErrorf("not in a Go module: %v", err)
+	}
+	if _, outside, err := NormalizeAndValidatePath(t.workspaceRoot, mod.Dir); err != nil || outside {
+		if err := t.config.CheckPathSafety("read", mod.Dir); err != nil {
+			return nil, RuntimeErrorf("the workspace has no go.mod of its own, and the module at %s is outside it: %v", mod.Dir, err)
+		}
+	}
+	return gocode.Load(ctx, mod)
+}
+
+// display returns a path as Read and Edit accept it: relative to the
+// workspace when inside it
+func (t *codeTool) display(p string) string {
+	if rel, err := filepath.Rel(t.workspaceRoot, p); err == nil && !strings.HasPrefix(rel, "..") {
+		return rel
+	}
+	return p
+}
+
+// declJSON turns a declaration into the result format. File is left out
+// when the caller groups declarations by file.
+func (t *codeTool) declJSON(d gocode.Decl, withFile bool) map[string]any {
+	m := map[string]any{
+		"name":       d.Name,
+		"kind":       d.Kind,
+		"start_line": d.StartLine,
+		"end_line":   d.EndLine,
+	}
+	if withFile {
+		m["file"] = t.display(d.File)
+	}
+	if d.Signature != "" {
+		m["signature"] = d.Signature
+	}
+	if d.DocLine > 0 {
+		m["doc_line"] = d.DocLine
+	}
+	if len(d.Members) > 0 {
+		members := make([]map[string]any, len(d.Members))
+		for i, member := range d.Members {
+			members[i] = t.declJSON(member, false)
+		}
+		m["members"] = members
+	}
+	return m
+}
+
+// symbolParam reads and checks the symbol argument of Code.definition and
+// Code.references
+func symbolParam(args json.RawMessage) (string, error) {
+	var params struct {
+		Symbol string `json:"symbol"`
+	}
+	if err := json.Unmarshal(args, &params); err != nil {
+		return "", SemanticErrorf("invalid arguments: %v", err)
+	}
+	symbol := strings.TrimSpace(params.Symbol)
+	if symbol == "" {
+		return "", SemanticErrorf("symbol is required, e.g. \"Runner.Run\"")
+	}
+	return symbol, nil
+}
+
+// CodeOutlineTool lists the declarations of a Go file or package
+type CodeOutlineTool struct {
+	codeTool
+}
+
+func NewCodeOutlineTool(cfg *config.Config) *CodeOutlineTool {
+	return &CodeOutlineTool{codeTool{config: cfg, workspaceRoot: cfg.Workspace.Root}}
+}
+
+func (t *CodeOutlineTool) Name() string { return "Code.outline" }
+
+func (t *CodeOutlineTool) Description() string {
+	return "List the declarations of a Go file or package directory with their line ranges, for use with Read and line-mode Edit."
+}
+
+func (t *CodeOutlineTool) ReadOnly() bool { return true }
+
+func (t *CodeOutlineTool) JSONSchema() map[string]any {
+	return map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"path": map[string]any{
+				"type":        "string",
+				"description": "Go file, or directory for every file of its package",
+			},
+		},
+		"required": []string{"path"},
+	}
+}
+
+func (t *CodeOutlineTool) Check(ctx context.Context, args json.RawMessage) error {
+	var params struct {
+		Path string `json:"path"`
+	}
+	if err := json.Unmarshal(args, &params); err != nil {
+		return SemanticErrorf("invalid arguments: %v", err)
+	}
+	if params.Path == "" {
+		return SemanticErrorf("path is required")
+	}
+	return nil
+}
+
+func (t *CodeOutlineTool) PromptCategory() string { return "filesystem" }
+func (t *CodeOutlineTool) PromptOrder() int       { return 6 }
+func (t *CodeOutlineTool) PromptSection() string {
+	return `### Code.outline / Code.definition / Code.references - Go Code Navigation
+
+**Usage:**
+- ` + "`" + `Code.outline {"path": "internal/agent/runner.go"}` + "`" + ` - declarations of a file (or of a package, given its directory)
+- ` + "`" + `Code.definition {"symbol": "Runner.Run"}` + "`" + ` - where a symbol is declared, with its source
+- ` + "`" + `Code.references {"symbol": "agent.NewRunner"}` + "`" + ` - where it is used across the module
+
+Symbols are ` + "`Name`" + ` or ` + "`Type.Member`" + `, optionally with the package name in front (` + "`agent.Runner.Run`" + `). Results give start_line and end_line, ready for line-mode Edit; doc_line is where the doc comment starts. For Go code, prefer these over Search: they find the declaration itself, not every line that mentions the name.`
+}
+
+func (t *CodeOutlineTool) Call(ctx context.Context, args json.RawMessage) (any, error) {
+	var params struct {
+		Path string `json:"path"`
+	}
+	if err := json.Unmarshal(args, &params); err != nil {
+		return nil, err
+	}
+	fullPath, err := t.resolve("read", params.Path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(fullPath)
+	if err != nil {
+		return nil, RuntimeErrorf("path not found: %s", params.Path)
+	}
+
+	dir, file := fullPath, ""
+	if !info.IsDir() {
+		if !strings.HasSuffix(fullPath, ".go") {
+			return nil, SemanticErrorf("%s is not a Go file", params.Path)
+		}
+		dir, file = filepath.Dir(fullPath), fullPath
+	}
+	idx := gocode.LoadDir(dir)
+
+	var files []map[string]any
+	var packages []string
+	for _, pkg := range idx.Packages {
+		for i, name := range pkg.Filenames {
+			if file != "" && name != file {
+				continue
+			}
+			var decls []map[string]any
+			for _, d := range gocode.FileDecls(idx.Fset, pkg, i) {
+				decls = append(decls, t.declJSON(d, false))
+			}
+			files = append(files, map[string]any{"file": t.display(name), "package": pkg.Name, "declarations": decls})
+		}
+		packages = append(packages, pkg.Name)
+	}
+	if len(files) == 0 {
+		return nil, RuntimeErrorf("no Go files in %s", params.Path)
+	}
+	if file != "" {
+		result := files[0]
+		result["success"] = true
+		return result, nil
+	}
+	return map[string]any{
+		"success":  true,
+		"packages": packages,
+		"files":    files,
+	}, nil
+}
+
+// CodeDefinitionTool finds where a Go symbol is declared
+type CodeDefinitionTool struct {
+	codeTool
+}
+
+func NewCodeDefinitionTool(cfg *config.Config) *CodeDefinitionTool {
+	return &CodeDefinitionTool{codeTool{config: cfg, workspaceRoot: cfg.Workspace.Root}}
+}
+
+func (t *CodeDefinitionTool) Name() string { return "Code.definition" }
+
+func (t *CodeDefinitionTool) Description() string {
+	return "Find where a Go function, type, method, field, constant or variable is declared in the module, with its line range and source."
+}
+
+func (t *CodeDefinitionTool) ReadOnly() bool { return true }
+
+func (t *CodeDefinitionTool) JSONSchema() map[string]any {
+	return map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"symbol": map[string]any{
+				"type":        "string",
+				"description": "Name or Type.Member, optionally prefixed with the package name, e.g. \"agent.Runner.Run\"",
+			},
+		},
+		"required": []string{"symbol"},
+	}
+}
+
+func (t *CodeDefinitionTool) Check(ctx context.Context, args json.RawMessage) error {
+	_, err := symbolParam(args)
+	return err
+}
+
+func (t *CodeDefinitionTool) PromptCategory() string { return "filesystem" }
+func (t *CodeDefinitionTool) PromptOrder() int       { return 7 }
+func (t *CodeDefinitionTool) PromptSection() string  { return "" } // Covered by Code.outline
+
+func (t *CodeDefinitionTool) Call(ctx context.Context, args json.RawMessage) (any, error) {
+	symbol, err := symbolParam(args)
+	if err != nil {
+		return nil, err
+	}
+	idx, err := t.loadModule(ctx, t.workspaceRoot)
+	if err != nil {
+		return nil, err
+	}
+	defs := idx.Definitions(symbol)
+	if len(defs) == 0 {
+		return nil, RuntimeErrorf("no declaration of %q in module %s. Code.outline lists the declarations of a file or package", symbol, idx.Module.Path)
+	}
+
+	results := make([]map[string]any, len(defs))
+	for i, d := range defs {
+		m := t.declJSON(d, true)
+		m["package"] = d.Package().Name
+		start := d.StartLine
+		if d.DocLine > 0 {
+			start = d.DocLine
+		}
+		if d.EndLine-start < maxDefinitionSource {
+			if source, err := readLines(d.File, start, d.EndLine); err == nil {
+				m["source"] = source
+			}
+		} else {
+			m["hint"] = fmt.Sprintf("Read {\"path\": \"%s\", \"start\": %d, \"limit\": %d}", t.display(d.File), start, d.EndLine-start+1)
+		}
+		results[i] = m
+	}
+	return map[string]any{
+		"success":     true,
+		"symbol":      symbol,
+		"definitions": results,
+	}, nil
+}
+
+// CodeReferencesTool finds the uses of a Go symbol across the module
+type CodeReferencesTool struct {
+	codeTool
+}
+
+func NewCodeReferencesTool(cfg *config.Config, tempFileMgr *TempFileManager) *CodeReferencesTool {
+	return &CodeReferencesTool{codeTool{config: cfg, workspaceRoot: cfg.Workspace.Root, tempFileMgr: tempFileMgr}}
+}
+
+func (t *CodeReferencesTool) Name() string { return "Code.references" }
+
+func (t *CodeReferencesTool) Description() string {
+	return "Find every use of a Go symbol across the module by type-checking it, unlike a text search that also matches unrelated names."
+}
+
+func (t *CodeReferencesTool) ReadOnly() bool { return true }
+
+func (t *CodeReferencesTool) JSONSchema() map[string]any {
+	return map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"symbol": map[string]any{
+				"type":        "string",
+				"description": "Name or Type.Member, optionally prefixed with the package name, e.g. \"agent.NewRunner\"",
+			},
+		},
+		"required": []string{"symbol"},
+	}
+}
+
+func (t *CodeReferencesTool) Check(ctx context.Context, args json.RawMessage) error {
+	_, err := symbolParam(args)
+	return err
+}
+
+func (t *CodeReferencesTool) PromptCategory() string { return "filesystem" }
+func (t *CodeReferencesTool) PromptOrder() int       { return 8 }
+func (t *CodeReferencesTool) PromptSection() string  { return "" } // Covered by Code.outline
+
+func (t *CodeReferencesTool) Call(ctx context.Context, args json.RawMessage) (any, error) {
+	symbol, err := symbolParam(args)
+	if err != nil {
+		return nil, err
+	}
+	idx, err := t.loadModule(ctx, t.workspaceRoot)
+	if err != nil {
+		return nil, err
+	}
+	defs := idx.Definitions(symbol)
+	switch {
+	case len(defs) == 0:
+		return nil, RuntimeErrorf("no declaration of %q in module %s. Code.outline lists the declarations of a file or package", symbol, idx.Module.Path)
+	case len(defs) > 1:
+		var candidates []string
+		for _, d := range defs {
+			candidates = append(candidates, fmt.Sprintf("%s.%s (%s:%d)", d.Package().Name, d.Name, t.display(d.File), d.StartLine))
+		}
+		return nil, RuntimeErrorWithDetails(
+			fmt.Sprintf("%q is declared %d times; call again with one of the candidates", symbol, len(defs)),
+			map[string]any{"candidates": candidates})
+	}
+
+	def := defs[0]
+	refs, err := idx.References(ctx, def)
+	if err != nil {
+		return nil, RuntimeErrorf("finding references: %v", err)
+	}
+	items := make([]map[string]any, len(refs))
+	for i, r := range refs {
+		items[i] = map[string]any{"file": t.display(r.File), "line": r.Line, "column": r.Column, "text": r.Text}
+		if r.In != "" {
+			items[i]["in"] = r.In
+		}
+	}
+
+	result := map[string]any{
+		"success":          true,
+		"definition":       t.declJSON(def, true),
+		"references":       items,
+		"total_references": len(items),
+	}
+	if len(items) == 0 {
+		result["references"] = []map[string]any{}
+		result["message"] = "No uses found in the module"
+		return result, nil
+	}
+
+	// Too many references - list the first ones and save all to a temp file
+	maxRefs := t.config.Tools.Code.MaxReferences
+	if maxRefs <= 0 {
+		maxRefs = defaultMaxReferences
+	}
+	if len(items) > maxRefs {
+		result["references"] = items[:maxRefs]
+		result["truncated"] = true
+		result["message"] = fmt.Sprintf("Too many references (%d). First %d shown.", len(items), maxRefs)
+		if t.tempFileMgr != nil {
+			if tempFile, err := t.tempFileMgr.CreateTempFile(); err == nil {
+				defer tempFile.Close()
+				for _, r := range refs {
+					fmt.Fprintf(tempFile, "%s:%d:%d: %s\n", t.display(r.File), r.Line, r.Column, r.Text)
+				}
+				result["results_file"] = tempFile.Name()
+				result["hint"] = fmt.Sprintf("Full results: %s", tempFile.Name())
+			}
+		}
+	}
+	return result, nil
+}
+
+// readLines returns lines start to end (1-based, inclusive) of a file
+func readLines(path string, start, end int) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	lines := strings.Split(string(data), "\n")
+	if start < 1 || start > len(lines) {
+		return "", fmt.Errorf("line %d out of range", start)
+	}
+	return strings.Join(lines[start-1:min(end, len(lines))], "\n"), nil
+}
@@ -0,0 +1,86 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCodeTools(t *testing.T) {
+	root := globWorkspace(t, map[string]string{
+		"go.mod": "module example.com/calc\n\ngo 1.22\n",
+		"calc.go": `package calc
+
+// Add returns a + b
+func Add(a, b int) int {
+	return a + b
+}
+`,
+		"cmd/main.go": `package main
+
+import "example.com/calc"
+
+func main() {
+	println(calc.Add(1, 2))
+}
+`,
+	})
+	cfg := newTestConfig()
+	cfg.Workspace.Root = root
+	ctx := context.Background()
+
+	outline, err := NewCodeOutlineTool(cfg).Call(ctx, json.RawMessage(`{"path": "calc.go"}`))
+	if err != nil {
+		t.Fatalf("Code.outline error = %v", err)
+	}
+	decls := outline.(map[string]any)["declarations"].([]map[string]any)
+	if len(decls) != 1 || decls[0]["name"] != "Add" || decls[0]["start_line"] != 4 || decls[0]["end_line"] != 6 {
+		t.Errorf("Code.outline declarations = %v, want Add at lines 4-6", decls)
+	}
+
+	def, err := NewCodeDefinitionTool(cfg).Call(ctx, json.RawMessage(`{"symbol": "calc.Add"}`))
+	if err != nil {
+		t.Fatalf("Code.definition error = %v", err)
+	}
+	d := def.(map[string]any)["definitions"].([]map[string]any)[0]
+	if d["file"] != "calc.go" || d["source"] != "// Add returns a + b\nfunc Add(a, b int) int {\n\treturn a + b\n}" {
+		t.Errorf("Code.definition = %v, want calc.go with its source", d)
+	}
+
+	refs, err := NewCodeReferencesTool(cfg, nil).Call(ctx, json.RawMessage(`{"symbol": "Add"}`))
+	if err != nil {
+		t.Fatalf("Code.references error = %v", err)
+	}
+	items := refs.(map[string]any)["references"].([]map[string]any)
+	if len(items) != 1 || items[0]["file"] != "cmd/main.go" || items[0]["line"] != 6 || items[0]["in"] != "main" {
+		t.Errorf("Code.references = %v, want the call in cmd/main.go:6", items)
+	}
+
+	if _, err := NewCodeDefinitionTool(cfg).Call(ctx, json.RawMessage(`{"symbol": "Sub"}`)); err == nil || IsBacktrackable(err) {
+		t.Errorf("Code.definition of a missing symbol = %v, want a runtime error", err)
+	}
+}
+
+func TestCodeToolsModuleOutsideWorkspace(t *testing.T) {
+	// The workspace is a package inside a module whose go.mod is above it
+	parent := globWorkspace(t, map[string]string{
+		"go.mod":       "module example.com/calc\n\ngo 1.22\n",
+		"calc/calc.go": "package calc\n\nfunc Add(a, b int) int { return a + b }\n",
+	})
+	cfg := newTestConfig()
+	cfg.Workspace.Root = filepath.Join(parent, "calc")
+	ctx := context.Background()
+
+	cfg.Workspace.PathSafetyMode = "block"
+	_, err := NewCodeDefinitionTool(cfg).Call(ctx, json.RawMessage(`{"symbol": "Add"}`))
+	if err == nil || !strings.Contains(err.Error(), "outside") {
+		t.Errorf("Code.definition with the module above the workspace = %v, want it blocked", err)
+	}
+
+	cfg.Workspace.PathSafetyMode = "warn"
+	if _, err := NewCodeDefinitionTool(cfg).Call(ctx, json.RawMessage(`{"symbol": "Add"}`)); err != nil {
+		t.Errorf("Code.definition in warn mode error = %v, want the module loaded", err)
+	}
+}
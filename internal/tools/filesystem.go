@@ -91,6 +91,30 @@ func (t *FileReadTracker) NextMessage() int {
 	return t.currentMsgID
 }
 
+// ReadTrackerState is a copy of a FileReadTracker's reads and message ID
+type ReadTrackerState struct {
+	readFiles    []fileReadEntry
+	currentMsgID int
+}
+
+// Save returns a copy of the tracker's current state
+func (t *FileReadTracker) Save() ReadTrackerState {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return ReadTrackerState{
+		readFiles:    append([]fileReadEntry(nil), t.readFiles...),
+		currentMsgID: t.currentMsgID,
+	}
+}
+
+// Restore puts back a state returned by Save, dropping everything recorded since
+func (t *FileReadTracker) Restore(s ReadTrackerState) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.readFiles = s.readFiles
+	t.currentMsgID = s.currentMsgID
+}
+
 // pendingEdit stores a computed edit waiting to be applied in preview mode
 type pendingEdit struct {
 	path          string
@@ -379,6 +403,8 @@ func (t *ReadFileTool) Check(ctx context.Context, args json.RawMessage) error {
 	return nil
 }
 
+func (t *ReadFileTool) ReadOnly() bool { return true }
+
 func (t *ReadFileTool) JSONSchema() map[string]any {
 	return map[string]any{
 		"type": "object",
@@ -0,0 +1,171 @@
+package tools
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// ignoreRule is one pattern of a .gitignore file
+type ignoreRule struct {
+	re      *regexp.Regexp
+	negate  bool // "!pattern" re-includes what an earlier rule ignored
+	dirOnly bool // "pattern/" only matches directories
+}
+
+// ignoreFile holds the rules of one .gitignore, which apply below its directory
+type ignoreFile struct {
+	dir   string
+	rules []ignoreRule
+}
+
+// ignoreMatcher applies the .gitignore files of the directories on the way
+// from the workspace root to the one being walked. Later rules and deeper
+// files win, as in git.
+type ignoreMatcher struct {
+	files []ignoreFile
+}
+
+// enter loads the .gitignore of dir, if it has one. Directories must be
+// entered from the top down.
+func (m *ignoreMatcher) enter(dir string) {
+	rules := parseGitignore(filepath.Join(dir, ".gitignore"))
+	if len(rules) > 0 {
+		m.files = append(m.files, ignoreFile{dir: dir, rules: rules})
+	}
+}
+
+// leave drops the rules of dir and the directories below it
+func (m *ignoreMatcher) leave(dir string) {
+	for len(m.files) > 0 {
+		last := m.files[len(m.files)-1].dir
+		if last != dir && !strings.HasPrefix(last, dir+string(filepath.Separator)) {
+			return
+		}
+		m.files = m.files[:len(m.files)-1]
+	}
+}
+
+// ignored reports whether the file or directory at path is ignored
+func (m *ignoreMatcher) ignored(path string, isDir bool) bool {
+	ignored := false
+	for _, f := range m.files {
+		rel, err := filepath.Rel(f.dir, path)
+		if err != nil || strings.HasPrefix(rel, "..") {
+			continue
+		}
+		rel = filepath.ToSlash(rel)
+		for _, r := range f.rules {
+			if r.dirOnly && !isDir {
+				continue
+			}
+			if r.re.MatchString(rel) {
+				ignored = !r.negate
+			}
+		}
+	}
+	return ignored
+}
+
+// parseGitignore reads the rules of a .gitignore file. A missing or
+// unreadable file has none.
+func parseGitignore(path string) []ignoreRule {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	var rules []ignoreRule
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		var r ignoreRule
+		if strings.HasPrefix(line, "!") {
+			r.negate = true
+			line = line[1:]
+		} else if strings.HasPrefix(line, `\!`) || strings.HasPrefix(line, `\#`) {
+			line = line[1:]
+		}
+		if strings.HasSuffix(line, "/") {
+			r.dirOnly = true
+			line = strings.TrimSuffix(line, "/")
+		}
+		if line == "" {
+			continue
+		}
+
+		// A pattern with a slash before its end is relative to the .gitignore;
+		// one without matches a name at any depth
+		prefix := "(?:.*/)?"
+		if strings.Contains(line, "/") {
+			prefix = ""
+			line = strings.TrimPrefix(line, "/")
+		}
+		re, err := regexp.Compile("^" + prefix + GlobToRegexp(line, false) + "$")
+		if err != nil {
+			continue
+		}
+		r.re = re
+		rules = append(rules, r)
+	}
+	return rules
+}
+
+// GlobToRegexp converts a path glob to an unanchored regular expression.
+// * and ? stay within a path segment, ** spans any number of segments and
+// [...] is a character class. With braces, {a,b} matches either part. Glob,
+// .gitignore and approval rules all match paths with it.
+func GlobToRegexp(glob string, braces bool) string {
+	var sb strings.Builder
+	depth := 0 // Open braces
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch {
+		case strings.HasPrefix(glob[i:], "**/"):
+			sb.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(glob[i:], "**"):
+			sb.WriteString(".*")
+			i++
+		case c == '*':
+			sb.WriteString("[^/]*")
+		case c == '?':
+			sb.WriteString("[^/]")
+		case c == '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end < 0 {
+				sb.WriteString(`\[`)
+				continue
+			}
+			class := glob[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			sb.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += end + 1
+		case braces && c == '{':
+			depth++
+			sb.WriteString("(?:")
+		case braces && c == ',' && depth > 0:
+			sb.WriteString("|")
+		case braces && c == '}' && depth > 0:
+			depth--
+			sb.WriteString(")")
+		case c == '\\' && i+1 < len(glob):
+			i++
+			sb.WriteString(regexp.QuoteMeta(string(glob[i])))
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	for ; depth > 0; depth-- {
+		sb.WriteString(")")
+	}
+	return sb.String()
+}
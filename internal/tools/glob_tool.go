@@ -0,0 +1,321 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/kvit-s/kvit-coder/internal/config"
+)
+
+// defaultGlobMaxResults caps the file list when tools.glob.max_results is unset
+const defaultGlobMaxResults = 200
+
+// globSkipDirs are never searched: version control and the agent's own files
+var globSkipDirs = map[string]bool{".git": true, ".kvit-coder": true}
+
+// GlobTool finds files by name pattern
+type GlobTool struct {
+	config        *config.Config
+	workspaceRoot string
+	tempFileMgr   *TempFileManager
+}
+
+func NewGlobTool(cfg *config.Config, tempFileMgr *TempFileManager) *GlobTool {
+	return &GlobTool{
+		config:        cfg,
+		workspaceRoot: cfg.Workspace.Root,
+		tempFileMgr:   tempFileMgr,
+	}
+}
+
+func (t *GlobTool) Name() string {
+	return "Glob"
+}
+
+func (t *GlobTool) Description() string {
+	return "Find files by name pattern, e.g. '**/*_test.go'. Skips files ignored by .gitignore. Returned paths can be passed to Read and Edit as they are."
+}
+
+func (t *GlobTool) ReadOnly() bool { return true }
+
+func (t *GlobTool) JSONSchema() map[string]any {
+	return map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"pattern": map[string]any{
+				"type":        "string",
+				"description": "Glob relative to path: * and ? within a directory, ** across directories, {a,b} alternatives. Without a slash it matches file names at any depth",
+			},
+			"path": map[string]any{
+				"type":        "string",
+				"description": "Directory to search in (default: workspace root)",
+			},
+			"sort": map[string]any{
+				"type":        "string",
+				"enum":        []string{"name", "mtime"},
+				"description": "name (default) or mtime, most recently modified first",
+			},
+			"include_ignored": map[string]any{
+				"type":        "boolean",
+				"description": "Also list files ignored by .gitignore (default: false)",
+			},
+		},
+		"required": []string{"pattern"},
+	}
+}
+
+func (t *GlobTool) PromptCategory() string { return "filesystem" }
+func (t *GlobTool) PromptOrder() int       { return 4 } // Before search
+func (t *GlobTool) PromptSection() string {
+	return `### Glob - Find Files by Name
+
+**Usage:** ` + "`" + `Glob {"pattern": "<glob>"}` + "`" + `
+
+Examples:
+- ` + "`" + `Glob {"pattern": "*.go"}` + "`" + ` - Go files at any depth
+- ` + "`" + `Glob {"pattern": "src/**/test_*.py"}` + "`" + `
+- ` + "`" + `Glob {"pattern": "**/*.{ts,tsx}", "path": "web", "sort": "mtime"}` + "`" + `
+
+**Parameters:**
+- ` + "`pattern`" + ` (required): Glob relative to path; ` + "`**`" + ` spans directories. Without a slash it matches file names at any depth
+- ` + "`path`" + ` (optional): Directory to search in (default: workspace root)
+- ` + "`sort`" + ` (optional): "name" (default) or "mtime" (most recently modified first)
+- ` + "`include_ignored`" + ` (optional): Also list files ignored by .gitignore
+
+Use Glob instead of Shell with find or ls to discover files.`
+}
+
+// globParams are the arguments of a Glob call
+type globParams struct {
+	Pattern        string `json:"pattern"`
+	Path           string `json:"path"`
+	Sort           string `json:"sort"`
+	IncludeIgnored bool   `json:"include_ignored"`
+}
+
+func (t *GlobTool) Check(ctx context.Context, args json.RawMessage) error {
+	var params globParams
+	if err := json.Unmarshal(args, &params); err != nil {
+		return SemanticErrorf("invalid arguments: %v", err)
+	}
+	if strings.TrimSpace(params.Pattern) == "" {
+		return SemanticErrorf("pattern is required, e.g. \"**/*.go\"")
+	}
+	if _, err := globPatternRegexp(params.Pattern); err != nil {
+		return SemanticErrorf("invalid pattern %q: %v", params.Pattern, err)
+	}
+	if params.Sort != "" && params.Sort != "name" && params.Sort != "mtime" {
+		return SemanticErrorf("sort must be \"name\" or \"mtime\", got %q", params.Sort)
+	}
+	return nil
+}
+
+// globMatch is a file found by Glob
+type globMatch struct {
+	path    string // As shown to the model
+	modTime time.Time
+}
+
+func (t *GlobTool) Call(ctx context.Context, args json.RawMessage) (any, error) {
+	var params globParams
+	if err := json.Unmarshal(args, &params); err != nil {
+		return nil, err
+	}
+	pattern, err := globPatternRegexp(params.Pattern)
+	if err != nil {
+		return nil, SemanticErrorf("invalid pattern %q: %v", params.Pattern, err)
+	}
+
+	root := t.workspaceRoot
+	outside := false
+	if params.Path != "" {
+		// Check permissions using 3-tier system
+		permResult, err := t.config.CheckPathPermission(params.Path, config.AccessRead)
+		if err != nil && permResult == config.PermissionDenied {
+			return nil, fmt.Errorf("access denied: %w", err)
+		}
+
+		root, outside, err = NormalizeAndValidatePath(t.workspaceRoot, params.Path)
+		if err != nil {
+			return nil, fmt.Errorf("invalid path: %w", err)
+		}
+
+		// For outside-workspace paths, use CheckPathSafety which respects path_safety_mode
+		if outside {
+			if err := t.config.CheckPathSafety("glob", params.Path); err != nil {
+				return nil, err
+			}
+		}
+	}
+	info, err := os.Stat(root)
+	if err != nil {
+		return nil, RuntimeErrorf("directory not found: %s", params.Path)
+	}
+	if !info.IsDir() {
+		return nil, RuntimeErrorf("%s is a file, not a directory; use Read to see it", params.Path)
+	}
+
+	// Rules of the .gitignore files above the search directory apply too
+	var ignores *ignoreMatcher
+	if !params.IncludeIgnored {
+		ignores = &ignoreMatcher{}
+		for _, dir := range dirsBetween(filepath.Clean(t.workspaceRoot), root) {
+			ignores.enter(dir)
+		}
+	}
+
+	matches, err := t.walk(ctx, root, pattern, ignores, outside)
+	if err != nil {
+		return nil, err
+	}
+
+	if params.Sort == "mtime" {
+		sort.SliceStable(matches, func(i, j int) bool { return matches[i].modTime.After(matches[j].modTime) })
+	} else {
+		sort.Slice(matches, func(i, j int) bool { return matches[i].path < matches[j].path })
+	}
+
+	files := make([]string, len(matches))
+	for i, m := range matches {
+		files[i] = m.path
+	}
+	result := map[string]any{
+		"success":     true,
+		"files":       files,
+		"total_files": len(files),
+	}
+	if len(files) == 0 {
+		result["files"] = []string{}
+		result["message"] = fmt.Sprintf("No files match %q", params.Pattern)
+		if !params.IncludeIgnored {
+			result["hint"] = "Files ignored by .gitignore are skipped; set include_ignored to list them too"
+		}
+		return result, nil
+	}
+
+	// Too many files - list the first ones and save all to a temp file
+	maxResults := t.config.Tools.Glob.MaxResults
+	if maxResults <= 0 {
+		maxResults = defaultGlobMaxResults
+	}
+	if len(files) > maxResults {
+		result["files"] = files[:maxResults]
+		result["truncated"] = true
+		result["message"] = fmt.Sprintf("Too many files (%d). First %d shown; narrow the pattern or path.", len(files), maxResults)
+		if t.tempFileMgr != nil {
+			if tempFile, err := t.tempFileMgr.CreateTempFile(); err == nil {
+				defer tempFile.Close()
+				for _, f := range files {
+					fmt.Fprintln(tempFile, f)
+				}
+				result["results_file"] = tempFile.Name()
+				if t.config.Tools.Read.Enabled {
+					result["hint"] = fmt.Sprintf("Full list: Read {\"path\": \"%s\"}", tempFile.Name())
+				} else {
+					result["hint"] = fmt.Sprintf("Full list: %s", tempFile.Name())
+				}
+			}
+		}
+	}
+	return result, nil
+}
+
+// walk lists the files under root whose path relative to root matches
+// pattern. Paths are relative to the workspace, or absolute outside it.
+func (t *GlobTool) walk(ctx context.Context, root string, pattern *regexp.Regexp, ignores *ignoreMatcher, outside bool) ([]globMatch, error) {
+	var matches []globMatch
+	var dirs []string // Directories entered, for leaving their .gitignore rules
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		if err != nil {
+			if d != nil && d.IsDir() && path != root {
+				return filepath.SkipDir // Unreadable directory
+			}
+			return nil
+		}
+
+		if ignores != nil {
+			parent := filepath.Dir(path)
+			for len(dirs) > 0 && dirs[len(dirs)-1] != parent && path != root {
+				ignores.leave(dirs[len(dirs)-1])
+				dirs = dirs[:len(dirs)-1]
+			}
+		}
+
+		if d.IsDir() {
+			if path != root && (globSkipDirs[d.Name()] || (ignores != nil && ignores.ignored(path, true))) {
+				return filepath.SkipDir
+			}
+			if ignores != nil {
+				if path != root {
+					ignores.enter(path)
+				}
+				dirs = append(dirs, path)
+			}
+			return nil
+		}
+		if ignores != nil && ignores.ignored(path, false) {
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, path)
+		if err != nil || !pattern.MatchString(filepath.ToSlash(rel)) {
+			return nil
+		}
+		m := globMatch{path: path}
+		if !outside {
+			if wsRel, err := filepath.Rel(t.workspaceRoot, path); err == nil {
+				m.path = wsRel
+			}
+		}
+		if info, err := d.Info(); err == nil {
+			m.modTime = info.ModTime()
+		}
+		matches = append(matches, m)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return matches, nil
+}
+
+// globPatternRegexp compiles a Glob pattern. One without a slash matches
+// file names at any depth.
+func globPatternRegexp(pattern string) (*regexp.Regexp, error) {
+	pattern = strings.TrimPrefix(filepath.ToSlash(pattern), "./")
+	prefix := ""
+	if !strings.Contains(pattern, "/") {
+		prefix = "(?:.*/)?"
+	}
+	return regexp.Compile("^" + prefix + GlobToRegexp(pattern, true) + "$")
+}
+
+// dirsBetween returns root and the directories below it down to dir, top
+// first, or only dir when it isn't inside root
+func dirsBetween(root, dir string) []string {
+	rel, err := filepath.Rel(root, dir)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return []string{dir}
+	}
+	dirs := []string{root}
+	if rel == "." {
+		return dirs
+	}
+	current := root
+	for _, part := range strings.Split(rel, string(filepath.Separator)) {
+		current = filepath.Join(current, part)
+		dirs = append(dirs, current)
+	}
+	return dirs
+}
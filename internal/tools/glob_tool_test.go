@@ -0,0 +1,159 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// globWorkspace creates files under a temp workspace and returns its root
+func globWorkspace(t *testing.T, files map[string]string) string {
+	t.Helper()
+	root := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+func callGlob(t *testing.T, tool *GlobTool, args string) map[string]any {
+	t.Helper()
+	if err := tool.Check(context.Background(), json.RawMessage(args)); err != nil {
+		t.Fatalf("Check(%s) error = %v", args, err)
+	}
+	result, err := tool.Call(context.Background(), json.RawMessage(args))
+	if err != nil {
+		t.Fatalf("Call(%s) error = %v", args, err)
+	}
+	return result.(map[string]any)
+}
+
+func globFiles(result map[string]any) []string {
+	files, _ := result["files"].([]string)
+	return files
+}
+
+func TestGlobPatterns(t *testing.T) {
+	root := globWorkspace(t, map[string]string{
+		"main.go":              "",
+		"README.md":            "",
+		"cmd/app/main.go":      "",
+		"internal/x/x.go":      "",
+		"internal/x/x_test.go": "",
+		"web/a.ts":             "",
+		"web/b.tsx":            "",
+	})
+	cfg := newTestConfig()
+	cfg.Workspace.Root = root
+	tool := NewGlobTool(cfg, nil)
+
+	tests := []struct {
+		args string
+		want []string
+	}{
+		{`{"pattern": "*.go"}`, []string{"cmd/app/main.go", "internal/x/x.go", "internal/x/x_test.go", "main.go"}},
+		{`{"pattern": "internal/**/*_test.go"}`, []string{"internal/x/x_test.go"}},
+		{`{"pattern": "**/*.{ts,tsx}"}`, []string{"web/a.ts", "web/b.tsx"}},
+		{`{"pattern": "*.go", "path": "cmd"}`, []string{"cmd/app/main.go"}},
+		{`{"pattern": "app/main.go", "path": "cmd"}`, []string{"cmd/app/main.go"}},
+		{`{"pattern": "[A-Z]*.md"}`, []string{"README.md"}},
+		{`{"pattern": "*.rs"}`, nil},
+	}
+	for _, tt := range tests {
+		got := globFiles(callGlob(t, tool, tt.args))
+		for i := range got {
+			got[i] = filepath.ToSlash(got[i])
+		}
+		if len(got) == 0 && len(tt.want) == 0 {
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Glob %s = %v, want %v", tt.args, got, tt.want)
+		}
+	}
+}
+
+func TestGlobGitignore(t *testing.T) {
+	root := globWorkspace(t, map[string]string{
+		".gitignore":        "node_modules/\n*.log\n/build\n!keep.log\n",
+		"src/.gitignore":    "gen_*.go\n",
+		"src/a.go":          "",
+		"src/gen_b.go":      "",
+		"src/build/c.go":    "",
+		"build/d.go":        "",
+		"node_modules/e.js": "",
+		"debug.log":         "",
+		"keep.log":          "",
+		".git/config":       "",
+		".kvit-coder/tmp/f": "",
+	})
+	cfg := newTestConfig()
+	cfg.Workspace.Root = root
+	tool := NewGlobTool(cfg, nil)
+
+	got := globFiles(callGlob(t, tool, `{"pattern": "**"}`))
+	want := []string{".gitignore", "keep.log", "src/.gitignore", "src/a.go", "src/build/c.go"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Glob ** = %v, want %v", got, want)
+	}
+
+	// Rules above the search directory still apply
+	got = globFiles(callGlob(t, tool, `{"pattern": "*.go", "path": "src"}`))
+	if want := []string{"src/a.go", "src/build/c.go"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Glob in src = %v, want %v", got, want)
+	}
+
+	got = globFiles(callGlob(t, tool, `{"pattern": "*.go", "include_ignored": true}`))
+	if want := []string{"build/d.go", "src/a.go", "src/build/c.go", "src/gen_b.go"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Glob with ignored files = %v, want %v", got, want)
+	}
+}
+
+func TestGlobSortAndCap(t *testing.T) {
+	root := globWorkspace(t, map[string]string{"a.txt": "", "b.txt": "", "c.txt": ""})
+	old := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(filepath.Join(root, "a.txt"), old, old); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(filepath.Join(root, "c.txt"), old.Add(time.Minute), old.Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	cfg := newTestConfig()
+	cfg.Workspace.Root = root
+	cfg.Tools.Glob.MaxResults = 2
+	tool := NewGlobTool(cfg, NewTempFileManager(root))
+
+	result := callGlob(t, tool, `{"pattern": "*.txt", "sort": "mtime"}`)
+	if got, want := globFiles(result), []string{"b.txt", "c.txt"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("files = %v, want %v", got, want)
+	}
+	if result["total_files"] != 3 || result["truncated"] != true {
+		t.Errorf("total_files = %v, truncated = %v; want 3, true", result["total_files"], result["truncated"])
+	}
+	data, err := os.ReadFile(result["results_file"].(string))
+	if err != nil {
+		t.Fatalf("reading results_file: %v", err)
+	}
+	if string(data) != "b.txt\nc.txt\na.txt\n" {
+		t.Errorf("results_file = %q, want all three files", data)
+	}
+}
+
+func TestGlobCheck(t *testing.T) {
+	tool := NewGlobTool(newTestConfig(), nil)
+	for _, args := range []string{`{}`, `{"pattern": "*.go", "sort": "size"}`} {
+		if err := tool.Check(context.Background(), json.RawMessage(args)); !IsBacktrackable(err) {
+			t.Errorf("Check(%s) = %v, want a semantic error", args, err)
+		}
+	}
+}
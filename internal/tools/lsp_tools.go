@@ -0,0 +1,589 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/kvit-s/kvit-coder/internal/config"
+	"github.com/kvit-s/kvit-coder/internal/lsp"
+)
+
+const (
+	// defaultLSPTimeout applies when tools.lsp.timeout_seconds is unset
+	defaultLSPTimeout = 30 * time.Second
+	// defaultLSPMaxResults caps LSP.references when tools.lsp.max_results is unset
+	defaultLSPMaxResults = 100
+	// lspDiagnosticsWait is how long LSP.diagnostics waits for the server to
+	// finish analyzing a file
+	lspDiagnosticsWait = 10 * time.Second
+)
+
+// lspTool holds what the LSP.* tools share
+type lspTool struct {
+	codeTool
+	manager *lsp.Manager
+}
+
+func newLSPTool(cfg *config.Config, manager *lsp.Manager, tempFileMgr *TempFileManager) lspTool {
+	return lspTool{codeTool{config: cfg, workspaceRoot: cfg.Workspace.Root, tempFileMgr: tempFileMgr}, manager}
+}
+
+// lspParams are the arguments of the LSP.* tools. Line and column are
+// 1-based; symbol finds the column on the line.
+type lspParams struct {
+	Path               string `json:"path"`
+	Line               int    `json:"line"`
+	Column             int    `json:"column"`
+	Symbol             string `json:"symbol"`
+	IncludeDeclaration bool   `json:"include_declaration"`
+}
+
+func parseLSPParams(args json.RawMessage, needPosition bool) (lspParams, error) {
+	var params lspParams
+	if err := json.Unmarshal(args, &params); err != nil {
+		return params, SemanticErrorf("invalid arguments: %v", err)
+	}
+	if params.Path == "" {
+		return params, SemanticErrorf("path is required")
+	}
+	if !needPosition {
+		return params, nil
+	}
+	if params.Line < 1 {
+		return params, SemanticErrorf("line is required (1-based)")
+	}
+	if params.Column < 1 && params.Symbol == "" {
+		return params, SemanticErrorf("give the symbol on the line, or its column (1-based)")
+	}
+	return params, nil
+}
+
+// positionSchema returns the schema properties of a position argument
+func positionSchema() map[string]any {
+	return map[string]any{
+		"path": map[string]any{
+			"type":        "string",
+			"description": "File path",
+		},
+		"line": map[string]any{
+			"type":        "integer",
+			"description": "Line number (1-based)",
+		},
+		"symbol": map[string]any{
+			"type":        "string",
+			"description": "Name on that line to ask about (or give column)",
+		},
+		"column": map[string]any{
+			"type":        "integer",
+			"description": "Column (1-based), if symbol is not enough",
+		},
+	}
+}
+
+// client resolves the path argument and returns the server for it
+func (t *lspTool) client(ctx context.Context, p string) (*lsp.Client, string, error) {
+	fullPath, err := t.resolve("read", p)
+	if err != nil {
+		return nil, "", err
+	}
+	if info, err := os.Stat(fullPath); err != nil || info.IsDir() {
+		return nil, "", RuntimeErrorf("file not found: %s", p)
+	}
+	if _, ok := t.manager.Server(fullPath); !ok {
+		return nil, "", RuntimeErrorf("no language server configured for %s. Servers are configured for: %s",
+			p, strings.Join(t.manager.Extensions(), ", "))
+	}
+	c, err := t.manager.Client(ctx, fullPath)
+	if err != nil {
+		return nil, "", RuntimeErrorf("starting language server: %v", err)
+	}
+	return c, fullPath, nil
+}
+
+// position converts the line and symbol or column arguments to an LSP position
+func (t *lspTool) position(fullPath string, params lspParams) (lsp.Position, error) {
+	lines := make(sourceLines)
+	text, ok := lines.line(fullPath, params.Line-1)
+	if !ok {
+		return lsp.Position{}, SemanticErrorf("line %d is past the end of %s", params.Line, params.Path)
+	}
+	column := params.Column - 1
+	if params.Symbol != "" {
+		loc := regexp.MustCompile(`\b` + regexp.QuoteMeta(params.Symbol) + `\b`).FindStringIndex(text)
+		if loc == nil {
+			loc = regexp.MustCompile(regexp.QuoteMeta(params.Symbol)).FindStringIndex(text)
+		}
+		if loc == nil {
+			return lsp.Position{}, SemanticErrorf("%q is not on line %d of %s: %s", params.Symbol, params.Line, params.Path, strings.TrimSpace(text))
+		}
+		column = len([]rune(text[:loc[0]]))
+	}
+	return lsp.Position{Line: params.Line - 1, Character: lsp.UTF16Offset(text, column)}, nil
+}
+
+// timeout returns the time a request may take
+func (t *lspTool) timeout() time.Duration {
+	if t.config.Tools.LSP.TimeoutSeconds > 0 {
+		return time.Duration(t.config.Tools.LSP.TimeoutSeconds) * time.Second
+	}
+	return defaultLSPTimeout
+}
+
+// sourceLines reads the lines of the files results point into, once per file
+type sourceLines map[string][]string
+
+// line returns line n (0-based) of path
+func (s sourceLines) line(path string, n int) (string, bool) {
+	lines, ok := s[path]
+	if !ok {
+		if data, err := os.ReadFile(path); err == nil {
+			lines = strings.Split(string(data), "\n")
+		}
+		s[path] = lines
+	}
+	if n < 0 || n >= len(lines) {
+		return "", false
+	}
+	return strings.TrimSuffix(lines[n], "\r"), true
+}
+
+// locationJSON turns a location into the result format, with 1-based lines
+// and columns and the text of its first line
+func (t *lspTool) locationJSON(loc lsp.Location, lines sourceLines, withRange bool) map[string]any {
+	path := loc.Path()
+	text, _ := lines.line(path, loc.Range.Start.Line)
+	m := map[string]any{
+		"file":   t.display(path),
+		"column": lsp.RuneColumn(text, loc.Range.Start.Character) + 1,
+		"text":   strings.TrimSpace(text),
+	}
+	if withRange {
+		m["start_line"] = loc.Range.Start.Line + 1
+		m["end_line"] = endLine(loc.Range)
+	} else {
+		m["line"] = loc.Range.Start.Line + 1
+	}
+	return m
+}
+
+// endLine returns the last line (1-based) of a range. A range ending at the
+// start of a line doesn't include that line.
+func endLine(r lsp.Range) int {
+	if r.End.Character == 0 && r.End.Line > r.Start.Line {
+		return r.End.Line
+	}
+	return r.End.Line + 1
+}
+
+// LSPHoverTool shows what a language server knows about a symbol
+type LSPHoverTool struct {
+	lspTool
+}
+
+func NewLSPHoverTool(cfg *config.Config, manager *lsp.Manager) *LSPHoverTool {
+	return &LSPHoverTool{newLSPTool(cfg, manager, nil)}
+}
+
+func (t *LSPHoverTool) Name() string { return "LSP.hover" }
+
+func (t *LSPHoverTool) Description() string {
+	return "Ask the language server for the type, signature and documentation of a symbol at a position."
+}
+
+func (t *LSPHoverTool) ReadOnly() bool { return true }
+
+func (t *LSPHoverTool) JSONSchema() map[string]any {
+	return map[string]any{
+		"type":       "object",
+		"properties": positionSchema(),
+		"required":   []string{"path", "line"},
+	}
+}
+
+func (t *LSPHoverTool) Check(ctx context.Context, args json.RawMessage) error {
+	_, err := parseLSPParams(args, true)
+	return err
+}
+
+func (t *LSPHoverTool) PromptCategory() string { return "filesystem" }
+func (t *LSPHoverTool) PromptOrder() int       { return 9 }
+func (t *LSPHoverTool) PromptSection() string {
+	return `### LSP.hover / LSP.definition / LSP.references / LSP.symbols / LSP.diagnostics - Language Servers
+
+Ask a language server about files with these extensions: ` + strings.Join(t.manager.Extensions(), ", ") + `.
+
+**Usage:**
+- ` + "`" + `LSP.symbols {"path": "app/models.py"}` + "`" + ` - declarations of a file with their line ranges
+- ` + "`" + `LSP.hover {"path": "app/views.py", "line": 42, "symbol": "render"}` + "`" + ` - type and documentation
+- ` + "`" + `LSP.definition {"path": "app/views.py", "line": 42, "symbol": "render"}` + "`" + ` - where it is declared
+- ` + "`" + `LSP.references {"path": "app/models.py", "line": 10, "symbol": "User"}` + "`" + ` - where it is used
+- ` + "`" + `LSP.diagnostics {"path": "app/views.py"}` + "`" + ` - errors and warnings, e.g. after an edit
+
+A position is a line plus the symbol on it (or its column). Lines in results are 1-based, ready for Read and line-mode Edit.`
+}
+
+func (t *LSPHoverTool) Call(ctx context.Context, args json.RawMessage) (any, error) {
+	params, err := parseLSPParams(args, true)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, t.timeout())
+	defer cancel()
+	c, fullPath, err := t.client(ctx, params.Path)
+	if err != nil {
+		return nil, err
+	}
+	pos, err := t.position(fullPath, params)
+	if err != nil {
+		return nil, err
+	}
+	text, err := c.Hover(ctx, fullPath, pos)
+	if err != nil {
+		return nil, RuntimeErrorf("%v", err)
+	}
+	if text == "" {
+		return map[string]any{"success": true, "message": "No information at this position"}, nil
+	}
+	return map[string]any{"success": true, "hover": text}, nil
+}
+
+// LSPDefinitionTool finds where a symbol is declared
+type LSPDefinitionTool struct {
+	lspTool
+}
+
+func NewLSPDefinitionTool(cfg *config.Config, manager *lsp.Manager) *LSPDefinitionTool {
+	return &LSPDefinitionTool{newLSPTool(cfg, manager, nil)}
+}
+
+func (t *LSPDefinitionTool) Name() string { return "LSP.definition" }
+
+func (t *LSPDefinitionTool) Description() string {
+	return "Ask the language server where the symbol at a position is declared."
+}
+
+func (t *LSPDefinitionTool) ReadOnly() bool { return true }
+
+func (t *LSPDefinitionTool) JSONSchema() map[string]any {
+	return map[string]any{
+		"type":       "object",
+		"properties": positionSchema(),
+		"required":   []string{"path", "line"},
+	}
+}
+
+func (t *LSPDefinitionTool) Check(ctx context.Context, args json.RawMessage) error {
+	_, err := parseLSPParams(args, true)
+	return err
+}
+
+func (t *LSPDefinitionTool) PromptCategory() string { return "filesystem" }
+func (t *LSPDefinitionTool) PromptOrder() int       { return 10 }
+func (t *LSPDefinitionTool) PromptSection() string  { return "" } // Covered by LSP.hover
+
+func (t *LSPDefinitionTool) Call(ctx context.Context, args json.RawMessage) (any, error) {
+	params, err := parseLSPParams(args, true)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, t.timeout())
+	defer cancel()
+	c, fullPath, err := t.client(ctx, params.Path)
+	if err != nil {
+		return nil, err
+	}
+	pos, err := t.position(fullPath, params)
+	if err != nil {
+		return nil, err
+	}
+	locs, err := c.Definition(ctx, fullPath, pos)
+	if err != nil {
+		return nil, RuntimeErrorf("%v", err)
+	}
+	if len(locs) == 0 {
+		return nil, RuntimeErrorf("the language server found no declaration at %s:%d", params.Path, params.Line)
+	}
+	lines := make(sourceLines)
+	defs := make([]map[string]any, len(locs))
+	for i, loc := range locs {
+		defs[i] = t.locationJSON(loc, lines, true)
+	}
+	return map[string]any{"success": true, "definitions": defs}, nil
+}
+
+// LSPReferencesTool finds where a symbol is used
+type LSPReferencesTool struct {
+	lspTool
+}
+
+func NewLSPReferencesTool(cfg *config.Config, manager *lsp.Manager, tempFileMgr *TempFileManager) *LSPReferencesTool {
+	return &LSPReferencesTool{newLSPTool(cfg, manager, tempFileMgr)}
+}
+
+func (t *LSPReferencesTool) Name() string { return "LSP.references" }
+
+func (t *LSPReferencesTool) Description() string {
+	return "Ask the language server where the symbol at a position is used across the project."
+}
+
+func (t *LSPReferencesTool) ReadOnly() bool { return true }
+
+func (t *LSPReferencesTool) JSONSchema() map[string]any {
+	properties := positionSchema()
+	properties["include_declaration"] = map[string]any{
+		"type":        "boolean",
+		"description": "Also list the declaration (default: false)",
+	}
+	return map[string]any{
+		"type":       "object",
+		"properties": properties,
+		"required":   []string{"path", "line"},
+	}
+}
+
+func (t *LSPReferencesTool) Check(ctx context.Context, args json.RawMessage) error {
+	_, err := parseLSPParams(args, true)
+	return err
+}
+
+func (t *LSPReferencesTool) PromptCategory() string { return "filesystem" }
+func (t *LSPReferencesTool) PromptOrder() int       { return 11 }
+func (t *LSPReferencesTool) PromptSection() string  { return "" } // Covered by LSP.hover
+
+func (t *LSPReferencesTool) Call(ctx context.Context, args json.RawMessage) (any, error) {
+	params, err := parseLSPParams(args, true)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, t.timeout())
+	defer cancel()
+	c, fullPath, err := t.client(ctx, params.Path)
+	if err != nil {
+		return nil, err
+	}
+	pos, err := t.position(fullPath, params)
+	if err != nil {
+		return nil, err
+	}
+	locs, err := c.References(ctx, fullPath, pos, params.IncludeDeclaration)
+	if err != nil {
+		return nil, RuntimeErrorf("%v", err)
+	}
+
+	lines := make(sourceLines)
+	items := make([]map[string]any, len(locs))
+	for i, loc := range locs {
+		items[i] = t.locationJSON(loc, lines, false)
+	}
+	result := map[string]any{
+		"success":          true,
+		"references":       items,
+		"total_references": len(items),
+	}
+	if len(items) == 0 {
+		result["message"] = "No uses found"
+		return result, nil
+	}
+
+	// Too many references - list the first ones and save all to a temp file
+	maxResults := t.config.Tools.LSP.MaxResults
+	if maxResults <= 0 {
+		maxResults = defaultLSPMaxResults
+	}
+	if len(items) > maxResults {
+		result["references"] = items[:maxResults]
+		result["truncated"] = true
+		result["message"] = fmt.Sprintf("Too many references (%d). First %d shown.", len(items), maxResults)
+		if t.tempFileMgr != nil {
+			if tempFile, err := t.tempFileMgr.CreateTempFile(); err == nil {
+				defer tempFile.Close()
+				for _, item := range items {
+					fmt.Fprintf(tempFile, "%s:%d:%d: %s\n", item["file"], item["line"], item["column"], item["text"])
+				}
+				result["results_file"] = tempFile.Name()
+				result["hint"] = fmt.Sprintf("Full results: %s", tempFile.Name())
+			}
+		}
+	}
+	return result, nil
+}
+
+// LSPSymbolsTool lists the declarations of a file
+type LSPSymbolsTool struct {
+	lspTool
+}
+
+func NewLSPSymbolsTool(cfg *config.Config, manager *lsp.Manager) *LSPSymbolsTool {
+	return &LSPSymbolsTool{newLSPTool(cfg, manager, nil)}
+}
+
+func (t *LSPSymbolsTool) Name() string { return "LSP.symbols" }
+
+func (t *LSPSymbolsTool) Description() string {
+	return "Ask the language server for the declarations of a file, with their line ranges."
+}
+
+func (t *LSPSymbolsTool) ReadOnly() bool { return true }
+
+func (t *LSPSymbolsTool) JSONSchema() map[string]any {
+	return map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"path": map[string]any{
+				"type":        "string",
+				"description": "File path",
+			},
+		},
+		"required": []string{"path"},
+	}
+}
+
+func (t *LSPSymbolsTool) Check(ctx context.Context, args json.RawMessage) error {
+	_, err := parseLSPParams(args, false)
+	return err
+}
+
+func (t *LSPSymbolsTool) PromptCategory() string { return "filesystem" }
+func (t *LSPSymbolsTool) PromptOrder() int       { return 12 }
+func (t *LSPSymbolsTool) PromptSection() string  { return "" } // Covered by LSP.hover
+
+func (t *LSPSymbolsTool) Call(ctx context.Context, args json.RawMessage) (any, error) {
+	params, err := parseLSPParams(args, false)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, t.timeout())
+	defer cancel()
+	c, fullPath, err := t.client(ctx, params.Path)
+	if err != nil {
+		return nil, err
+	}
+	symbols, err := c.Symbols(ctx, fullPath)
+	if err != nil {
+		return nil, RuntimeErrorf("%v", err)
+	}
+	return map[string]any{
+		"success": true,
+		"file":    t.display(fullPath),
+		"symbols": symbolsJSON(symbols),
+	}, nil
+}
+
+func symbolsJSON(symbols []lsp.Symbol) []map[string]any {
+	items := make([]map[string]any, len(symbols))
+	for i, s := range symbols {
+		items[i] = map[string]any{
+			"name":       s.Name,
+			"kind":       s.Kind,
+			"start_line": s.Range.Start.Line + 1,
+			"end_line":   endLine(s.Range),
+		}
+		if s.Detail != "" {
+			items[i]["detail"] = s.Detail
+		}
+		if s.Container != "" {
+			items[i]["container"] = s.Container
+		}
+		if len(s.Children) > 0 {
+			items[i]["children"] = symbolsJSON(s.Children)
+		}
+	}
+	return items
+}
+
+// LSPDiagnosticsTool shows the errors and warnings of a file
+type LSPDiagnosticsTool struct {
+	lspTool
+}
+
+func NewLSPDiagnosticsTool(cfg *config.Config, manager *lsp.Manager) *LSPDiagnosticsTool {
+	return &LSPDiagnosticsTool{newLSPTool(cfg, manager, nil)}
+}
+
+func (t *LSPDiagnosticsTool) Name() string { return "LSP.diagnostics" }
+
+func (t *LSPDiagnosticsTool) Description() string {
+	return "Ask the language server for the errors and warnings in a file, as it is now on disk."
+}
+
+func (t *LSPDiagnosticsTool) ReadOnly() bool { return true }
+
+func (t *LSPDiagnosticsTool) JSONSchema() map[string]any {
+	return map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"path": map[string]any{
+				"type":        "string",
+				"description": "File path",
+			},
+		},
+		"required": []string{"path"},
+	}
+}
+
+func (t *LSPDiagnosticsTool) Check(ctx context.Context, args json.RawMessage) error {
+	_, err := parseLSPParams(args, false)
+	return err
+}
+
+func (t *LSPDiagnosticsTool) PromptCategory() string { return "filesystem" }
+func (t *LSPDiagnosticsTool) PromptOrder() int       { return 13 }
+func (t *LSPDiagnosticsTool) PromptSection() string  { return "" } // Covered by LSP.hover
+
+func (t *LSPDiagnosticsTool) Call(ctx context.Context, args json.RawMessage) (any, error) {
+	params, err := parseLSPParams(args, false)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, t.timeout())
+	defer cancel()
+	c, fullPath, err := t.client(ctx, params.Path)
+	if err != nil {
+		return nil, err
+	}
+	diags, published, err := c.Diagnostics(ctx, fullPath, lspDiagnosticsWait)
+	if err != nil {
+		return nil, RuntimeErrorf("%v", err)
+	}
+	if !published {
+		return nil, RuntimeErrorf("%s reported no diagnostics for %s within %s; it may still be analyzing, try again",
+			c.Name(), params.Path, lspDiagnosticsWait)
+	}
+
+	lines := make(sourceLines)
+	items := make([]map[string]any, len(diags))
+	errorCount := 0
+	for i, d := range diags {
+		text, _ := lines.line(fullPath, d.Range.Start.Line)
+		items[i] = map[string]any{
+			"severity": d.SeverityName(),
+			"line":     d.Range.Start.Line + 1,
+			"column":   lsp.RuneColumn(text, d.Range.Start.Character) + 1,
+			"message":  d.Message,
+		}
+		if d.Source != "" {
+			items[i]["source"] = d.Source
+		}
+		if len(d.Code) > 0 {
+			items[i]["code"] = strings.Trim(string(d.Code), `"`)
+		}
+		if d.Severity == lsp.SeverityError || d.Severity == 0 {
+			errorCount++
+		}
+	}
+	result := map[string]any{
+		"success":     true,
+		"file":        t.display(fullPath),
+		"diagnostics": items,
+		"errors":      errorCount,
+	}
+	if len(items) == 0 {
+		result["message"] = "No errors or warnings"
+	}
+	return result, nil
+}
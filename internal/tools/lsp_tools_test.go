@@ -0,0 +1,97 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/kvit-s/kvit-coder/internal/config"
+	"github.com/kvit-s/kvit-coder/internal/lsp"
+	"github.com/kvit-s/kvit-coder/internal/lsp/lsptest"
+)
+
+// TestMain lets the test binary double as the fake language server
+func TestMain(m *testing.M) {
+	lsptest.MainIfServer()
+	os.Exit(m.Run())
+}
+
+func TestLSPTools(t *testing.T) {
+	root := globWorkspace(t, map[string]string{
+		"lib.fk":   "def greet\n",
+		"main.fk":  "# main\ncall greet\ncall greet\n",
+		"bad.fk":   "def wave\n# héllo\ncall wave\ncall gone\n",
+		"notes.md": "call greet\n",
+	})
+	cfg := newTestConfig()
+	cfg.Workspace.Root = root
+	mgr := lsp.NewManager(root, []config.LSPServerConfig{lsptest.Server(".fk")})
+	defer mgr.Shutdown(context.Background())
+	ctx := context.Background()
+
+	call := func(tool Tool, args string) map[string]any {
+		t.Helper()
+		if err := tool.Check(ctx, json.RawMessage(args)); err != nil {
+			t.Fatalf("%s Check(%s) error = %v", tool.Name(), args, err)
+		}
+		result, err := tool.Call(ctx, json.RawMessage(args))
+		if err != nil {
+			t.Fatalf("%s(%s) error = %v", tool.Name(), args, err)
+		}
+		return result.(map[string]any)
+	}
+
+	// The fake server only searches files it has seen, so lib.fk goes first
+	symbols := call(NewLSPSymbolsTool(cfg, mgr), `{"path": "lib.fk"}`)["symbols"].([]map[string]any)
+	if len(symbols) != 1 || symbols[0]["name"] != "greet" || symbols[0]["kind"] != "function" || symbols[0]["start_line"] != 1 {
+		t.Errorf("LSP.symbols = %v, want greet on line 1", symbols)
+	}
+
+	def := call(NewLSPDefinitionTool(cfg, mgr), `{"path": "main.fk", "line": 2, "symbol": "greet"}`)
+	d := def["definitions"].([]map[string]any)[0]
+	if d["file"] != "lib.fk" || d["start_line"] != 1 || d["end_line"] != 1 || d["column"] != 5 {
+		t.Errorf("LSP.definition = %v, want lib.fk line 1 column 5", d)
+	}
+
+	refs := call(NewLSPReferencesTool(cfg, mgr, nil), `{"path": "lib.fk", "line": 1, "column": 5}`)
+	items := refs["references"].([]map[string]any)
+	if len(items) != 2 || items[0]["file"] != "main.fk" || items[0]["line"] != 2 || items[1]["text"] != "call greet" {
+		t.Errorf("LSP.references = %v, want lines 2 and 3 of main.fk", items)
+	}
+
+	hover := call(NewLSPHoverTool(cfg, mgr), `{"path": "main.fk", "line": 3, "symbol": "greet"}`)
+	if hover["hover"] != "```fake\ndef greet\n```" {
+		t.Errorf("LSP.hover = %v", hover)
+	}
+
+	diags := call(NewLSPDiagnosticsTool(cfg, mgr), `{"path": "bad.fk"}`)
+	list := diags["diagnostics"].([]map[string]any)
+	if diags["errors"] != 1 || len(list) != 1 || list[0]["line"] != 4 || list[0]["column"] != 6 || list[0]["message"] != "undefined: gone" {
+		t.Errorf("LSP.diagnostics = %v, want undefined: gone at 4:6", diags)
+	}
+
+	// Files no server handles, and symbols that aren't on the line
+	if _, err := NewLSPSymbolsTool(cfg, mgr).Call(ctx, json.RawMessage(`{"path": "notes.md"}`)); err == nil || IsBacktrackable(err) {
+		t.Errorf("LSP.symbols on notes.md error = %v, want a runtime error", err)
+	}
+	if _, err := NewLSPHoverTool(cfg, mgr).Call(ctx, json.RawMessage(`{"path": "main.fk", "line": 1, "symbol": "greet"}`)); err == nil || !IsBacktrackable(err) {
+		t.Errorf("LSP.hover with a symbol not on the line error = %v, want a semantic error", err)
+	}
+}
+
+func TestLSPPositionColumns(t *testing.T) {
+	root := globWorkspace(t, map[string]string{"a.fk": "x := \"é😀\" + greet\n"})
+	cfg := newTestConfig()
+	cfg.Workspace.Root = root
+	tool := newLSPTool(cfg, lsp.NewManager(root, nil), nil)
+
+	pos, err := tool.position(root+"/a.fk", lspParams{Path: "a.fk", Line: 1, Symbol: "greet"})
+	if err != nil {
+		t.Fatalf("position() error = %v", err)
+	}
+	// The emoji takes two UTF-16 code units
+	if pos.Line != 0 || pos.Character != 13 {
+		t.Errorf("position() = %+v, want 0:13", pos)
+	}
+}
@@ -0,0 +1,95 @@
+package tools
+
+// PendingState is the previewed edit and write waiting for confirmation, in
+// a form that can be saved with a run and restored when it resumes
+type PendingState struct {
+	Edit  *SavedEdit  `json:"edit,omitempty"`
+	Write *SavedWrite `json:"write,omitempty"`
+}
+
+// SavedEdit is a pending edit as saved with a run
+type SavedEdit struct {
+	Path          string `json:"path"`
+	FullPath      string `json:"full_path"`
+	OldContent    string `json:"old_content"`
+	NewContent    string `json:"new_content"`
+	Diff          string `json:"diff"`
+	IsNewFile     bool   `json:"is_new_file,omitempty"`
+	EditStartLine int    `json:"edit_start_line"`
+	EditEndLine   int    `json:"edit_end_line"`
+}
+
+// SavedWrite is a pending write as saved with a run
+type SavedWrite struct {
+	Path     string `json:"path"`
+	FullPath string `json:"full_path"`
+	Content  string `json:"content"`
+	OldSize  int64  `json:"old_size"`
+	OldLines int    `json:"old_lines"`
+}
+
+// SnapshotPending returns the pending edit and write, if any
+func SnapshotPending() PendingState {
+	var s PendingState
+
+	pendingEditMu.Lock()
+	if e := globalPendingEdit; e != nil {
+		s.Edit = &SavedEdit{
+			Path:          e.path,
+			FullPath:      e.fullPath,
+			OldContent:    e.oldContent,
+			NewContent:    e.newContent,
+			Diff:          e.diff,
+			IsNewFile:     e.isNewFile,
+			EditStartLine: e.editStartLine,
+			EditEndLine:   e.editEndLine,
+		}
+	}
+	pendingEditMu.Unlock()
+
+	pendingWriteMu.Lock()
+	if w := globalPendingWrite; w != nil {
+		s.Write = &SavedWrite{
+			Path:     w.path,
+			FullPath: w.fullPath,
+			Content:  w.content,
+			OldSize:  w.oldSize,
+			OldLines: w.oldLines,
+		}
+	}
+	pendingWriteMu.Unlock()
+
+	return s
+}
+
+// RestorePending replaces the pending edit and write with the saved ones
+func RestorePending(s PendingState) {
+	pendingEditMu.Lock()
+	globalPendingEdit = nil
+	if e := s.Edit; e != nil {
+		globalPendingEdit = &pendingEdit{
+			path:          e.Path,
+			fullPath:      e.FullPath,
+			oldContent:    e.OldContent,
+			newContent:    e.NewContent,
+			diff:          e.Diff,
+			isNewFile:     e.IsNewFile,
+			editStartLine: e.EditStartLine,
+			editEndLine:   e.EditEndLine,
+		}
+	}
+	pendingEditMu.Unlock()
+
+	pendingWriteMu.Lock()
+	globalPendingWrite = nil
+	if w := s.Write; w != nil {
+		globalPendingWrite = &pendingWrite{
+			path:     w.Path,
+			fullPath: w.FullPath,
+			content:  w.Content,
+			oldSize:  w.OldSize,
+			oldLines: w.OldLines,
+		}
+	}
+	pendingWriteMu.Unlock()
+}
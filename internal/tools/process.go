@@ -0,0 +1,697 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/kvit-s/kvit-coder/internal/config"
+)
+
+const (
+	defaultMaxProcesses = 8                      // running at once when tools.process.max_processes is unset
+	defaultStartWait    = 1 * time.Second        // Process.start shows what the command printed in this time
+	maxProcessWait      = 60 * time.Second       // longest wait Process.start and Process.output accept
+	processPollInterval = 100 * time.Millisecond // how often a wait checks for new output
+)
+
+// ProcessManager keeps the commands started with Process.start running in
+// the background for the rest of the session. Each one writes stdout and
+// stderr to a log file; Process.output returns what was added since the
+// last check.
+type ProcessManager struct {
+	tempFileMgr  *TempFileManager
+	maxProcesses int
+
+	mu     sync.Mutex
+	nextID int
+	procs  map[string]*backgroundProcess
+}
+
+// backgroundProcess is a command started with Process.start
+type backgroundProcess struct {
+	id      string
+	command string
+	cmd     *exec.Cmd
+	stdin   io.WriteCloser
+	logPath string
+	started time.Time
+
+	done     chan struct{} // closed when the process has exited
+	exitCode int           // valid once done is closed
+
+	mu     sync.Mutex
+	offset int64 // how much of the log Process.output has returned
+	killed bool
+}
+
+// NewProcessManager creates a manager allowing maxProcesses running at once
+// (0 = default)
+func NewProcessManager(tempFileMgr *TempFileManager, maxProcesses int) *ProcessManager {
+	if maxProcesses <= 0 {
+		maxProcesses = defaultMaxProcesses
+	}
+	return &ProcessManager{
+		tempFileMgr:  tempFileMgr,
+		maxProcesses: maxProcesses,
+		procs:        make(map[string]*backgroundProcess),
+	}
+}
+
+// start runs command with sh in workDir, in its own process group
+func (m *ProcessManager) start(command, workDir string) (*backgroundProcess, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	running := 0
+	for _, p := range m.procs {
+		if p.running() {
+			running++
+		}
+	}
+	if running >= m.maxProcesses {
+		return nil, fmt.Errorf("%d processes are already running; kill one with Process.kill first", running)
+	}
+
+	logFile, err := m.tempFileMgr.CreateTempFile()
+	if err != nil {
+		return nil, err
+	}
+	// The process writes to the log directly; our handle isn't needed after Start
+	defer logFile.Close()
+
+	cmd := exec.Command("sh", "-c", command)
+	cmd.Dir = workDir
+	cmd.Stdout = logFile
+	cmd.Stderr = logFile
+	// A process group of its own, so killing it also stops its children
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start command: %w", err)
+	}
+
+	m.nextID++
+	p := &backgroundProcess{
+		id:      "p" + strconv.Itoa(m.nextID),
+		command: command,
+		cmd:     cmd,
+		stdin:   stdin,
+		logPath: logFile.Name(),
+		started: time.Now(),
+		done:    make(chan struct{}),
+	}
+	go func() {
+		if err := cmd.Wait(); err != nil {
+			p.exitCode = -1
+			if exitErr, ok := err.(*exec.ExitError); ok {
+				p.exitCode = exitErr.ExitCode()
+			}
+		}
+		close(p.done)
+	}()
+	m.procs[p.id] = p
+	return p, nil
+}
+
+// get returns the process with the given handle
+func (m *ProcessManager) get(id string) (*backgroundProcess, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	p, ok := m.procs[id]
+	return p, ok
+}
+
+// list returns every process, oldest first
+func (m *ProcessManager) list() []*backgroundProcess {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	procs := make([]*backgroundProcess, 0, len(m.procs))
+	for _, p := range m.procs {
+		procs = append(procs, p)
+	}
+	sort.Slice(procs, func(i, j int) bool { return procs[i].started.Before(procs[j].started) })
+	return procs
+}
+
+// kill stops a process and its children and forgets it
+func (m *ProcessManager) kill(id string) (*backgroundProcess, bool) {
+	m.mu.Lock()
+	p, ok := m.procs[id]
+	delete(m.procs, id)
+	m.mu.Unlock()
+	if ok {
+		p.kill()
+	}
+	return p, ok
+}
+
+// KillAll stops every process; called when the session ends
+func (m *ProcessManager) KillAll() {
+	m.mu.Lock()
+	procs := m.procs
+	m.procs = make(map[string]*backgroundProcess)
+	m.mu.Unlock()
+	for _, p := range procs {
+		p.kill()
+	}
+}
+
+func (p *backgroundProcess) running() bool {
+	select {
+	case <-p.done:
+		return false
+	default:
+		return true
+	}
+}
+
+// kill stops the process group even when sh itself has exited, so commands
+// it left running in the background (server &) go too. The group ID is the
+// leader's PID, which isn't reused while the group has members.
+func (p *backgroundProcess) kill() {
+	if p.running() {
+		p.mu.Lock()
+		p.killed = true
+		p.mu.Unlock()
+	}
+	_ = syscall.Kill(-p.cmd.Process.Pid, syscall.SIGKILL)
+	p.stdin.Close()
+	<-p.done
+}
+
+// unread returns the output added to the log since the last call
+func (p *backgroundProcess) unread() ([]byte, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	f, err := os.Open(p.logPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if _, err := f.Seek(p.offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(f)
+	p.offset += int64(len(data))
+	return data, err
+}
+
+// wait collects new output until the process exits, until matches it, or
+// the wait is over
+func (p *backgroundProcess) wait(ctx context.Context, wait time.Duration, until *regexp.Regexp) ([]byte, error) {
+	output, err := p.unread()
+	if err != nil {
+		return nil, err
+	}
+	deadline := time.NewTimer(wait)
+	defer deadline.Stop()
+	ticker := time.NewTicker(processPollInterval)
+	defer ticker.Stop()
+	for wait > 0 && (until == nil || !until.Match(output)) {
+		select {
+		case <-p.done:
+			more, err := p.unread()
+			return append(output, more...), err
+		case <-deadline.C:
+			return output, nil
+		case <-ctx.Done():
+			return output, nil
+		case <-ticker.C:
+		}
+		more, err := p.unread()
+		if err != nil {
+			return output, err
+		}
+		output = append(output, more...)
+	}
+	return output, nil
+}
+
+// state describes the process for results
+func (p *backgroundProcess) state() map[string]any {
+	s := map[string]any{
+		"id":       p.id,
+		"command":  p.command,
+		"pid":      p.cmd.Process.Pid,
+		"log_file": p.logPath,
+	}
+	select {
+	case <-p.done:
+		s["status"] = "exited"
+		p.mu.Lock()
+		killed := p.killed
+		p.mu.Unlock()
+		if killed {
+			s["status"] = "killed"
+		}
+		s["exit_code"] = p.exitCode
+	default:
+		s["status"] = "running"
+		s["running_for"] = time.Since(p.started).Round(time.Second).String()
+	}
+	return s
+}
+
+// formatOutput truncates output the way OutputBuffer does. The log file
+// keeps all of it, so that is where the notice points.
+func (p *backgroundProcess) formatOutput(output []byte) string {
+	result := TruncateContent(output, DefaultMaxLines, DefaultMaxBytes, maxLLMLines, maxLLMBytes)
+	if !result.WasTruncated {
+		return result.Content
+	}
+	var sb strings.Builder
+	sb.WriteString("───────────────────────────────────────────────────────\n")
+	sb.WriteString("⚠️  PROCESS OUTPUT TRUNCATED\n")
+	sb.WriteString(fmt.Sprintf("   New output: %d lines, %d bytes\n", result.TotalLines, result.TotalBytes))
+	sb.WriteString(fmt.Sprintf("   Complete log: %s\n", p.logPath))
+	sb.WriteString("   Use read to investigate the full output\n")
+	sb.WriteString("───────────────────────────────────────────────────────\n\n")
+	sb.WriteString(result.Content)
+	return sb.String()
+}
+
+// processResult is the state of a process with its new output
+func processResult(p *backgroundProcess, output []byte) map[string]any {
+	result := p.state()
+	result["success"] = true
+	if len(output) > 0 {
+		result["output"] = p.formatOutput(output)
+	} else {
+		result["output"] = ""
+	}
+	return result
+}
+
+// processParams are the arguments of the Process.* tools
+type processParams struct {
+	ID         string  `json:"id"`
+	Command    string  `json:"command"`
+	WorkingDir string  `json:"working_dir"`
+	Wait       float64 `json:"wait"`
+	Until      string  `json:"until"`
+	Input      string  `json:"input"`
+	CloseStdin bool    `json:"close_stdin"`
+}
+
+func parseProcessParams(args json.RawMessage) (processParams, *regexp.Regexp, error) {
+	var params processParams
+	if err := json.Unmarshal(args, &params); err != nil {
+		return params, nil, SemanticErrorf("invalid arguments: %v", err)
+	}
+	if params.Wait < 0 || time.Duration(params.Wait*float64(time.Second)) > maxProcessWait {
+		return params, nil, SemanticErrorf("wait must be between 0 and %d seconds", int(maxProcessWait.Seconds()))
+	}
+	var until *regexp.Regexp
+	if params.Until != "" {
+		var err error
+		if until, err = regexp.Compile(params.Until); err != nil {
+			return params, nil, SemanticErrorf("invalid until pattern: %v", err)
+		}
+	}
+	return params, until, nil
+}
+
+// waitDuration returns how long to wait for output: the wait argument, as
+// long as allowed when there is only an until pattern, or def
+func waitDuration(params processParams, until *regexp.Regexp, def time.Duration) time.Duration {
+	switch {
+	case params.Wait > 0:
+		return time.Duration(params.Wait * float64(time.Second))
+	case until != nil:
+		return maxProcessWait
+	default:
+		return def
+	}
+}
+
+// waitSchema returns the schema properties of the wait and until arguments
+func waitSchema(properties map[string]any) map[string]any {
+	properties["wait"] = map[string]any{
+		"type":        "number",
+		"description": "Seconds to wait for output (max 60, the default with until); returns early when the process exits",
+	}
+	properties["until"] = map[string]any{
+		"type":        "string",
+		"description": "Regex; stop waiting as soon as the new output matches it",
+	}
+	return properties
+}
+
+// processTool holds what the Process.* tools share
+type processTool struct {
+	manager *ProcessManager
+}
+
+// process returns the process with the handle in params
+func (t *processTool) process(params processParams) (*backgroundProcess, error) {
+	if params.ID == "" {
+		return nil, SemanticErrorf("id is required (from Process.start)")
+	}
+	p, ok := t.manager.get(params.ID)
+	if !ok {
+		return nil, SemanticErrorf("no process %q. Process.list shows the current ones", params.ID)
+	}
+	return p, nil
+}
+
+func idSchema() map[string]any {
+	return map[string]any{
+		"type":        "string",
+		"description": "Process handle from Process.start, e.g. \"p1\"",
+	}
+}
+
+// ProcessStartTool starts a command in the background
+type ProcessStartTool struct {
+	processTool
+	shell *ShellAdvancedTool
+}
+
+func NewProcessStartTool(cfg *config.Config, manager *ProcessManager, tempFileMgr *TempFileManager) *ProcessStartTool {
+	return &ProcessStartTool{
+		processTool: processTool{manager},
+		shell:       NewShellAdvancedTool(cfg, 0, tempFileMgr),
+	}
+}
+
+func (t *ProcessStartTool) Name() string { return "Process.start" }
+
+func (t *ProcessStartTool) Description() string {
+	return "Start a long-running command (dev server, watcher, long test run) in the background and return a handle for the other Process tools."
+}
+
+func (t *ProcessStartTool) JSONSchema() map[string]any {
+	return map[string]any{
+		"type": "object",
+		"properties": waitSchema(map[string]any{
+			"command": map[string]any{
+				"type":        "string",
+				"description": "The shell command to run",
+			},
+			"working_dir": map[string]any{
+				"type":        "string",
+				"description": "Working directory (relative to workspace root or absolute)",
+			},
+		}),
+		"required": []string{"command"},
+	}
+}
+
+// Check validates the command and working directory the way Shell.advanced does
+func (t *ProcessStartTool) Check(ctx context.Context, args json.RawMessage) error {
+	params, _, err := parseProcessParams(args)
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(params.Command) == "" {
+		return SemanticErrorf("command is required")
+	}
+	return t.shell.Check(ctx, args)
+}
+
+func (t *ProcessStartTool) PromptCategory() string { return "shell" }
+func (t *ProcessStartTool) PromptOrder() int       { return 12 }
+func (t *ProcessStartTool) PromptSection() string {
+	return `### Process.* - Background Processes
+
+Shell commands stop after their timeout. For a dev server, a watcher or a long test run, start a background process and check on it:
+
+- Process.start({"command": "npm run dev", "until": "ready on"}) - returns a handle such as "p1", with the output printed until "ready on" appears (or 1 second without until)
+- Process.output({"id": "p1", "wait": 30, "until": "PASS|FAIL"}) - output added since the last check, waiting up to 30 seconds
+- Process.write({"id": "p1", "input": "yes\n"}) - send input to the process (include \n to end a line)
+- Process.list({}) - every process with its status
+- Process.kill({"id": "p1"}) - stop the process and its children
+
+Processes keep running between turns and are killed when the session ends. Long output is truncated; the full log is in log_file.`
+}
+
+func (t *ProcessStartTool) Call(ctx context.Context, args json.RawMessage) (any, error) {
+	params, until, err := parseProcessParams(args)
+	if err != nil {
+		return nil, err
+	}
+	workDir := t.shell.workspaceRoot
+	if params.WorkingDir != "" {
+		if workDir, err = t.shell.validateWorkingDir(params.WorkingDir); err != nil {
+			return nil, fmt.Errorf("invalid working_dir: %w", err)
+		}
+	}
+	p, err := t.manager.start(params.Command, workDir)
+	if err != nil {
+		return nil, RuntimeErrorf("%v", err)
+	}
+	output, err := p.wait(ctx, waitDuration(params, until, defaultStartWait), until)
+	if err != nil {
+		return nil, RuntimeErrorf("reading output: %v", err)
+	}
+	result := processResult(p, output)
+	if p.running() {
+		result["hint"] = fmt.Sprintf("Process.output({\"id\": %q}) shows new output", p.id)
+	}
+	return result, nil
+}
+
+// ProcessOutputTool returns what a background process printed since the last check
+type ProcessOutputTool struct {
+	processTool
+}
+
+func NewProcessOutputTool(manager *ProcessManager) *ProcessOutputTool {
+	return &ProcessOutputTool{processTool{manager}}
+}
+
+func (t *ProcessOutputTool) Name() string { return "Process.output" }
+
+func (t *ProcessOutputTool) Description() string {
+	return "Show the output a background process printed since the last check, and whether it is still running."
+}
+
+func (t *ProcessOutputTool) JSONSchema() map[string]any {
+	return map[string]any{
+		"type":       "object",
+		"properties": waitSchema(map[string]any{"id": idSchema()}),
+		"required":   []string{"id"},
+	}
+}
+
+func (t *ProcessOutputTool) Check(ctx context.Context, args json.RawMessage) error {
+	params, _, err := parseProcessParams(args)
+	if err != nil {
+		return err
+	}
+	_, err = t.process(params)
+	return err
+}
+
+func (t *ProcessOutputTool) PromptCategory() string { return "shell" }
+func (t *ProcessOutputTool) PromptOrder() int       { return 13 }
+func (t *ProcessOutputTool) PromptSection() string  { return "" } // Covered by Process.start
+
+func (t *ProcessOutputTool) Call(ctx context.Context, args json.RawMessage) (any, error) {
+	params, until, err := parseProcessParams(args)
+	if err != nil {
+		return nil, err
+	}
+	p, err := t.process(params)
+	if err != nil {
+		return nil, err
+	}
+	output, err := p.wait(ctx, waitDuration(params, until, 0), until)
+	if err != nil {
+		return nil, RuntimeErrorf("reading output: %v", err)
+	}
+	result := processResult(p, output)
+	if len(output) == 0 {
+		result["message"] = "No new output"
+	}
+	return result, nil
+}
+
+// ProcessWriteTool sends input to a background process
+type ProcessWriteTool struct {
+	processTool
+}
+
+func NewProcessWriteTool(manager *ProcessManager) *ProcessWriteTool {
+	return &ProcessWriteTool{processTool{manager}}
+}
+
+func (t *ProcessWriteTool) Name() string { return "Process.write" }
+
+func (t *ProcessWriteTool) Description() string {
+	return "Write to the stdin of a background process."
+}
+
+func (t *ProcessWriteTool) JSONSchema() map[string]any {
+	return map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"id": idSchema(),
+			"input": map[string]any{
+				"type":        "string",
+				"description": "Text to send as is; include \\n to end a line",
+			},
+			"close_stdin": map[string]any{
+				"type":        "boolean",
+				"description": "Close stdin after writing, for commands that read until end of input",
+			},
+		},
+		"required": []string{"id"},
+	}
+}
+
+func (t *ProcessWriteTool) Check(ctx context.Context, args json.RawMessage) error {
+	params, _, err := parseProcessParams(args)
+	if err != nil {
+		return err
+	}
+	if params.Input == "" && !params.CloseStdin {
+		return SemanticErrorf("give input to write, or close_stdin")
+	}
+	_, err = t.process(params)
+	return err
+}
+
+func (t *ProcessWriteTool) PromptCategory() string { return "shell" }
+func (t *ProcessWriteTool) PromptOrder() int       { return 14 }
+func (t *ProcessWriteTool) PromptSection() string  { return "" } // Covered by Process.start
+
+func (t *ProcessWriteTool) Call(ctx context.Context, args json.RawMessage) (any, error) {
+	params, _, err := parseProcessParams(args)
+	if err != nil {
+		return nil, err
+	}
+	p, err := t.process(params)
+	if err != nil {
+		return nil, err
+	}
+	if !p.running() {
+		return nil, RuntimeErrorf("process %s has exited (exit code %d)", p.id, p.exitCode)
+	}
+	if params.Input != "" {
+		if _, err := io.WriteString(p.stdin, params.Input); err != nil {
+			return nil, RuntimeErrorf("writing to %s: %v", p.id, err)
+		}
+	}
+	if params.CloseStdin {
+		p.stdin.Close()
+	}
+	return map[string]any{
+		"success": true,
+		"id":      p.id,
+		"written": len(params.Input),
+		"hint":    fmt.Sprintf("Process.output({\"id\": %q}) shows the response", p.id),
+	}, nil
+}
+
+// ProcessListTool lists the background processes
+type ProcessListTool struct {
+	processTool
+}
+
+func NewProcessListTool(manager *ProcessManager) *ProcessListTool {
+	return &ProcessListTool{processTool{manager}}
+}
+
+func (t *ProcessListTool) Name() string { return "Process.list" }
+
+func (t *ProcessListTool) Description() string {
+	return "List the background processes started with Process.start and their status."
+}
+
+func (t *ProcessListTool) ReadOnly() bool { return true }
+
+func (t *ProcessListTool) JSONSchema() map[string]any {
+	return map[string]any{
+		"type":       "object",
+		"properties": map[string]any{},
+	}
+}
+
+func (t *ProcessListTool) Check(ctx context.Context, args json.RawMessage) error { return nil }
+
+func (t *ProcessListTool) PromptCategory() string { return "shell" }
+func (t *ProcessListTool) PromptOrder() int       { return 15 }
+func (t *ProcessListTool) PromptSection() string  { return "" } // Covered by Process.start
+
+func (t *ProcessListTool) Call(ctx context.Context, args json.RawMessage) (any, error) {
+	procs := t.manager.list()
+	items := make([]map[string]any, len(procs))
+	for i, p := range procs {
+		items[i] = p.state()
+	}
+	return map[string]any{
+		"success":   true,
+		"processes": items,
+		"count":     len(items),
+	}, nil
+}
+
+// ProcessKillTool stops a background process
+type ProcessKillTool struct {
+	processTool
+}
+
+func NewProcessKillTool(manager *ProcessManager) *ProcessKillTool {
+	return &ProcessKillTool{processTool{manager}}
+}
+
+func (t *ProcessKillTool) Name() string { return "Process.kill" }
+
+func (t *ProcessKillTool) Description() string {
+	return "Stop a background process and everything it started, and show its remaining output."
+}
+
+func (t *ProcessKillTool) JSONSchema() map[string]any {
+	return map[string]any{
+		"type":       "object",
+		"properties": map[string]any{"id": idSchema()},
+		"required":   []string{"id"},
+	}
+}
+
+func (t *ProcessKillTool) Check(ctx context.Context, args json.RawMessage) error {
+	params, _, err := parseProcessParams(args)
+	if err != nil {
+		return err
+	}
+	_, err = t.process(params)
+	return err
+}
+
+func (t *ProcessKillTool) PromptCategory() string { return "shell" }
+func (t *ProcessKillTool) PromptOrder() int       { return 16 }
+func (t *ProcessKillTool) PromptSection() string  { return "" } // Covered by Process.start
+
+func (t *ProcessKillTool) Call(ctx context.Context, args json.RawMessage) (any, error) {
+	params, _, err := parseProcessParams(args)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := t.process(params); err != nil {
+		return nil, err
+	}
+	p, ok := t.manager.kill(params.ID)
+	if !ok {
+		return nil, SemanticErrorf("no process %q. Process.list shows the current ones", params.ID)
+	}
+	output, err := p.unread()
+	if err != nil {
+		return nil, RuntimeErrorf("reading output: %v", err)
+	}
+	return processResult(p, output), nil
+}
@@ -0,0 +1,122 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newProcessTools(t *testing.T) (*ProcessManager, *ProcessStartTool, *ProcessOutputTool) {
+	t.Helper()
+	root := t.TempDir()
+	cfg := newTestConfig()
+	cfg.Workspace.Root = root
+	tempFileMgr := NewTempFileManager(root)
+	mgr := NewProcessManager(tempFileMgr, 2)
+	t.Cleanup(func() {
+		mgr.KillAll()
+		tempFileMgr.CleanupAll()
+	})
+	return mgr, NewProcessStartTool(cfg, mgr, tempFileMgr), NewProcessOutputTool(mgr)
+}
+
+func TestProcessConversation(t *testing.T) {
+	mgr, start, output := newProcessTools(t)
+
+	started := callTool(t, start, `{"command": "echo ready; read name; echo hello $name", "until": "ready"}`)
+	if started["id"] != "p1" || started["status"] != "running" || started["output"] != "ready\n" {
+		t.Fatalf("Process.start = %v, want p1 running with \"ready\"", started)
+	}
+
+	callTool(t, NewProcessWriteTool(mgr), `{"id": "p1", "input": "world\n"}`)
+	got := callTool(t, output, `{"id": "p1", "wait": 10}`)
+	if got["output"] != "hello world\n" || got["status"] != "exited" || got["exit_code"] != 0 {
+		t.Errorf("Process.output = %v, want only the new line and exit code 0", got)
+	}
+
+	again := callTool(t, output, `{"id": "p1"}`)
+	if again["output"] != "" || again["message"] != "No new output" {
+		t.Errorf("second Process.output = %v, want no new output", again)
+	}
+
+	listed := callTool(t, NewProcessListTool(mgr), `{}`)
+	if listed["count"] != 1 {
+		t.Errorf("Process.list = %v, want the exited process", listed)
+	}
+}
+
+func TestProcessKillStopsTheGroup(t *testing.T) {
+	mgr, start, _ := newProcessTools(t)
+
+	// The loop runs in a child of the shell, in the same process group
+	callTool(t, start, `{"command": "(while true; do echo tick >> ticks; sleep 0.02; done) & sleep 30", "wait": 0.2}`)
+	ticks := filepath.Join(start.shell.workspaceRoot, "ticks")
+
+	killed := callTool(t, NewProcessKillTool(mgr), `{"id": "p1"}`)
+	if killed["status"] != "killed" {
+		t.Errorf("Process.kill = %v, want status killed", killed)
+	}
+	before, _ := os.ReadFile(ticks)
+	time.Sleep(200 * time.Millisecond)
+	after, _ := os.ReadFile(ticks)
+	if len(before) == 0 || len(after) != len(before) {
+		t.Errorf("child of the killed process still running: %d bytes of ticks, then %d", len(before), len(after))
+	}
+
+	if _, err := NewProcessOutputTool(mgr).Call(context.Background(), json.RawMessage(`{"id": "p1"}`)); err == nil || !IsBacktrackable(err) {
+		t.Errorf("Process.output of a killed process error = %v, want a semantic error", err)
+	}
+}
+
+func TestProcessKillStopsOrphanedChildren(t *testing.T) {
+	mgr, start, output := newProcessTools(t)
+
+	// The shell exits at once, leaving the loop running in its process group
+	callTool(t, start, `{"command": "(while true; do echo tick >> ticks; sleep 0.02; done) &", "wait": 0}`)
+	ticks := filepath.Join(start.shell.workspaceRoot, "ticks")
+	if got := callTool(t, output, `{"id": "p1", "wait": 5}`); got["status"] != "exited" {
+		t.Fatalf("Process.output = %v, want the shell exited", got)
+	}
+	for i := 0; i < 50; i++ {
+		if _, err := os.Stat(ticks); err == nil {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	callTool(t, NewProcessKillTool(mgr), `{"id": "p1"}`)
+	before, _ := os.ReadFile(ticks)
+	time.Sleep(200 * time.Millisecond)
+	after, _ := os.ReadFile(ticks)
+	if len(before) == 0 || len(after) != len(before) {
+		t.Errorf("orphaned child still running: %d bytes of ticks, then %d", len(before), len(after))
+	}
+}
+
+func TestProcessLimitsAndTruncation(t *testing.T) {
+	mgr, start, _ := newProcessTools(t)
+
+	long := callTool(t, start, `{"command": "seq 1 5000", "wait": 10}`)
+	if text := long["output"].(string); !strings.Contains(text, "PROCESS OUTPUT TRUNCATED") || !strings.Contains(text, long["log_file"].(string)) {
+		t.Errorf("long Process.output was not truncated with a pointer to the log:\n%s", text)
+	}
+
+	callTool(t, start, `{"command": "sleep 30"}`)
+	callTool(t, start, `{"command": "sleep 30"}`)
+	if _, err := start.Call(context.Background(), json.RawMessage(`{"command": "sleep 30"}`)); err == nil || !strings.Contains(err.Error(), "already running") {
+		t.Errorf("third running process error = %v, want the limit of 2", err)
+	}
+
+	mgr.KillAll()
+	if procs := mgr.list(); len(procs) != 0 {
+		t.Errorf("list() after KillAll = %d processes", len(procs))
+	}
+
+	if err := start.Check(context.Background(), json.RawMessage(`{"command": "sudo ls"}`)); err == nil {
+		t.Error("Process.start Check allowed a command Shell blocks")
+	}
+}
@@ -33,6 +33,7 @@ var CategoryHeaders = map[string]string{
 	"shell":      "## Shell Tool",
 	"plan":       "## Plan Management Tools",
 	"checkpoint": "## Checkpoints and Undo",
+	"agent":      "## Sub-Agents",
 }
 
 // Registry manages enabled tools
@@ -217,7 +218,7 @@ func (r *Registry) GenerateToolPrompt() string {
 	var sb strings.Builder
 
 	// Generate in deterministic order
-	categories := []string{"filesystem", "shell", "plan", "checkpoint"}
+	categories := []string{"filesystem", "shell", "plan", "checkpoint", "agent"}
 	for _, cat := range categories {
 		docs, ok := sections[cat]
 		if !ok || len(docs) == 0 {
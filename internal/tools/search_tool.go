@@ -79,6 +79,8 @@ func (t *SearchTool) Check(ctx context.Context, args json.RawMessage) error {
 	return nil
 }
 
+func (t *SearchTool) ReadOnly() bool { return true }
+
 func (t *SearchTool) JSONSchema() map[string]any {
 	return map[string]any{
 		"type": "object",
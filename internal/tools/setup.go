@@ -7,6 +7,7 @@ import (
 	"github.com/kvit-s/kvit-coder/internal/checkpoint"
 	"github.com/kvit-s/kvit-coder/internal/config"
 	ctxtools "github.com/kvit-s/kvit-coder/internal/context"
+	"github.com/kvit-s/kvit-coder/internal/lsp"
 )
 
 // DebugLogger is an interface for debug logging to avoid import cycles
@@ -22,6 +23,9 @@ type SetupConfig struct {
 	Logger        DebugLogger // Optional debug logger (can be nil)
 	TempFileMgr   *TempFileManager
 	PlanManager   *PlanManager
+	LSPManager    *lsp.Manager    // Runs the language servers of the LSP.* tools (can be nil)
+	ProcessMgr    *ProcessManager // Keeps the processes of the Process.* tools (can be nil)
+	ShellSession  *ShellSession   // Persistent shell of Shell and Shell.advanced (nil = a new sh per command)
 }
 
 // SetupRegistry creates and configures the tool registry based on config.
@@ -99,16 +103,85 @@ func SetupRegistry(sc SetupConfig) *Registry {
 		debug(fmt.Sprintf("Enabled tool: %s", searchTool.Name()))
 	}
 
+	if cfg.Tools.Glob.Enabled && sc.TempFileMgr != nil {
+		globTool := NewGlobTool(cfg, sc.TempFileMgr)
+		registry.Enable(globTool)
+		debug(fmt.Sprintf("Enabled tool: %s", globTool.Name()))
+	}
+
+	// Code.* tools - Go code navigation
+	if cfg.Tools.Code.Enabled {
+		codeOutlineTool := NewCodeOutlineTool(cfg)
+		registry.Enable(codeOutlineTool)
+		debug(fmt.Sprintf("Enabled tool: %s", codeOutlineTool.Name()))
+
+		codeDefinitionTool := NewCodeDefinitionTool(cfg)
+		registry.Enable(codeDefinitionTool)
+		debug(fmt.Sprintf("Enabled tool: %s", codeDefinitionTool.Name()))
+
+		codeReferencesTool := NewCodeReferencesTool(cfg, sc.TempFileMgr)
+		registry.Enable(codeReferencesTool)
+		debug(fmt.Sprintf("Enabled tool: %s", codeReferencesTool.Name()))
+	}
+
+	// LSP.* tools - language servers configured per file extension
+	if cfg.Tools.LSP.Enabled && sc.LSPManager != nil {
+		lspHoverTool := NewLSPHoverTool(cfg, sc.LSPManager)
+		registry.Enable(lspHoverTool)
+		debug(fmt.Sprintf("Enabled tool: %s", lspHoverTool.Name()))
+
+		lspDefinitionTool := NewLSPDefinitionTool(cfg, sc.LSPManager)
+		registry.Enable(lspDefinitionTool)
+		debug(fmt.Sprintf("Enabled tool: %s", lspDefinitionTool.Name()))
+
+		lspReferencesTool := NewLSPReferencesTool(cfg, sc.LSPManager, sc.TempFileMgr)
+		registry.Enable(lspReferencesTool)
+		debug(fmt.Sprintf("Enabled tool: %s", lspReferencesTool.Name()))
+
+		lspSymbolsTool := NewLSPSymbolsTool(cfg, sc.LSPManager)
+		registry.Enable(lspSymbolsTool)
+		debug(fmt.Sprintf("Enabled tool: %s", lspSymbolsTool.Name()))
+
+		lspDiagnosticsTool := NewLSPDiagnosticsTool(cfg, sc.LSPManager)
+		registry.Enable(lspDiagnosticsTool)
+		debug(fmt.Sprintf("Enabled tool: %s", lspDiagnosticsTool.Name()))
+	}
+
 	if cfg.Tools.Shell.Enabled && sc.TempFileMgr != nil {
-		shellTool := NewShellTool(cfg, 30*time.Second, sc.TempFileMgr)
+		// Shell and Shell.advanced share the persistent shell, if there is one
+		shellAdvancedTool := NewShellAdvancedTool(cfg, 30*time.Second, sc.TempFileMgr)
+		shellAdvancedTool.session = sc.ShellSession
+		shellTool := &ShellTool{advanced: shellAdvancedTool}
 		registry.Enable(shellTool)
 		debug(fmt.Sprintf("Enabled tool: %s", shellTool.Name()))
 
-		shellAdvancedTool := NewShellAdvancedTool(cfg, 30*time.Second, sc.TempFileMgr)
 		registry.Enable(shellAdvancedTool)
 		debug(fmt.Sprintf("Enabled tool: %s", shellAdvancedTool.Name()))
 	}
 
+	// Process.* tools - background commands, checked like shell commands
+	if cfg.Tools.Process.Enabled && sc.ProcessMgr != nil && sc.TempFileMgr != nil {
+		processStartTool := NewProcessStartTool(cfg, sc.ProcessMgr, sc.TempFileMgr)
+		registry.Enable(processStartTool)
+		debug(fmt.Sprintf("Enabled tool: %s", processStartTool.Name()))
+
+		processOutputTool := NewProcessOutputTool(sc.ProcessMgr)
+		registry.Enable(processOutputTool)
+		debug(fmt.Sprintf("Enabled tool: %s", processOutputTool.Name()))
+
+		processWriteTool := NewProcessWriteTool(sc.ProcessMgr)
+		registry.Enable(processWriteTool)
+		debug(fmt.Sprintf("Enabled tool: %s", processWriteTool.Name()))
+
+		processListTool := NewProcessListTool(sc.ProcessMgr)
+		registry.Enable(processListTool)
+		debug(fmt.Sprintf("Enabled tool: %s", processListTool.Name()))
+
+		processKillTool := NewProcessKillTool(sc.ProcessMgr)
+		registry.Enable(processKillTool)
+		debug(fmt.Sprintf("Enabled tool: %s", processKillTool.Name()))
+	}
+
 	// Tasks.* tools - mutually exclusive with Plan.* and Checkpoint.* tools
 	if cfg.Tools.Tasks.Enabled && sc.ContextMgr != nil {
 		tasksStartTool := NewTasksStartTool(sc.ContextMgr)
@@ -3,7 +3,9 @@ package tools
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -54,6 +56,7 @@ type ShellAdvancedTool struct {
 	cfg           *config.Config
 	timeout       time.Duration
 	tempFileMgr   *TempFileManager
+	session       *ShellSession // Long-lived shell of persistent mode (nil = a new sh per command)
 }
 
 func NewShellAdvancedTool(cfg *config.Config, timeout time.Duration, tempFileMgr *TempFileManager) *ShellAdvancedTool {
@@ -65,6 +68,15 @@ func NewShellAdvancedTool(cfg *config.Config, timeout time.Duration, tempFileMgr
 	}
 }
 
+// currentDir returns the directory commands run in by default: the
+// persistent shell's working directory, or the workspace root
+func (t *ShellAdvancedTool) currentDir() string {
+	if t.session != nil {
+		return t.session.dir()
+	}
+	return t.workspaceRoot
+}
+
 func (t *ShellAdvancedTool) Name() string {
 	return "Shell.advanced"
 }
@@ -112,18 +124,27 @@ func (t *ShellTool) PromptSection() string {
 		warningLine = "\n\n" + strings.Join(warnings, ". ") + "."
 	}
 
+	where := fmt.Sprintf("Runs in workspace root (%s).", t.advanced.workspaceRoot)
+	if t.advanced.session != nil {
+		where = fmt.Sprintf("The shell is persistent: cd, export and source carry over to later calls. Starts in workspace root (%s).", t.advanced.workspaceRoot)
+	}
+
 	return fmt.Sprintf(`### Shell - Execute Shell Commands
 
 Shell({"command": "pytest -q"})
 
 Examples: "go build ./...", "npm test", "git status", "ls -la"
 
-Runs in workspace root (%s). For different directory or custom timeout, use Shell.advanced.%s`, t.advanced.workspaceRoot, warningLine)
+%s For different directory or custom timeout, use Shell.advanced.%s`, where, warningLine)
 }
 
 func (t *ShellAdvancedTool) PromptCategory() string { return "shell" }
 func (t *ShellAdvancedTool) PromptOrder() int        { return 11 }
 func (t *ShellAdvancedTool) PromptSection() string {
+	workDir := fmt.Sprintf("Directory to run in (default: %s)", t.workspaceRoot)
+	if t.session != nil {
+		workDir = "Directory to run this command in; the shell's own directory stays as it is (default: the shell's current directory)"
+	}
 	return fmt.Sprintf(`### Shell.advanced - Shell with Options
 
 Use when you need working_dir or timeout. Call with JSON object:
@@ -134,8 +155,8 @@ Examples:
 
 Parameters:
 - command (required): The shell command
-- working_dir (optional): Directory to run in (default: %s)
-- timeout (optional): Seconds, default 30, max 180`, t.workspaceRoot)
+- working_dir (optional): %s
+- timeout (optional): Seconds, default 30, max 180`, workDir)
 }
 
 // Check performs validation - delegates to Shell.advanced
@@ -146,8 +167,8 @@ func (t *ShellTool) Check(ctx context.Context, args json.RawMessage) error {
 	if err := json.Unmarshal(args, &params); err != nil {
 		return fmt.Errorf("invalid arguments: %w", err)
 	}
-	// Use workspace root as effective working directory
-	return t.advanced.validateCommand(params.Command, t.advanced.workspaceRoot)
+	// Use the current directory (workspace root unless the shell is persistent)
+	return t.advanced.validateCommand(params.Command, t.advanced.currentDir())
 }
 
 // Call executes command - delegates to Shell.advanced (ignores working_dir/timeout)
@@ -168,7 +189,7 @@ func (t *ShellAdvancedTool) Check(ctx context.Context, args json.RawMessage) err
 	}
 
 	// Determine effective working directory for path safety checks
-	effectiveWorkDir := t.workspaceRoot
+	effectiveWorkDir := t.currentDir()
 	if params.WorkingDir != "" {
 		resolvedDir, err := t.validateWorkingDir(params.WorkingDir)
 		if err != nil {
@@ -193,7 +214,7 @@ func (t *ShellAdvancedTool) Call(ctx context.Context, args json.RawMessage) (any
 	}
 
 	// Determine working directory
-	workDir := t.workspaceRoot
+	workDir := t.currentDir()
 	if params.WorkingDir != "" {
 		resolvedDir, err := t.validateWorkingDir(params.WorkingDir)
 		if err != nil {
@@ -212,6 +233,13 @@ func (t *ShellAdvancedTool) Call(ctx context.Context, args json.RawMessage) (any
 		}
 	}
 
+	if t.session != nil {
+		// The shell already is in its current directory
+		if params.WorkingDir == "" {
+			workDir = ""
+		}
+		return t.executeInSession(ctx, params.Command, workDir, timeout)
+	}
 	return t.executeCommand(ctx, params.Command, workDir, timeout)
 }
 
@@ -250,12 +278,12 @@ func (t *ShellAdvancedTool) executeCommand(ctx context.Context, command, workDir
 	select {
 	case <-ctx.Done():
 		// Parent context cancelled (e.g., user pressed ESC)
-		t.killProcessGroup(cmd)
+		killProcessGroup(cmd)
 		<-done // Wait for process to exit
 		timedOut = true
 	case <-timer.C:
 		// Timeout - kill the entire process group
-		t.killProcessGroup(cmd)
+		killProcessGroup(cmd)
 		<-done // Wait for process to exit
 		timedOut = true
 	case cmdErr = <-done:
@@ -295,8 +323,68 @@ func (t *ShellAdvancedTool) executeCommand(ctx context.Context, command, workDir
 	}, nil
 }
 
+// executeInSession runs the command in the persistent shell. workDir, when
+// set, applies to this command only.
+func (t *ShellAdvancedTool) executeInSession(ctx context.Context, command, workDir string, timeout time.Duration) (any, error) {
+	outputBuf := NewOutputBuffer(t.tempFileMgr)
+	defer outputBuf.Close()
+
+	exitCode, runErr := t.session.run(ctx, command, workDir, timeout, outputBuf)
+	formattedOutput, err := outputBuf.FormatForLLM()
+	if err != nil {
+		return nil, fmt.Errorf("failed to format output: %w", err)
+	}
+
+	switch {
+	case errors.Is(runErr, errShellWedged):
+		timeoutSecs := int(timeout.Seconds())
+		return map[string]any{
+			"stdout":    formattedOutput,
+			"exit_code": -1,
+			"error":     "timeout",
+			"hint":      fmt.Sprintf("Command timed out after %ds and the shell was reset: cwd and environment are back to the workspace defaults. Use Shell.advanced with timeout=%d", timeoutSecs, timeoutSecs*2),
+		}, nil
+	case errors.Is(runErr, errShellExited):
+		return map[string]any{
+			"stdout":    formattedOutput,
+			"exit_code": -1,
+			"error":     "shell exited",
+			"hint":      "The command ended the shell. The next command starts a new one in the workspace root",
+		}, nil
+	case runErr != nil:
+		return nil, fmt.Errorf("execution failed: %w", runErr)
+	}
+
+	result := map[string]any{
+		"stdout":    formattedOutput,
+		"exit_code": exitCode,
+	}
+
+	// Commands are checked against the directory the shell is in, so it may
+	// only leave the workspace as far as path safety allows. A cd the checks
+	// couldn't follow (cd -, cd "$OLDPWD", a second cd) is caught here.
+	if dir, outside, err := NormalizeAndValidatePath(t.workspaceRoot, t.session.dir()); err == nil && outside {
+		if err := t.cfg.CheckPathSafety("shell.workdir", dir); err != nil {
+			// If even this fails, the shell is reset, which starts over in the root
+			back := "cd -- " + shellQuote(t.workspaceRoot)
+			_, _ = t.session.run(ctx, back, "", 5*time.Second, io.Discard)
+			result["warning"] = fmt.Sprintf("The shell was moved back to the workspace root: %v", err)
+		}
+	}
+
+	cwd := "."
+	if rel, err := filepath.Rel(t.workspaceRoot, t.session.dir()); err == nil && rel != "." {
+		cwd = rel
+		if strings.HasPrefix(rel, "..") {
+			cwd = t.session.dir()
+		}
+	}
+	result["cwd"] = cwd
+	return result, nil
+}
+
 // killProcessGroup kills the entire process group of the command
-func (t *ShellAdvancedTool) killProcessGroup(cmd *exec.Cmd) {
+func killProcessGroup(cmd *exec.Cmd) {
 	if cmd.Process == nil {
 		return
 	}
@@ -320,11 +408,12 @@ func (t *ShellAdvancedTool) validateCommand(cmd string, baseDir string) error {
 	effectiveDir := baseDir
 
 	// Handle 'cd' commands - allow chained (cd /path && cmd), block standalone
+	// unless the shell is persistent
 	if cmdTrimmed == "cd" || strings.HasPrefix(cmdTrimmed, "cd ") {
 		// Check if cd is chained with another command via && or ;
 		hasChain := strings.Contains(cmdTrimmed, "&&") || strings.Contains(cmdTrimmed, ";")
 
-		if !hasChain {
+		if !hasChain && t.session == nil {
 			// Standalone cd has no effect in stateless shell - block with helpful message
 			parts := strings.Fields(cmdTrimmed)
 			if len(parts) >= 2 {
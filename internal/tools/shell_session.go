@@ -0,0 +1,220 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// errShellExited is returned when the shell ends while running a command,
+// e.g. after "exit"
+var errShellExited = errors.New("shell exited")
+
+// errShellWedged is returned when a command outlives its timeout and the
+// shell is reset
+var errShellWedged = errors.New("shell reset")
+
+// ShellSession is the long-lived bash of persistent shell mode. Each command
+// is eval'd in the shell itself, so cd, export and sourced scripts carry over
+// to the next one. After the command the shell prints a sentinel line with
+// the exit status and working directory; everything before it is output.
+//
+// The shell starts with the first command and runs until Close.
+type ShellSession struct {
+	workspaceRoot string
+
+	mu     sync.Mutex // Held while a command runs
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	chunks chan []byte // output of the shell; closed when it exits
+	cwd    string
+
+	shell atomic.Pointer[exec.Cmd] // cmd, for Close to kill without waiting for mu
+}
+
+// NewShellSession creates the persistent shell of Shell and Shell.advanced
+func NewShellSession(workspaceRoot string) *ShellSession {
+	return &ShellSession{workspaceRoot: workspaceRoot, cwd: workspaceRoot}
+}
+
+// dir returns the shell's working directory
+func (s *ShellSession) dir() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.cwd
+}
+
+// start runs a new bash in the workspace root
+func (s *ShellSession) start() error {
+	outR, outW, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	cmd := exec.Command("bash", "--noprofile", "--norc")
+	cmd.Dir = s.workspaceRoot
+	cmd.Stdout = outW
+	cmd.Stderr = outW
+	// A process group of its own, so a reset also stops what the command started
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		outR.Close()
+		outW.Close()
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		outR.Close()
+		outW.Close()
+		return fmt.Errorf("failed to start shell: %w", err)
+	}
+	outW.Close() // the shell has its own copy
+
+	chunks := make(chan []byte, 64)
+	go func() {
+		defer close(chunks)
+		defer outR.Close()
+		buf := make([]byte, 32*1024)
+		for {
+			n, err := outR.Read(buf)
+			if n > 0 {
+				chunks <- bytes.Clone(buf[:n])
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+	go func() { _ = cmd.Wait() }()
+
+	s.cmd, s.stdin, s.chunks, s.cwd = cmd, stdin, chunks, s.workspaceRoot
+	s.shell.Store(cmd)
+	return nil
+}
+
+// reset kills the shell and everything it started. The next command starts
+// a new one in the workspace root.
+func (s *ShellSession) reset() {
+	if s.cmd == nil {
+		return
+	}
+	killProcessGroup(s.cmd)
+	s.stdin.Close()
+	// Wait for the output pipe to close, unless something that left the
+	// process group still holds it
+	giveUp := time.After(2 * time.Second)
+	for open := true; open; {
+		select {
+		case _, open = <-s.chunks:
+		case <-giveUp:
+			open = false
+		}
+	}
+	s.cmd, s.stdin, s.chunks, s.cwd = nil, nil, nil, s.workspaceRoot
+	s.shell.Store(nil)
+}
+
+// Close kills the shell and everything it started. It doesn't wait for a
+// running command, which sees the shell exit and cleans up after it.
+func (s *ShellSession) Close() {
+	if cmd := s.shell.Load(); cmd != nil {
+		killProcessGroup(cmd)
+	}
+	if s.mu.TryLock() {
+		s.reset()
+		s.mu.Unlock()
+	}
+}
+
+// run runs command in the shell and copies its output to out. workDir, when
+// set, applies to this command only. On timeout or cancellation the shell is
+// reset and errShellWedged returned; if the command ends the shell,
+// errShellExited.
+func (s *ShellSession) run(ctx context.Context, command, workDir string, timeout time.Duration, out io.Writer) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cmd == nil {
+		if err := s.start(); err != nil {
+			return -1, err
+		}
+	}
+
+	token := make([]byte, 8)
+	_, _ = rand.Read(token)
+	sentinel := []byte("__KVIT_DONE_" + hex.EncodeToString(token) + "__")
+
+	// stdin comes from /dev/null so the command can't eat the lines after it
+	script := "eval " + shellQuote(command) + " </dev/null"
+	if workDir != "" {
+		script = "(cd -- " + shellQuote(workDir) + " && " + script + ")"
+	}
+	script += fmt.Sprintf("\nprintf '\\n%s %%d %%s\\n' \"$?\" \"$PWD\"\n", sentinel)
+	if _, err := io.WriteString(s.stdin, script); err != nil {
+		s.reset()
+		return -1, errShellExited
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	var pending []byte
+	for {
+		select {
+		case chunk, ok := <-s.chunks:
+			if !ok {
+				_, _ = out.Write(pending)
+				s.reset()
+				return -1, errShellExited
+			}
+			pending = append(pending, chunk...)
+		case <-timer.C:
+			_, _ = out.Write(pending)
+			s.reset()
+			return -1, errShellWedged
+		case <-ctx.Done():
+			_, _ = out.Write(pending)
+			s.reset()
+			return -1, errShellWedged
+		}
+
+		i := bytes.Index(pending, sentinel)
+		if i < 0 {
+			// Pass output on, keeping enough to find a sentinel split across reads
+			if keep := len(sentinel) + 1; len(pending) > keep {
+				_, _ = out.Write(pending[:len(pending)-keep])
+				pending = pending[len(pending)-keep:]
+			}
+			continue
+		}
+		end := bytes.IndexByte(pending[i:], '\n')
+		if end < 0 {
+			continue // the rest of the sentinel line is still coming
+		}
+		// The newline before the sentinel was added by printf
+		_, _ = out.Write(bytes.TrimSuffix(pending[:i], []byte("\n")))
+		status, cwd, _ := strings.Cut(string(pending[i+len(sentinel)+1:i+end]), " ")
+		exitCode, err := strconv.Atoi(status)
+		if err != nil {
+			exitCode = -1
+		}
+		if cwd != "" {
+			s.cwd = cwd
+		}
+		return exitCode, nil
+	}
+}
+
+// shellQuote quotes s for bash
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
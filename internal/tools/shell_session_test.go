@@ -0,0 +1,135 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newPersistentShell(t *testing.T, timeout time.Duration) (*ShellTool, *ShellAdvancedTool) {
+	t.Helper()
+	root, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(root, "sub"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	cfg := newTestConfig()
+	cfg.Workspace.Root = root
+	cfg.Workspace.PathSafetyMode = "block"
+	cfg.Tools.Shell.Persistent = true
+	tempFileMgr := NewTempFileManager(root)
+	advanced := NewShellAdvancedTool(cfg, timeout, tempFileMgr)
+	advanced.session = NewShellSession(root)
+	t.Cleanup(func() {
+		advanced.session.Close()
+		tempFileMgr.CleanupAll()
+	})
+	return &ShellTool{advanced: advanced}, advanced
+}
+
+func TestPersistentShellKeepsState(t *testing.T) {
+	shell, advanced := newPersistentShell(t, 10*time.Second)
+
+	// A standalone cd is what persistent mode is for
+	if got := callTool(t, shell, `{"command": "cd sub"}`); got["exit_code"] != 0 || got["cwd"] != "sub" {
+		t.Fatalf("cd sub = %v, want exit code 0 in sub", got)
+	}
+	callTool(t, shell, `{"command": "export GREETING=hi; x=1"}`)
+	got := callTool(t, shell, `{"command": "printf '%s %s ' $GREETING $x; pwd"}`)
+	if want := "hi 1 " + filepath.Join(advanced.workspaceRoot, "sub") + "\n"; got["stdout"] != want {
+		t.Errorf("stdout = %q, want %q", got["stdout"], want)
+	}
+
+	// working_dir applies to one command only
+	once := callTool(t, advanced, `{"command": "pwd", "working_dir": "."}`)
+	if once["stdout"] != advanced.workspaceRoot+"\n" || once["cwd"] != "sub" {
+		t.Errorf("pwd with working_dir = %v, want the root with the shell still in sub", once)
+	}
+
+	// Output without a final newline, and a failing command
+	if got := callTool(t, shell, `{"command": "printf abc; false"}`); got["stdout"] != "abc" || got["exit_code"] != 1 {
+		t.Errorf("printf abc; false = %v, want abc with exit code 1", got)
+	}
+}
+
+func TestPersistentShellPathSafety(t *testing.T) {
+	shell, _ := newPersistentShell(t, 10*time.Second)
+	ctx := context.Background()
+	callTool(t, shell, `{"command": "cd sub"}`)
+
+	// Relative paths resolve against the shell's directory, not the root
+	if err := shell.Check(ctx, json.RawMessage(`{"command": "ls ../sub"}`)); err != nil {
+		t.Errorf("ls ../sub from sub error = %v, want it allowed", err)
+	}
+	if err := shell.Check(ctx, json.RawMessage(`{"command": "ls ../.."}`)); err == nil {
+		t.Error("ls ../.. from sub was allowed, want it blocked")
+	}
+	if err := shell.Check(ctx, json.RawMessage(`{"command": "cd /etc"}`)); err == nil {
+		t.Error("cd /etc was allowed, want it blocked")
+	}
+
+	// A cd the checks can't see is caught by the directory the shell reports
+	got := callTool(t, shell, `{"command": "export GREETING=hi; d=/; cd \"$d\""}`)
+	if got["cwd"] != "." || !strings.Contains(fmt.Sprint(got["warning"]), "moved back to the workspace root") {
+		t.Errorf("cd to a hidden / = %v, want a warning and the shell back in the root", got)
+	}
+	if got := callTool(t, shell, `{"command": "echo $GREETING"}`); got["stdout"] != "hi\n" {
+		t.Errorf("environment after moving back = %v, want it kept", got)
+	}
+}
+
+func TestPersistentShellResets(t *testing.T) {
+	shell, advanced := newPersistentShell(t, 500*time.Millisecond)
+	callTool(t, shell, `{"command": "cd sub; export GREETING=hi"}`)
+
+	hung := callTool(t, shell, `{"command": "echo waiting; sleep 30"}`)
+	if hung["error"] != "timeout" || hung["stdout"] != "waiting\n" || !strings.Contains(hung["hint"].(string), "reset") {
+		t.Fatalf("sleep 30 = %v, want a timeout that resets the shell", hung)
+	}
+	if got := callTool(t, shell, `{"command": "echo \"[$GREETING]\""}`); got["stdout"] != "[]\n" || got["cwd"] != "." {
+		t.Errorf("after the reset = %v, want a fresh shell in the root", got)
+	}
+
+	callTool(t, shell, `{"command": "cd sub"}`)
+	if got := callTool(t, shell, `{"command": "exit 3"}`); got["error"] != "shell exited" {
+		t.Errorf("exit 3 = %v, want the shell to have exited", got)
+	}
+	if got := callTool(t, shell, `{"command": "pwd"}`); got["stdout"] != advanced.workspaceRoot+"\n" {
+		t.Errorf("pwd after exit = %v, want a new shell in the root", got)
+	}
+}
+
+func TestPersistentShellClose(t *testing.T) {
+	shell, advanced := newPersistentShell(t, 10*time.Second)
+	ticks := filepath.Join(advanced.workspaceRoot, "ticks")
+
+	// Close kills what the shell left running, and doesn't wait for the
+	// command in progress
+	callTool(t, shell, `{"command": "(while true; do echo tick >> ticks; sleep 0.02; done) &"}`)
+	done := make(chan map[string]any)
+	go func() { done <- callTool(t, shell, `{"command": "sleep 30"}`) }()
+	time.Sleep(200 * time.Millisecond)
+	advanced.session.Close()
+
+	select {
+	case got := <-done:
+		if got["error"] != "shell exited" {
+			t.Errorf("sleep 30 after Close = %v, want the shell to have exited", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("command still running 5s after Close")
+	}
+	before, _ := os.ReadFile(ticks)
+	time.Sleep(200 * time.Millisecond)
+	after, _ := os.ReadFile(ticks)
+	if len(before) == 0 || len(after) != len(before) {
+		t.Errorf("background loop still running after Close: %d bytes of ticks, then %d", len(before), len(after))
+	}
+}
@@ -1,6 +1,12 @@
 package tools
 
-import "github.com/kvit-s/kvit-coder/internal/config"
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/kvit-s/kvit-coder/internal/config"
+)
 
 // newTestConfig creates a minimal config for tool tests.
 func newTestConfig() *config.Config {
@@ -10,3 +16,17 @@ func newTestConfig() *config.Config {
 	cfg.Tools.SafetyConfirmations = make(map[string]config.SafetyConfirmation)
 	return cfg
 }
+
+// callTool checks and calls a tool that must succeed and returns its result.
+func callTool(t *testing.T, tool Tool, args string) map[string]any {
+	t.Helper()
+	ctx := context.Background()
+	if err := tool.Check(ctx, json.RawMessage(args)); err != nil {
+		t.Fatalf("%s Check(%s) error = %v", tool.Name(), args, err)
+	}
+	result, err := tool.Call(ctx, json.RawMessage(args))
+	if err != nil {
+		t.Fatalf("%s(%s) error = %v", tool.Name(), args, err)
+	}
+	return result.(map[string]any)
+}
@@ -29,10 +29,28 @@ type Tool interface {
 	PromptSection() string
 
 	// PromptCategory returns the category for grouping in the system prompt.
-	// Valid categories: "filesystem", "shell", "plan", "checkpoint"
+	// Valid categories: "filesystem", "shell", "plan", "checkpoint", "agent"
 	PromptCategory() string
 
 	// PromptOrder returns the sort order within the category (lower numbers first).
 	// This ensures deterministic ordering for prompt caching.
 	PromptOrder() int
 }
+
+// ReadOnlyTool is implemented by tools that never change files or other
+// state, so several calls to them can run at the same time: the agent runs
+// the read-only calls of a turn concurrently, up to agent.parallel_read_tools.
+// Their Check must not prompt the user either.
+type ReadOnlyTool interface {
+	Tool
+
+	// ReadOnly reports whether the tool is free of side effects
+	ReadOnly() bool
+}
+
+// IsReadOnly reports whether t can run concurrently with other read-only calls.
+// Tools that don't implement ReadOnlyTool are treated as mutating.
+func IsReadOnly(t Tool) bool {
+	ro, ok := t.(ReadOnlyTool)
+	return ok && ro.ReadOnly()
+}
@@ -0,0 +1,83 @@
+package trajectory
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const browseHelp = "Enter/n next · p previous · t <n> turn · s <n> step · q quit"
+
+// Browse shows the steps one at a time, reading navigation commands from in
+// until it is closed or the user quits. start is the index of the first step
+// shown.
+func Browse(in io.Reader, out io.Writer, t *Trajectory, start int) error {
+	if len(t.Steps) == 0 {
+		fmt.Fprintln(out, "The session has no steps.")
+		return nil
+	}
+	i := min(max(start, 0), len(t.Steps)-1)
+	scanner := bufio.NewScanner(in)
+	show := true
+	for {
+		if show {
+			fmt.Fprintln(out)
+			Render(out, t, i)
+		}
+		show = true
+		fmt.Fprintf(out, "\n[%d/%d] %s> ", i+1, len(t.Steps), browseHelp)
+		if !scanner.Scan() {
+			fmt.Fprintln(out)
+			return scanner.Err()
+		}
+
+		fields := strings.Fields(scanner.Text())
+		cmd, arg := "n", ""
+		if len(fields) > 0 {
+			cmd = fields[0]
+		}
+		if len(fields) > 1 {
+			arg = fields[1]
+		}
+
+		switch cmd {
+		case "q", "quit":
+			return nil
+		case "n", "next":
+			if i == len(t.Steps)-1 {
+				fmt.Fprintln(out, "Already at the last step.")
+				show = false
+				continue
+			}
+			i++
+		case "p", "prev":
+			if i == 0 {
+				fmt.Fprintln(out, "Already at the first step.")
+				show = false
+				continue
+			}
+			i--
+		case "t", "turn":
+			n, err := strconv.Atoi(arg)
+			if err != nil || t.TurnStart(n) < 0 {
+				fmt.Fprintf(out, "No turn %q: turns go from 1 to %d.\n", arg, max(t.Turns, 1))
+				show = false
+				continue
+			}
+			i = t.TurnStart(n)
+		case "s", "step":
+			n, err := strconv.Atoi(arg)
+			if err != nil || n < 1 || n > len(t.Steps) {
+				fmt.Fprintf(out, "No step %q: steps go from 1 to %d.\n", arg, len(t.Steps))
+				show = false
+				continue
+			}
+			i = n - 1
+		default:
+			fmt.Fprintf(out, "Unknown command %q. %s\n", cmd, browseHelp)
+			show = false
+		}
+	}
+}
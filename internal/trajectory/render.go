@@ -0,0 +1,144 @@
+package trajectory
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/fatih/color"
+)
+
+var (
+	headerColor    = color.New(color.FgYellow, color.Bold)
+	promptColor    = color.New(color.FgWhite, color.Bold)
+	reasoningColor = color.New(color.FgWhite, color.Faint)
+	toolColor      = color.New(color.FgCyan)
+	errorColor     = color.New(color.FgRed)
+	addedColor     = color.New(color.FgGreen)
+	removedColor   = color.New(color.FgRed)
+	hunkColor      = color.New(color.FgCyan, color.Faint)
+)
+
+// Render writes step i in full: the prompts before it, the reasoning and text
+// of the reply, each tool call with its arguments and complete result, and
+// the diff of each edit
+func Render(w io.Writer, t *Trajectory, i int) {
+	s := t.Steps[i]
+	approx := ""
+	if s.Estimated {
+		approx = "~"
+	}
+	cost := ""
+	if s.Cost > 0 {
+		cost = fmt.Sprintf(" · $%.4f", s.Cost)
+	}
+	headerColor.Fprintf(w, "━━ Step %d/%d · turn %d/%d · %s%s prompt + %s%s completion tokens%s\n",
+		s.Number, len(t.Steps), s.Turn, max(t.Turns, 1), approx, formatTokens(s.PromptTokens), approx, formatTokens(s.CompletionTokens), cost)
+
+	for _, p := range s.Prompts {
+		promptColor.Fprintln(w, "\n[user]")
+		fmt.Fprintln(w, p.Content)
+	}
+
+	a := s.Assistant
+	if a.Role == "" {
+		reasoningColor.Fprintln(w, "\n(the session ends before a reply)")
+		return
+	}
+	if a.ReasoningContent != "" {
+		reasoningColor.Fprintln(w, "\n[reasoning]")
+		reasoningColor.Fprintln(w, a.ReasoningContent)
+	}
+	if a.Content != "" {
+		promptColor.Fprintln(w, "\n[assistant]")
+		fmt.Fprintln(w, a.Content)
+	}
+	for _, call := range a.ToolCalls {
+		toolColor.Fprintf(w, "\n[tool call] %s\n", call.Function.Name)
+		fmt.Fprintln(w, indentJSON(call.Function.Arguments))
+		result := s.Result(call)
+		if result == nil {
+			errorColor.Fprintln(w, "(no result)")
+			continue
+		}
+		renderResult(w, result.Content)
+	}
+}
+
+// RenderAll writes every step, one after another
+func RenderAll(w io.Writer, t *Trajectory) {
+	for i := range t.Steps {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		Render(w, t, i)
+	}
+}
+
+// renderResult writes a tool result. An edit's diff is taken out of the JSON
+// and shown as a diff.
+func renderResult(w io.Writer, content string) {
+	toolColor.Fprintln(w, "[result]")
+	var fields map[string]any
+	if json.Unmarshal([]byte(content), &fields) != nil {
+		fmt.Fprintln(w, content)
+		return
+	}
+	diff, _ := fields["diff"].(string)
+	delete(fields, "diff")
+	if _, failed := fields["error"]; failed {
+		errorColor.Fprintln(w, indentValue(fields))
+	} else {
+		fmt.Fprintln(w, indentValue(fields))
+	}
+	if diff != "" {
+		toolColor.Fprintln(w, "[diff]")
+		renderDiff(w, diff)
+	}
+}
+
+func renderDiff(w io.Writer, diff string) {
+	for _, line := range strings.Split(strings.TrimRight(diff, "\n"), "\n") {
+		switch {
+		case strings.HasPrefix(line, "+++"), strings.HasPrefix(line, "---"), strings.HasPrefix(line, "@@"):
+			hunkColor.Fprintln(w, line)
+		case strings.HasPrefix(line, "+"):
+			addedColor.Fprintln(w, line)
+		case strings.HasPrefix(line, "-"):
+			removedColor.Fprintln(w, line)
+		default:
+			fmt.Fprintln(w, line)
+		}
+	}
+}
+
+// indentJSON pretty-prints a JSON string, or returns it as it is
+func indentJSON(s string) string {
+	var buf bytes.Buffer
+	if json.Indent(&buf, []byte(s), "", "  ") != nil {
+		return s
+	}
+	return buf.String()
+}
+
+// indentValue pretty-prints v without escaping HTML characters, which are
+// common in code
+func indentValue(v any) string {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		return fmt.Sprint(v)
+	}
+	return strings.TrimRight(buf.String(), "\n")
+}
+
+func formatTokens(n int) string {
+	if n < 1000 {
+		return fmt.Sprintf("%d", n)
+	}
+	return fmt.Sprintf("%.1fk", float64(n)/1000)
+}
@@ -0,0 +1,111 @@
+// Package trajectory splits a saved session into the steps the agent took,
+// for inspecting a run after the fact with `kvit-coder replay`.
+package trajectory
+
+import (
+	"context"
+
+	"github.com/kvit-s/kvit-coder/internal/llm"
+	"github.com/kvit-s/kvit-coder/internal/tokenizer"
+)
+
+// Step is one assistant message with the tool results it led to
+type Step struct {
+	Number    int           // 1-based position in the session
+	Turn      int           // 1-based user turn the step belongs to
+	Prompts   []llm.Message // User messages sent just before the step
+	Assistant llm.Message   // Empty when the session ends before an answer
+	Results   []llm.Message // Tool results of the step's calls
+
+	// Usage the server reported for the step. Sessions saved before it was
+	// kept get estimates instead: the history the step was requested with,
+	// and its reply.
+	PromptTokens     int
+	CompletionTokens int
+	Cost             float64 // USD, 0 when the provider doesn't report it
+	Estimated        bool
+}
+
+// Result returns the result of the step's call, or nil if there is none
+func (s *Step) Result(call llm.ToolCall) *llm.Message {
+	for i := range s.Results {
+		if s.Results[i].ToolCallID == call.ID {
+			return &s.Results[i]
+		}
+	}
+	return nil
+}
+
+// Trajectory is a session as a list of steps
+type Trajectory struct {
+	System string // System prompt, if the session has one
+	Steps  []Step
+	Turns  int
+}
+
+// Build splits messages into steps. Tokens of steps saved without their
+// usage are estimated with counter.
+func Build(messages []llm.Message, counter *tokenizer.Counter) *Trajectory {
+	ctx := context.Background()
+	t := &Trajectory{}
+	var prompts []llm.Message
+	history := 0 // Estimated tokens of the messages so far
+
+	for _, msg := range messages {
+		tokens, _ := counter.MessageTokens(ctx, msg)
+		switch msg.Role {
+		case llm.RoleSystem:
+			if t.System == "" {
+				t.System = msg.Content
+			}
+		case llm.RoleUser:
+			if len(prompts) == 0 {
+				t.Turns++
+			}
+			prompts = append(prompts, msg)
+		case llm.RoleAssistant:
+			step := Step{
+				Number:           len(t.Steps) + 1,
+				Turn:             max(t.Turns, 1),
+				Prompts:          prompts,
+				Assistant:        msg,
+				PromptTokens:     history,
+				CompletionTokens: tokens,
+				Estimated:        true,
+			}
+			if u := msg.Usage; u != nil {
+				step.PromptTokens, step.CompletionTokens, step.Cost = u.PromptTokens, u.CompletionTokens, u.Cost
+				step.Estimated = false
+			}
+			t.Steps = append(t.Steps, step)
+			prompts = nil
+		case llm.RoleTool:
+			if n := len(t.Steps); n > 0 {
+				t.Steps[n-1].Results = append(t.Steps[n-1].Results, msg)
+			}
+		}
+		history += tokens
+	}
+
+	// A prompt the agent never answered still gets a step, so it can be seen
+	if len(prompts) > 0 {
+		t.Steps = append(t.Steps, Step{
+			Number:       len(t.Steps) + 1,
+			Turn:         t.Turns,
+			Prompts:      prompts,
+			PromptTokens: history,
+			Estimated:    true,
+		})
+	}
+	return t
+}
+
+// TurnStart returns the index of the first step of a 1-based turn, or -1
+func (t *Trajectory) TurnStart(turn int) int {
+	for i, s := range t.Steps {
+		if s.Turn == turn {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,134 @@
+package trajectory
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/fatih/color"
+
+	"github.com/kvit-s/kvit-coder/internal/llm"
+	"github.com/kvit-s/kvit-coder/internal/tokenizer"
+)
+
+func toolCall(id, name, args string) llm.ToolCall {
+	call := llm.ToolCall{ID: id, Type: "function"}
+	call.Function.Name = name
+	call.Function.Arguments = args
+	return call
+}
+
+// session is two turns: an edit and its answer, then a prompt with no reply
+func session() []llm.Message {
+	return []llm.Message{
+		{Role: llm.RoleSystem, Content: "You are a coding agent."},
+		{Role: llm.RoleUser, Content: "rename foo to bar"},
+		{Role: llm.RoleAssistant, ReasoningContent: "edit main.go", ToolCalls: []llm.ToolCall{
+			toolCall("call_1", "Edit", `{"path":"main.go"}`),
+		}},
+		{Role: llm.RoleTool, Name: "Edit", ToolCallID: "call_1",
+			Content: `{"path":"main.go","diff":"@@ -1 +1 @@\n-foo()\n+bar()\n"}`},
+		{Role: llm.RoleAssistant, Content: "Renamed."},
+		{Role: llm.RoleUser, Content: "now run the tests"},
+	}
+}
+
+func build(t *testing.T) *Trajectory {
+	t.Helper()
+	return Build(session(), tokenizer.NewCounter(tokenizer.NewHeuristic("")))
+}
+
+func TestBuild(t *testing.T) {
+	tr := build(t)
+	if tr.System != "You are a coding agent." || tr.Turns != 2 {
+		t.Errorf("system = %q, turns = %d; want the system prompt and 2 turns", tr.System, tr.Turns)
+	}
+	if len(tr.Steps) != 3 {
+		t.Fatalf("steps = %d, want 3", len(tr.Steps))
+	}
+
+	first := tr.Steps[0]
+	if len(first.Prompts) != 1 || first.Turn != 1 || len(first.Results) != 1 {
+		t.Errorf("first step = %+v, want the prompt and one result", first)
+	}
+	if first.Result(first.Assistant.ToolCalls[0]) == nil {
+		t.Error("Result() = nil for the Edit call")
+	}
+	second := tr.Steps[1]
+	if len(second.Prompts) != 0 || second.PromptTokens <= first.PromptTokens || second.CompletionTokens == 0 {
+		t.Errorf("second step = %+v, want no prompts and growing token estimates", second)
+	}
+	last := tr.Steps[2]
+	if last.Turn != 2 || last.Assistant.Role != "" {
+		t.Errorf("last step = %+v, want the unanswered prompt of turn 2", last)
+	}
+	if got := tr.TurnStart(2); got != 2 {
+		t.Errorf("TurnStart(2) = %d, want 2", got)
+	}
+	if got := tr.TurnStart(3); got != -1 {
+		t.Errorf("TurnStart(3) = %d, want -1", got)
+	}
+}
+
+func TestBuildUsesReportedUsage(t *testing.T) {
+	messages := session()
+	messages[4].Usage = &llm.MessageUsage{PromptTokens: 5000, CompletionTokens: 12, Cost: 0.01}
+	tr := Build(messages, tokenizer.NewCounter(tokenizer.NewHeuristic("")))
+
+	// Sessions saved without usage fall back to estimates
+	if first := tr.Steps[0]; !first.Estimated {
+		t.Errorf("first step = %+v, want an estimate", first)
+	}
+	second := tr.Steps[1]
+	if second.Estimated || second.PromptTokens != 5000 || second.CompletionTokens != 12 || second.Cost != 0.01 {
+		t.Errorf("second step = %+v, want the reported usage", second)
+	}
+
+	color.NoColor = true
+	var out bytes.Buffer
+	Render(&out, tr, 1)
+	if header := strings.SplitN(out.String(), "\n", 2)[0]; !strings.Contains(header, " 5.0k prompt + 12 completion tokens · $0.0100") {
+		t.Errorf("header = %q, want the reported usage without ~", header)
+	}
+}
+
+func TestRenderShowsResultAndDiff(t *testing.T) {
+	color.NoColor = true
+	var out bytes.Buffer
+	Render(&out, build(t), 0)
+
+	for _, want := range []string{"Step 1/3 · turn 1/2", "rename foo to bar", "edit main.go", "[tool call] Edit", `"path": "main.go"`, "[diff]", "-foo()", "+bar()"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("Render() output lacks %q:\n%s", want, out.String())
+		}
+	}
+	if strings.Contains(out.String(), `"diff"`) {
+		t.Errorf("Render() output repeats the diff in the JSON:\n%s", out.String())
+	}
+}
+
+func TestBrowse(t *testing.T) {
+	color.NoColor = true
+	var out bytes.Buffer
+	in := strings.NewReader("\nt 2\np\ns 9\ns 1\np\nq\n")
+	if err := Browse(in, &out, build(t), 0); err != nil {
+		t.Fatalf("Browse() error = %v", err)
+	}
+
+	var shown []string
+	for _, line := range strings.Split(out.String(), "\n") {
+		if strings.HasPrefix(line, "━━ Step ") {
+			shown = append(shown, strings.Fields(line)[2])
+		}
+	}
+	// Start, next, turn 2, previous, (no step 9), step 1, (no previous)
+	want := []string{"1/3", "2/3", "3/3", "2/3", "1/3"}
+	if strings.Join(shown, " ") != strings.Join(want, " ") {
+		t.Errorf("steps shown = %v, want %v", shown, want)
+	}
+	for _, msg := range []string{`No step "9"`, "Already at the first step."} {
+		if !strings.Contains(out.String(), msg) {
+			t.Errorf("Browse() output lacks %q", msg)
+		}
+	}
+}
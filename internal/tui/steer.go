@@ -0,0 +1,57 @@
+package tui
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/muesli/cancelreader"
+
+	"github.com/kvit-s/kvit-coder/internal/control"
+)
+
+// steerCommands maps what the user types while the agent works to control
+// requests. Any other line is sent to the agent as a message.
+var steerCommands = map[string]string{
+	":pause":  control.TypePause,
+	":resume": control.TypeResume,
+	":cancel": control.TypeCancelTool,
+	":abort":  control.TypeAbort,
+}
+
+// steer forwards lines typed on stdin to the agent's control socket until
+// the returned stop function is called
+func steer(socketPath string) (stop func()) {
+	reader, err := cancelreader.NewReader(os.Stdin)
+	if err != nil {
+		return func() {}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		scanner := bufio.NewScanner(reader)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" {
+				continue
+			}
+			req := control.Request{Type: control.TypeMessage, Text: line}
+			if t, ok := steerCommands[line]; ok {
+				req = control.Request{Type: t}
+			}
+			if err := control.Send(socketPath, req); err != nil {
+				fmt.Printf("\033[31m[error] %v\033[0m\n", err)
+			} else if req.Type == control.TypeMessage {
+				fmt.Println("\033[38;5;136m[queued for the next step]\033[0m")
+			}
+		}
+	}()
+
+	return func() {
+		reader.Cancel()
+		<-done
+		reader.Close()
+	}
+}
@@ -261,10 +261,17 @@ func (u *UI) showHelp() {
 	fmt.Println()
 	fmt.Println("Enter any other text to send as a prompt to the agent.")
 	fmt.Println()
+	fmt.Println("While the agent works, type a line to add it to the conversation, or:")
+	fmt.Println("  :pause           Pause before the next step")
+	fmt.Println("  :resume          Continue after a pause")
+	fmt.Println("  :cancel          Cancel the running tool call")
+	fmt.Println("  :abort           Stop the agent")
+	fmt.Println()
 }
 
-// runAgent spawns kvit-coder with the given prompt
-func (u *UI) runAgent(prompt string) {
+// agentArgs returns the kvit-coder arguments for a prompt, with steering on
+// socketPath
+func (u *UI) agentArgs(prompt, socketPath string) []string {
 	args := []string{"-p", prompt}
 
 	// Pass config file
@@ -277,18 +284,33 @@ func (u *UI) runAgent(prompt string) {
 		args = append(args, "-s", u.currentSession)
 	}
 
+	// Lines typed while the agent works go to its control socket. The
+	// steering reader holds the terminal, so the agent can't ask there for
+	// approvals; calls that need asking are denied instead.
+	return append(args, "-control", socketPath, "-approval-interactive", "never")
+}
+
+// runAgent spawns kvit-coder with the given prompt
+func (u *UI) runAgent(prompt string) {
+	socketPath := filepath.Join(os.TempDir(), fmt.Sprintf("kvit-coder-ui-%d.sock", os.Getpid()))
+
 	// Create command
-	cmd := exec.Command(u.agentPath, args...)
+	cmd := exec.Command(u.agentPath, u.agentArgs(prompt, socketPath)...)
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 	cmd.Stdin = nil // No stdin for the agent
 
 	// Run and wait for completion
-	if err := cmd.Run(); err != nil {
+	err := cmd.Start()
+	if err == nil {
+		stopSteering := steer(socketPath)
+		err = cmd.Wait()
+		stopSteering()
+	}
+	if err != nil {
 		if exitErr, ok := err.(*exec.ExitError); ok {
-			if exitErr.ExitCode() == 2 {
-				// User interrupt (SIGINT)
-				fmt.Println("[cancelled]")
+			if msg := exitMessage(exitErr.ExitCode()); msg != "" {
+				fmt.Println(msg)
 			}
 		} else {
 			fmt.Printf("\033[31m[error] Agent failed: %v\033[0m\n", err)
@@ -297,3 +319,24 @@ func (u *UI) runAgent(prompt string) {
 
 	fmt.Println()
 }
+
+// exitMessage tells why the agent exited with code, for the codes that don't
+// speak for themselves; errors are already on the agent's stderr
+func exitMessage(code int) string {
+	switch code {
+	case 130: // Ctrl+C
+		return "[cancelled]"
+	case 3:
+		return "[stopped: budget exhausted]"
+	case 4:
+		return "[stopped: max iterations reached]"
+	case 5:
+		return "[stopped: loop detected]"
+	case 6:
+		return "[stopped: repeated identical tool calls]"
+	case 7:
+		return "[stopped: verification still fails]"
+	default:
+		return ""
+	}
+}
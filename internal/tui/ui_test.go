@@ -0,0 +1,32 @@
+package tui
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestAgentArgsKeepApprovalsOffTheSteeredTerminal(t *testing.T) {
+	u := &UI{configPath: "custom.yaml", currentSession: "work"}
+	args := u.agentArgs("fix the build", "/tmp/ui.sock")
+
+	want := []string{"-p", "fix the build", "-config", "custom.yaml", "-s", "work",
+		"-control", "/tmp/ui.sock", "-approval-interactive", "never"}
+	if !slices.Equal(args, want) {
+		t.Errorf("agentArgs() = %q, want %q", args, want)
+	}
+}
+
+func TestExitMessage(t *testing.T) {
+	tests := map[int]string{
+		130: "[cancelled]",
+		4:   "[stopped: max iterations reached]",
+		7:   "[stopped: verification still fails]",
+		1:   "",
+		2:   "",
+	}
+	for code, want := range tests {
+		if got := exitMessage(code); got != want {
+			t.Errorf("exitMessage(%d) = %q, want %q", code, got, want)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package ui
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/kvit-s/kvit-coder/internal/events"
+)
+
+// TerminalSink renders runner events through a Writer
+type TerminalSink struct {
+	w             *Writer
+	workspaceRoot string // base for working directories shown in Shell.advanced calls
+}
+
+// NewTerminalSink creates a sink that renders events with w
+func NewTerminalSink(w *Writer, workspaceRoot string) *TerminalSink {
+	return &TerminalSink{w: w, workspaceRoot: workspaceRoot}
+}
+
+// Handle renders e. Events without a terminal form are ignored.
+func (t *TerminalSink) Handle(e events.Event) {
+	switch e := e.(type) {
+	case events.AssistantText:
+		// Streamed text was already shown live
+		if e.Streamed {
+			return
+		}
+		contextStr := FormatContextStr(e.ContextTokens, e.ContextWindow)
+		if e.Reasoning != "" {
+			t.w.Thinking(contextStr, e.Reasoning)
+		}
+		if e.Content != "" {
+			t.w.Thinking(contextStr, e.Content)
+		}
+	case events.ToolCallStarted:
+		t.toolCall(e)
+	case events.ToolCallFinished:
+		if !strings.HasPrefix(e.Name, "Plan.") {
+			var duration string
+			if e.Duration >= time.Second {
+				duration = fmt.Sprintf("...%.0fs", e.Duration.Seconds())
+			}
+			t.w.ToolResult(GetResultSummary(e.Result), duration)
+		}
+		t.w.VerboseOutput(e.Content)
+	case events.ToolCallFailed:
+		switch e.Stage {
+		case events.StageUnknownTool:
+			t.w.Error(fmt.Sprintf("Unknown tool: %s", e.Name))
+		case events.StageCall:
+			t.w.Error(fmt.Sprintf("Tool error: %s", e.Error))
+		default:
+			t.w.ToolResult(e.Summary, "")
+		}
+	case events.Backtrack:
+		t.w.Info(fmt.Sprintf("↩ Retry [%d/%d]: %s - %s", e.Retry, e.MaxRetries, e.Tool, e.Error))
+	case events.LoopDetected:
+		switch e.Loop {
+		case events.LoopRepeatedError:
+			t.w.Warn(fmt.Sprintf("Loop detected: %s called %d times with same error", e.Tool, e.Count))
+		case events.LoopRepeatedSuccess:
+			t.w.Warn(fmt.Sprintf("Loop detected: %s called %d times with same arguments and result", e.Tool, e.Count))
+		case events.LoopErrorStreak:
+			t.w.Warn(fmt.Sprintf("Error loop detected: %s has failed %d times consecutively", e.Tool, e.Count))
+		case events.LoopAlternating:
+			t.w.Warn(fmt.Sprintf("Alternating loop detected: %s is repeating the same cycle", e.Tool))
+		}
+	case events.Verification:
+		if e.Passed {
+			t.w.Info(fmt.Sprintf("✓ Verification passed (%s)", FormatDuration(e.Duration)))
+		} else {
+			t.w.Warn(fmt.Sprintf("Verification failed with exit code %d (%s)", e.ExitCode, FormatDuration(e.Duration)))
+			t.w.VerboseOutput(e.Output)
+		}
+	case events.UserMessage:
+		t.w.Info(fmt.Sprintf("✉ Message from user: %s", e.Content))
+	case events.FinalAnswer:
+		t.w.Assistant(e.Content)
+	case events.Notice:
+		switch e.Level {
+		case events.LevelError:
+			t.w.Error(e.Message)
+		case events.LevelWarn:
+			t.w.Warn(e.Message)
+		case events.LevelDebug:
+			t.w.Debug(e.Message)
+		default:
+			t.w.Info(e.Message)
+		}
+	case events.Error:
+		t.w.Error(e.Message)
+	}
+}
+
+// toolCall shows a tool call with its arguments formatted per tool
+func (t *TerminalSink) toolCall(e events.ToolCallStarted) {
+	contextStr := FormatContextStr(e.ContextTokens, e.ContextWindow)
+	var args map[string]any
+	_ = json.Unmarshal([]byte(e.Arguments), &args)
+
+	switch {
+	case e.Name == "Shell":
+		cmdStr, _ := args["command"].(string)
+		t.w.ToolCall("Shell", cmdStr, contextStr)
+	case e.Name == "Shell.advanced":
+		cmdStr, _ := args["command"].(string)
+		wdStr, _ := args["working_dir"].(string)
+		argsDisplay := FormatShellDisplay(cmdStr, wdStr, t.workspaceRoot)
+		if timeoutVal, ok := args["timeout"].(float64); ok && timeoutVal > 0 && int(timeoutVal) != 30 {
+			argsDisplay += fmt.Sprintf(", timeout=%ds", int(timeoutVal))
+		}
+		t.w.ToolCall("Shell.advanced", argsDisplay, contextStr)
+	case strings.HasPrefix(e.Name, "Plan."):
+		if t.w.IsVerbose() {
+			t.w.ToolCall(e.Name, FormatToolArgs(args), contextStr)
+		} else {
+			t.w.ToolContext(contextStr)
+		}
+	default:
+		t.w.ToolCall(e.Name, FormatToolArgs(args), contextStr)
+	}
+}
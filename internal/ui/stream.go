@@ -0,0 +1,253 @@
+package ui
+
+import (
+	"encoding/json"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/kvit-s/kvit-coder/internal/events"
+)
+
+// StreamFormatVersion is the version of the --output-format stream-json
+// records. It changes when a record or field is removed or changes meaning;
+// new records and fields can be added without a change, so consumers should
+// ignore what they don't know.
+const StreamFormatVersion = 1
+
+// Record types written by StreamJSONSink
+const (
+	StreamStart      = "start"
+	StreamAssistant  = "assistant"
+	StreamToolCall   = "tool_call"
+	StreamToolResult = "tool_result"
+	StreamToolError  = "tool_error"
+	StreamBacktrack  = "backtrack"
+	StreamLoop       = "loop"
+	StreamUsage      = "usage"
+	StreamVerify     = "verify"
+	StreamUser       = "user"
+	StreamNotice     = "notice"
+	StreamError      = "error"
+	StreamResult     = "result"
+)
+
+// streamHeader starts every record
+type streamHeader struct {
+	V    int    `json:"v"`
+	Type string `json:"type"`
+}
+
+type streamStart struct {
+	streamHeader
+	Session string `json:"session,omitempty"`
+	Model   string `json:"model,omitempty"`
+}
+
+type streamAssistant struct {
+	streamHeader
+	Step      int    `json:"step,omitempty"`
+	Text      string `json:"text,omitempty"`
+	Reasoning string `json:"reasoning,omitempty"`
+	Final     bool   `json:"final"`
+}
+
+type streamToolCall struct {
+	streamHeader
+	ID        string          `json:"id"`
+	Name      string          `json:"name"`
+	Arguments json.RawMessage `json:"arguments"`
+}
+
+type streamToolResult struct {
+	streamHeader
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	Summary    string `json:"summary"`
+	DurationMs int64  `json:"duration_ms"`
+}
+
+type streamToolError struct {
+	streamHeader
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	Stage      string `json:"stage"`
+	Error      string `json:"error"`
+	DurationMs int64  `json:"duration_ms,omitempty"`
+}
+
+type streamBacktrack struct {
+	streamHeader
+	Tool       string `json:"tool"`
+	Error      string `json:"error"`
+	Retry      int    `json:"retry"`
+	MaxRetries int    `json:"max_retries"`
+}
+
+type streamLoop struct {
+	streamHeader
+	Tool  string `json:"tool"`
+	Loop  string `json:"loop"`
+	Count int    `json:"count"`
+}
+
+type streamUsage struct {
+	streamHeader
+	Step             int     `json:"step"`
+	PromptTokens     int     `json:"prompt_tokens"`
+	CompletionTokens int     `json:"completion_tokens"`
+	CacheReadTokens  int     `json:"cache_read_tokens,omitempty"`
+	Cost             float64 `json:"cost_usd,omitempty"`
+	DurationMs       int64   `json:"duration_ms"`
+	FinishReason     string  `json:"finish_reason,omitempty"`
+}
+
+type streamVerify struct {
+	streamHeader
+	Command    string `json:"command"`
+	Round      int    `json:"round"`
+	Passed     bool   `json:"passed"`
+	ExitCode   int    `json:"exit_code"`
+	DurationMs int64  `json:"duration_ms"`
+}
+
+type streamUser struct {
+	streamHeader
+	Text string `json:"text"`
+}
+
+type streamNotice struct {
+	streamHeader
+	Level   string `json:"level"`
+	Topic   string `json:"topic"`
+	Message string `json:"message"`
+}
+
+type streamError struct {
+	streamHeader
+	Message string `json:"message"`
+}
+
+type streamResult struct {
+	streamHeader
+	Content string     `json:"content"`
+	Error   string     `json:"error,omitempty"`
+	Stats   *JSONStats `json:"stats,omitempty"`
+}
+
+// StreamJSONSink writes a headless run as JSON lines for --output-format
+// stream-json: one record per assistant message, tool call, tool outcome,
+// retry, LLM response, verification, steering message and notice, then a final result record. Every
+// record carries the format version in "v" and its kind in "type".
+type StreamJSONSink struct {
+	mu    sync.Mutex
+	w     io.Writer
+	final string // content of the last FinalAnswer
+	err   error
+}
+
+// NewStreamJSONSink creates a sink writing to w
+func NewStreamJSONSink(w io.Writer) *StreamJSONSink {
+	return &StreamJSONSink{w: w}
+}
+
+// Start writes the record that opens the stream
+func (s *StreamJSONSink) Start(session, model string) {
+	s.write(streamStart{header(StreamStart), session, model})
+}
+
+// Handle writes the record for e. Events without a record are ignored.
+func (s *StreamJSONSink) Handle(e events.Event) {
+	switch e := e.(type) {
+	case events.AssistantText:
+		s.write(streamAssistant{header(StreamAssistant), e.Iteration + 1, e.Content, e.Reasoning, false})
+	case events.FinalAnswer:
+		s.mu.Lock()
+		s.final = e.Content
+		s.mu.Unlock()
+		s.write(streamAssistant{streamHeader: header(StreamAssistant), Text: e.Content, Final: true})
+	case events.ToolCallStarted:
+		s.write(streamToolCall{header(StreamToolCall), e.ID, e.Name, rawArguments(e.Arguments)})
+	case events.ToolCallFinished:
+		s.write(streamToolResult{header(StreamToolResult), e.ID, e.Name, GetResultSummary(e.Result), e.Duration.Milliseconds()})
+	case events.ToolCallFailed:
+		s.write(streamToolError{header(StreamToolError), e.ID, e.Name, e.Stage, e.Error, e.Duration.Milliseconds()})
+	case events.Backtrack:
+		s.write(streamBacktrack{header(StreamBacktrack), e.Tool, e.Error, e.Retry, e.MaxRetries})
+	case events.LoopDetected:
+		s.write(streamLoop{header(StreamLoop), e.Tool, e.Loop, e.Count})
+	case events.LLMRequestFinished:
+		s.write(streamUsage{
+			streamHeader:     header(StreamUsage),
+			Step:             e.Iteration + 1,
+			PromptTokens:     e.Usage.PromptTokens,
+			CompletionTokens: e.Usage.CompletionTokens,
+			CacheReadTokens:  e.Usage.CacheReadTokens,
+			Cost:             e.Usage.Cost,
+			DurationMs:       e.Duration.Milliseconds(),
+			FinishReason:     e.FinishReason,
+		})
+	case events.Verification:
+		s.write(streamVerify{header(StreamVerify), e.Command, e.Round, e.Passed, e.ExitCode, e.Duration.Milliseconds()})
+	case events.UserMessage:
+		s.write(streamUser{header(StreamUser), e.Content})
+	case events.Notice:
+		// The result record carries the stats
+		if e.Topic != events.TopicStats {
+			s.write(streamNotice{header(StreamNotice), e.Level, e.Topic, e.Message})
+		}
+	case events.Error:
+		s.write(streamError{header(StreamError), e.Message})
+	}
+}
+
+// Result writes the record that closes the stream, with the final answer and
+// the run's stats. runErr is set when the run failed.
+func (s *StreamJSONSink) Result(stats *JSONStats, runErr error) {
+	s.mu.Lock()
+	record := streamResult{streamHeader: header(StreamResult), Content: s.final, Stats: stats}
+	s.mu.Unlock()
+	if runErr != nil {
+		record.Error = runErr.Error()
+	}
+	s.write(record)
+}
+
+// Err returns the first error that stopped the sink, if any
+func (s *StreamJSONSink) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+func (s *StreamJSONSink) write(record any) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return
+	}
+	line, err := json.Marshal(record)
+	if err != nil {
+		s.err = err
+		return
+	}
+	_, s.err = s.w.Write(append(line, '\n'))
+}
+
+func header(recordType string) streamHeader {
+	return streamHeader{V: StreamFormatVersion, Type: recordType}
+}
+
+// rawArguments keeps valid JSON arguments as an object and wraps anything
+// else the model produced in a string
+func rawArguments(args string) json.RawMessage {
+	args = strings.TrimSpace(args)
+	if args == "" {
+		return json.RawMessage("{}")
+	}
+	if json.Valid([]byte(args)) {
+		return json.RawMessage(args)
+	}
+	quoted, _ := json.Marshal(args)
+	return quoted
+}
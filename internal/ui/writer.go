@@ -8,6 +8,7 @@ import (
 	"strings"
 
 	"github.com/fatih/color"
+	"github.com/kvit-s/kvit-coder/internal/stats"
 	"github.com/kvit-s/kvit-coder/internal/tools"
 )
 
@@ -46,10 +47,18 @@ type JSONStats struct {
 	CompletionTokens int     `json:"completion_tokens"`
 	TotalTokens      int     `json:"total_tokens"`
 	CacheReadTokens  int     `json:"cache_read_tokens,omitempty"`
+	CacheWriteTokens int     `json:"cache_write_tokens,omitempty"`
 	TotalCost        float64 `json:"total_cost_usd,omitempty"`
 	CacheDiscount    float64 `json:"cache_discount_usd,omitempty"`
 	DurationMs       int64   `json:"duration_ms"`
 	Steps            int     `json:"steps"`
+
+	Truncations   int `json:"truncations,omitempty"`   // Responses cut off at the output token limit
+	Continuations int `json:"continuations,omitempty"` // Extra requests made to complete them
+
+	StopReason string `json:"stop_reason,omitempty"` // Why the run ended, e.g. "completed" or "budget"
+
+	Verify *stats.VerifyJSON `json:"verify,omitempty"` // Runs of agent.verify_command
 }
 
 // Writer provides formatted output with consistent prefixes and optional colors.
@@ -60,6 +69,7 @@ type Writer struct {
 	headless     bool     // Route progress to stderr, final answer to stdout
 	stderr       io.Writer // stderr output (defaults to os.Stderr)
 	stdout       io.Writer // stdout output (defaults to os.Stdout)
+	streamKind   string    // kind of the streamed block in progress ("", "reasoning", "content")
 }
 
 // NewWriter creates a new Writer with the specified verbosity level.
@@ -256,6 +266,50 @@ func (w *Writer) Thinking(context, msg string) {
 	}
 }
 
+// StreamReasoning prints a streamed reasoning delta in gray as it arrives.
+func (w *Writer) StreamReasoning(delta string) {
+	w.streamDelta("reasoning", delta)
+}
+
+// StreamContent prints a streamed content delta in gray as it arrives.
+func (w *Writer) StreamContent(delta string) {
+	w.streamDelta("content", delta)
+}
+
+// StreamEnd finishes the streamed block in progress, if any.
+func (w *Writer) StreamEnd() {
+	if w.streamKind == "" {
+		return
+	}
+	w.streamKind = ""
+	if w.headless {
+		fmt.Fprintln(w.stderr)
+	} else {
+		fmt.Println()
+	}
+}
+
+// streamDelta prints a delta, starting a new "* " block when the kind changes.
+func (w *Writer) streamDelta(kind, delta string) {
+	if w.quiet || w.jsonMode || delta == "" {
+		return
+	}
+	output := delta
+	if w.streamKind != kind {
+		if w.streamKind != "" {
+			output = "\n* " + delta
+		} else {
+			output = "* " + delta
+		}
+		w.streamKind = kind
+	}
+	if w.headless {
+		fmt.Fprint(w.stderr, output)
+	} else {
+		grayColor.Print(output)
+	}
+}
+
 // ToolCall prints a compact tool call representation in gray.
 func (w *Writer) ToolCall(name, argsDisplay, context string) {
 	if w.quiet {
@@ -19,6 +19,7 @@ type Lock struct {
 	sigChan     chan os.Signal
 	mu          sync.Mutex
 	cleanupOnce sync.Once
+	atExit      []func()
 }
 
 // AcquireLock attempts to acquire an exclusive lock on a workspace directory.
@@ -57,6 +58,12 @@ func AcquireLock(workspaceRoot string) (*Lock, error) {
 	go func() {
 		sig, ok := <-sigChan
 		if ok && sig != nil {
+			lock.mu.Lock()
+			atExit := lock.atExit
+			lock.mu.Unlock()
+			for _, f := range atExit {
+				f()
+			}
 			lock.cleanup()
 			os.Exit(130) // 128 + SIGINT(2)
 		}
@@ -65,6 +72,14 @@ func AcquireLock(workspaceRoot string) (*Lock, error) {
 	return lock, nil
 }
 
+// AtExit registers f to run when Ctrl+C or SIGTERM ends the process, where
+// deferred cleanup doesn't run.
+func (l *Lock) AtExit(f func()) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.atExit = append(l.atExit, f)
+}
+
 // Release releases the workspace lock and removes the lock file.
 func (l *Lock) Release() {
 	l.mu.Lock()